@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/service"
+	"Gous/pkg/constant"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReloadConfig 重新读取配置文件，热加载允许热更新的配置项，返回生效和需要重启的变更
+func ReloadConfig(c *gin.Context) {
+	rsp := &HttpResponse{}
+	result, err := config.Reload()
+	ev := &audit.Event{Action: constant.AuditConfigReload, Actor: constant.AuditActorAdmin, Err: err}
+	if err != nil {
+		log.Errorf("ReloadConfig|%v", err)
+		audit.Record(c.Request.Context(), ev)
+		rsp.ResponseWithError(c, CodeReloadConfigErr, err.Error())
+		return
+	}
+	// 密钥类配置项在结果中已脱敏
+	ev.Changes = map[string]audit.Change{}
+	for _, ch := range result.Applied {
+		ev.Changes[ch.Key] = audit.Change{From: ch.Old, To: ch.New}
+	}
+	audit.Record(c.Request.Context(), ev)
+	rsp.ResponseWithData(c, result)
+}
+
+// ListAuditLogs 按条件分页查询审计日志
+func ListAuditLogs(c *gin.Context) {
+	req := &service.ListAuditLogsRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	list, err := service.ListAuditLogs(req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeAuditErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, list)
+}
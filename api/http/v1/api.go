@@ -2,6 +2,7 @@ package v1
 
 import (
 	"Gous/config"
+	"Gous/internal/lifecycle"
 	"Gous/internal/service"
 	"Gous/internal/utils"
 	"Gous/pkg/constant"
@@ -22,6 +23,32 @@ func Ping(c *gin.Context) {
 	c.String(http.StatusOK, appInfo)
 }
 
+// Healthz 存活探针，进程能响应即返回成功
+func Healthz(c *gin.Context) {
+	c.String(http.StatusOK, "ok")
+}
+
+// Readyz 就绪探针，服务停机排空期间返回 503，让负载均衡先摘除流量；降级模式下仍返回 200 并附带依赖状态
+func Readyz(c *gin.Context) {
+	if !lifecycle.IsReady() {
+		c.String(http.StatusServiceUnavailable, "not ready")
+		return
+	}
+	status := "ok"
+	if lifecycle.IsDegraded() {
+		status = "degraded"
+	}
+	deps := gin.H{}
+	for name, err := range lifecycle.Dependencies() {
+		if err != nil {
+			deps[name] = err.Error()
+		} else {
+			deps[name] = "ok"
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status, "dependencies": deps})
+}
+
 // Register 注册
 func Register(c *gin.Context) {
 	// 请求
@@ -30,12 +57,12 @@ func Register(c *gin.Context) {
 	rsp := &HttpResponse{}
 	err := c.ShouldBindJSON(&req)
 	if err != nil { // 参数解析错误
-		log.Error("Gous：bind request json err %v", err)
+		log.Errorf("Gous：bind request json err %v", err)
 		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
 	}
 
 	// 开始注册
-	if err := service.Register(req); err != nil {
+	if err := service.Register(c.Request.Context(), req); err != nil {
 		rsp.ResponseWithError(c, CodeRegisterErr, err.Error())
 		return
 	}
@@ -54,23 +81,58 @@ func Login(c *gin.Context) {
 
 	// 获取 uuid
 	uuid := utils.Md5String(req.UserName + time.Now().GoString())
-	ctx := context.WithValue(context.Background(), "uuid", uuid)
-	log.Infof("loggin start, user:%s, password:%s", req.UserName, req.PassWord)
+	ctx := context.WithValue(c.Request.Context(), "uuid", uuid)
+	log.Infof("loggin start, user:%s", req.UserName)
 	session, err := service.Login(ctx, req)
 	if err != nil {
 		rsp.ResponseWithError(c, CodeLoginErr, err.Error())
 		return
 	}
-	// 设置 cookie 值
-	c.SetCookie(constant.SessionKey, session, constant.CookieExpire, "/", "", false, true)
+	loginSuccess(c, rsp, session)
+}
+
+// loginSuccess 登录成功后下发会话 cookie 和 CSRF token
+func loginSuccess(c *gin.Context, rsp *HttpResponse, session string) {
+	csrfToken, err := setSessionCookies(c, session)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeLoginErr, err.Error())
+		return
+	}
+	rsp.Data = gin.H{"csrf_token": csrfToken}
 	rsp.ResponseSuccess(c)
 }
 
+// setSessionCookies 设置会话 cookie，并签发与会话绑定的 CSRF token，跨域前端从响应中读取
+func setSessionCookies(c *gin.Context, session string) (string, error) {
+	// 设置 cookie 值
+	setCookie(c, constant.SessionKey, session, constant.CookieExpire, true)
+
+	csrfToken, err := service.IssueCsrfToken(session)
+	if err != nil {
+		return "", err
+	}
+	setCsrfCookie(c, csrfToken, constant.CookieExpire)
+	return csrfToken, nil
+}
+
+// GetCsrfToken 为当前会话重新签发 CSRF token
+func GetCsrfToken(c *gin.Context) {
+	rsp := &HttpResponse{}
+	session, _ := c.Cookie(constant.SessionKey)
+	csrfToken, err := service.IssueCsrfToken(session)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeCsrfErr, err.Error())
+		return
+	}
+	setCsrfCookie(c, csrfToken, constant.CookieExpire)
+	rsp.ResponseWithData(c, gin.H{"csrf_token": csrfToken})
+}
+
 // Logout 登出
 func Logout(c *gin.Context) {
 	// 从上下文获取 session 会话 ID
 	session, _ := c.Cookie(constant.SessionKey)
-	ctx := context.WithValue(context.Background(), constant.SessionKey, session)
+	ctx := context.WithValue(c.Request.Context(), constant.SessionKey, session)
 	req := &service.LogoutRequest{}
 	rsp := &HttpResponse{}
 	err := c.ShouldBindJSON(req)
@@ -89,7 +151,8 @@ func Logout(c *gin.Context) {
 	}
 
 	// 将会话设置会过期，即浏览器删除该 cookie
-	c.SetCookie(constant.SessionKey, session, -1, "/", "", false, true)
+	setCookie(c, constant.SessionKey, session, -1, true)
+	setCsrfCookie(c, "", -1)
 	rsp.ResponseSuccess(c)
 }
 
@@ -101,14 +164,15 @@ func Logoff(c *gin.Context) {
 	if err != nil {
 		log.Errorf("request json err %v", err)
 		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
 	}
 	// 获取 session 用于后续删除
 	session, _ := c.Cookie(constant.SessionKey)
-	ctx := context.WithValue(context.Background(), constant.SessionKey, session)
+	ctx := context.WithValue(c.Request.Context(), constant.SessionKey, session)
 
 	// 注销
 	if err := service.Logoff(req, ctx); err != nil {
-		log.Println("Logoff|Failed:%v", err)
+		log.Errorf("Logoff|Failed:%v", err)
 		rsp.ResponseWithError(c, CodeLogoffErr, err.Error())
 		return
 	}
@@ -124,17 +188,17 @@ func GetUserInfo(c *gin.Context) {
 	session, _ := c.Cookie(constant.SessionKey)
 	//使用context.WithValue函数创建一个带有session值的上下文，并将其存储在常量SessionKey中，以便在后续处理程序中使用。
 	ctx := context.WithValue(context.Background(), constant.SessionKey, session)
+	// 使用访问令牌认证时带上令牌所属用户
+	ctx = context.WithValue(ctx, constant.AuthUserKey, c.GetString(constant.AuthUserKey))
 	req := &service.GetUserInfoRequest{
 		UserName: userName,
 	}
-	fmt.Println(ctx)
 	//创建一个HttpResponse结构体实例rsp用于返回响应
 	rsp := &HttpResponse{}
 	//生成一个uuid
 	uuid := utils.Md5String(req.UserName + time.Now().GoString())
 	//将其保存在请求上下文ctx
 	ctx = context.WithValue(ctx, "uuid", uuid)
-	fmt.Println(ctx)
 	userInfo, err := service.GetUserInfo(ctx, req)
 	if err != nil {
 		rsp.ResponseWithError(c, CodeGetUserInfoErr, err.Error())
@@ -156,7 +220,8 @@ func UpdateNickName(c *gin.Context) {
 	session, _ := c.Cookie(constant.SessionKey)
 	log.Infof("UpdateNickName|session=%s", session)
 	//使用context.WithValue函数创建一个带有session值的上下文，并将其存储在常量SessionKey中，以便在后续处理程序中使用。
-	ctx := context.WithValue(context.Background(), constant.SessionKey, session)
+	ctx := context.WithValue(c.Request.Context(), constant.SessionKey, session)
+	ctx = context.WithValue(ctx, constant.AuthUserKey, c.GetString(constant.AuthUserKey))
 	uuid := utils.Md5String(req.UserName + time.Now().GoString())
 	ctx = context.WithValue(ctx, "uuid", uuid)
 	if err := service.UpdateUserNickName(ctx, req); err != nil {
@@ -166,6 +231,67 @@ func UpdateNickName(c *gin.Context) {
 	rsp.ResponseSuccess(c)
 }
 
+// VerifyEmail 点击验证链接完成邮箱验证
+func VerifyEmail(c *gin.Context) {
+	rsp := &HttpResponse{}
+	if err := service.VerifyEmail(c.Query("token")); err != nil {
+		rsp.ResponseWithError(c, CodeVerifyEmailErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
+
+// ResendVerification 重新发送验证邮件
+func ResendVerification(c *gin.Context) {
+	req := &service.ResendVerificationRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		log.Errorf("bind resend verification request json err %v", err)
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	if err := service.ResendVerification(c.Request.Context(), req); err != nil {
+		rsp.ResponseWithError(c, CodeVerifyEmailErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
+
+// OtpSend 发送登录验证码
+func OtpSend(c *gin.Context) {
+	req := &service.OtpSendRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		log.Errorf("bind otp send request json err %v", err)
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	if err := service.SendOtp(c.Request.Context(), req); err != nil {
+		rsp.ResponseWithError(c, CodeOtpErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
+
+// OtpVerify 校验验证码并登录
+func OtpVerify(c *gin.Context) {
+	req := &service.OtpVerifyRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		log.Errorf("bind otp verify request json err %v", err)
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	uuid := utils.Md5String(req.Identifier + time.Now().GoString())
+	ctx := context.WithValue(c.Request.Context(), constant.ReqUuid, uuid)
+	session, err := service.VerifyOtp(ctx, req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeOtpErr, err.Error())
+		return
+	}
+	loginSuccess(c, rsp, session)
+}
+
 // UpLoad 更新用户头像
 func UpLoad(c *gin.Context) {
 
@@ -0,0 +1,45 @@
+package v1
+
+import (
+	"Gous/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// setCookie 按 cookie 配置的 Domain、Secure、SameSite 属性写入 cookie
+func setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	conf := config.GetGlobalConf().Cookie
+	c.SetSameSite(sameSiteMode(conf.SameSite))
+	c.SetCookie(name, value, maxAge, "/", conf.Domain, conf.Secure, httpOnly)
+}
+
+func sameSiteMode(s string) http.SameSite {
+	switch strings.ToLower(s) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// setCsrfCookie 下发 CSRF token，cookie 不设置 HttpOnly，同域前端可读取后放入请求头
+func setCsrfCookie(c *gin.Context, token string, maxAge int) {
+	csrfConf := config.GetGlobalConf().Csrf
+	if !csrfConf.Enabled {
+		return
+	}
+	setCookie(c, csrfConf.CookieName, token, maxAge, false)
+}
+
+// oidcStateCookie 第三方登录跳转时下发的 state，回调时与参数比对，防止登录 CSRF
+const oidcStateCookie = "oidc_state"
+
+// setOidcStateCookie 回调来自身份提供方的跨站跳转，SameSite 固定为 Lax 才能带上该 cookie
+func setOidcStateCookie(c *gin.Context, state string, maxAge int) {
+	conf := config.GetGlobalConf().Cookie
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/user/oidc/", conf.Domain, conf.Secure, true)
+}
@@ -15,6 +15,19 @@ const (
 	CodeLogoffErr         ErrCode = 10004 // 注销错误
 	CodeGetUserInfoErr    ErrCode = 10005 // 获取用户信息错误
 	CodeUpdateUserInfoErr ErrCode = 10006 // 更新用户信息错误
+	CodeReloadConfigErr   ErrCode = 10007 // 配置热加载错误
+	CodeCsrfErr           ErrCode = 10008 // CSRF 校验错误
+	CodeVerifyEmailErr    ErrCode = 10009 // 邮箱验证错误
+	CodeOtpErr            ErrCode = 10010 // 验证码登录错误
+	CodeOidcErr           ErrCode = 10011 // 第三方登录错误
+	CodeOAuthClientErr    ErrCode = 10012 // 应用注册错误
+	CodeAccessTokenErr    ErrCode = 10013 // 个人访问令牌错误
+	CodeAuditErr          ErrCode = 10014 // 审计日志查询错误
+	CodeLoginHistoryErr   ErrCode = 10015 // 登录历史查询错误
+	CodeWebhookErr        ErrCode = 10016 // 事件订阅错误
+	CodeDataExportErr     ErrCode = 10017 // 个人数据导出错误
+	CodeErasureErr        ErrCode = 10018 // 个人数据清除错误
+	CodeOutboxErr         ErrCode = 10019 // 领域事件错误
 )
 
 type (
@@ -0,0 +1,65 @@
+package v1
+
+import (
+	"Gous/internal/service"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// EraseUser 删除用户并清除其个人数据
+func EraseUser(c *gin.Context) {
+	rsp := &HttpResponse{}
+	e, err := service.EraseUser(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeErasureErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, e)
+}
+
+// ListErasures 分页查询个人数据清除任务
+func ListErasures(c *gin.Context) {
+	req := &service.ListErasuresRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	list, err := service.ListErasures(req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeErasureErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, list)
+}
+
+// GetErasure 查询清除任务的执行报告
+func GetErasure(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid erasure id")
+		return
+	}
+	e, err := service.GetErasure(id)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeErasureErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, e)
+}
+
+// RetryErasure 重新执行失败的清除任务
+func RetryErasure(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid erasure id")
+		return
+	}
+	if err := service.RetryErasure(c.Request.Context(), id); err != nil {
+		rsp.ResponseWithError(c, CodeErasureErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
@@ -0,0 +1,44 @@
+package v1
+
+import (
+	"Gous/internal/service"
+	"Gous/pkg/constant"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// RequestDataExport 申请导出个人数据
+func RequestDataExport(c *gin.Context) {
+	rsp := &HttpResponse{}
+	session, _ := c.Cookie(constant.SessionKey)
+	e, err := service.RequestDataExport(c.Request.Context(), session)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeDataExportErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, e)
+}
+
+// ListDataExports 查询导出任务及下载链接
+func ListDataExports(c *gin.Context) {
+	rsp := &HttpResponse{}
+	session, _ := c.Cookie(constant.SessionKey)
+	list, err := service.ListDataExports(c.Request.Context(), session)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeDataExportErr, err.Error())
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	rsp.ResponseWithData(c, list)
+}
+
+// DownloadDataExport 通过签名链接下载导出文件
+func DownloadDataExport(c *gin.Context) {
+	path, name, err := service.DownloadDataExport(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(path, name)
+}
@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"Gous/internal/service"
+	"Gous/pkg/constant"
+	"context"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// ListLoginHistory 分页查询当前用户的登录记录
+func ListLoginHistory(c *gin.Context) {
+	rsp := &HttpResponse{}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	session, _ := c.Cookie(constant.SessionKey)
+	// 使用访问令牌认证时带上令牌所属用户
+	ctx := context.WithValue(c.Request.Context(), constant.AuthUserKey, c.GetString(constant.AuthUserKey))
+	list, err := service.ListLoginHistory(ctx, session, page, pageSize)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeLoginHistoryErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, list)
+}
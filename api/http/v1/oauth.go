@@ -0,0 +1,329 @@
+package v1
+
+import (
+	"Gous/config"
+	"Gous/internal/oauth"
+	"Gous/internal/service"
+	"Gous/pkg/constant"
+	"embed"
+	"errors"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//go:embed templates/consent.html
+var templateFS embed.FS
+
+var consentTemplate = template.Must(template.ParseFS(templateFS, "templates/consent.html"))
+
+// scopeDescriptions 授权确认页上展示的 scope 说明，自定义 scope 直接展示名称
+var scopeDescriptions = map[string]string{
+	"openid":  "识别你的账号",
+	"profile": "用户名、昵称、性别",
+	"email":   "邮箱地址",
+	"phone":   "手机号",
+}
+
+// OpenIDConfiguration 授权服务器发现文档
+func OpenIDConfiguration(c *gin.Context) {
+	if !config.GetGlobalConf().OAuth.Enabled {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, service.Discovery())
+}
+
+// OAuthJWKS 校验令牌签名的公钥
+func OAuthJWKS(c *gin.Context) {
+	if !config.GetGlobalConf().OAuth.Enabled {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	jwks, err := oauth.JWKS()
+	if err != nil {
+		log.Errorf("OAuthJWKS|%v", err)
+		oauthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, jwks)
+}
+
+// OAuthAuthorize 授权端点：校验请求，未登录时跳转登录页，需要时展示授权确认页，否则直接签发授权码
+func OAuthAuthorize(c *gin.Context) {
+	req := &service.AuthorizeRequest{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	client, scopes, err := service.ValidateAuthorize(req)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+
+	session, _ := c.Cookie(constant.SessionKey)
+	user, err := service.SessionUser(session)
+	if err != nil {
+		loginUrl := config.GetGlobalConf().OAuth.LoginUrl
+		sep := "?"
+		if strings.Contains(loginUrl, "?") {
+			sep = "&"
+		}
+		c.Redirect(http.StatusFound, loginUrl+sep+"redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+		return
+	}
+
+	need, err := service.NeedConsent(user, client, scopes)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+	if !need {
+		redirect, err := service.ApproveAuthorize(user, client, req, scopes, false)
+		if err != nil {
+			authorizeError(c, req, err)
+			return
+		}
+		c.Redirect(http.StatusFound, redirect)
+		return
+	}
+
+	csrfToken, err := service.CurrentCsrfToken(session)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+	descriptions := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if d, ok := scopeDescriptions[s]; ok {
+			descriptions = append(descriptions, d)
+		} else {
+			descriptions = append(descriptions, s)
+		}
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	// 授权确认页不允许被其他站点嵌入，防止点击劫持
+	c.Header("X-Frame-Options", "DENY")
+	c.Status(http.StatusOK)
+	err = consentTemplate.Execute(c.Writer, map[string]interface{}{
+		"AppName":    config.GetGlobalConf().AppConfig.AppName,
+		"ClientName": client.Name,
+		"UserName":   user.Name,
+		"Scopes":     descriptions,
+		"CsrfToken":  csrfToken,
+		"Req":        req,
+	})
+	if err != nil {
+		log.Errorf("OAuthAuthorize|render consent page err:%v", err)
+	}
+}
+
+// OAuthConsent 授权确认页提交，同意后签发授权码，拒绝时把 access_denied 带回应用
+func OAuthConsent(c *gin.Context) {
+	req := &service.AuthorizeRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	client, scopes, err := service.ValidateAuthorize(req)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+	session, _ := c.Cookie(constant.SessionKey)
+	user, err := service.SessionUser(session)
+	if err != nil {
+		oauthError(c, &service.OAuthError{Code: "access_denied", Description: err.Error()})
+		return
+	}
+	if err := service.CheckCsrfToken(session, c.PostForm("csrf_token")); err != nil {
+		log.Warnf("OAuthConsent|user=%s|%v", user.Name, err)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if c.PostForm("decision") != "allow" {
+		c.Redirect(http.StatusFound, service.AuthorizeErrorURL(req, &service.OAuthError{Code: "access_denied", Description: "user denied the request"}))
+		return
+	}
+	redirect, err := service.ApproveAuthorize(user, client, req, scopes, true)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// OAuthToken 令牌端点
+func OAuthToken(c *gin.Context) {
+	req := &service.TokenRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	clientID, secret, err := clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	req.ClientID, req.ClientSecret = clientID, secret
+	rsp, err := service.Token(req)
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, rsp)
+}
+
+// OAuthUserInfo userinfo 端点，使用 Bearer access token 访问
+func OAuthUserInfo(c *gin.Context) {
+	token := ""
+	if auth := c.GetHeader("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		token = strings.TrimSpace(auth[7:])
+	}
+	if token == "" {
+		oauthError(c, &service.OAuthError{Code: "invalid_token", Description: "bearer token required"})
+		return
+	}
+	claims, err := service.UserInfo(token)
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, claims)
+}
+
+// OAuthIntrospect 令牌内省端点
+func OAuthIntrospect(c *gin.Context) {
+	clientID, secret, err := clientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	result, err := service.Introspect(clientID, secret, c.PostForm("token"))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result)
+}
+
+// OAuthRevoke 令牌撤销端点
+func OAuthRevoke(c *gin.Context) {
+	clientID, secret, err := clientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+	if err := service.Revoke(clientID, secret, c.PostForm("token")); err != nil {
+		oauthError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials 读取客户端身份，支持 HTTP Basic 和表单两种方式，不能同时使用
+func clientCredentials(c *gin.Context, formID, formSecret string) (string, string, error) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return formID, formSecret, nil
+	}
+	if formSecret != "" || formID != "" && formID != id {
+		return "", "", &service.OAuthError{Code: "invalid_request", Description: "multiple client authentication methods"}
+	}
+	// Basic 中的 client_id 和密钥按 application/x-www-form-urlencoded 编码
+	var err error
+	if id, err = url.QueryUnescape(id); err != nil {
+		return "", "", &service.OAuthError{Code: "invalid_client", Description: "malformed client_id"}
+	}
+	if secret, err = url.QueryUnescape(secret); err != nil {
+		return "", "", &service.OAuthError{Code: "invalid_client", Description: "malformed client_secret"}
+	}
+	return id, secret, nil
+}
+
+// authorizeError 授权端点的错误：能重定向时带回应用回调地址，否则直接展示
+func authorizeError(c *gin.Context, req *service.AuthorizeRequest, err error) {
+	var oe *service.OAuthError
+	if errors.As(err, &oe) && oe.Redirect {
+		c.Redirect(http.StatusFound, service.AuthorizeErrorURL(req, oe))
+		return
+	}
+	oauthError(c, err)
+}
+
+// oauthError 按 RFC 6749 的格式返回错误
+func oauthError(c *gin.Context, err error) {
+	var oe *service.OAuthError
+	if !errors.As(err, &oe) {
+		log.Errorf("oauth|%s %s|%v", c.Request.Method, c.Request.URL.Path, err)
+		oe = &service.OAuthError{Code: "server_error"}
+	}
+	status := http.StatusBadRequest
+	switch oe.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		if _, _, ok := c.Request.BasicAuth(); ok {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	case "invalid_token":
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	case "insufficient_scope":
+		status = http.StatusForbidden
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+	case "access_denied":
+		status = http.StatusForbidden
+	case "server_error":
+		status = http.StatusInternalServerError
+	case "temporarily_unavailable":
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(status, oe)
+}
+
+// CreateOAuthClient 注册接入的应用
+func CreateOAuthClient(c *gin.Context) {
+	req := &service.CreateOAuthClientRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	client, err := service.CreateOAuthClient(c.Request.Context(), req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeOAuthClientErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, client)
+}
+
+// ListOAuthClients 查询已注册的应用
+func ListOAuthClients(c *gin.Context) {
+	rsp := &HttpResponse{}
+	clients, err := service.ListOAuthClients()
+	if err != nil {
+		rsp.ResponseWithError(c, CodeOAuthClientErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, clients)
+}
+
+// DeleteOAuthClient 删除应用
+func DeleteOAuthClient(c *gin.Context) {
+	rsp := &HttpResponse{}
+	if err := service.DeleteOAuthClient(c.Request.Context(), c.Param("client_id")); err != nil {
+		rsp.ResponseWithError(c, CodeOAuthClientErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
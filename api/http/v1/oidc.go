@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"Gous/config"
+	"Gous/internal/service"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// OidcLogin 跳转到身份提供方登录
+func OidcLogin(c *gin.Context) {
+	rsp := &HttpResponse{}
+	authUrl, state, err := service.OidcAuthURL(c.Param("provider"), "")
+	if err != nil {
+		log.Errorf("OidcLogin|%v", err)
+		rsp.ResponseWithError(c, CodeOidcErr, err.Error())
+		return
+	}
+	setOidcStateCookie(c, state, config.GetGlobalConf().Oidc.StateTTL)
+	c.Redirect(http.StatusFound, authUrl)
+}
+
+// OidcLink 已登录用户绑定第三方身份，返回授权地址由前端跳转
+func OidcLink(c *gin.Context) {
+	rsp := &HttpResponse{}
+	session, _ := c.Cookie(constant.SessionKey)
+	authUrl, state, err := service.OidcAuthURL(c.Param("provider"), session)
+	if err != nil {
+		log.Errorf("OidcLink|%v", err)
+		rsp.ResponseWithError(c, CodeOidcErr, err.Error())
+		return
+	}
+	setOidcStateCookie(c, state, config.GetGlobalConf().Oidc.StateTTL)
+	rsp.Data = gin.H{"auth_url": authUrl}
+	rsp.ResponseSuccess(c)
+}
+
+// OidcCallback 身份提供方回调，登录成功后下发会话并跳转到成功页面
+func OidcCallback(c *gin.Context) {
+	rsp := &HttpResponse{}
+	if errCode := c.Query("error"); errCode != "" {
+		rsp.ResponseWithError(c, CodeOidcErr, errCode+": "+c.Query("error_description"))
+		return
+	}
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOidcStateCookie(c, "", -1)
+	if state == "" || state != cookieState {
+		rsp.ResponseWithError(c, CodeOidcErr, "oidc state mismatch")
+		return
+	}
+
+	uuid := utils.Md5String(state + time.Now().GoString())
+	ctx := context.WithValue(c.Request.Context(), constant.ReqUuid, uuid)
+	session, err := service.OidcCallback(ctx, c.Param("provider"), state, c.Query("code"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeOidcErr, err.Error())
+		return
+	}
+	// 绑定流程沿用原有会话
+	if session != "" {
+		if _, err := setSessionCookies(c, session); err != nil {
+			rsp.ResponseWithError(c, CodeOidcErr, err.Error())
+			return
+		}
+	}
+	c.Redirect(http.StatusFound, config.GetGlobalConf().Oidc.SuccessUrl)
+}
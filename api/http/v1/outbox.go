@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"Gous/internal/service"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// ListOutboxDeadEvents 分页查询发布次数用尽的领域事件
+func ListOutboxDeadEvents(c *gin.Context) {
+	req := &service.ListOutboxDeadEventsRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	list, err := service.ListOutboxDeadEvents(req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeOutboxErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, list)
+}
+
+// RetryOutboxEvent 死信事件重新发布
+func RetryOutboxEvent(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid event id")
+		return
+	}
+	if err := service.RetryOutboxEvent(c.Request.Context(), id); err != nil {
+		rsp.ResponseWithError(c, CodeOutboxErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
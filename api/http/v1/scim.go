@@ -0,0 +1,245 @@
+package v1
+
+import (
+	"Gous/config"
+	"Gous/internal/scim"
+	"Gous/internal/service"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// scimBase 资源地址前缀，未配置 scim.base_url 时使用请求的 Host
+func scimBase(c *gin.Context) string {
+	if base := strings.TrimRight(config.GetGlobalConf().Scim.BaseUrl, "/"); base != "" {
+		return base + "/scim/v2"
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2"
+}
+
+// scimJSON 以 application/scim+json 返回
+func scimJSON(c *gin.Context, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Data(status, scim.ContentType, body)
+}
+
+// ScimError 按 SCIM 格式返回错误，非 SCIM 错误只记录日志
+func ScimError(c *gin.Context, err error) {
+	scimError(c, err)
+}
+
+func scimError(c *gin.Context, err error) {
+	var se *scim.Error
+	if !errors.As(err, &se) {
+		log.Errorf("scim|%s %s|%v", c.Request.Method, c.Request.URL.Path, err)
+		se = scim.NewError(http.StatusInternalServerError, "", "internal error")
+	}
+	body, _ := json.Marshal(se)
+	c.Abort()
+	c.Data(se.StatusCode(), scim.ContentType, body)
+}
+
+// scimResource 返回单个资源并带上 ETag；GET 请求的 If-None-Match 命中时返回 304
+func scimResource(c *gin.Context, status int, res interface{}, meta *scim.Meta) {
+	c.Header("ETag", meta.Version)
+	if c.Request.Method == http.MethodGet {
+		for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+			if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(meta.Version, "W/") {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	if status == http.StatusCreated {
+		c.Header("Location", meta.Location)
+	}
+	scimJSON(c, status, res)
+}
+
+// scimPageQuery 读取分页参数，格式错误时按默认值处理
+func scimPageQuery(c *gin.Context) (int, int) {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "0"))
+	return startIndex, count
+}
+
+func bindScim(c *gin.Context, out interface{}) bool {
+	if err := c.ShouldBindJSON(out); err != nil {
+		scimError(c, scim.NewError(http.StatusBadRequest, "invalidSyntax", "%v", err))
+		return false
+	}
+	return true
+}
+
+// ScimServiceProviderConfig 服务能力声明
+func ScimServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, service.ScimServiceProviderConfig(scimBase(c)))
+}
+
+// ScimResourceTypes 支持的资源类型
+func ScimResourceTypes(c *gin.Context) {
+	types := service.ScimResourceTypes(scimBase(c))
+	scimJSON(c, http.StatusOK, &scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: int64(len(types)),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// ScimListUsers 查询用户
+func ScimListUsers(c *gin.Context) {
+	startIndex, count := scimPageQuery(c)
+	list, err := service.ScimListUsers(scimBase(c), c.Query("filter"), startIndex, count)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, list)
+}
+
+// ScimGetUser 查询单个用户
+func ScimGetUser(c *gin.Context) {
+	user, err := service.ScimGetUser(scimBase(c), c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusOK, user, user.Meta)
+}
+
+// ScimCreateUser 创建用户
+func ScimCreateUser(c *gin.Context) {
+	in := &scim.User{}
+	if !bindScim(c, in) {
+		return
+	}
+	user, err := service.ScimCreateUser(c.Request.Context(), scimBase(c), in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusCreated, user, user.Meta)
+}
+
+// ScimReplaceUser 替换用户
+func ScimReplaceUser(c *gin.Context) {
+	in := &scim.User{}
+	if !bindScim(c, in) {
+		return
+	}
+	user, err := service.ScimReplaceUser(c.Request.Context(), scimBase(c), c.Param("id"), c.GetHeader("If-Match"), in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusOK, user, user.Meta)
+}
+
+// ScimPatchUser 修改用户，active 设为 false 时停用账号并删除其会话
+func ScimPatchUser(c *gin.Context) {
+	req := &scim.PatchRequest{}
+	if !bindScim(c, req) {
+		return
+	}
+	user, err := service.ScimPatchUser(c.Request.Context(), scimBase(c), c.Param("id"), c.GetHeader("If-Match"), req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusOK, user, user.Meta)
+}
+
+// ScimDeleteUser 删除用户
+func ScimDeleteUser(c *gin.Context) {
+	if err := service.ScimDeleteUser(c.Request.Context(), scimBase(c), c.Param("id"), c.GetHeader("If-Match")); err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ScimListGroups 查询组
+func ScimListGroups(c *gin.Context) {
+	startIndex, count := scimPageQuery(c)
+	list, err := service.ScimListGroups(scimBase(c), c.Query("filter"), startIndex, count)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, list)
+}
+
+// ScimGetGroup 查询单个组
+func ScimGetGroup(c *gin.Context) {
+	group, err := service.ScimGetGroup(scimBase(c), c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusOK, group, group.Meta)
+}
+
+// ScimCreateGroup 创建组
+func ScimCreateGroup(c *gin.Context) {
+	in := &scim.Group{}
+	if !bindScim(c, in) {
+		return
+	}
+	group, err := service.ScimCreateGroup(c.Request.Context(), scimBase(c), in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusCreated, group, group.Meta)
+}
+
+// ScimReplaceGroup 替换组
+func ScimReplaceGroup(c *gin.Context) {
+	in := &scim.Group{}
+	if !bindScim(c, in) {
+		return
+	}
+	group, err := service.ScimReplaceGroup(c.Request.Context(), scimBase(c), c.Param("id"), c.GetHeader("If-Match"), in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusOK, group, group.Meta)
+}
+
+// ScimPatchGroup 修改组，常用于增删成员
+func ScimPatchGroup(c *gin.Context) {
+	req := &scim.PatchRequest{}
+	if !bindScim(c, req) {
+		return
+	}
+	group, err := service.ScimPatchGroup(c.Request.Context(), scimBase(c), c.Param("id"), c.GetHeader("If-Match"), req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimResource(c, http.StatusOK, group, group.Meta)
+}
+
+// ScimDeleteGroup 删除组
+func ScimDeleteGroup(c *gin.Context) {
+	if err := service.ScimDeleteGroup(c.Request.Context(), scimBase(c), c.Param("id"), c.GetHeader("If-Match")); err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,22 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+// cspReportMaxSize 单条 CSP 违规上报的最大长度
+const cspReportMaxSize = 64 << 10
+
+// CspReport 接收浏览器上报的 CSP 违规信息并记录日志
+func CspReport(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, cspReportMaxSize))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	log.Warnf("CspReport|ip=%s|ua=%s|report=%s", c.ClientIP(), c.Request.UserAgent(), body)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package v1
+
+import (
+	"Gous/internal/service"
+	"Gous/pkg/constant"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// CreateAccessToken 创建个人访问令牌
+func CreateAccessToken(c *gin.Context) {
+	req := &service.CreateAccessTokenRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	session, _ := c.Cookie(constant.SessionKey)
+	token, err := service.CreateAccessToken(c.Request.Context(), session, req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeAccessTokenErr, err.Error())
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	rsp.ResponseWithData(c, token)
+}
+
+// ListAccessTokens 查询个人访问令牌
+func ListAccessTokens(c *gin.Context) {
+	rsp := &HttpResponse{}
+	session, _ := c.Cookie(constant.SessionKey)
+	tokens, err := service.ListAccessTokens(session)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeAccessTokenErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, tokens)
+}
+
+// RevokeAccessToken 撤销个人访问令牌
+func RevokeAccessToken(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid token id")
+		return
+	}
+	session, _ := c.Cookie(constant.SessionKey)
+	if err := service.RevokeAccessToken(c.Request.Context(), session, id); err != nil {
+		rsp.ResponseWithError(c, CodeAccessTokenErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
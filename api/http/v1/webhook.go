@@ -0,0 +1,122 @@
+package v1
+
+import (
+	"Gous/internal/service"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// CreateWebhook 创建事件订阅
+func CreateWebhook(c *gin.Context) {
+	req := &service.WebhookRequest{}
+	rsp := &HttpResponse{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	w, err := service.CreateWebhook(c.Request.Context(), req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, w)
+}
+
+// ListWebhooks 查询全部事件订阅
+func ListWebhooks(c *gin.Context) {
+	rsp := &HttpResponse{}
+	list, err := service.ListWebhooks()
+	if err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, list)
+}
+
+// UpdateWebhook 修改事件订阅
+func UpdateWebhook(c *gin.Context) {
+	req := &service.WebhookRequest{}
+	rsp := &HttpResponse{}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid webhook id")
+		return
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	w, err := service.UpdateWebhook(c.Request.Context(), id, req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, w)
+}
+
+// DeleteWebhook 删除事件订阅
+func DeleteWebhook(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid webhook id")
+		return
+	}
+	if err := service.DeleteWebhook(c.Request.Context(), id); err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
+
+// ListWebhookDeliveries 分页查询订阅的投递记录
+func ListWebhookDeliveries(c *gin.Context) {
+	req := &service.ListWebhookDeliveriesRequest{}
+	rsp := &HttpResponse{}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid webhook id")
+		return
+	}
+	if err := c.ShouldBindQuery(req); err != nil {
+		rsp.ResponseWithError(c, CodeBodyBindErr, err.Error())
+		return
+	}
+	list, err := service.ListWebhookDeliveries(id, req)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, list)
+}
+
+// GetWebhookDelivery 查询投递记录及每次尝试的结果
+func GetWebhookDelivery(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid delivery id")
+		return
+	}
+	d, err := service.GetWebhookDelivery(id)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseWithData(c, d)
+}
+
+// RedeliverWebhook 手动重新投递
+func RedeliverWebhook(c *gin.Context) {
+	rsp := &HttpResponse{}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		rsp.ResponseWithError(c, CodeParamErr, "invalid delivery id")
+		return
+	}
+	if err := service.RedeliverWebhook(c.Request.Context(), id); err != nil {
+		rsp.ResponseWithError(c, CodeWebhookErr, err.Error())
+		return
+	}
+	rsp.ResponseSuccess(c)
+}
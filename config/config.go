@@ -1,18 +1,24 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
 	rlog "github.com/lestrrat-go/file-rotatelogs"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"os"
+	"strings"
 	"time"
 
 	"sync"
+	"sync/atomic"
 )
 
 var (
-	config GlobalConfig // 全局配置文件
-	once   sync.Once    // 只执行一次的代码
+	config     atomic.Pointer[GlobalConfig] // 全局配置文件，热加载时整体替换，读到的快照不会被修改
+	once       sync.Once                    // 只执行一次的代码
+	configFile string                       // 指定的配置文件路径，为空时按默认路径查找 app.yml
+	loadErr    error                        // 读取或校验配置时的错误
 )
 
 // LogConf 日志配置
@@ -25,14 +31,16 @@ type LogConf struct {
 
 // DbConf 数据库配置
 type DbConf struct {
-	Host        string `yaml:"host" mapstructure:"host"`                   // 主机地址
-	Port        string `yaml:"port" mapstructure:"port"`                   // 端口号
-	User        string `yaml:"user" mapstructure:"user"`                   // 用户名
-	Password    string `yaml:"password" mapstructure:"password"`           // 密码
-	Dbname      string `yaml:"dbname" mapstructure:"dbname"`               // 数据库名
-	MaxIdleConn int    `yaml:"max_idle_conn" mapstructure:"max_idle_conn"` // 最大空闲连接数
-	MaxOpenConn int    `yaml:"max_open_conn" mapstructure:"max_open_conn"` // 最大打开连接数
-	MaxIdleTime int64  `yaml:"max_idle_time" mapstructure:"max_idle_time"` // 连接最大空闲时间
+	Host         string `yaml:"host" mapstructure:"host"`                       // 主机地址
+	Port         int    `yaml:"port" mapstructure:"port"`                       // 端口号
+	User         string `yaml:"user" mapstructure:"user"`                       // 用户名
+	Password     string `yaml:"password" mapstructure:"password" secret:"true"` // 密码
+	PasswordFile string `yaml:"password_file" mapstructure:"password_file"`     // 密码文件，设置后从文件读取密码
+	Dbname       string `yaml:"dbname" mapstructure:"dbname"`                   // 数据库名
+	MaxIdleConn  int    `yaml:"max_idle_conn" mapstructure:"max_idle_conn"`     // 最大空闲连接数
+	MaxOpenConn  int    `yaml:"max_open_conn" mapstructure:"max_open_conn"`     // 最大打开连接数
+	MaxIdleTime  int64  `yaml:"max_idle_time" mapstructure:"max_idle_time"`     // 连接最大空闲时间
+	AutoMigrate  bool   `yaml:"auto_migrate" mapstructure:"auto_migrate"`       // 启动时自动建表、补齐字段和索引
 }
 
 // AppConf 服务配置
@@ -41,15 +49,28 @@ type AppConf struct {
 	Version string `yaml:"version" mapstructure:"version"`   // 版本
 	Port    int    `yaml:"port" mapstructure:"port"`         // 端口
 	RunMode string `yaml:"run_mode" mapstructure:"run_mode"` // 运行模式
+
+	ReadTimeout       int `yaml:"read_timeout" mapstructure:"read_timeout"`               // 读取请求超时时间（s）
+	ReadHeaderTimeout int `yaml:"read_header_timeout" mapstructure:"read_header_timeout"` // 读取请求头超时时间（s），防止慢速客户端占用连接
+	WriteTimeout      int `yaml:"write_timeout" mapstructure:"write_timeout"`             // 写响应超时时间（s）
+	IdleTimeout       int `yaml:"idle_timeout" mapstructure:"idle_timeout"`               // keep-alive 空闲连接超时时间（s）
+	DrainPeriod       int `yaml:"drain_period" mapstructure:"drain_period"`               // 停机前 /readyz 返回失败的等待时间（s）
+	ShutdownTimeout   int `yaml:"shutdown_timeout" mapstructure:"shutdown_timeout"`       // 等待处理中请求结束的最长时间（s）
+
+	AdminHost string `yaml:"admin_host" mapstructure:"admin_host"` // 管理端口监听地址，默认仅本机可访问
+	AdminPort int    `yaml:"admin_port" mapstructure:"admin_port"` // 管理端口，为 0 时不启用
+
+	TrustedProxies []string `yaml:"trusted_proxies" mapstructure:"trusted_proxies"` // 信任的反向代理 IP 或 CIDR，只有来自这些地址的 X-Forwarded-For 才用于识别客户端 IP
 }
 
 // RedisConf 配置
 type RedisConf struct {
-	Host     string `yaml:"rhost" mapstructure:"rhost"`       // db主机地址
-	Port     int    `yaml:"rport" mapstructure:"rport"`       // db端口
-	DB       int    `yaml:"rdb" mapstructure:"rdb"`           // 数据库
-	PassWord string `yaml:"passwd" mapstructure:"passwd"`     // 密码
-	PoolSile int    `yaml:"poolsize" mapstructure:"poolsize"` // 连接池大小，即最大连接数
+	Host         string `yaml:"rhost" mapstructure:"rhost"`                 // db主机地址
+	Port         int    `yaml:"rport" mapstructure:"rport"`                 // db端口
+	DB           int    `yaml:"rdb" mapstructure:"rdb"`                     // 数据库
+	PassWord     string `yaml:"passwd" mapstructure:"passwd" secret:"true"` // 密码
+	PassWordFile string `yaml:"passwd_file" mapstructure:"passwd_file"`     // 密码文件，设置后从文件读取密码
+	PoolSile     int    `yaml:"poolsize" mapstructure:"poolsize"`           // 连接池大小，即最大连接数
 }
 
 // Cache 配置
@@ -58,47 +79,520 @@ type Cache struct {
 	UserExpired    int `yaml:"user_expired" mapstructure:"user_expired"`       // 用户信息过期时间
 }
 
+// StartupConf 启动时依赖初始化配置
+type StartupConf struct {
+	MaxRetries     int  `yaml:"max_retries" mapstructure:"max_retries"`         // 每个依赖的最大重试次数
+	InitialBackoff int  `yaml:"initial_backoff" mapstructure:"initial_backoff"` // 首次重试等待时间（ms）
+	MaxBackoff     int  `yaml:"max_backoff" mapstructure:"max_backoff"`         // 重试等待时间上限（ms）
+	Timeout        int  `yaml:"timeout" mapstructure:"timeout"`                 // 依赖初始化总超时时间（s）
+	AllowDegraded  bool `yaml:"allow_degraded" mapstructure:"allow_degraded"`   // 依赖不可用时是否以降级模式启动
+}
+
+// SecretConf 密钥配置
+type SecretConf struct {
+	SigningKey     string `yaml:"signing_key" mapstructure:"signing_key" secret:"true"` // 签名密钥，用于签发链接、令牌等
+	SigningKeyFile string `yaml:"signing_key_file" mapstructure:"signing_key_file"`     // 签名密钥文件，设置后从文件读取
+}
+
+// CorsConf 跨域配置，允许的源见 GlobalConfig.CorsOrigin
+type CorsConf struct {
+	AllowMethods     []string        `yaml:"allow_methods" mapstructure:"allow_methods"`         // 允许的请求方法
+	AllowHeaders     []string        `yaml:"allow_headers" mapstructure:"allow_headers"`         // 允许的请求头
+	ExposeHeaders    []string        `yaml:"expose_headers" mapstructure:"expose_headers"`       // 允许前端读取的响应头
+	AllowCredentials bool            `yaml:"allow_credentials" mapstructure:"allow_credentials"` // 是否允许携带 cookie
+	MaxAge           int             `yaml:"max_age" mapstructure:"max_age"`                     // 预检请求缓存时间（s）
+	Groups           []CorsGroupConf `yaml:"groups" mapstructure:"groups"`                       // 按路由分组覆盖的配置
+}
+
+// CorsGroupConf 路由分组跨域配置，未填写的字段沿用 CorsConf 和 CorsOrigin
+type CorsGroupConf struct {
+	PathPrefix       string   `yaml:"path_prefix" mapstructure:"path_prefix"`             // 路由前缀，如 /user
+	Origins          []string `yaml:"origins" mapstructure:"origins"`                     // 允许的源
+	AllowMethods     []string `yaml:"allow_methods" mapstructure:"allow_methods"`         // 允许的请求方法
+	AllowHeaders     []string `yaml:"allow_headers" mapstructure:"allow_headers"`         // 允许的请求头
+	AllowCredentials *bool    `yaml:"allow_credentials" mapstructure:"allow_credentials"` // 是否允许携带 cookie
+	Disabled         bool     `yaml:"disabled" mapstructure:"disabled"`                   // 该分组禁止跨域访问
+}
+
+// CookieConf 会话等 cookie 的属性配置
+type CookieConf struct {
+	Domain   string `yaml:"domain" mapstructure:"domain"`       // cookie 作用域名，为空时为当前域名
+	Secure   bool   `yaml:"secure" mapstructure:"secure"`       // 是否只在 https 下发送
+	SameSite string `yaml:"same_site" mapstructure:"same_site"` // 可选 lax、strict、none
+}
+
+// CsrfConf CSRF 防护配置
+type CsrfConf struct {
+	Enabled        bool     `yaml:"enabled" mapstructure:"enabled"`                 // 是否开启 CSRF 校验
+	CookieName     string   `yaml:"cookie_name" mapstructure:"cookie_name"`         // 下发 token 的 cookie 名，前端读取后放入请求头
+	HeaderName     string   `yaml:"header_name" mapstructure:"header_name"`         // 携带 token 的请求头
+	TrustedOrigins []string `yaml:"trusted_origins" mapstructure:"trusted_origins"` // 除同源和 cors_origin 外额外信任的来源
+}
+
+// TlsConf https 配置
+type TlsConf struct {
+	Enabled        bool     `yaml:"enabled" mapstructure:"enabled"`                 // 是否启用 https
+	CertFile       string   `yaml:"cert_file" mapstructure:"cert_file"`             // 证书文件（含中间证书链）
+	KeyFile        string   `yaml:"key_file" mapstructure:"key_file"`               // 私钥文件
+	MinVersion     string   `yaml:"min_version" mapstructure:"min_version"`         // 最低 TLS 版本，可选 1.2、1.3
+	CipherSuites   []string `yaml:"cipher_suites" mapstructure:"cipher_suites"`     // TLS 1.2 加密套件，为空时使用 Go 默认值
+	Http2          bool     `yaml:"http2" mapstructure:"http2"`                     // 是否启用 HTTP/2
+	RedirectPort   int      `yaml:"redirect_port" mapstructure:"redirect_port"`     // http 跳转 https 的监听端口，为 0 时不启用
+	ReloadInterval int      `yaml:"reload_interval" mapstructure:"reload_interval"` // 检查证书文件变化的间隔（s），为 0 时不自动重新加载
+	AdminClientCA  string   `yaml:"admin_client_ca" mapstructure:"admin_client_ca"` // 管理端口客户端证书 CA，设置后管理端口要求双向认证
+}
+
+// SecurityConf 安全响应头及请求限制配置
+type SecurityConf struct {
+	HstsMaxAge            int    `yaml:"hsts_max_age" mapstructure:"hsts_max_age"`                       // HSTS 有效期（s），为 0 时不下发，仅 https 请求下发
+	HstsIncludeSubdomains bool   `yaml:"hsts_include_subdomains" mapstructure:"hsts_include_subdomains"` // HSTS 是否包含子域名
+	HstsPreload           bool   `yaml:"hsts_preload" mapstructure:"hsts_preload"`                       // HSTS 是否加入 preload
+	ContentSecurityPolicy string `yaml:"content_security_policy" mapstructure:"content_security_policy"` // CSP 策略，为空时不下发
+	CspReportOnly         bool   `yaml:"csp_report_only" mapstructure:"csp_report_only"`                 // 只上报不拦截，违规上报到 /csp-report
+	FrameAncestors        string `yaml:"frame_ancestors" mapstructure:"frame_ancestors"`                 // 允许嵌入页面的来源，如 'none'、'self'
+	ReferrerPolicy        string `yaml:"referrer_policy" mapstructure:"referrer_policy"`                 // Referrer-Policy
+	PermissionsPolicy     string `yaml:"permissions_policy" mapstructure:"permissions_policy"`           // Permissions-Policy
+	MaxBodySize           int64  `yaml:"max_body_size" mapstructure:"max_body_size"`                     // 请求体大小上限（字节），为 0 时不限制
+}
+
+// MailConf 邮件发送配置
+type MailConf struct {
+	Provider         string `yaml:"provider" mapstructure:"provider"`                         // 发送方式，可选 log（仅打印日志）、smtp
+	From             string `yaml:"from" mapstructure:"from"`                                 // 发件人
+	SmtpHost         string `yaml:"smtp_host" mapstructure:"smtp_host"`                       // smtp 主机
+	SmtpPort         int    `yaml:"smtp_port" mapstructure:"smtp_port"`                       // smtp 端口
+	SmtpUser         string `yaml:"smtp_user" mapstructure:"smtp_user"`                       // smtp 用户名
+	SmtpPassword     string `yaml:"smtp_password" mapstructure:"smtp_password" secret:"true"` // smtp 密码
+	SmtpPasswordFile string `yaml:"smtp_password_file" mapstructure:"smtp_password_file"`     // smtp 密码文件
+}
+
+// EmailVerifyConf 注册邮箱验证配置
+type EmailVerifyConf struct {
+	Enabled          bool   `yaml:"enabled" mapstructure:"enabled"`                       // 是否要求新注册用户验证邮箱
+	BaseUrl          string `yaml:"base_url" mapstructure:"base_url"`                     // 验证链接前缀，如 https://user.example.com
+	LinkTTL          int    `yaml:"link_ttl" mapstructure:"link_ttl"`                     // 验证链接有效期（s）
+	ResendCooldown   int    `yaml:"resend_cooldown" mapstructure:"resend_cooldown"`       // 两次发送的最小间隔（s）
+	ResendMaxPerDay  int    `yaml:"resend_max_per_day" mapstructure:"resend_max_per_day"` // 每个用户每天最多发送次数
+	UnverifiedAccess string `yaml:"unverified_access" mapstructure:"unverified_access"`   // 未验证账号的处理方式，block 禁止登录，restricted 允许登录但不能修改资料
+}
+
+// OtpConf 验证码登录配置
+type OtpConf struct {
+	Enabled        bool        `yaml:"enabled" mapstructure:"enabled"`                 // 是否开启验证码登录
+	CodeTTL        int         `yaml:"code_ttl" mapstructure:"code_ttl"`               // 验证码有效期（s）
+	MaxAttempts    int         `yaml:"max_attempts" mapstructure:"max_attempts"`       // 每个验证码最多校验次数
+	ResendCooldown int         `yaml:"resend_cooldown" mapstructure:"resend_cooldown"` // 两次发送的最小间隔（s）
+	EmailProvider  string      `yaml:"email_provider" mapstructure:"email_provider"`   // 邮箱验证码发送方式：mail、http、fake
+	SmsProvider    string      `yaml:"sms_provider" mapstructure:"sms_provider"`       // 短信验证码发送方式：http、fake
+	Http           OtpHttpConf `yaml:"http" mapstructure:"http"`                       // 通用 http 发送配置
+}
+
+// OtpHttpConf 通过 http 接口发送验证码的配置，适配各类短信网关
+type OtpHttpConf struct {
+	Url       string `yaml:"url" mapstructure:"url"`                   // 发送接口地址
+	Token     string `yaml:"token" mapstructure:"token" secret:"true"` // Bearer 令牌
+	TokenFile string `yaml:"token_file" mapstructure:"token_file"`     // 从文件读取令牌
+	Timeout   int    `yaml:"timeout" mapstructure:"timeout"`           // 请求超时（s）
+}
+
+// OidcConf 第三方身份提供方（OpenID Connect）登录配置
+type OidcConf struct {
+	Enabled         bool               `yaml:"enabled" mapstructure:"enabled"`                     // 是否开启第三方登录
+	RedirectBaseUrl string             `yaml:"redirect_base_url" mapstructure:"redirect_base_url"` // 回调地址前缀，回调地址为 <前缀>/user/oidc/<name>/callback
+	SuccessUrl      string             `yaml:"success_url" mapstructure:"success_url"`             // 登录或绑定成功后跳转的页面
+	StateTTL        int                `yaml:"state_ttl" mapstructure:"state_ttl"`                 // 从跳转到回调的最长时间（s）
+	Providers       []OidcProviderConf `yaml:"providers" mapstructure:"providers"`                 // 身份提供方列表
+}
+
+// OidcProviderConf 单个身份提供方配置
+type OidcProviderConf struct {
+	Name             string   `yaml:"name" mapstructure:"name"`                                 // 名称，出现在登录地址中
+	Issuer           string   `yaml:"issuer" mapstructure:"issuer"`                             // issuer 地址，用于服务发现
+	ClientID         string   `yaml:"client_id" mapstructure:"client_id"`                       // 客户端 ID
+	ClientSecret     string   `yaml:"client_secret" mapstructure:"client_secret" secret:"true"` // 客户端密钥，公开客户端可为空
+	ClientSecretFile string   `yaml:"client_secret_file" mapstructure:"client_secret_file"`     // 从文件读取客户端密钥
+	Scopes           []string `yaml:"scopes" mapstructure:"scopes"`                             // 额外申请的 scope，openid 默认带上
+	AutoProvision    bool     `yaml:"auto_provision" mapstructure:"auto_provision"`             // 首次登录时自动创建账号
+}
+
+// OAuthConf 作为 OAuth2 / OIDC 授权服务器的配置，供其他应用接入统一登录
+type OAuthConf struct {
+	Enabled         bool   `yaml:"enabled" mapstructure:"enabled"`                     // 是否开启授权服务器
+	Issuer          string `yaml:"issuer" mapstructure:"issuer"`                       // 对外地址，作为令牌的 iss 和发现文档中端点的前缀
+	SigningKeyFile  string `yaml:"signing_key_file" mapstructure:"signing_key_file"`   // 签名令牌的 RSA 私钥（PEM），为空时启动后生成临时密钥
+	LoginUrl        string `yaml:"login_url" mapstructure:"login_url"`                 // 未登录时跳转的登录页，授权地址通过 redirect 参数带上
+	CodeTTL         int    `yaml:"code_ttl" mapstructure:"code_ttl"`                   // 授权码有效期（s）
+	AccessTokenTTL  int    `yaml:"access_token_ttl" mapstructure:"access_token_ttl"`   // access token 有效期（s）
+	RefreshTokenTTL int    `yaml:"refresh_token_ttl" mapstructure:"refresh_token_ttl"` // refresh token 有效期（s）
+	IDTokenTTL      int    `yaml:"id_token_ttl" mapstructure:"id_token_ttl"`           // ID token 有效期（s）
+}
+
+// AccessTokenConf 个人访问令牌配置，供脚本和集成以 Bearer 方式调用接口
+type AccessTokenConf struct {
+	Enabled    bool `yaml:"enabled" mapstructure:"enabled"`           // 是否允许使用个人访问令牌
+	MaxPerUser int  `yaml:"max_per_user" mapstructure:"max_per_user"` // 每个用户最多持有的令牌数
+	DefaultTTL int  `yaml:"default_ttl" mapstructure:"default_ttl"`   // 未指定有效期时的有效期（天）
+	MaxTTL     int  `yaml:"max_ttl" mapstructure:"max_ttl"`           // 最长有效期（天），0 表示允许永不过期
+}
+
+// ScimConf SCIM 2.0 用户同步配置，供企业身份提供方自动创建、更新、停用账号
+type ScimConf struct {
+	Enabled    bool   `yaml:"enabled" mapstructure:"enabled"`           // 是否开启 /scim/v2 接口
+	Token      string `yaml:"token" mapstructure:"token" secret:"true"` // 身份提供方调用时使用的 Bearer 令牌
+	TokenFile  string `yaml:"token_file" mapstructure:"token_file"`     // 从文件读取令牌
+	MaxResults int    `yaml:"max_results" mapstructure:"max_results"`   // 列表接口每页最多返回的条数
+	BaseUrl    string `yaml:"base_url" mapstructure:"base_url"`         // 对外地址，用于资源的 meta.location
+}
+
+// AuditConf 审计日志配置
+type AuditConf struct {
+	Enabled     bool   `yaml:"enabled" mapstructure:"enabled"`                 // 是否记录审计日志
+	HmacKey     string `yaml:"hmac_key" mapstructure:"hmac_key" secret:"true"` // 哈希链使用的 HMAC 密钥，为空时使用 sha256，有数据库写权限即可重算哈希链
+	HmacKeyFile string `yaml:"hmac_key_file" mapstructure:"hmac_key_file"`     // 从文件读取 HMAC 密钥
+}
+
+// LoginHistoryConf 登录历史配置
+type LoginHistoryConf struct {
+	Enabled         bool   `yaml:"enabled" mapstructure:"enabled"`                     // 是否记录登录历史
+	NotifyNewDevice bool   `yaml:"notify_new_device" mapstructure:"notify_new_device"` // 首次从未见过的设备登录成功时通知用户
+	Notifier        string `yaml:"notifier" mapstructure:"notifier"`                   // 通知方式：mail 发送到已验证邮箱，log 只记录日志
+}
+
+// WebhookConf 用户事件回调配置，订阅通过管理端口接口维护
+type WebhookConf struct {
+	Enabled             bool `yaml:"enabled" mapstructure:"enabled"`                             // 是否生成并投递事件
+	Timeout             int  `yaml:"timeout" mapstructure:"timeout"`                             // 单次投递超时（s）
+	MaxAttempts         int  `yaml:"max_attempts" mapstructure:"max_attempts"`                   // 最多投递次数，仍失败时进入死信状态，可手动重新投递
+	InitialBackoff      int  `yaml:"initial_backoff" mapstructure:"initial_backoff"`             // 首次重试等待时间（s），之后指数增长
+	MaxBackoff          int  `yaml:"max_backoff" mapstructure:"max_backoff"`                     // 重试等待时间上限（s）
+	PollInterval        int  `yaml:"poll_interval" mapstructure:"poll_interval"`                 // 扫描待投递记录的间隔（s）
+	BatchSize           int  `yaml:"batch_size" mapstructure:"batch_size"`                       // 每次扫描最多投递的条数
+	AllowPrivateNetwork bool `yaml:"allow_private_network" mapstructure:"allow_private_network"` // 允许投递到内网和本机地址，关闭时防止回调地址被用来访问内部服务
+}
+
+// OutboxConf 用户领域事件 outbox 配置，事件与用户数据在同一事务中写入，由后台任务发布
+type OutboxConf struct {
+	Enabled        bool     `yaml:"enabled" mapstructure:"enabled"`                 // 是否写入并发布领域事件
+	Publisher      string   `yaml:"publisher" mapstructure:"publisher"`             // 发布方式：redis（Redis Streams）、nats（JetStream）、kafka、stdout
+	Stream         string   `yaml:"stream" mapstructure:"stream"`                   // Redis Stream 名称
+	MaxLen         int64    `yaml:"max_len" mapstructure:"max_len"`                 // Stream 大约保留的条数，0 表示不限制
+	NatsUrl        string   `yaml:"nats_url" mapstructure:"nats_url"`               // NATS 地址，多个用逗号分隔
+	NatsSubject    string   `yaml:"nats_subject" mapstructure:"nats_subject"`       // 主题前缀，事件发布到 <前缀>.<事件类型>，需要有 JetStream stream 覆盖
+	KafkaBrokers   []string `yaml:"kafka_brokers" mapstructure:"kafka_brokers"`     // Kafka broker 地址
+	KafkaTopic     string   `yaml:"kafka_topic" mapstructure:"kafka_topic"`         // Kafka topic，用户 id 作为消息 key
+	PollInterval   int      `yaml:"poll_interval" mapstructure:"poll_interval"`     // 扫描未发布事件的间隔（ms）
+	BatchSize      int      `yaml:"batch_size" mapstructure:"batch_size"`           // 每次扫描最多发布的条数
+	InitialBackoff int      `yaml:"initial_backoff" mapstructure:"initial_backoff"` // 发布失败后首次重试等待时间（s），之后指数增长
+	MaxBackoff     int      `yaml:"max_backoff" mapstructure:"max_backoff"`         // 重试等待时间上限（s）
+	MaxAttempts    int      `yaml:"max_attempts" mapstructure:"max_attempts"`       // 最多发布次数，仍失败时进入死信状态，不再阻塞该用户的后续事件，0 表示不限制
+	Retention      int      `yaml:"retention" mapstructure:"retention"`             // 已发布事件在数据库中保留的天数，0 表示不清理
+}
+
+// DataExportConf 个人数据导出配置
+type DataExportConf struct {
+	Enabled      bool   `yaml:"enabled" mapstructure:"enabled"`             // 是否允许用户导出个人数据
+	Dir          string `yaml:"dir" mapstructure:"dir"`                     // 导出文件目录，多实例部署时需要使用共享存储
+	BaseUrl      string `yaml:"base_url" mapstructure:"base_url"`           // 下载链接前缀，如 https://user.example.com，为空时返回相对地址
+	LinkTTL      int    `yaml:"link_ttl" mapstructure:"link_ttl"`           // 下载链接有效期（s），不超过文件保留时间
+	Retention    int    `yaml:"retention" mapstructure:"retention"`         // 导出文件保留时间（h），过期后删除
+	MinInterval  int    `yaml:"min_interval" mapstructure:"min_interval"`   // 同一用户两次导出的最小间隔（s）
+	PollInterval int    `yaml:"poll_interval" mapstructure:"poll_interval"` // 扫描导出任务的间隔（s）
+}
+
+// ErasureConf 账号注销后清除个人数据的配置，失败的步骤由后台任务重试
+type ErasureConf struct {
+	PollInterval   int `yaml:"poll_interval" mapstructure:"poll_interval"`     // 扫描待重试任务的间隔（s）
+	MaxAttempts    int `yaml:"max_attempts" mapstructure:"max_attempts"`       // 最多执行次数，仍失败时需要管理员处理后手动重试
+	InitialBackoff int `yaml:"initial_backoff" mapstructure:"initial_backoff"` // 首次重试等待时间（s），之后指数增长
+	MaxBackoff     int `yaml:"max_backoff" mapstructure:"max_backoff"`         // 重试等待时间上限（s）
+}
+
+// EncryptionConf 用户个人信息字段级加密配置
+type EncryptionConf struct {
+	Enabled        bool   `yaml:"enabled" mapstructure:"enabled"`                       // 是否加密写入昵称、年龄、邮箱、手机号，关闭后已加密的数据仍可读取
+	MasterKeys     string `yaml:"master_keys" mapstructure:"master_keys" secret:"true"` // 主密钥，格式 id:base64，多个用逗号或换行分隔，第一个用于加密数据密钥
+	MasterKeysFile string `yaml:"master_keys_file" mapstructure:"master_keys_file"`     // 从文件读取主密钥
+}
+
+// MasterKey 加密数据密钥的主密钥
+type MasterKey struct {
+	ID  string
+	Key []byte // 32 字节，AES-256
+}
+
+// ParseMasterKeys 解析主密钥列表，第一个为当前使用的主密钥
+func ParseMasterKeys(s string) ([]MasterKey, error) {
+	var keys []MasterKey
+	seen := map[string]bool{}
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("master key %q should be id:base64", item)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate master key id %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %s should be 32 bytes encoded in base64", id)
+		}
+		seen[id] = true
+		keys = append(keys, MasterKey{ID: id, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no master key configured")
+	}
+	return keys, nil
+}
+
+// LdapConf LDAP 目录认证配置
+type LdapConf struct {
+	Enabled            bool              `yaml:"enabled" mapstructure:"enabled"`                           // 是否使用 LDAP 认证
+	Url                string            `yaml:"url" mapstructure:"url"`                                   // ldap:// 或 ldaps:// 地址
+	StartTLS           bool              `yaml:"start_tls" mapstructure:"start_tls"`                       // ldap:// 连接后升级为 TLS
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify" mapstructure:"insecure_skip_verify"` // 不校验服务端证书，仅用于测试
+	CAFile             string            `yaml:"ca_file" mapstructure:"ca_file"`                           // 校验服务端证书的 CA
+	Timeout            int               `yaml:"timeout" mapstructure:"timeout"`                           // 连接和请求超时（s）
+	Mode               string            `yaml:"mode" mapstructure:"mode"`                                 // bind 按模板拼出 DN 直接绑定，search 先用服务账号查找用户再绑定
+	UserDNTemplate     string            `yaml:"user_dn_template" mapstructure:"user_dn_template"`         // bind 模式的 DN 模板，%s 为用户名
+	BindDN             string            `yaml:"bind_dn" mapstructure:"bind_dn"`                           // search 模式的服务账号
+	BindPassword       string            `yaml:"bind_password" mapstructure:"bind_password" secret:"true"` // 服务账号密码
+	BindPasswordFile   string            `yaml:"bind_password_file" mapstructure:"bind_password_file"`     // 从文件读取服务账号密码
+	BaseDN             string            `yaml:"base_dn" mapstructure:"base_dn"`                           // 查找用户的根节点
+	UserFilter         string            `yaml:"user_filter" mapstructure:"user_filter"`                   // 查找用户的过滤器，%s 为转义后的用户名
+	GroupBaseDN        string            `yaml:"group_base_dn" mapstructure:"group_base_dn"`               // 查找用户所属组的根节点，为空时读取用户的 memberOf 属性
+	GroupFilter        string            `yaml:"group_filter" mapstructure:"group_filter"`                 // 查找组的过滤器，%s 为转义后的用户 DN
+	GroupRoles         []LdapGroupRole   `yaml:"group_roles" mapstructure:"group_roles"`                   // 组到角色的映射，按顺序取第一个匹配
+	DefaultRole        string            `yaml:"default_role" mapstructure:"default_role"`                 // 没有匹配的组时的角色
+	Attributes         LdapAttributeConf `yaml:"attributes" mapstructure:"attributes"`                     // 目录属性到用户字段的映射
+	LocalFallback      bool              `yaml:"local_fallback" mapstructure:"local_fallback"`             // 目录中没有该用户或目录不可用时，允许本地账号登录
+}
+
+// LdapGroupRole 组到角色的映射
+type LdapGroupRole struct {
+	Group string `yaml:"group" mapstructure:"group"` // 组 DN，不区分大小写
+	Role  string `yaml:"role" mapstructure:"role"`
+}
+
+// LdapAttributeConf 目录属性到用户字段的映射，属性为空时不同步该字段
+type LdapAttributeConf struct {
+	Name     string `yaml:"name" mapstructure:"name"`         // 用户名
+	Email    string `yaml:"email" mapstructure:"email"`       // 邮箱
+	NickName string `yaml:"nickname" mapstructure:"nickname"` // 昵称
+	Phone    string `yaml:"phone" mapstructure:"phone"`       // 手机号
+	Groups   string `yaml:"groups" mapstructure:"groups"`     // 用户所属组，未配置 group_base_dn 时使用
+}
+
 // GlobalConfig 业务配置结构体
 type GlobalConfig struct {
-	AppConfig   AppConf   `yaml:"app" mapstructure:"app"`                 // 服务配置
-	CorsOrigin  []string  `yaml:"cors_origin" mapstructure:"cors_origin"` // 跨域源列表
-	DbConfig    DbConf    `yaml:"db" mapstructure:"db"`                   // 数据库配置
-	LogConfig   LogConf   `yaml:"log" mapstructure:"log"`                 // 日志配置
-	RedisConfig RedisConf `yaml:"redis" mapstructure:"redis"`             // redis 配置
-	Cache       Cache     `yaml:"cache" mapstructure:"cache"`             // 缓存配置
+	AppConfig    AppConf          `yaml:"app" mapstructure:"app"`                     // 服务配置
+	CorsOrigin   []string         `yaml:"cors_origin" mapstructure:"cors_origin"`     // 跨域源列表
+	Cors         CorsConf         `yaml:"cors" mapstructure:"cors"`                   // 跨域配置
+	Cookie       CookieConf       `yaml:"cookie" mapstructure:"cookie"`               // cookie 配置
+	Csrf         CsrfConf         `yaml:"csrf" mapstructure:"csrf"`                   // CSRF 配置
+	Tls          TlsConf          `yaml:"tls" mapstructure:"tls"`                     // https 配置
+	Security     SecurityConf     `yaml:"security" mapstructure:"security"`           // 安全配置
+	DbConfig     DbConf           `yaml:"db" mapstructure:"db"`                       // 数据库配置
+	LogConfig    LogConf          `yaml:"log" mapstructure:"log"`                     // 日志配置
+	RedisConfig  RedisConf        `yaml:"redis" mapstructure:"redis"`                 // redis 配置
+	Cache        Cache            `yaml:"cache" mapstructure:"cache"`                 // 缓存配置
+	Startup      StartupConf      `yaml:"startup" mapstructure:"startup"`             // 启动配置
+	Secret       SecretConf       `yaml:"secret" mapstructure:"secret"`               // 密钥配置
+	Mail         MailConf         `yaml:"mail" mapstructure:"mail"`                   // 邮件配置
+	EmailVerify  EmailVerifyConf  `yaml:"email_verify" mapstructure:"email_verify"`   // 邮箱验证配置
+	Otp          OtpConf          `yaml:"otp" mapstructure:"otp"`                     // 验证码登录配置
+	Oidc         OidcConf         `yaml:"oidc" mapstructure:"oidc"`                   // 第三方登录配置
+	OAuth        OAuthConf        `yaml:"oauth" mapstructure:"oauth"`                 // 授权服务器配置
+	Ldap         LdapConf         `yaml:"ldap" mapstructure:"ldap"`                   // LDAP 认证配置
+	AccessToken  AccessTokenConf  `yaml:"access_token" mapstructure:"access_token"`   // 个人访问令牌配置
+	Scim         ScimConf         `yaml:"scim" mapstructure:"scim"`                   // SCIM 用户同步配置
+	Audit        AuditConf        `yaml:"audit" mapstructure:"audit"`                 // 审计日志配置
+	LoginHistory LoginHistoryConf `yaml:"login_history" mapstructure:"login_history"` // 登录历史配置
+	Webhook      WebhookConf      `yaml:"webhook" mapstructure:"webhook"`             // 事件回调配置
+	Outbox       OutboxConf       `yaml:"outbox" mapstructure:"outbox"`               // 领域事件发布配置
+	DataExport   DataExportConf   `yaml:"data_export" mapstructure:"data_export"`     // 个人数据导出配置
+	Erasure      ErasureConf      `yaml:"erasure" mapstructure:"erasure"`             // 个人数据清除配置
+	Encryption   EncryptionConf   `yaml:"encryption" mapstructure:"encryption"`       // 字段级加密配置
 }
 
-// GetGlobalConf 获取全局配置文件
+// GetGlobalConf 获取全局配置文件，返回的配置为只读快照
 func GetGlobalConf() *GlobalConfig {
 	once.Do(readConf)
-	return &config
+	return config.Load()
+}
+
+// LoadConfig 读取并校验配置，返回读取失败或校验发现的全部问题
+func LoadConfig() (*GlobalConfig, error) {
+	once.Do(readConf)
+	return config.Load(), loadErr
+}
+
+// SetConfigFile 指定配置文件路径，需在首次获取配置前调用
+func SetConfigFile(path string) {
+	configFile = path
 }
 
 // 将配置文件中的信息全部加载到 全局配置文件中
+// 优先级：环境变量 > 配置文件 > 默认值，*_file 指定的密钥文件覆盖对应字段
 func readConf() {
-	viper.SetConfigName("app")
-	viper.SetConfigType("yml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./conf")
-	viper.AddConfigPath("../conf")
+	if configFile == "" {
+		configFile = os.Getenv(envPrefix + "_CONFIG")
+	}
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName("app")
+		viper.SetConfigType("yml")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("./conf")
+		viper.AddConfigPath("../conf")
+	}
+	setDefaults()
+	bindEnvs()
+	config.Store(&GlobalConfig{})
 	err := viper.ReadInConfig() // 读取配置信息
 	if err != nil {
-		panic("read config file err:" + err.Error())
+		loadErr = fmt.Errorf("read config file err: %w", err)
+		return
 	}
-	err = viper.Unmarshal(&config) // 将配置信息反序列化填充到全局配置文件中
+	conf, err := decodeConf()
+	if conf != nil {
+		config.Store(conf)
+	}
+	loadErr = err
+}
+
+// decodeConf 将 viper 中的配置反序列化为新的配置对象，读取密钥文件并校验
+func decodeConf() (*GlobalConfig, error) {
+	conf := &GlobalConfig{}
+	if err := viper.Unmarshal(conf); err != nil { // 将配置信息反序列化填充到全局配置文件中
+		return nil, fmt.Errorf("config file unmarshal err: %w", err)
+	}
+	if err := loadSecretFiles(conf); err != nil {
+		return nil, fmt.Errorf("load secret file err: %w", err)
+	}
+	return conf, conf.Validate()
+}
+
+// 设置配置项默认值，配置文件中未填写时生效
+func setDefaults() {
+	viper.SetDefault("app.read_timeout", 10)
+	viper.SetDefault("app.write_timeout", 10)
+	viper.SetDefault("app.idle_timeout", 60)
+	viper.SetDefault("app.read_header_timeout", 5)
+	viper.SetDefault("app.drain_period", 5)
+	viper.SetDefault("app.shutdown_timeout", 15)
+	viper.SetDefault("app.admin_host", "127.0.0.1")
+	viper.SetDefault("cors.allow_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	viper.SetDefault("cors.allow_headers", []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"})
+	viper.SetDefault("cors.max_age", 600)
+	viper.SetDefault("cookie.same_site", "lax")
+	viper.SetDefault("csrf.enabled", true)
+	viper.SetDefault("csrf.cookie_name", "csrf_token")
+	viper.SetDefault("csrf.header_name", "X-CSRF-Token")
+	viper.SetDefault("tls.min_version", "1.2")
+	viper.SetDefault("tls.http2", true)
+	viper.SetDefault("tls.reload_interval", 60)
+	viper.SetDefault("security.hsts_max_age", 31536000)
+	viper.SetDefault("security.csp_report_only", true)
+	viper.SetDefault("security.frame_ancestors", "'self'")
+	viper.SetDefault("security.referrer_policy", "strict-origin-when-cross-origin")
+	viper.SetDefault("security.permissions_policy", "camera=(), microphone=(), geolocation=()")
+	viper.SetDefault("security.max_body_size", 1<<20)
+	viper.SetDefault("db.auto_migrate", true)
+	viper.SetDefault("mail.provider", "log")
+	viper.SetDefault("mail.smtp_port", 587)
+	viper.SetDefault("email_verify.link_ttl", 86400)
+	viper.SetDefault("email_verify.resend_cooldown", 60)
+	viper.SetDefault("email_verify.resend_max_per_day", 5)
+	viper.SetDefault("email_verify.unverified_access", "restricted")
+	viper.SetDefault("otp.code_ttl", 300)
+	viper.SetDefault("otp.max_attempts", 5)
+	viper.SetDefault("otp.resend_cooldown", 60)
+	viper.SetDefault("otp.email_provider", "mail")
+	viper.SetDefault("otp.sms_provider", "http")
+	viper.SetDefault("otp.http.timeout", 5)
+	viper.SetDefault("oidc.success_url", "/static/index.html")
+	viper.SetDefault("oidc.state_ttl", 600)
+	viper.SetDefault("oauth.login_url", "/static/login.html")
+	viper.SetDefault("oauth.code_ttl", 60)
+	viper.SetDefault("oauth.access_token_ttl", 3600)
+	viper.SetDefault("oauth.refresh_token_ttl", 2592000)
+	viper.SetDefault("oauth.id_token_ttl", 3600)
+	viper.SetDefault("ldap.timeout", 5)
+	viper.SetDefault("ldap.mode", "search")
+	viper.SetDefault("ldap.user_filter", "(uid=%s)")
+	viper.SetDefault("ldap.group_filter", "(member=%s)")
+	viper.SetDefault("ldap.default_role", "user")
+	viper.SetDefault("ldap.attributes.name", "uid")
+	viper.SetDefault("ldap.attributes.email", "mail")
+	viper.SetDefault("ldap.attributes.nickname", "displayName")
+	viper.SetDefault("ldap.attributes.phone", "telephoneNumber")
+	viper.SetDefault("ldap.attributes.groups", "memberOf")
+	viper.SetDefault("ldap.local_fallback", true)
+	viper.SetDefault("access_token.max_per_user", 20)
+	viper.SetDefault("access_token.default_ttl", 90)
+	viper.SetDefault("access_token.max_ttl", 365)
+	viper.SetDefault("scim.max_results", 100)
+	viper.SetDefault("audit.enabled", true)
+	viper.SetDefault("login_history.enabled", true)
+	viper.SetDefault("login_history.notify_new_device", true)
+	viper.SetDefault("login_history.notifier", "mail")
+	viper.SetDefault("webhook.timeout", 10)
+	viper.SetDefault("webhook.max_attempts", 8)
+	viper.SetDefault("webhook.initial_backoff", 30)
+	viper.SetDefault("webhook.max_backoff", 3600)
+	viper.SetDefault("webhook.poll_interval", 5)
+	viper.SetDefault("webhook.batch_size", 20)
+	viper.SetDefault("outbox.publisher", "redis")
+	viper.SetDefault("outbox.stream", "gous:events")
+	viper.SetDefault("outbox.max_len", 100000)
+	viper.SetDefault("outbox.poll_interval", 500)
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.initial_backoff", 1)
+	viper.SetDefault("outbox.max_backoff", 60)
+	viper.SetDefault("outbox.max_attempts", 50)
+	viper.SetDefault("outbox.nats_subject", "gous.events")
+	viper.SetDefault("outbox.kafka_topic", "gous.events")
+	viper.SetDefault("outbox.retention", 7)
+	viper.SetDefault("data_export.dir", "data/exports")
+	viper.SetDefault("data_export.link_ttl", 3600)
+	viper.SetDefault("data_export.retention", 72)
+	viper.SetDefault("data_export.min_interval", 3600)
+	viper.SetDefault("data_export.poll_interval", 5)
+	viper.SetDefault("erasure.poll_interval", 10)
+	viper.SetDefault("erasure.max_attempts", 10)
+	viper.SetDefault("erasure.initial_backoff", 10)
+	viper.SetDefault("erasure.max_backoff", 3600)
+	viper.SetDefault("startup.max_retries", 5)
+	viper.SetDefault("startup.initial_backoff", 500)
+	viper.SetDefault("startup.max_backoff", 8000)
+	viper.SetDefault("startup.timeout", 60)
+}
+
+// InitConfig 读取、校验配置并初始化日志
+func InitConfig() error {
+	globalConf, err := LoadConfig() // 获取全局配置文件
 	if err != nil {
-		panic("config file unmarshal err:" + err.Error())
+		return err
+	}
+	if err := setupLog(globalConf.LogConfig); err != nil {
+		return err
 	}
-	log.Infof("config === %+v", config)
+	log.Infof("config === %+v", globalConf.Masked())
+	return nil
 }
 
-// InitConfig 初始化日志
-func InitConfig() {
-	globalConf := GetGlobalConf() // 获取全局配置文件
+// setupLog 根据日志配置设置日志级别和输出，热加载时也会调用
+func setupLog(logConf LogConf) error {
 	// 根据我们自己设置的日志级别来设置日志级别
-	level, err := log.ParseLevel(globalConf.LogConfig.Level)
+	level, err := log.ParseLevel(logConf.Level)
 	if err != nil {
-		panic("log level parse err:" + err.Error())
+		return fmt.Errorf("log level parse err: %w", err)
 	}
 	log.SetFormatter(&logFormatter{
 		log.TextFormatter{
@@ -108,22 +602,23 @@ func InitConfig() {
 		}})
 	log.SetReportCaller(true) // 打印文件位置，行号
 	log.SetLevel(level)       // 设置日志的级别
-	switch globalConf.LogConfig.LogPattern {
+	switch logConf.LogPattern {
 	case "stdout": // 将日志输出到标准输出
 		log.SetOutput(os.Stdout)
 	case "stderr": // 将日志输出到标准错误输出
 		log.SetOutput(os.Stderr)
 	case "file": // 使用第三方日志库 rlog 创建一个新的日志记录器，并将其设置为日志的输出目标
 		logger, err := rlog.New( // 基于文件的日志记录器，将日志输出到指定的文件中。
-			globalConf.LogConfig.LogPath+".%Y%m%d",                // 文件名：路径+日期
-			rlog.WithRotationCount(globalConf.LogConfig.SaveDays), // 设置日志文件保留天数
-			rlog.WithRotationTime(time.Hour*24),                   // 设置日志文件的轮转时间间隔
+			logConf.LogPath+".%Y%m%d",                // 文件名：路径+日期
+			rlog.WithRotationCount(logConf.SaveDays), // 设置日志文件保留天数
+			rlog.WithRotationTime(time.Hour*24),      // 设置日志文件的轮转时间间隔
 		)
 		if err != nil {
-			panic("log conf err:" + err.Error())
+			return fmt.Errorf("log conf err: %w", err)
 		}
 		log.SetOutput(logger)
 	default:
-		panic("log conf err, check log_pattern in logsvr.yaml")
+		return fmt.Errorf("log conf err, check log_pattern in app.yml")
 	}
+	return nil
 }
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// envPrefix 环境变量前缀，如 app.port 对应 GOUS_APP_PORT
+const envPrefix = "GOUS"
+
+// bindEnvs 为 GlobalConfig 的每个字段绑定环境变量。
+// viper.AutomaticEnv 只对已知的 key 生效，配置文件里没写的字段需要显式绑定才能被 Unmarshal 读到。
+func bindEnvs() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	for _, key := range configKeys(reflect.TypeOf(GlobalConfig{}), "") {
+		_ = viper.BindEnv(key)
+	}
+}
+
+// configKeys 根据 mapstructure 标签递归列出所有配置项的 key
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(field.Type, key)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// loadSecretFiles 从 *_file 指定的文件中读取密钥，覆盖配置中的明文值，便于挂载 secret 文件部署
+func loadSecretFiles(conf *GlobalConfig) error {
+	secrets := []struct {
+		file   string
+		target *string
+	}{
+		{conf.DbConfig.PasswordFile, &conf.DbConfig.Password},
+		{conf.RedisConfig.PassWordFile, &conf.RedisConfig.PassWord},
+		{conf.Secret.SigningKeyFile, &conf.Secret.SigningKey},
+		{conf.Mail.SmtpPasswordFile, &conf.Mail.SmtpPassword},
+		{conf.Otp.Http.TokenFile, &conf.Otp.Http.Token},
+		{conf.Ldap.BindPasswordFile, &conf.Ldap.BindPassword},
+		{conf.Scim.TokenFile, &conf.Scim.Token},
+		{conf.Audit.HmacKeyFile, &conf.Audit.HmacKey},
+		{conf.Encryption.MasterKeysFile, &conf.Encryption.MasterKeys},
+	}
+	for i := range conf.Oidc.Providers {
+		p := &conf.Oidc.Providers[i]
+		secrets = append(secrets, struct {
+			file   string
+			target *string
+		}{p.ClientSecretFile, &p.ClientSecret})
+	}
+	for _, s := range secrets {
+		if s.file == "" {
+			continue
+		}
+		val, err := os.ReadFile(s.file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", s.file, err)
+		}
+		*s.target = strings.TrimRight(string(val), "\r\n")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// hotReloadKeys 允许热加载的配置项，其余配置项变更需要重启服务才能生效
+var hotReloadKeys = []string{
+	"log.level",
+	"log.log_pattern",
+	"log.log_path",
+	"log.save_days",
+	"cache.session_expired",
+	"cache.user_expired",
+	"cors_origin",
+	"cors",
+	"security",
+	"webhook",
+	"erasure",
+}
+
+var reloadMu sync.Mutex // 文件监听和手动触发的热加载串行执行
+
+// Change 配置项变更
+type Change struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ReloadResult 热加载结果
+type ReloadResult struct {
+	Applied         []Change `json:"applied"`          // 已生效的变更
+	RestartRequired []Change `json:"restart_required"` // 需要重启才能生效的变更
+}
+
+// WatchConfig 监听配置文件变化，自动热加载允许热更新的配置项
+func WatchConfig() {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		log.Infof("config file changed: %s", e.Name)
+		if _, err := reloadFromViper(); err != nil {
+			log.Errorf("reload config err:%v", err)
+		}
+	})
+	viper.WatchConfig()
+}
+
+// Reload 重新读取配置文件并热加载允许热更新的配置项
+func Reload() (*ReloadResult, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config file err: %w", err)
+	}
+	return reloadFromViper()
+}
+
+// reloadFromViper 对比新旧配置，原子替换允许热加载的部分，并记录需要重启的变更
+func reloadFromViper() (*ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := decodeConf()
+	if err != nil {
+		return nil, fmt.Errorf("new config rejected, keep current config: %w", err)
+	}
+	cur := GetGlobalConf()
+	applied := *cur
+	result := &ReloadResult{}
+
+	curVal, nextVal := reflect.ValueOf(cur).Elem(), reflect.ValueOf(next).Elem()
+	for _, key := range configKeys(reflect.TypeOf(GlobalConfig{}), "") {
+		oldField, newField := fieldByKey(curVal, key), fieldByKey(nextVal, key)
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+		change := Change{Key: key, Old: oldField.Interface(), New: newField.Interface()}
+		if isSecretKey(key) {
+			change.Old, change.New = maskedValue, maskedValue
+		}
+		if !canHotReload(key) {
+			result.RestartRequired = append(result.RestartRequired, change)
+			log.Warnf("config %s changed %v -> %v, restart required to take effect", change.Key, change.Old, change.New)
+			continue
+		}
+		fieldByKey(reflect.ValueOf(&applied).Elem(), key).Set(newField)
+		result.Applied = append(result.Applied, change)
+		log.Infof("config %s changed %v -> %v", change.Key, change.Old, change.New)
+	}
+
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+	if !reflect.DeepEqual(cur.LogConfig, applied.LogConfig) {
+		if err := setupLog(applied.LogConfig); err != nil {
+			_ = setupLog(cur.LogConfig)
+			return nil, fmt.Errorf("new log config rejected: %w", err)
+		}
+	}
+	config.Store(&applied)
+	return result, nil
+}
+
+func canHotReload(key string) bool {
+	for _, k := range hotReloadKeys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByKey 按 mapstructure 标签路径（如 log.level）查找字段
+func fieldByKey(v reflect.Value, key string) reflect.Value {
+	for _, name := range strings.Split(key, ".") {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if strings.Split(t.Field(i).Tag.Get("mapstructure"), ",")[0] == name {
+				v = v.Field(i)
+				break
+			}
+		}
+	}
+	return v
+}
+
+// isSecretKey 配置项是否为密钥
+func isSecretKey(key string) bool {
+	names := strings.Split(key, ".")
+	t := reflect.TypeOf(GlobalConfig{})
+	for i, name := range names {
+		for j := 0; j < t.NumField(); j++ {
+			f := t.Field(j)
+			if strings.Split(f.Tag.Get("mapstructure"), ",")[0] != name {
+				continue
+			}
+			if i == len(names)-1 {
+				return f.Tag.Get("secret") == "true"
+			}
+			t = f.Type
+			break
+		}
+	}
+	return false
+}
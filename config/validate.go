@@ -0,0 +1,459 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const maskedValue = "******" // 脱敏后的密钥显示值
+
+// oidcNamePattern 身份提供方名称会出现在回调地址中，只允许小写字母、数字和横线
+var oidcNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ValidationError 配置校验错误，包含发现的全部问题
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config, %d problem(s):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// validator 收集校验问题
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(key, val string) {
+	if strings.TrimSpace(val) == "" {
+		v.addf("%s is required", key)
+	}
+}
+
+func (v *validator) port(key string, val int) {
+	if val < 1 || val > 65535 {
+		v.addf("%s must be in [1, 65535], got %d", key, val)
+	}
+}
+
+func (v *validator) min(key string, val, min int) {
+	if val < min {
+		v.addf("%s must be >= %d, got %d", key, min, val)
+	}
+}
+
+func (v *validator) oneOf(key, val string, options ...string) {
+	for _, o := range options {
+		if val == o {
+			return
+		}
+	}
+	v.addf("%s must be one of %v, got %q", key, options, val)
+}
+
+var (
+	namesMu sync.RWMutex
+	names   = map[string][]string{} // 配置项 -> 各模块注册的实现名称
+)
+
+// RegisterName 登记配置项 key 可选的实现名称，由可扩展的模块在注册实现时调用，校验时只接受登记过的名称
+func RegisterName(key, name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	for _, n := range names[key] {
+		if n == name {
+			return
+		}
+	}
+	names[key] = append(names[key], name)
+	sort.Strings(names[key])
+}
+
+func registeredNames(key string) []string {
+	namesMu.RLock()
+	defer namesMu.RUnlock()
+	return append([]string(nil), names[key]...)
+}
+
+// validIPOrCIDR 是否为 IP 地址或 CIDR 网段
+func validIPOrCIDR(s string) bool {
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
+
+// loopbackHost 是否只监听本机，为空表示监听全部地址
+func loopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Validate 校验配置的必填项、取值范围、枚举值以及字段间约束，一次性返回全部问题
+func (c *GlobalConfig) Validate() error {
+	v := &validator{}
+
+	app := c.AppConfig
+	v.required("app.app_name", app.AppName)
+	v.port("app.port", app.Port)
+	v.oneOf("app.run_mode", app.RunMode, "release", "debug", "test")
+	v.min("app.read_timeout", app.ReadTimeout, 0)
+	v.min("app.write_timeout", app.WriteTimeout, 0)
+	v.min("app.idle_timeout", app.IdleTimeout, 0)
+	v.min("app.read_header_timeout", app.ReadHeaderTimeout, 0)
+	if app.ReadTimeout > 0 && app.ReadHeaderTimeout > app.ReadTimeout {
+		v.addf("app.read_header_timeout (%d) must not exceed app.read_timeout (%d)", app.ReadHeaderTimeout, app.ReadTimeout)
+	}
+	v.min("app.drain_period", app.DrainPeriod, 0)
+	v.min("app.shutdown_timeout", app.ShutdownTimeout, 1)
+	if app.AdminPort != 0 {
+		v.port("app.admin_port", app.AdminPort)
+		if app.AdminPort == app.Port {
+			v.addf("app.admin_port must differ from app.port (%d)", app.Port)
+		}
+	}
+	for i, proxy := range app.TrustedProxies {
+		if !validIPOrCIDR(proxy) {
+			v.addf("app.trusted_proxies[%d] must be an IP or CIDR, got %q", i, proxy)
+		}
+	}
+
+	for i, origin := range c.CorsOrigin {
+		if strings.TrimSpace(origin) == "" {
+			v.addf("cors_origin[%d] is empty", i)
+		}
+	}
+
+	v.min("cors.max_age", c.Cors.MaxAge, 0)
+	for i, g := range c.Cors.Groups {
+		if !strings.HasPrefix(g.PathPrefix, "/") {
+			v.addf("cors.groups[%d].path_prefix must start with /, got %q", i, g.PathPrefix)
+		}
+	}
+	if c.Cors.AllowCredentials {
+		for _, origin := range c.CorsOrigin {
+			if origin == "*" {
+				v.addf("cors_origin * cannot be combined with cors.allow_credentials, list the allowed origins instead")
+			}
+		}
+	}
+
+	v.oneOf("cookie.same_site", strings.ToLower(c.Cookie.SameSite), "lax", "strict", "none")
+	if strings.EqualFold(c.Cookie.SameSite, "none") && !c.Cookie.Secure {
+		v.addf("cookie.same_site none requires cookie.secure true")
+	}
+	if c.Csrf.Enabled {
+		v.required("csrf.cookie_name", c.Csrf.CookieName)
+		v.required("csrf.header_name", c.Csrf.HeaderName)
+	}
+
+	tc := c.Tls
+	if tc.Enabled {
+		v.required("tls.cert_file", tc.CertFile)
+		v.required("tls.key_file", tc.KeyFile)
+		v.oneOf("tls.min_version", tc.MinVersion, "1.2", "1.3")
+		for _, name := range tc.CipherSuites {
+			if _, ok := CipherSuiteID(name); !ok {
+				v.addf("tls.cipher_suites contains unknown or insecure suite %q", name)
+			}
+		}
+		if tc.RedirectPort != 0 {
+			v.port("tls.redirect_port", tc.RedirectPort)
+			if tc.RedirectPort == app.Port || tc.RedirectPort == app.AdminPort {
+				v.addf("tls.redirect_port (%d) conflicts with app.port or app.admin_port", tc.RedirectPort)
+			}
+		}
+		v.min("tls.reload_interval", tc.ReloadInterval, 0)
+	}
+	if tc.AdminClientCA != "" && (!tc.Enabled || app.AdminPort == 0) {
+		v.addf("tls.admin_client_ca requires tls.enabled and app.admin_port")
+	}
+	// 管理接口没有登录认证，可以删除用户、修改配置，监听本机以外的地址时必须校验客户端证书
+	if app.AdminPort != 0 && !loopbackHost(app.AdminHost) && tc.AdminClientCA == "" {
+		v.addf("app.admin_host %q is not a loopback address, set tls.admin_client_ca to require client certificates", app.AdminHost)
+	}
+
+	v.min("security.hsts_max_age", c.Security.HstsMaxAge, 0)
+	if c.Security.MaxBodySize < 0 {
+		v.addf("security.max_body_size must be >= 0, got %d", c.Security.MaxBodySize)
+	}
+	if c.Security.HstsPreload && (c.Security.HstsMaxAge < 31536000 || !c.Security.HstsIncludeSubdomains) {
+		v.addf("security.hsts_preload requires hsts_max_age >= 31536000 and hsts_include_subdomains")
+	}
+
+	v.oneOf("mail.provider", c.Mail.Provider, "log", "smtp")
+	if c.Mail.Provider == "smtp" {
+		v.required("mail.smtp_host", c.Mail.SmtpHost)
+		v.port("mail.smtp_port", c.Mail.SmtpPort)
+		v.required("mail.from", c.Mail.From)
+	}
+
+	ev := c.EmailVerify
+	if ev.Enabled {
+		v.required("email_verify.base_url", ev.BaseUrl)
+		v.min("email_verify.link_ttl", ev.LinkTTL, 60)
+		v.min("email_verify.resend_cooldown", ev.ResendCooldown, 0)
+		v.min("email_verify.resend_max_per_day", ev.ResendMaxPerDay, 1)
+		v.oneOf("email_verify.unverified_access", ev.UnverifiedAccess, "block", "restricted")
+		if c.Secret.SigningKey == "" {
+			v.addf("email_verify.enabled requires secret.signing_key to sign verification links")
+		}
+	}
+
+	otp := c.Otp
+	if otp.Enabled {
+		v.min("otp.code_ttl", otp.CodeTTL, 30)
+		v.min("otp.max_attempts", otp.MaxAttempts, 1)
+		v.min("otp.resend_cooldown", otp.ResendCooldown, 0)
+		v.oneOf("otp.email_provider", otp.EmailProvider, "mail", "http", "fake")
+		v.oneOf("otp.sms_provider", otp.SmsProvider, "http", "fake")
+		if otp.EmailProvider == "http" || otp.SmsProvider == "http" {
+			v.required("otp.http.url", otp.Http.Url)
+			v.min("otp.http.timeout", otp.Http.Timeout, 1)
+		}
+	}
+
+	if c.Oidc.Enabled {
+		v.required("oidc.redirect_base_url", c.Oidc.RedirectBaseUrl)
+		v.min("oidc.state_ttl", c.Oidc.StateTTL, 60)
+		if len(c.Oidc.Providers) == 0 {
+			v.addf("oidc.enabled requires at least one provider")
+		}
+		names := map[string]bool{}
+		for i, p := range c.Oidc.Providers {
+			if !oidcNamePattern.MatchString(p.Name) {
+				v.addf("oidc.providers[%d].name must match %s, got %q", i, oidcNamePattern, p.Name)
+			}
+			if names[p.Name] {
+				v.addf("oidc.providers[%d].name %q is duplicated", i, p.Name)
+			}
+			names[p.Name] = true
+			v.required(fmt.Sprintf("oidc.providers[%d].issuer", i), p.Issuer)
+			v.required(fmt.Sprintf("oidc.providers[%d].client_id", i), p.ClientID)
+		}
+	}
+
+	oc := c.OAuth
+	if oc.Enabled {
+		v.required("oauth.issuer", oc.Issuer)
+		v.required("oauth.login_url", oc.LoginUrl)
+		v.min("oauth.code_ttl", oc.CodeTTL, 10)
+		v.min("oauth.access_token_ttl", oc.AccessTokenTTL, 60)
+		v.min("oauth.refresh_token_ttl", oc.RefreshTokenTTL, 60)
+		v.min("oauth.id_token_ttl", oc.IDTokenTTL, 60)
+	}
+
+	ld := c.Ldap
+	if ld.Enabled {
+		if !strings.HasPrefix(ld.Url, "ldap://") && !strings.HasPrefix(ld.Url, "ldaps://") {
+			v.addf("ldap.url must start with ldap:// or ldaps://, got %q", ld.Url)
+		}
+		if ld.StartTLS && strings.HasPrefix(ld.Url, "ldaps://") {
+			v.addf("ldap.start_tls can not be used with ldaps://")
+		}
+		v.min("ldap.timeout", ld.Timeout, 1)
+		v.oneOf("ldap.mode", ld.Mode, "bind", "search")
+		if ld.Mode == "bind" && strings.Count(ld.UserDNTemplate, "%s") != 1 {
+			v.addf("ldap.user_dn_template must contain exactly one %%s in bind mode")
+		}
+		if ld.Mode == "search" {
+			v.required("ldap.base_dn", ld.BaseDN)
+			if !strings.Contains(ld.UserFilter, "%s") {
+				v.addf("ldap.user_filter must contain %%s in search mode")
+			}
+		}
+		if ld.GroupBaseDN != "" && !strings.Contains(ld.GroupFilter, "%s") {
+			v.addf("ldap.group_filter must contain %%s when group_base_dn is set")
+		}
+		v.required("ldap.default_role", ld.DefaultRole)
+		for i, gr := range ld.GroupRoles {
+			v.required(fmt.Sprintf("ldap.group_roles[%d].group", i), gr.Group)
+			v.required(fmt.Sprintf("ldap.group_roles[%d].role", i), gr.Role)
+		}
+	}
+
+	at := c.AccessToken
+	if at.Enabled {
+		v.min("access_token.max_per_user", at.MaxPerUser, 1)
+		v.min("access_token.default_ttl", at.DefaultTTL, 1)
+		v.min("access_token.max_ttl", at.MaxTTL, 0)
+		if at.MaxTTL > 0 && at.DefaultTTL > at.MaxTTL {
+			v.addf("access_token.default_ttl (%d) must not exceed access_token.max_ttl (%d)", at.DefaultTTL, at.MaxTTL)
+		}
+	}
+
+	sc := c.Scim
+	if sc.Enabled {
+		// 令牌过短容易被猜测，身份提供方可以生成足够长的随机串
+		if len(sc.Token) < 32 {
+			v.addf("scim.token must be at least 32 characters when scim is enabled")
+		}
+		v.min("scim.max_results", sc.MaxResults, 1)
+	}
+
+	if lh := c.LoginHistory; lh.Enabled && lh.NotifyNewDevice {
+		v.oneOf("login_history.notifier", lh.Notifier, "mail", "log")
+	}
+
+	wh := c.Webhook
+	if wh.Enabled {
+		v.min("webhook.timeout", wh.Timeout, 1)
+		v.min("webhook.max_attempts", wh.MaxAttempts, 1)
+		v.min("webhook.initial_backoff", wh.InitialBackoff, 1)
+		v.min("webhook.max_backoff", wh.MaxBackoff, wh.InitialBackoff)
+		v.min("webhook.poll_interval", wh.PollInterval, 1)
+		v.min("webhook.batch_size", wh.BatchSize, 1)
+	}
+
+	if ob := c.Outbox; ob.Enabled {
+		v.oneOf("outbox.publisher", ob.Publisher, registeredNames("outbox.publisher")...)
+		switch ob.Publisher {
+		case "redis":
+			v.required("outbox.stream", ob.Stream)
+		case "nats":
+			v.required("outbox.nats_url", ob.NatsUrl)
+			v.required("outbox.nats_subject", ob.NatsSubject)
+		case "kafka":
+			if len(ob.KafkaBrokers) == 0 {
+				v.addf("outbox.kafka_brokers is required")
+			}
+			v.required("outbox.kafka_topic", ob.KafkaTopic)
+		}
+		v.min("outbox.poll_interval", ob.PollInterval, 10)
+		v.min("outbox.batch_size", ob.BatchSize, 1)
+		v.min("outbox.initial_backoff", ob.InitialBackoff, 1)
+		v.min("outbox.max_backoff", ob.MaxBackoff, ob.InitialBackoff)
+		v.min("outbox.max_attempts", ob.MaxAttempts, 0)
+		v.min("outbox.retention", ob.Retention, 0)
+	}
+
+	if de := c.DataExport; de.Enabled {
+		v.required("data_export.dir", de.Dir)
+		v.min("data_export.link_ttl", de.LinkTTL, 60)
+		v.min("data_export.retention", de.Retention, 1)
+		v.min("data_export.min_interval", de.MinInterval, 0)
+		v.min("data_export.poll_interval", de.PollInterval, 1)
+		if c.Secret.SigningKey == "" {
+			v.addf("data_export.enabled requires secret.signing_key to sign download links")
+		}
+	}
+
+	er := c.Erasure
+	v.min("erasure.poll_interval", er.PollInterval, 1)
+	v.min("erasure.max_attempts", er.MaxAttempts, 1)
+	v.min("erasure.initial_backoff", er.InitialBackoff, 1)
+	v.min("erasure.max_backoff", er.MaxBackoff, er.InitialBackoff)
+
+	if enc := c.Encryption; enc.Enabled || enc.MasterKeys != "" {
+		if _, err := ParseMasterKeys(enc.MasterKeys); err != nil {
+			v.addf("encryption.master_keys: %v", err)
+		}
+	}
+
+	// 密钥过短时攻击者可以穷举后重算哈希链
+	if ak := c.Audit.HmacKey; ak != "" && len(ak) < 32 {
+		v.addf("audit.hmac_key must be at least 32 characters")
+	}
+
+	db := c.DbConfig
+	v.required("db.host", db.Host)
+	v.port("db.port", db.Port)
+	v.required("db.user", db.User)
+	v.required("db.dbname", db.Dbname)
+	v.min("db.max_open_conn", db.MaxOpenConn, 1)
+	v.min("db.max_idle_conn", db.MaxIdleConn, 0)
+	if db.MaxIdleConn > db.MaxOpenConn && db.MaxOpenConn > 0 {
+		v.addf("db.max_idle_conn (%d) must not exceed db.max_open_conn (%d)", db.MaxIdleConn, db.MaxOpenConn)
+	}
+	if db.MaxIdleTime <= 0 {
+		v.addf("db.max_idle_time must be > 0, got %d", db.MaxIdleTime)
+	}
+
+	lc := c.LogConfig
+	v.oneOf("log.log_pattern", lc.LogPattern, "stdout", "stderr", "file")
+	if _, err := log.ParseLevel(lc.Level); err != nil {
+		v.addf("log.level %q is invalid: %v", lc.Level, err)
+	}
+	if lc.LogPattern == "file" {
+		v.required("log.log_path", lc.LogPath)
+		if lc.SaveDays == 0 {
+			v.addf("log.save_days must be > 0 when log.log_pattern is file")
+		}
+	}
+
+	rc := c.RedisConfig
+	v.required("redis.rhost", rc.Host)
+	v.port("redis.rport", rc.Port)
+	if rc.DB < 0 || rc.DB > 15 {
+		v.addf("redis.rdb must be in [0, 15], got %d", rc.DB)
+	}
+	v.min("redis.poolsize", rc.PoolSile, 1)
+
+	v.min("cache.session_expired", c.Cache.SessionExpired, 1)
+	v.min("cache.user_expired", c.Cache.UserExpired, 1)
+
+	st := c.Startup
+	v.min("startup.max_retries", st.MaxRetries, 0)
+	v.min("startup.initial_backoff", st.InitialBackoff, 1)
+	if st.MaxBackoff < st.InitialBackoff {
+		v.addf("startup.max_backoff (%d) must be >= startup.initial_backoff (%d)", st.MaxBackoff, st.InitialBackoff)
+	}
+	v.min("startup.timeout", st.Timeout, 1)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// CipherSuiteID 根据名称查找 Go 支持的安全加密套件
+func CipherSuiteID(name string) (uint16, bool) {
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == name {
+			return cs.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Masked 返回将 secret 标签字段脱敏后的配置副本，用于打印
+func (c GlobalConfig) Masked() GlobalConfig {
+	maskSecrets(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+func maskSecrets(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			maskSecrets(field)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			// 切片与原配置共享底层数组，先复制再脱敏
+			copied := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			reflect.Copy(copied, field)
+			for j := 0; j < copied.Len(); j++ {
+				maskSecrets(copied.Index(j))
+			}
+			field.Set(copied)
+		case field.Kind() == reflect.String && t.Field(i).Tag.Get("secret") == "true" && field.String() != "":
+			field.SetString(maskedValue)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package audit
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Source 请求来源，由路由中间件放入请求上下文
+type Source struct {
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+type sourceKey struct{}
+
+// WithSource 在上下文中保存请求来源
+func WithSource(ctx context.Context, src *Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// SourceFrom 获取上下文中的请求来源，命令行等没有请求的场景返回空值
+func SourceFrom(ctx context.Context) *Source {
+	if src, ok := ctx.Value(sourceKey{}).(*Source); ok {
+		return src
+	}
+	return &Source{}
+}
+
+// Change 字段修改前后的值，密码等敏感字段只记录是否修改
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Event 一次需要审计的操作
+type Event struct {
+	Action  string            // 见 constant.Audit*
+	Actor   string            // 操作者
+	Target  string            // 被操作的用户、应用等
+	Err     error             // 不为 nil 时记为失败，错误信息作为失败原因
+	Changes map[string]Change // 修改前后的值
+}
+
+var mu sync.Mutex // 同一实例内串行写入，减少事务间的锁等待
+
+// Record 写入审计日志，写入失败只记录错误日志，不影响业务操作
+func Record(ctx context.Context, ev *Event) {
+	conf := config.GetGlobalConf().Audit
+	if !conf.Enabled {
+		return
+	}
+	src := SourceFrom(ctx)
+	// 字段按数据库长度截断后再计算哈希，避免数据库截断后哈希与内容不一致
+	entry := &model.AuditLog{
+		Action:      ev.Action,
+		Result:      constant.AuditSuccess,
+		Actor:       utils.Truncate(ev.Actor, 255),
+		Target:      utils.Truncate(ev.Target, 255),
+		IP:          utils.Truncate(src.IP, 64),
+		UserAgent:   utils.Truncate(src.UserAgent, 512),
+		RequestID:   utils.Truncate(src.RequestID, 64),
+		CreateTime:  time.Now().Truncate(time.Millisecond), // 与数据库 datetime(3) 精度一致
+		HashVersion: HashVersion,
+	}
+	if ev.Err != nil {
+		entry.Result = constant.AuditFailure
+		entry.Reason = utils.Truncate(ev.Err.Error(), 512)
+	}
+	if len(ev.Changes) > 0 {
+		raw, err := json.Marshal(ev.Changes)
+		if err != nil {
+			log.Errorf("audit|marshal changes of %s err:%v", ev.Action, err)
+		}
+		entry.Changes = string(raw)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 多个实例同时写入时可能因主键冲突或死锁失败，重试几次
+	var err error
+	for i := 0; i < 3; i++ {
+		err = dao.AppendAuditLog(entry, func(last *model.AuditLog) {
+			entry.ID, entry.PrevHash = 1, ""
+			if last != nil {
+				entry.ID, entry.PrevHash = last.ID+1, last.Hash
+			}
+			entry.Hash = Hash(entry, conf.HmacKey)
+		})
+		if err == nil {
+			return
+		}
+	}
+	log.Errorf("audit|%s actor=%s target=%s result=%s request_id=%s not recorded: %v",
+		entry.Action, entry.Actor, entry.Target, entry.Result, entry.RequestID, err)
+}
+
+// HashVersion 新写入记录使用的哈希版本
+const HashVersion = 2
+
+// 个人数据字段，版本 2 的哈希覆盖这些字段的摘要而不是内容，假名化时替换内容并保存原摘要
+const (
+	FieldActor     = "actor"
+	FieldTarget    = "target"
+	FieldIP        = "ip"
+	FieldUserAgent = "user_agent"
+	FieldReason    = "reason"
+	FieldChanges   = "changes"
+)
+
+// Hash 计算记录的哈希，覆盖前一条记录的哈希和除自身哈希外的全部字段；key 不为空时使用 HMAC
+func Hash(e *model.AuditLog, key string) string {
+	fields := []string{e.Actor, e.Target, e.IP, e.UserAgent, e.Reason, e.Changes}
+	if e.HashVersion >= 2 {
+		redacted := redactedDigests(e)
+		for i, name := range []string{FieldActor, FieldTarget, FieldIP, FieldUserAgent, FieldReason, FieldChanges} {
+			if d, ok := redacted[name]; ok {
+				fields[i] = d
+			} else {
+				fields[i] = digest(fields[i], key)
+			}
+		}
+	}
+	// 按固定顺序编码成 JSON 数组，字段内容不会产生歧义
+	payload, _ := json.Marshal([]string{
+		strconv.FormatInt(e.ID, 10), e.PrevHash, e.Action, e.Result, fields[0], fields[1],
+		fields[2], fields[3], e.RequestID, fields[4], fields[5],
+		strconv.FormatInt(e.CreateTime.UnixMilli(), 10),
+	})
+	return digest(string(payload), key)
+}
+
+func digest(s, key string) string {
+	if key == "" {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func redactedDigests(e *model.AuditLog) map[string]string {
+	redacted := map[string]string{}
+	if e.Redacted != "" {
+		_ = json.Unmarshal([]byte(e.Redacted), &redacted)
+	}
+	return redacted
+}
+
+// Redact 把记录的个人数据字段替换为 values 中的内容，并保存原内容的摘要，哈希和哈希链不变。
+// 版本 1 的哈希覆盖字段内容，假名化后无法再校验内容，只能校验链的连续性
+func Redact(e *model.AuditLog, values map[string]string, key string) {
+	redacted := redactedDigests(e)
+	for name, val := range values {
+		field := auditField(e, name)
+		if field == nil || *field == val {
+			continue
+		}
+		// 已假名化的字段保留最初的摘要
+		if _, ok := redacted[name]; !ok {
+			redacted[name] = ""
+			if e.HashVersion >= 2 {
+				redacted[name] = digest(*field, key)
+			}
+		}
+		*field = val
+	}
+	if len(redacted) > 0 {
+		raw, _ := json.Marshal(redacted)
+		e.Redacted = string(raw)
+	}
+}
+
+func auditField(e *model.AuditLog, name string) *string {
+	switch name {
+	case FieldActor:
+		return &e.Actor
+	case FieldTarget:
+		return &e.Target
+	case FieldIP:
+		return &e.IP
+	case FieldUserAgent:
+		return &e.UserAgent
+	case FieldReason:
+		return &e.Reason
+	case FieldChanges:
+		return &e.Changes
+	}
+	return nil
+}
+
+// Problem 校验发现的问题
+type Problem struct {
+	ID     int64
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("id=%d: %s", p.ID, p.Reason)
+}
+
+// Report 哈希链校验结果
+type Report struct {
+	Count        int64     // 校验的记录数
+	LastID       int64     // 最后一条记录，可以保存到别处，下次校验时对比以发现末尾被截断
+	LastHash     string    // 最后一条记录的哈希
+	Redacted     int64     // 已假名化的记录数
+	Unverifiable int64     // 其中使用版本 1 哈希、内容无法校验的记录数，只校验了链的连续性
+	Problems     []Problem // 为空表示未发现篡改
+}
+
+// Verify 按 ID 顺序校验全部审计日志：ID 连续、prev_hash 等于前一条的哈希、哈希与内容一致。
+// 某条记录被修改时只报告该条，之后的记录继续以库中保存的哈希为准校验。
+// anchorID 不为 0 时还会确认该记录仍然存在且哈希等于 anchorHash，用于发现末尾记录被删除
+func Verify(ctx context.Context, batch int, key string, anchorID int64, anchorHash string) (*Report, error) {
+	report := &Report{}
+	var last *model.AuditLog
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		logs, err := dao.ScanAuditLogs(report.LastID, batch)
+		if err != nil {
+			return report, err
+		}
+		for _, e := range logs {
+			report.check(last, e, key)
+			if e.ID == anchorID && e.Hash != anchorHash {
+				report.Problems = append(report.Problems, Problem{e.ID, "hash differs from the one saved at last verification"})
+			}
+			report.Count++
+			report.LastID, report.LastHash = e.ID, e.Hash
+			last = e
+		}
+		if len(logs) < batch {
+			break
+		}
+	}
+	if anchorID > report.LastID {
+		report.Problems = append(report.Problems, Problem{anchorID, fmt.Sprintf("records %d-%d are missing", report.LastID+1, anchorID)})
+	}
+	return report, nil
+}
+
+func (r *Report) check(last, e *model.AuditLog, key string) {
+	expectID, expectPrev := int64(1), ""
+	if last != nil {
+		expectID, expectPrev = last.ID+1, last.Hash
+	}
+	if e.ID != expectID {
+		r.Problems = append(r.Problems, Problem{e.ID, fmt.Sprintf("records %d-%d are missing", expectID, e.ID-1)})
+	} else if e.PrevHash != expectPrev {
+		r.Problems = append(r.Problems, Problem{e.ID, "prev_hash does not match the previous record"})
+	}
+	if e.Redacted != "" {
+		r.Redacted++
+		if e.HashVersion < 2 {
+			r.Unverifiable++
+			return
+		}
+	}
+	if Hash(e, key) != e.Hash {
+		r.Problems = append(r.Problems, Problem{e.ID, "hash does not match the content, record was modified"})
+	}
+}
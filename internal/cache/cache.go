@@ -2,11 +2,13 @@ package cache
 
 import (
 	"Gous/config"
+	"Gous/internal/fieldcrypt"
 	"Gous/internal/model"
 	"Gous/internal/utils"
 	"Gous/pkg/constant"
 	"context"
 	"encoding/json"
+	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 	"time"
 )
@@ -20,15 +22,41 @@ func GetUserInfoFromCache(username string) (*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	return unmarshalUser(userInfoColumn, val)
+}
+
+// 缓存的用户信息加密时使用的附加数据，防止密文在两类 key 之间挪用
+const (
+	userInfoColumn = "cache.user_info"
+	sessionColumn  = "cache.session"
+)
+
+// marshalUser 序列化缓存的用户信息，不保存密码，开启字段加密时整体加密，与数据库中的个人信息同等保护
+func marshalUser(column string, user *model.User) (string, error) {
+	cached := *user
+	cached.PassWord = ""
+	val, err := json.Marshal(&cached)
+	if err != nil {
+		return "", err
+	}
+	return fieldcrypt.Encrypt(column, string(val))
+}
+
+// unmarshalUser 解析缓存的用户信息，开启加密前写入的明文同样可以读取
+func unmarshalUser(column, val string) (*model.User, error) {
+	plain, err := fieldcrypt.Decrypt(column, val)
+	if err != nil {
+		return nil, err
+	}
 	user := &model.User{}
-	err = json.Unmarshal([]byte(val), user)
+	err = json.Unmarshal([]byte(plain), user)
 	return user, err
 }
 
 // SetUserCacheInfo 缓存用户信息
 func SetUserCacheInfo(user *model.User) error {
 	rediskey := constant.UserInfoPrefix + user.Name
-	val, err := json.Marshal(user)
+	val, err := marshalUser(userInfoColumn, user)
 	// 解析失败
 	if err != nil {
 		return err
@@ -36,7 +64,7 @@ func SetUserCacheInfo(user *model.User) error {
 	// 缓存过期时间
 	expired := time.Second * time.Duration(config.GetGlobalConf().Cache.UserExpired)
 	// 键 值 过期时间
-	_, err = utils.GetRedisCLi().Set(context.Background(), rediskey, val, expired*time.Second).Result()
+	_, err = utils.GetRedisCLi().Set(context.Background(), rediskey, val, expired).Result()
 	return err
 }
 
@@ -45,7 +73,7 @@ func SetSessionInfo(user *model.User, session string) error {
 	//生成一个redis key，该key的格式是 "session:{session}"，其中的"{session}"是一个变量，代表了用户的session ID
 	redisKey := constant.SessionKeyPrefix + session
 	//将用户对象序列化为JSON格式的字符串。json.Marshal函数接受一个任意类型的值作为参数，并返回一个[]byte类型的字节数组和一个错误对象。
-	val, err := json.Marshal(&user)
+	val, err := marshalUser(sessionColumn, user)
 	if err != nil {
 		return err
 	}
@@ -54,10 +82,33 @@ func SetSessionInfo(user *model.User, session string) error {
 	//使用了Go Redis客户端库（github.com/go-redis/redis）提供的Set方法，将用户信息序列化为JSON字符串后存储在Redis中，并设置了过期时间为配置文件中设定的Session过期时间。
 	//该方法返回一个Redis的Reply对象，其中包含了当前键值的状态信息和执行结果。
 	//在这里使用了一个匿名变量来忽略掉状态信息，只关心执行结果的error类型，以便上层业务可以判断是否存储成功。
-	_, err = utils.GetRedisCLi().Set(context.Background(), redisKey, val, expired*time.Second).Result()
+	_, err = utils.GetRedisCLi().Set(context.Background(), redisKey, val, expired).Result()
+	if err != nil {
+		return err
+	}
+	// 记录用户的会话，停用账号时可以找到全部会话
+	sessionsKey := constant.UserSessionsKey + user.Name
+	pipe := utils.GetRedisCLi().TxPipeline()
+	pipe.SAdd(context.Background(), sessionsKey, session)
+	pipe.Expire(context.Background(), sessionsKey, expired)
+	_, err = pipe.Exec(context.Background())
 	return err
 }
 
+// DelUserSessions 删除用户的全部会话及对应的 CSRF token
+func DelUserSessions(userName string) error {
+	sessionsKey := constant.UserSessionsKey + userName
+	sessions, err := utils.GetRedisCLi().SMembers(context.Background(), sessionsKey).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{sessionsKey}
+	for _, s := range sessions {
+		keys = append(keys, constant.SessionKeyPrefix+s, constant.CsrfKeyPrefix+s)
+	}
+	return utils.GetRedisCLi().Del(context.Background(), keys...).Err()
+}
+
 // GetSessionInfo 查询缓存中是否存在该 session，用于判断是否处于登录状态
 func GetSessionInfo(session string) (*model.User, error) {
 	redisKey := constant.SessionKeyPrefix + session
@@ -66,9 +117,7 @@ func GetSessionInfo(session string) (*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	user := &model.User{}
-	err = json.Unmarshal([]byte(val), &user)
-	return user, err
+	return unmarshalUser(sessionColumn, val)
 }
 
 func DelSessionInfo(session string) error {
@@ -78,21 +127,195 @@ func DelSessionInfo(session string) error {
 	return err
 }
 
-// DelUserCacheInfo 删除缓存中的用户信息，注销时用
+// DelUserCacheInfo 删除缓存中的用户信息及其邮箱、手机号索引，注销、资料变更时用
 func DelUserCacheInfo(user *model.User) error {
-	redisKey := constant.UserInfoPrefix + user.Name
-	log.Infof("rediskey=============%v", redisKey)
-	_, err := utils.GetRedisCLi().Del(context.Background(), redisKey).Result()
+	redisKeys := userCacheKeys(user)
+	log.Infof("rediskey=============%v", redisKeys)
+	_, err := utils.GetRedisCLi().Del(context.Background(), redisKeys...).Result()
 	return err
 }
 
+// userCacheKeys 用户相关的全部缓存 key，需要一起失效
+func userCacheKeys(user *model.User) []string {
+	keys := []string{constant.UserInfoPrefix + user.Name}
+	if user.Email != nil {
+		keys = append(keys, identKey(constant.IdentEmail, *user.Email))
+	}
+	if user.Phone != nil {
+		keys = append(keys, identKey(constant.IdentPhone, *user.Phone))
+	}
+	return keys
+}
+
+func identKey(kind, value string) string {
+	return constant.UserIdentPrefix + kind + "_" + value
+}
+
+// GetUserNameByIdent 根据邮箱、手机号等登录标识查询缓存中的用户名
+func GetUserNameByIdent(kind, value string) (string, error) {
+	return utils.GetRedisCLi().Get(context.Background(), identKey(kind, value)).Result()
+}
+
+// SetUserIdent 缓存登录标识到用户名的映射，过期时间与用户信息一致
+func SetUserIdent(kind, value, userName string) error {
+	expired := time.Second * time.Duration(config.GetGlobalConf().Cache.UserExpired)
+	return utils.GetRedisCLi().Set(context.Background(), identKey(kind, value), userName, expired).Err()
+}
+
 // UpdateCachedUserInfo 更新用户在redis中的信息
 func UpdateCachedUserInfo(user *model.User) error {
 	err := SetUserCacheInfo(user) //直接添加同名key，原本的数据会被覆盖
 	if err != nil {
-		redisKey := constant.UserInfoPrefix + user.Name
 		//如果存储失败，则说明 Redis 存储出现问题，这时候需要将原先的缓存删除以避免缓存数据和数据库中数据不一致。
-		utils.GetRedisCLi().Del(context.Background(), redisKey).Result()
+		utils.GetRedisCLi().Del(context.Background(), userCacheKeys(user)...).Result()
+	}
+	return err
+}
+
+// SetCsrfToken 缓存会话对应的 CSRF token，过期时间与会话一致
+func SetCsrfToken(session, token string) error {
+	redisKey := constant.CsrfKeyPrefix + session
+	expired := time.Second * time.Duration(config.GetGlobalConf().Cache.SessionExpired)
+	return utils.GetRedisCLi().Set(context.Background(), redisKey, token, expired).Err()
+}
+
+// GetCsrfToken 查询会话对应的 CSRF token
+func GetCsrfToken(session string) (string, error) {
+	redisKey := constant.CsrfKeyPrefix + session
+	return utils.GetRedisCLi().Get(context.Background(), redisKey).Result()
+}
+
+// DelCsrfToken 删除会话对应的 CSRF token，登出时用
+func DelCsrfToken(session string) error {
+	redisKey := constant.CsrfKeyPrefix + session
+	return utils.GetRedisCLi().Del(context.Background(), redisKey).Err()
+}
+
+// AcquireVerifyEmailQuota 申请发送一次验证邮件：冷却期内或当天次数用尽时返回 false
+func AcquireVerifyEmailQuota(userName string, cooldown time.Duration, maxPerDay int) (bool, error) {
+	ctx := context.Background()
+	cli := utils.GetRedisCLi()
+	if cooldown > 0 {
+		ok, err := cli.SetNX(ctx, constant.VerifyResendKey+userName, 1, cooldown).Result()
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	countKey := constant.VerifyCountKey + userName + "_" + time.Now().Format("20060102")
+	count, err := cli.Incr(ctx, countKey).Result()
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		cli.Expire(ctx, countKey, 24*time.Hour)
 	}
+	return count <= int64(maxPerDay), nil
+}
+
+// otpAttemptScript 校验次数加一并取出验证码摘要，验证码不存在时返回 nil，避免 HINCRBY 创建没有过期时间的 key
+var otpAttemptScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return nil
+end
+local n = redis.call("HINCRBY", KEYS[1], "n", 1)
+return {n, redis.call("HGET", KEYS[1], "h")}
+`)
+
+// AcquireOtpCooldown 申请发送一次验证码，冷却期内返回 false
+func AcquireOtpCooldown(target string, cooldown time.Duration) (bool, error) {
+	if cooldown <= 0 {
+		return true, nil
+	}
+	return utils.GetRedisCLi().SetNX(context.Background(), constant.OtpCooldownKey+target, 1, cooldown).Result()
+}
+
+// SetOtpCode 保存验证码摘要并重置校验次数，新验证码覆盖旧验证码
+func SetOtpCode(target, codeHash string, ttl time.Duration) error {
+	ctx := context.Background()
+	key := constant.OtpKeyPrefix + target
+	_, err := utils.GetRedisCLi().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "h", codeHash, "n", 0)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
 	return err
 }
+
+// IncrOtpAttempt 记录一次校验并返回累计次数和验证码摘要，验证码不存在或已过期时返回 redis.Nil
+func IncrOtpAttempt(target string) (int, string, error) {
+	res, err := otpAttemptScript.Run(context.Background(), utils.GetRedisCLi(), []string{constant.OtpKeyPrefix + target}).Slice()
+	if err != nil {
+		return 0, "", err
+	}
+	attempts, _ := res[0].(int64)
+	codeHash, _ := res[1].(string)
+	return int(attempts), codeHash, nil
+}
+
+// DelOtpCode 删除验证码，校验成功或次数用尽后调用
+func DelOtpCode(target string) error {
+	return utils.GetRedisCLi().Del(context.Background(), constant.OtpKeyPrefix+target).Err()
+}
+
+// SetOidcState 保存第三方登录跳转时生成的 state 及其关联数据
+func SetOidcState(state string, data interface{}, ttl time.Duration) error {
+	return setJSON(constant.OidcStateKey+state, data, ttl)
+}
+
+// TakeOidcState 取出并删除 state，每个 state 只能使用一次
+func TakeOidcState(state string, out interface{}) error {
+	return takeJSON(constant.OidcStateKey+state, out)
+}
+
+// lockScript 未被占用时加锁，已由 token 持有时续期，被其他持有者占用时返回 0
+var lockScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if not v then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// unlockScript 只释放 token 自己持有的锁
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock 获取或续期锁，token 区分持有者，ttl 内未续期时锁自动释放
+func AcquireLock(key, token string, ttl time.Duration) (bool, error) {
+	n, err := lockScript.Run(context.Background(), utils.GetRedisCLi(), []string{key}, token, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// ReleaseLock 释放 token 持有的锁
+func ReleaseLock(key, token string) error {
+	return unlockScript.Run(context.Background(), utils.GetRedisCLi(), []string{key}, token).Err()
+}
+
+// UserSessionTTLs 查询用户仍然有效的会话及剩余有效期
+func UserSessionTTLs(userName string) (map[string]time.Duration, error) {
+	ctx := context.Background()
+	sessions, err := utils.GetRedisCLi().SMembers(ctx, constant.UserSessionsKey+userName).Result()
+	if err != nil {
+		return nil, err
+	}
+	ttls := make(map[string]time.Duration, len(sessions))
+	for _, s := range sessions {
+		ttl, err := utils.GetRedisCLi().PTTL(ctx, constant.SessionKeyPrefix+s).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			ttls[s] = ttl
+		}
+	}
+	return ttls, nil
+}
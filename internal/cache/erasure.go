@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+const scanCount = 500 // SCAN 每次返回的大约条数
+
+// EscapePattern 转义 SCAN MATCH 中的通配符，用户名、邮箱等按字面匹配
+func EscapePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
+
+// DelKeysByPattern 删除匹配 pattern 的全部 key，返回删除的个数。使用 SCAN 遍历，不会阻塞 redis
+func DelKeysByPattern(pattern string) (int64, error) {
+	ctx := context.Background()
+	cli := utils.GetRedisCLi()
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := cli.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) > 0 {
+			n, err := cli.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
+// DelUserOAuthRefresh 撤销用户的全部 refresh token，key 中只有令牌摘要，需要读取内容判断所属用户
+func DelUserOAuthRefresh(userID int) (int64, error) {
+	ctx := context.Background()
+	cli := utils.GetRedisCLi()
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := cli.Scan(ctx, cursor, constant.OAuthRefreshKey+"*", scanCount).Result()
+		if err != nil {
+			return deleted, err
+		}
+		for _, key := range keys {
+			val, err := cli.Get(ctx, key).Result()
+			if err != nil {
+				continue // 已过期或被使用
+			}
+			var data struct {
+				UserID int `json:"uid"`
+			}
+			if json.Unmarshal([]byte(val), &data) != nil || data.UserID != userID {
+				continue
+			}
+			n, err := cli.Del(ctx, key).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// SetOAuthCode 保存授权码关联的授权信息
+func SetOAuthCode(codeHash string, data interface{}, ttl time.Duration) error {
+	return setJSON(constant.OAuthCodeKey+codeHash, data, ttl)
+}
+
+// TakeOAuthCode 取出并删除授权码，每个授权码只能使用一次
+func TakeOAuthCode(codeHash string, out interface{}) error {
+	return takeJSON(constant.OAuthCodeKey+codeHash, out)
+}
+
+// SetOAuthRefresh 保存 refresh token 关联的授权信息
+func SetOAuthRefresh(tokenHash string, data interface{}, ttl time.Duration) error {
+	return setJSON(constant.OAuthRefreshKey+tokenHash, data, ttl)
+}
+
+// GetOAuthRefresh 查询 refresh token，用于令牌内省
+func GetOAuthRefresh(tokenHash string, out interface{}) error {
+	val, err := utils.GetRedisCLi().Get(context.Background(), constant.OAuthRefreshKey+tokenHash).Result()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), out)
+}
+
+// TakeOAuthRefresh 取出并删除 refresh token，刷新时换发新令牌
+func TakeOAuthRefresh(tokenHash string, out interface{}) error {
+	return takeJSON(constant.OAuthRefreshKey+tokenHash, out)
+}
+
+// DelOAuthRefresh 撤销 refresh token
+func DelOAuthRefresh(tokenHash string) error {
+	return utils.GetRedisCLi().Del(context.Background(), constant.OAuthRefreshKey+tokenHash).Err()
+}
+
+// RevokeAccessToken 记录撤销的 access token，保留到令牌过期
+func RevokeAccessToken(jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	return utils.GetRedisCLi().Set(context.Background(), constant.OAuthRevokedKey+jti, 1, ttl).Err()
+}
+
+// IsAccessTokenRevoked access token 是否已撤销
+func IsAccessTokenRevoked(jti string) (bool, error) {
+	n, err := utils.GetRedisCLi().Exists(context.Background(), constant.OAuthRevokedKey+jti).Result()
+	return n > 0, err
+}
+
+func setJSON(key string, data interface{}, ttl time.Duration) error {
+	val, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return utils.GetRedisCLi().Set(context.Background(), key, val, ttl).Err()
+}
+
+func takeJSON(key string, out interface{}) error {
+	val, err := utils.GetRedisCLi().GetDel(context.Background(), key).Result()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), out)
+}
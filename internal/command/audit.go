@@ -0,0 +1,64 @@
+package command
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/utils"
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func init() {
+	Register(&Command{
+		Name:  "audit verify",
+		Usage: "校验审计日志哈希链，发现删改时返回非 0",
+		Run:   runAuditVerify,
+	})
+}
+
+// runAuditVerify 校验审计日志哈希链。记录末尾被整体删除时链本身仍然完整，
+// 可以保存上次输出的最后一条记录，通过 -last-id、-last-hash 确认它仍在且未被修改
+func runAuditVerify(args []string) error {
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	batch := fs.Int("batch", 1000, "每次读取的记录数")
+	lastID := fs.Int64("last-id", 0, "上次校验时最后一条记录的 id")
+	lastHash := fs.String("last-hash", "", "上次校验时最后一条记录的哈希")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("batch must be >= 1")
+	}
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Startup.Timeout)*time.Second)
+	err = utils.PingDB(ctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer utils.CloseDB()
+
+	report, err := audit.Verify(context.Background(), *batch, conf.Audit.HmacKey, *lastID, *lastHash)
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("checked %d records, last id=%d hash=%s\n", report.Count, report.LastID, report.LastHash)
+	if report.Redacted > 0 {
+		fmt.Printf("%d records pseudonymized by erasure, %d of them written before hash version 2 and only checked for chain continuity\n",
+			report.Redacted, report.Unverifiable)
+	}
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("audit log has been tampered with, %d problems found", len(report.Problems))
+	}
+	fmt.Println("# audit log ok")
+	return nil
+}
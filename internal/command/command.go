@@ -0,0 +1,52 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Command 命令行子命令，如 gous config validate
+type Command struct {
+	Name  string                    // 子命令名，多级用空格分隔
+	Usage string                    // 简要说明
+	Run   func(args []string) error // 执行函数，args 为子命令名之后的参数
+}
+
+var commands []*Command // 已注册的子命令
+
+// Register 注册子命令
+func Register(c *Command) {
+	commands = append(commands, c)
+}
+
+// Run 根据参数匹配并执行子命令，返回进程退出码
+func Run(args []string) int {
+	var matched *Command
+	for _, c := range commands {
+		names := strings.Fields(c.Name)
+		if len(args) >= len(names) && strings.Join(args[:len(names)], " ") == c.Name {
+			if matched == nil || len(names) > len(strings.Fields(matched.Name)) {
+				matched = c
+			}
+		}
+	}
+	if matched == nil {
+		usage()
+		return 2
+	}
+	if err := matched.Run(args[len(strings.Fields(matched.Name)):]); err != nil {
+		fmt.Fprintf(os.Stderr, "gous %s: %v\n", matched.Name, err)
+		return 1
+	}
+	return 0
+}
+
+// usage 打印所有子命令说明
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gous [--config path] [command]")
+	fmt.Fprintln(os.Stderr, "\nwithout command, start the http server\n\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", c.Name, c.Usage)
+	}
+}
@@ -0,0 +1,33 @@
+package command
+
+import (
+	"Gous/config"
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	Register(&Command{
+		Name:  "config validate",
+		Usage: "校验配置并打印合并后的有效配置（密钥已脱敏）",
+		Run:   runConfigValidate,
+	})
+}
+
+// runConfigValidate 打印合并了默认值、配置文件、环境变量和密钥文件后的配置，并输出校验结果
+func runConfigValidate(args []string) error {
+	conf, err := config.LoadConfig()
+	if _, ok := err.(*config.ValidationError); err != nil && !ok {
+		return err // 配置读取失败，没有可打印的配置
+	}
+	out, mErr := yaml.Marshal(conf.Masked())
+	if mErr != nil {
+		return mErr
+	}
+	fmt.Print(string(out))
+	if err != nil {
+		return err
+	}
+	fmt.Println("# config ok")
+	return nil
+}
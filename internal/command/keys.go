@@ -0,0 +1,223 @@
+package command
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/fieldcrypt"
+	"Gous/internal/utils"
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func init() {
+	Register(&Command{
+		Name:  "keys rotate",
+		Usage: "轮换字段加密密钥，在线按批重新加密用户数据",
+		Run:   runKeysRotate,
+	})
+	Register(&Command{
+		Name:  "keys migrate",
+		Usage: "把 t_user.age 改为字符串类型以保存密文，开启字段加密前执行一次",
+		Run:   runKeysMigrate,
+	})
+}
+
+// runKeysMigrate 修改 t_user.age 的类型。自动迁移不会修改已有的 age 列，大表上会锁表重建，建议在低峰期执行
+func runKeysMigrate(args []string) error {
+	fs := flag.NewFlagSet("keys migrate", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Startup.Timeout)*time.Second)
+	err = utils.PingDB(ctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer utils.CloseDB()
+	if conf.DbConfig.AutoMigrate {
+		if err := dao.Migrate(); err != nil {
+			return err
+		}
+	}
+
+	changed, err := dao.MigrateUserAge()
+	if err != nil {
+		return err
+	}
+	if changed {
+		fmt.Println("t_user.age changed to varchar(128)")
+	} else {
+		fmt.Println("t_user.age is already a string column")
+	}
+	return nil
+}
+
+const rotatePasses = 3 // 重新加密时被并发修改的记录最多重试的轮数
+
+// runKeysRotate 轮换字段加密密钥：用当前主密钥重新加密全部数据密钥，生成新的数据密钥，
+// 再按 id 分批用新密钥重新加密用户数据并补齐盲索引。
+// 更换主密钥时把新主密钥放在 encryption.master_keys 最前面后执行，完成后可以移除旧主密钥；
+// 关闭 encryption 后执行会把已加密的数据还原为明文
+func runKeysRotate(args []string) error {
+	fs := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	batch := fs.Int("batch", 500, "每批处理的用户数")
+	pause := fs.Duration("pause", 100*time.Millisecond, "每批之间的间隔，降低对线上数据库的压力")
+	noNewKey := fs.Bool("no-new-key", false, "不生成新的数据密钥，只加密尚未加密的数据、补齐盲索引")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("batch must be >= 1")
+	}
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Startup.Timeout)*time.Second)
+	err = utils.PingDB(ctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer utils.CloseDB()
+	if conf.DbConfig.AutoMigrate {
+		if err := dao.Migrate(); err != nil {
+			return err
+		}
+	}
+
+	if conf.Encryption.MasterKeys != "" {
+		n, err := fieldcrypt.RewrapKeys()
+		if err != nil {
+			return fmt.Errorf("rewrap data keys: %w", err)
+		}
+		fmt.Printf("rewrapped %d data keys with the current master key\n", n)
+	}
+	active := 0
+	if conf.Encryption.Enabled {
+		if err := dao.CheckUserAgeColumn(); err != nil {
+			return err
+		}
+		if !*noNewKey {
+			if active, err = fieldcrypt.NewDataKey(); err != nil {
+				return fmt.Errorf("create data key: %w", err)
+			}
+			// 运行中的实例在刷新前仍使用旧密钥写入，等它们切换后再开始，避免遗漏
+			fmt.Printf("created data key %d, waiting %s for running instances to switch\n", active, fieldcrypt.RefreshInterval)
+			time.Sleep(fieldcrypt.RefreshInterval)
+		}
+		if active, err = fieldcrypt.ActiveKeyID(); err != nil {
+			return err
+		}
+	}
+
+	var scanned, updated int
+	for pass := 1; ; pass++ {
+		conflicts := 0
+		for after := 0; ; {
+			rows, err := dao.FindEncryptedUserRows(after, *batch)
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				after = row.ID
+				columns, err := rotateUserRow(row, active)
+				if err != nil {
+					return fmt.Errorf("user %d: %w", row.ID, err)
+				}
+				if pass == 1 {
+					scanned++
+				}
+				if len(columns) == 0 {
+					continue
+				}
+				ok, err := dao.UpdateEncryptedUserRow(row, columns)
+				if err != nil {
+					return err
+				}
+				if ok {
+					updated++
+				} else {
+					conflicts++
+				}
+			}
+			if len(rows) < *batch {
+				break
+			}
+			time.Sleep(*pause)
+		}
+		if conflicts == 0 {
+			break
+		}
+		if pass >= rotatePasses {
+			return fmt.Errorf("%d users were modified during rotation, run again", conflicts)
+		}
+		fmt.Printf("pass %d: %d users were modified concurrently, retrying\n", pass, conflicts)
+	}
+	fmt.Printf("scanned %d users, rewrote %d\n", scanned, updated)
+	if active > 0 {
+		fmt.Printf("# all users encrypted with data key %d\n", active)
+	} else {
+		fmt.Println("# encryption disabled, all users stored in plaintext")
+	}
+	return nil
+}
+
+// rotateUserRow 计算需要重写的字段：开启加密时重新加密未加密或不是用 active 加密的值，
+// 关闭加密时还原为明文，盲索引与当前值不一致时一并更新
+func rotateUserRow(row *dao.EncryptedUserRow, active int) (map[string]interface{}, error) {
+	fields := []struct {
+		column string
+		value  *string
+		bidx   string
+		index  *string
+	}{
+		{"nickname", row.NickName, "", nil},
+		{"age", row.Age, "", nil},
+		{"email", row.Email, "email_bidx", row.EmailIndex},
+		{"phone", row.Phone, "phone_bidx", row.PhoneIndex},
+	}
+	columns := map[string]interface{}{}
+	for _, f := range fields {
+		if f.value == nil {
+			if f.index != nil {
+				columns[f.bidx] = nil
+			}
+			continue
+		}
+		column := "t_user." + f.column
+		plain, err := fieldcrypt.Decrypt(column, *f.value)
+		if err != nil {
+			return nil, err
+		}
+		id, encrypted := fieldcrypt.KeyID(*f.value)
+		if plain != "" && (active > 0 && (!encrypted || id != active) || active == 0 && encrypted) {
+			if columns[f.column], err = fieldcrypt.Encrypt(column, plain); err != nil {
+				return nil, err
+			}
+		}
+		if f.bidx == "" {
+			continue
+		}
+		idx, err := fieldcrypt.BlindIndex(column, plain)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case idx == "" && f.index != nil:
+			columns[f.bidx] = nil
+		case idx != "" && (f.index == nil || *f.index != idx):
+			columns[f.bidx] = idx
+		}
+	}
+	return columns, nil
+}
@@ -0,0 +1,356 @@
+package command
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/service"
+	"Gous/internal/userfile"
+	"Gous/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&Command{
+		Name:  "users import",
+		Usage: "从 CSV 或 JSON Lines 文件批量导入用户，支持只校验、更新已存在的用户和断点续传",
+		Run:   runUsersImport,
+	})
+	Register(&Command{
+		Name:  "users export",
+		Usage: "导出全部用户到 CSV 或 JSON Lines 文件，不包含密码",
+		Run:   runUsersExport,
+	})
+}
+
+// importProgress 导入进度，每批写入后保存，中断后从 Offset 继续
+type importProgress struct {
+	File    string         `json:"file"`
+	Size    int64          `json:"size"`
+	ModTime time.Time      `json:"mod_time"`
+	Mode    string         `json:"mode"`
+	Offset  int64          `json:"offset"`
+	Stats   map[string]int `json:"stats"`
+}
+
+var importResults = []string{
+	service.ImportCreated, service.ImportUpdated, service.ImportUnchanged,
+	service.ImportSkipped, service.ImportInvalid, service.ImportFailed,
+}
+
+// runUsersImport 按批读取文件导入用户，新用户每批在一个事务中写入。
+// 每批完成后把读取位置写入进度文件，中断后再次执行同样的命令从上次的位置继续，
+// 文件有变化时需要加 -restart 从头导入；-dry-run 只校验并输出结果，不写入数据库也不记录进度
+func runUsersImport(args []string) error {
+	fs := flag.NewFlagSet("users import", flag.ContinueOnError)
+	file := fs.String("file", "", "导入的文件")
+	format := fs.String("format", "", "文件格式 csv 或 jsonl，默认按扩展名判断")
+	mapping := fs.String("map", "", "字段与文件列名的映射，如 name=login,email=mail，字段: "+strings.Join(service.UserImportFields, ","))
+	batch := fs.Int("batch", 500, "每批写入的用户数")
+	mode := fs.String("mode", service.ImportSkip, "用户名已存在时跳过(skip)或按文件中非空的字段更新(upsert)")
+	dryRun := fs.Bool("dry-run", false, "只校验，输出每行的导入结果，不写入")
+	report := fs.String("report", "", "把每行的导入结果以 JSON Lines 格式写入该文件")
+	progressFile := fs.String("progress", "", "进度文件，默认为 <file>.progress")
+	restart := fs.Bool("restart", false, "忽略已有的进度，从头导入")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	if *batch < 1 {
+		return fmt.Errorf("batch must be >= 1")
+	}
+	fileFormat, err := userfile.Format(*file, *format)
+	if err != nil {
+		return err
+	}
+	m, err := userfile.ParseMapping(*mapping, service.UserImportFields)
+	if err != nil {
+		return err
+	}
+	importer, err := service.NewUserImporter(*mode, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	absFile, err := filepath.Abs(*file)
+	if err != nil {
+		return err
+	}
+	if *progressFile == "" {
+		*progressFile = *file + ".progress"
+	}
+	progress := &importProgress{File: absFile, Size: info.Size(), ModTime: info.ModTime(), Mode: *mode, Stats: map[string]int{}}
+	if !*dryRun {
+		if *restart {
+			if err := os.Remove(*progressFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else if saved, err := loadImportProgress(*progressFile); err != nil {
+			return err
+		} else if saved != nil {
+			if saved.File != progress.File || saved.Size != progress.Size || !saved.ModTime.Equal(progress.ModTime) || saved.Mode != progress.Mode {
+				return fmt.Errorf("%s was saved for a different file or mode, use -restart to import from the beginning", *progressFile)
+			}
+			progress = saved
+			fmt.Printf("resuming from byte %d of %d\n", progress.Offset, progress.Size)
+		}
+	}
+
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Startup.Timeout)*time.Second)
+	err = utils.PingDB(ctx)
+	if err == nil {
+		// 缓存只用于更新用户后清理，不可用时仍然导入
+		if rerr := utils.PingRedis(ctx); rerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: redis unavailable, user cache will not be invalidated: %v\n", rerr)
+		}
+	}
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer utils.CloseDB()
+	if conf.DbConfig.AutoMigrate && !*dryRun {
+		if err := dao.Migrate(); err != nil {
+			return err
+		}
+	}
+
+	r, err := userfile.NewReader(f, fileFormat, progress.Offset)
+	if err != nil {
+		return err
+	}
+	if columns := r.Columns(); columns != nil {
+		if !utils.Contains(columns, m.Column("name")) {
+			return fmt.Errorf("column %s for name not found in %s", m.Column("name"), *file)
+		}
+		if unknown := userfile.UnknownColumns(columns, service.UserImportFields, m); len(unknown) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: ignoring unknown columns: %s\n", strings.Join(unknown, ","))
+		}
+	}
+
+	var reportOut *json.Encoder
+	if *report != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if progress.Offset > 0 {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		rf, err := os.OpenFile(*report, flags, 0600)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		reportOut = json.NewEncoder(rf)
+	}
+
+	ctx = context.Background()
+	offset := progress.Offset
+	for eof := false; !eof; {
+		rows := make([]*service.ImportRow, 0, *batch)
+		for len(rows) < *batch {
+			rec, err := r.Read()
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read %s after byte %d: %w", *file, offset, err)
+			}
+			offset = rec.Offset
+			rows = append(rows, importRow(rec, m))
+		}
+		if len(rows) == 0 {
+			break
+		}
+		results, err := importer.Import(ctx, rows)
+		if err != nil {
+			return fmt.Errorf("import lines %d-%d: %w", rows[0].Line, rows[len(rows)-1].Line, err)
+		}
+		for _, res := range results {
+			progress.Stats[res.Result]++
+			if res.Error != "" {
+				fmt.Fprintf(os.Stderr, "line %d %s %s: %s\n", res.Line, res.Name, res.Result, res.Error)
+			}
+			if reportOut != nil {
+				if err := reportOut.Encode(res); err != nil {
+					return err
+				}
+			}
+		}
+		if *dryRun {
+			continue
+		}
+		progress.Offset = offset
+		if err := saveImportProgress(*progressFile, progress); err != nil {
+			return err
+		}
+		fmt.Printf("imported up to line %d (%d/%d bytes)\n", rows[len(rows)-1].Line, offset, progress.Size)
+	}
+
+	if !*dryRun {
+		if err := os.Remove(*progressFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	var summary []string
+	for _, result := range importResults {
+		summary = append(summary, fmt.Sprintf("%s=%d", result, progress.Stats[result]))
+	}
+	if *dryRun {
+		fmt.Printf("# dry run, nothing written: %s\n", strings.Join(summary, " "))
+	} else {
+		fmt.Printf("# import finished: %s\n", strings.Join(summary, " "))
+	}
+	if n := progress.Stats[service.ImportInvalid] + progress.Stats[service.ImportFailed]; n > 0 {
+		return fmt.Errorf("%d rows were not imported", n)
+	}
+	return nil
+}
+
+// importRow 按映射把文件的列转换为导入字段
+func importRow(rec *userfile.Record, m userfile.Mapping) *service.ImportRow {
+	row := &service.ImportRow{Line: rec.Line, Err: rec.Err, Values: map[string]string{}}
+	for _, field := range service.UserImportFields {
+		if v, ok := rec.Values[m.Column(field)]; ok {
+			row.Values[field] = v
+		}
+	}
+	return row
+}
+
+// loadImportProgress 读取进度文件，不存在时返回 nil
+func loadImportProgress(path string) (*importProgress, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &importProgress{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if p.Stats == nil {
+		p.Stats = map[string]int{}
+	}
+	return p, nil
+}
+
+// saveImportProgress 先写临时文件再重命名，中断时不会留下不完整的进度文件
+func saveImportProgress(path string, p *importProgress) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runUsersExport 按 id 顺序分批导出全部用户，-file 为 - 时输出到标准输出
+func runUsersExport(args []string) error {
+	fs := flag.NewFlagSet("users export", flag.ContinueOnError)
+	file := fs.String("file", "-", "导出的文件，- 表示标准输出")
+	format := fs.String("format", "", "文件格式 csv 或 jsonl，默认按扩展名判断，标准输出默认 csv")
+	fields := fs.String("fields", strings.Join(service.UserExportFields, ","), "导出的字段及顺序")
+	mapping := fs.String("map", "", "字段与文件列名的映射，如 name=login,email=mail")
+	batch := fs.Int("batch", 500, "每批读取的用户数")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("batch must be >= 1")
+	}
+	if *file == "-" && *format == "" {
+		*format = userfile.FormatCSV
+	}
+	fileFormat, err := userfile.Format(*file, *format)
+	if err != nil {
+		return err
+	}
+	var exportFields []string
+	for _, field := range strings.Split(*fields, ",") {
+		field = strings.TrimSpace(field)
+		if !utils.Contains(service.UserExportFields, field) {
+			return fmt.Errorf("unknown field %s, supported: %s", field, strings.Join(service.UserExportFields, ","))
+		}
+		exportFields = append(exportFields, field)
+	}
+	m, err := userfile.ParseMapping(*mapping, service.UserExportFields)
+	if err != nil {
+		return err
+	}
+	columns := make([]string, len(exportFields))
+	for i, field := range exportFields {
+		columns[i] = m.Column(field)
+	}
+
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Startup.Timeout)*time.Second)
+	err = utils.PingDB(ctx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer utils.CloseDB()
+
+	out, status := os.Stdout, os.Stdout
+	if *file != "-" {
+		// 导出的文件包含个人信息，只允许当前用户读取
+		f, err := os.OpenFile(*file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	} else {
+		status = os.Stderr
+	}
+	w, err := userfile.NewWriter(out, fileFormat, columns)
+	if err != nil {
+		return err
+	}
+	n, err := service.ExportUsers(context.Background(), *batch, exportFields, func(values map[string]interface{}) error {
+		row := make(map[string]interface{}, len(exportFields))
+		for i, field := range exportFields {
+			row[columns[i]] = values[field]
+		}
+		return w.Write(row)
+	})
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "# exported %d users\n", n)
+	return nil
+}
@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AppendAuditLog 在事务中锁定最后一条审计日志，由 seal 根据它填写 ID 和哈希后写入。
+// 多个实例同时写入时由行锁串行化，last 为 nil 表示第一条
+func AppendAuditLog(entry *model.AuditLog, seal func(last *model.AuditLog)) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		last := &model.AuditLog{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id desc").First(last).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			last = nil
+		} else if err != nil {
+			return err
+		}
+		seal(last)
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		log.Errorf("AppendAuditLog failed: %v", err)
+		return fmt.Errorf("AppendAuditLog fail: %v", err)
+	}
+	return nil
+}
+
+// FindAuditLogs 按条件分页查询审计日志，按时间倒序，返回当前页和总数
+func FindAuditLogs(where string, args []interface{}, offset, limit int) ([]*model.AuditLog, int64, error) {
+	db := utils.GetDB().Model(model.AuditLog{})
+	if where != "" {
+		db = db.Where(where, args...)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("FindAuditLogs failed: %v", err)
+		return nil, 0, fmt.Errorf("FindAuditLogs failed: %v", err)
+	}
+	var logs []*model.AuditLog
+	if err := db.Order("id desc").Offset(offset).Limit(limit).Find(&logs).Error; err != nil {
+		log.Errorf("FindAuditLogs failed: %v", err)
+		return nil, 0, fmt.Errorf("FindAuditLogs failed: %v", err)
+	}
+	return logs, total, nil
+}
+
+// ScanAuditLogs 按 ID 顺序读取 afterID 之后的至多 limit 条审计日志，用于校验哈希链
+func ScanAuditLogs(afterID int64, limit int) ([]*model.AuditLog, error) {
+	var logs []*model.AuditLog
+	if err := utils.GetDB().Where("id > ?", afterID).Order("id").Limit(limit).Find(&logs).Error; err != nil {
+		log.Errorf("ScanAuditLogs failed: %v", err)
+		return nil, fmt.Errorf("ScanAuditLogs failed: %v", err)
+	}
+	return logs, nil
+}
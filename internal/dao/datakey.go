@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"Gous/internal/fieldcrypt"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func init() {
+	fieldcrypt.SetStore(dataKeyStore{})
+}
+
+// dataKeyStore 数据密钥保存在 t_data_key 中
+type dataKeyStore struct{}
+
+func (dataKeyStore) ListDataKeys() ([]*model.DataKey, error) {
+	var list []*model.DataKey
+	if err := utils.GetDB().Order("id").Find(&list).Error; err != nil {
+		log.Errorf("ListDataKeys failed: %v", err)
+		return nil, fmt.Errorf("ListDataKeys failed: %v", err)
+	}
+	return list, nil
+}
+
+func (dataKeyStore) CreateDataKey(k *model.DataKey, retire bool) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if retire {
+			err := tx.Model(&model.DataKey{}).Where("purpose=? AND status=?", k.Purpose, fieldcrypt.KeyActive).
+				Update("status", fieldcrypt.KeyRetired).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Create(k).Error
+	})
+	if err != nil {
+		log.Errorf("CreateDataKey failed: %v", err)
+		return fmt.Errorf("CreateDataKey failed: %v", err)
+	}
+	return nil
+}
+
+func (dataKeyStore) RewrapDataKey(k *model.DataKey, masterKeyID, wrapped string) (bool, error) {
+	res := utils.GetDB().Model(&model.DataKey{}).Where("id=? AND wrapped_key=?", k.ID, k.WrappedKey).
+		Updates(map[string]interface{}{"master_key_id": masterKeyID, "wrapped_key": wrapped})
+	if res.Error != nil {
+		log.Errorf("RewrapDataKey failed: %v", res.Error)
+		return false, fmt.Errorf("RewrapDataKey failed: %v", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
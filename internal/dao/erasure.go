@@ -0,0 +1,182 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 清除任务状态
+const (
+	ErasurePending = "pending"
+	ErasureDone    = "done"
+	ErasureFailed  = "failed" // 超过最多执行次数，需要手动重试
+)
+
+// EraseUser 删除用户并创建清除其余个人数据的任务，events 在同一事务中写入，
+// 用户删除后一定有任务负责清除剩余数据
+func EraseUser(user *model.User, req *model.ErasureRequest, events ...UserEvent) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := deleteUser(tx, user, events); err != nil {
+			return err
+		}
+		return tx.Create(req).Error
+	})
+	if err != nil {
+		log.Errorf("EraseUser failed: %v", err)
+		return fmt.Errorf("EraseUser fail: %v", err)
+	}
+	return nil
+}
+
+// GetErasureRequest 根据 id 查询清除任务，不存在时返回 nil
+func GetErasureRequest(id int) (*model.ErasureRequest, error) {
+	r := &model.ErasureRequest{}
+	err := utils.GetDB().Model(model.ErasureRequest{}).Where("id=?", id).First(r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetErasureRequest failed: %v", err)
+		return nil, fmt.Errorf("GetErasureRequest failed: %v", err)
+	}
+	return r, nil
+}
+
+// FindErasureRequests 分页查询清除任务，按时间倒序，返回当前页和总数
+func FindErasureRequests(status string, offset, limit int) ([]*model.ErasureRequest, int64, error) {
+	db := utils.GetDB().Model(model.ErasureRequest{})
+	if status != "" {
+		db = db.Where("status=?", status)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("FindErasureRequests failed: %v", err)
+		return nil, 0, fmt.Errorf("FindErasureRequests failed: %v", err)
+	}
+	var list []*model.ErasureRequest
+	if err := db.Order("id desc").Offset(offset).Limit(limit).Find(&list).Error; err != nil {
+		log.Errorf("FindErasureRequests failed: %v", err)
+		return nil, 0, fmt.Errorf("FindErasureRequests failed: %v", err)
+	}
+	return list, total, nil
+}
+
+// DueErasureRequests 查询到了执行时间的任务
+func DueErasureRequests(now time.Time, limit int) ([]*model.ErasureRequest, error) {
+	var list []*model.ErasureRequest
+	err := utils.GetDB().Where("status=? AND next_attempt_at<=?", ErasurePending, now).
+		Order("next_attempt_at").Limit(limit).Find(&list).Error
+	if err != nil {
+		log.Errorf("DueErasureRequests failed: %v", err)
+		return nil, fmt.Errorf("DueErasureRequests failed: %v", err)
+	}
+	return list, nil
+}
+
+// ClaimErasureRequest 把下次执行时间推迟到 lease，抢占成功才由当前实例执行；
+// 执行过程中实例退出时，其他实例在 lease 之后重新执行
+func ClaimErasureRequest(r *model.ErasureRequest, lease time.Time) (bool, error) {
+	res := utils.GetDB().Model(model.ErasureRequest{}).
+		Where("id=? AND status=? AND next_attempt_at=?", r.ID, ErasurePending, r.NextAttemptAt).
+		Update("next_attempt_at", lease)
+	if res.Error != nil {
+		log.Errorf("ClaimErasureRequest failed: %v", res.Error)
+		return false, fmt.Errorf("ClaimErasureRequest fail: %v", res.Error)
+	}
+	if res.RowsAffected == 1 {
+		r.NextAttemptAt = lease
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// UpdateErasureRequest 按 id 更新清除任务的字段
+func UpdateErasureRequest(id int, columns map[string]interface{}) error {
+	if err := utils.GetDB().Model(model.ErasureRequest{}).Where("id=?", id).Updates(columns).Error; err != nil {
+		log.Errorf("UpdateErasureRequest failed: %v", err)
+		return fmt.Errorf("UpdateErasureRequest fail: %v", err)
+	}
+	return nil
+}
+
+// DeleteUserRows 删除 m 对应的表中属于该用户（user_id 列）的全部记录，返回删除的条数
+func DeleteUserRows(m interface{}, userID int) (int64, error) {
+	res := utils.GetDB().Where("user_id=?", userID).Delete(m)
+	if res.Error != nil {
+		log.Errorf("DeleteUserRows failed: %v", res.Error)
+		return 0, fmt.Errorf("DeleteUserRows fail: %v", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// DeleteUserWebhookDeliveries 删除用户事件的投递记录及其尝试记录，返回删除的条数和仍在投递中的条数；
+// 投递中的记录保留到投递结束，订阅方需要收到用户删除事件
+func DeleteUserWebhookDeliveries(userID int) (int64, int64, error) {
+	// 事件数据的第一个字段是用户 id，见 service.userEventData
+	db := utils.GetDB().Model(model.WebhookDelivery{}).
+		Where("event_type LIKE ? AND payload LIKE ?", "user.%", fmt.Sprintf(`%%"data":{"id":%d,%%`, userID))
+	var pending int64
+	if err := db.Session(&gorm.Session{}).Where("status=?", WebhookPending).Count(&pending).Error; err != nil {
+		log.Errorf("DeleteUserWebhookDeliveries failed: %v", err)
+		return 0, 0, fmt.Errorf("DeleteUserWebhookDeliveries fail: %v", err)
+	}
+	var ids []int64
+	if err := db.Session(&gorm.Session{}).Where("status<>?", WebhookPending).Pluck("id", &ids).Error; err != nil {
+		log.Errorf("DeleteUserWebhookDeliveries failed: %v", err)
+		return 0, 0, fmt.Errorf("DeleteUserWebhookDeliveries fail: %v", err)
+	}
+	if len(ids) == 0 {
+		return 0, pending, nil
+	}
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("delivery_id IN ?", ids).Delete(&model.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&model.WebhookDelivery{}).Error
+	})
+	if err != nil {
+		log.Errorf("DeleteUserWebhookDeliveries failed: %v", err)
+		return 0, 0, fmt.Errorf("DeleteUserWebhookDeliveries fail: %v", err)
+	}
+	return int64(len(ids)), pending, nil
+}
+
+// DeleteUserOutboxEvents 删除用户已发布的领域事件，返回删除的条数和未发布的条数；
+// 未发布的事件保留到发布之后，消费方需要收到用户删除事件
+func DeleteUserOutboxEvents(aggregateID string) (int64, int64, error) {
+	var pending int64
+	err := utils.GetDB().Model(model.OutboxEvent{}).
+		Where("aggregate_id=? AND published_at IS NULL", aggregateID).Count(&pending).Error
+	if err != nil {
+		log.Errorf("DeleteUserOutboxEvents failed: %v", err)
+		return 0, 0, fmt.Errorf("DeleteUserOutboxEvents fail: %v", err)
+	}
+	res := utils.GetDB().Where("aggregate_id=? AND published_at IS NOT NULL", aggregateID).Delete(&model.OutboxEvent{})
+	if res.Error != nil {
+		log.Errorf("DeleteUserOutboxEvents failed: %v", res.Error)
+		return 0, 0, fmt.Errorf("DeleteUserOutboxEvents fail: %v", res.Error)
+	}
+	return res.RowsAffected, pending, nil
+}
+
+// UpdateAuditLogRedaction 保存审计日志假名化后的字段，哈希和哈希链不变
+func UpdateAuditLogRedaction(e *model.AuditLog) error {
+	err := utils.GetDB().Model(model.AuditLog{}).Where("id=?", e.ID).Updates(map[string]interface{}{
+		"actor":      e.Actor,
+		"target":     e.Target,
+		"ip":         e.IP,
+		"user_agent": e.UserAgent,
+		"reason":     e.Reason,
+		"changes":    e.Changes,
+		"redacted":   e.Redacted,
+	}).Error
+	if err != nil {
+		log.Errorf("UpdateAuditLogRedaction failed: %v", err)
+		return fmt.Errorf("UpdateAuditLogRedaction fail: %v", err)
+	}
+	return nil
+}
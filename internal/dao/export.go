@@ -0,0 +1,105 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 导出任务状态
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	ExportExpired = "expired" // 文件已过期删除
+)
+
+// CreateDataExport 创建导出任务
+func CreateDataExport(e *model.DataExport) error {
+	if err := utils.GetDB().Create(e).Error; err != nil {
+		log.Errorf("CreateDataExport failed: %v", err)
+		return fmt.Errorf("CreateDataExport fail: %v", err)
+	}
+	return nil
+}
+
+// GetDataExport 根据 id 查询导出任务，不存在时返回 nil
+func GetDataExport(id int) (*model.DataExport, error) {
+	e := &model.DataExport{}
+	err := utils.GetDB().Model(model.DataExport{}).Where("id=?", id).First(e).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetDataExport failed: %v", err)
+		return nil, fmt.Errorf("GetDataExport failed: %v", err)
+	}
+	return e, nil
+}
+
+// ListDataExports 查询用户最近的导出任务，按时间倒序
+func ListDataExports(userID, limit int) ([]*model.DataExport, error) {
+	var list []*model.DataExport
+	if err := utils.GetDB().Where("user_id=?", userID).Order("id desc").Limit(limit).Find(&list).Error; err != nil {
+		log.Errorf("ListDataExports failed: %v", err)
+		return nil, fmt.Errorf("ListDataExports failed: %v", err)
+	}
+	return list, nil
+}
+
+// PendingDataExports 按创建顺序查询等待执行的任务
+func PendingDataExports(limit int) ([]*model.DataExport, error) {
+	var list []*model.DataExport
+	if err := utils.GetDB().Where("status=?", ExportPending).Order("id").Limit(limit).Find(&list).Error; err != nil {
+		log.Errorf("PendingDataExports failed: %v", err)
+		return nil, fmt.Errorf("PendingDataExports failed: %v", err)
+	}
+	return list, nil
+}
+
+// ClaimDataExport 把任务置为执行中，抢占成功才由当前实例执行
+func ClaimDataExport(id int, now time.Time) (bool, error) {
+	res := utils.GetDB().Model(model.DataExport{}).Where("id=? AND status=?", id, ExportPending).
+		Updates(map[string]interface{}{"status": ExportRunning, "start_time": now})
+	if res.Error != nil {
+		log.Errorf("ClaimDataExport failed: %v", res.Error)
+		return false, fmt.Errorf("ClaimDataExport fail: %v", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// UpdateDataExport 按 id 更新导出任务的字段
+func UpdateDataExport(id int, columns map[string]interface{}) error {
+	if err := utils.GetDB().Model(model.DataExport{}).Where("id=?", id).Updates(columns).Error; err != nil {
+		log.Errorf("UpdateDataExport failed: %v", err)
+		return fmt.Errorf("UpdateDataExport fail: %v", err)
+	}
+	return nil
+}
+
+// ResetStaleDataExports 执行中的实例退出后，把开始时间早于 before 的任务重新置为等待执行
+func ResetStaleDataExports(before time.Time) error {
+	err := utils.GetDB().Model(model.DataExport{}).Where("status=? AND start_time<?", ExportRunning, before).
+		Update("status", ExportPending).Error
+	if err != nil {
+		log.Errorf("ResetStaleDataExports failed: %v", err)
+		return fmt.Errorf("ResetStaleDataExports fail: %v", err)
+	}
+	return nil
+}
+
+// ExpiredDataExports 查询文件已到删除时间的任务
+func ExpiredDataExports(now time.Time, limit int) ([]*model.DataExport, error) {
+	var list []*model.DataExport
+	err := utils.GetDB().Where("status=? AND expire_time<=?", ExportDone, now).Order("id").Limit(limit).Find(&list).Error
+	if err != nil {
+		log.Errorf("ExpiredDataExports failed: %v", err)
+		return nil, fmt.Errorf("ExpiredDataExports failed: %v", err)
+	}
+	return list, nil
+}
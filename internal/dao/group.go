@@ -0,0 +1,158 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// GroupMemberInfo 组成员关系及双方名称，用于展示
+type GroupMemberInfo struct {
+	GroupID     int    `gorm:"column:group_id"`
+	UserID      int    `gorm:"column:user_id"`
+	UserName    string `gorm:"column:user_name"`
+	DisplayName string `gorm:"column:display_name"`
+}
+
+// FindUsers 按条件分页查询用户，返回当前页和总数，where 为空时查询全部
+func FindUsers(where string, args []interface{}, offset, limit int) ([]*model.User, int64, error) {
+	db := utils.GetDB().Model(model.User{})
+	if where != "" {
+		db = db.Where(where, args...)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("FindUsers failed: %v", err)
+		return nil, 0, fmt.Errorf("FindUsers failed: %v", err)
+	}
+	var users []*model.User
+	if limit > 0 {
+		if err := db.Order("id").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+			log.Errorf("FindUsers failed: %v", err)
+			return nil, 0, fmt.Errorf("FindUsers failed: %v", err)
+		}
+	}
+	return users, total, nil
+}
+
+// GetGroup 根据 id 查询组，不存在时返回 nil
+func GetGroup(id int) (*model.Group, error) {
+	group := &model.Group{}
+	err := utils.GetDB().Model(model.Group{}).Where("id=?", id).First(group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetGroup failed: %v", err)
+		return nil, fmt.Errorf("GetGroup failed: %v", err)
+	}
+	return group, nil
+}
+
+// GetGroupByName 根据名称查询组，不存在时返回 nil
+func GetGroupByName(name string) (*model.Group, error) {
+	group := &model.Group{}
+	err := utils.GetDB().Model(model.Group{}).Where("display_name=?", name).First(group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetGroupByName failed: %v", err)
+		return nil, fmt.Errorf("GetGroupByName failed: %v", err)
+	}
+	return group, nil
+}
+
+// FindGroups 按条件分页查询组，返回当前页和总数
+func FindGroups(where string, args []interface{}, offset, limit int) ([]*model.Group, int64, error) {
+	db := utils.GetDB().Model(model.Group{})
+	if where != "" {
+		db = db.Where(where, args...)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("FindGroups failed: %v", err)
+		return nil, 0, fmt.Errorf("FindGroups failed: %v", err)
+	}
+	var groups []*model.Group
+	if limit > 0 {
+		if err := db.Order("id").Offset(offset).Limit(limit).Find(&groups).Error; err != nil {
+			log.Errorf("FindGroups failed: %v", err)
+			return nil, 0, fmt.Errorf("FindGroups failed: %v", err)
+		}
+	}
+	return groups, total, nil
+}
+
+// SaveGroup 创建或更新组，并把成员替换为 userIDs
+func SaveGroup(group *model.Group, userIDs []int) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(group).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id=?", group.ID).Delete(&model.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return nil
+		}
+		members := make([]*model.GroupMember, 0, len(userIDs))
+		for _, uid := range userIDs {
+			members = append(members, &model.GroupMember{GroupID: group.ID, UserID: uid})
+		}
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		log.Errorf("SaveGroup failed: %v", err)
+		return fmt.Errorf("SaveGroup fail: %v", err)
+	}
+	return nil
+}
+
+// DeleteGroup 删除组及其成员关系
+func DeleteGroup(id int) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id=?", id).Delete(&model.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id=?", id).Delete(&model.Group{}).Error
+	})
+	if err != nil {
+		log.Errorf("DeleteGroup failed: %v", err)
+		return fmt.Errorf("DeleteGroup fail: %v", err)
+	}
+	return nil
+}
+
+// ListGroupMembers 查询组的成员，groupIDs 或 userIDs 为 nil 时不按该项过滤
+func ListGroupMembers(groupIDs, userIDs []int) ([]*GroupMemberInfo, error) {
+	db := utils.GetDB().Table("t_group_member m").
+		Select("m.group_id, m.user_id, u.name as user_name, g.display_name").
+		Joins("join t_user u on u.id = m.user_id").
+		Joins("join t_group g on g.id = m.group_id")
+	if groupIDs != nil {
+		db = db.Where("m.group_id in ?", groupIDs)
+	}
+	if userIDs != nil {
+		db = db.Where("m.user_id in ?", userIDs)
+	}
+	var members []*GroupMemberInfo
+	if err := db.Order("m.id").Scan(&members).Error; err != nil {
+		log.Errorf("ListGroupMembers failed: %v", err)
+		return nil, fmt.Errorf("ListGroupMembers failed: %v", err)
+	}
+	return members, nil
+}
+
+// CountUsersByIDs 统计存在的用户数，用于校验组成员
+func CountUsersByIDs(ids []int) (int64, error) {
+	var count int64
+	if err := utils.GetDB().Model(model.User{}).Where("id in ?", ids).Count(&count).Error; err != nil {
+		log.Errorf("CountUsersByIDs failed: %v", err)
+		return 0, fmt.Errorf("CountUsersByIDs failed: %v", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,65 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// GetUserIdentity 根据身份提供方和 subject 查询绑定关系，未绑定时返回 nil
+func GetUserIdentity(provider, subject string) (*model.UserIdentity, error) {
+	identity := &model.UserIdentity{}
+	err := utils.GetDB().Model(model.UserIdentity{}).Where("provider=? and subject=?", provider, subject).First(identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetUserIdentity failed: %v", err)
+		return nil, fmt.Errorf("GetUserIdentity failed: %v", err)
+	}
+	return identity, nil
+}
+
+// CreateUserIdentity 绑定第三方身份
+func CreateUserIdentity(identity *model.UserIdentity) error {
+	if err := utils.GetDB().Create(identity).Error; err != nil {
+		log.Errorf("CreateUserIdentity failed: %v", err)
+		return fmt.Errorf("CreateUserIdentity fail: %v", err)
+	}
+	return nil
+}
+
+// CreateUserWithIdentity 在同一事务中创建用户并绑定第三方身份，用于首次登录自动开户
+func CreateUserWithIdentity(user *model.User, identity *model.UserIdentity, events ...UserEvent) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := setUserIndexes(user); err != nil {
+			return err
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		if err := tx.Create(identity).Error; err != nil {
+			return err
+		}
+		return writeUserEvents(tx, user, events)
+	})
+	if err != nil {
+		log.Errorf("CreateUserWithIdentity failed: %v", err)
+		return fmt.Errorf("CreateUserWithIdentity fail: %v", err)
+	}
+	return nil
+}
+
+// ListUserIdentities 查询用户绑定的全部第三方身份
+func ListUserIdentities(userID int) ([]*model.UserIdentity, error) {
+	var list []*model.UserIdentity
+	if err := utils.GetDB().Where("user_id=?", userID).Order("id").Find(&list).Error; err != nil {
+		log.Errorf("ListUserIdentities failed: %v", err)
+		return nil, fmt.Errorf("ListUserIdentities failed: %v", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateLoginHistory 写入登录记录
+func CreateLoginHistory(h *model.LoginHistory) error {
+	if err := utils.GetDB().Create(h).Error; err != nil {
+		log.Errorf("CreateLoginHistory failed: %v", err)
+		return fmt.Errorf("CreateLoginHistory fail: %v", err)
+	}
+	return nil
+}
+
+// LoginDeviceSeen 查询用户是否从该设备成功登录过，first 表示用户此前没有任何成功登录
+func LoginDeviceSeen(userID int, fingerprint string) (seen, first bool, err error) {
+	var rows []*model.LoginHistory
+	err = utils.GetDB().Model(model.LoginHistory{}).Select("fingerprint").
+		Where("user_id=? AND result=?", userID, constant.AuditSuccess).
+		Group("fingerprint").Find(&rows).Error
+	if err != nil {
+		log.Errorf("LoginDeviceSeen failed: %v", err)
+		return false, false, fmt.Errorf("LoginDeviceSeen failed: %v", err)
+	}
+	for _, r := range rows {
+		if r.Fingerprint == fingerprint {
+			return true, false, nil
+		}
+	}
+	return false, len(rows) == 0, nil
+}
+
+// ListLoginHistory 分页查询用户的登录记录，按时间倒序
+func ListLoginHistory(userID, offset, limit int) ([]*model.LoginHistory, int64, error) {
+	db := utils.GetDB().Model(model.LoginHistory{}).Where("user_id=?", userID)
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("ListLoginHistory failed: %v", err)
+		return nil, 0, fmt.Errorf("ListLoginHistory failed: %v", err)
+	}
+	var list []*model.LoginHistory
+	if err := db.Order("id desc").Offset(offset).Limit(limit).Find(&list).Error; err != nil {
+		log.Errorf("ListLoginHistory failed: %v", err)
+		return nil, 0, fmt.Errorf("ListLoginHistory failed: %v", err)
+	}
+	return list, total, nil
+}
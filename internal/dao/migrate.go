@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// migrateModels 需要自动建表和补齐字段的 model，新增表时在这里注册
+var migrateModels = []interface{}{
+	&model.User{},
+	&model.UserIdentity{},
+	&model.OAuthClient{},
+	&model.OAuthConsent{},
+	&model.AccessToken{},
+	&model.Group{},
+	&model.GroupMember{},
+	&model.AuditLog{},
+	&model.LoginHistory{},
+	&model.Webhook{},
+	&model.WebhookDelivery{},
+	&model.WebhookAttempt{},
+	&model.OutboxEvent{},
+	&model.DataExport{},
+	&model.ErasureRequest{},
+	&model.DataKey{},
+}
+
+// legacyUser 字段加密前 t_user.age 为整数列，执行 gous keys migrate 之前按原类型迁移，
+// 自动迁移不修改已有的 age 列，避免每次升级都锁表重建
+type legacyUser struct {
+	model.User
+	Age int `gorm:"column:age"`
+}
+
+// Migrate 自动建表、补齐字段和索引，不会删除已有字段
+func Migrate() error {
+	db := utils.GetDB()
+	models := migrateModels
+	user, err := userModel(db)
+	if err != nil {
+		return err
+	}
+	if user != migrateModels[0] {
+		models = append([]interface{}{user}, migrateModels[1:]...)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		log.Errorf("Migrate failed: %v", err)
+		return fmt.Errorf("migrate failed: %v", err)
+	}
+	log.Infof("migrate success, %d tables", len(models))
+	return nil
+}
+
+// userModel 迁移 t_user 使用的 model，age 仍为整数列时保持原类型
+func userModel(db *gorm.DB) (interface{}, error) {
+	text, err := userAgeIsText(db)
+	if err != nil {
+		return nil, err
+	}
+	if !text {
+		return &legacyUser{}, nil
+	}
+	return migrateModels[0], nil
+}
+
+// userAgeIsText t_user.age 是否为字符串类型，可以保存密文；表不存在时按新建的类型处理
+func userAgeIsText(db *gorm.DB) (bool, error) {
+	if !db.Migrator().HasTable(&model.User{}) {
+		return true, nil
+	}
+	columns, err := db.Migrator().ColumnTypes(&model.User{})
+	if err != nil {
+		log.Errorf("userAgeIsText failed: %v", err)
+		return false, fmt.Errorf("userAgeIsText fail: %v", err)
+	}
+	for _, c := range columns {
+		if c.Name() == "age" {
+			t := strings.ToLower(c.DatabaseTypeName())
+			return strings.Contains(t, "char") || strings.Contains(t, "text"), nil
+		}
+	}
+	return true, nil
+}
+
+// CheckUserAgeColumn 开启字段加密前确认 t_user.age 已改为字符串类型，整数列无法保存密文
+func CheckUserAgeColumn() error {
+	text, err := userAgeIsText(utils.GetDB())
+	if err != nil {
+		return err
+	}
+	if !text {
+		return fmt.Errorf("t_user.age is still an integer column, run gous keys migrate before enabling encryption")
+	}
+	return nil
+}
+
+// MigrateUserAge 把 t_user.age 改为 varchar(128) 以保存密文，已改过时返回 false。
+// 大表上会锁表重建，已有的整数值原样保留并可正常读取
+func MigrateUserAge() (bool, error) {
+	db := utils.GetDB()
+	text, err := userAgeIsText(db)
+	if err != nil || text {
+		return false, err
+	}
+	if err := db.Migrator().AlterColumn(&model.User{}, "Age"); err != nil {
+		log.Errorf("MigrateUserAge failed: %v", err)
+		return false, fmt.Errorf("MigrateUserAge fail: %v", err)
+	}
+	return true, nil
+}
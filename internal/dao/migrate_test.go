@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"Gous/internal/utils"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetDB(db)
+	return db
+}
+
+func TestUserModelKeepsIntegerAge(t *testing.T) {
+	db := openDB(t)
+	// 加密前创建的表，age 为整数列
+	if err := db.AutoMigrate(&legacyUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO t_user (name, age, creator, modifier) VALUES (?, ?, '', '')", "legacy", 42).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 自动迁移保持原类型，开启加密前报错
+	for i := 0; i < 2; i++ {
+		m, err := userModel(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.(*legacyUser); !ok {
+			t.Fatalf("got %T, want *legacyUser", m)
+		}
+		if err := db.AutoMigrate(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if text, err := userAgeIsText(db); err != nil || text {
+		t.Fatalf("age column changed by auto migrate: %v, %v", text, err)
+	}
+	if err := CheckUserAgeColumn(); err == nil {
+		t.Fatal("integer age column accepted")
+	}
+
+	// 手动迁移后改为字符串类型，已有数据不变
+	if changed, err := MigrateUserAge(); err != nil || !changed {
+		t.Fatalf("migrate: %v, %v", changed, err)
+	}
+	if err := CheckUserAgeColumn(); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := MigrateUserAge(); err != nil || changed {
+		t.Fatalf("repeat migrate: %v, %v", changed, err)
+	}
+	if m, err := userModel(db); err != nil || m != migrateModels[0] {
+		t.Fatalf("got %T, %v", m, err)
+	}
+	var age string
+	if err := db.Raw("SELECT age FROM t_user WHERE name=?", "legacy").Scan(&age).Error; err != nil || age != "42" {
+		t.Fatalf("age %q, %v", age, err)
+	}
+}
+
+func TestUserModelNewTable(t *testing.T) {
+	db := openDB(t)
+	// 新建的表直接使用字符串类型
+	m, err := userModel(db)
+	if err != nil || m != migrateModels[0] {
+		t.Fatalf("got %T, %v", m, err)
+	}
+	if err := db.AutoMigrate(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckUserAgeColumn(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetOAuthClient 根据 client_id 查询应用，不存在时返回 nil
+func GetOAuthClient(clientID string) (*model.OAuthClient, error) {
+	client := &model.OAuthClient{}
+	err := utils.GetDB().Model(model.OAuthClient{}).Where("client_id=?", clientID).First(client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetOAuthClient failed: %v", err)
+		return nil, fmt.Errorf("GetOAuthClient failed: %v", err)
+	}
+	return client, nil
+}
+
+// ListOAuthClients 查询全部应用
+func ListOAuthClients() ([]*model.OAuthClient, error) {
+	var clients []*model.OAuthClient
+	if err := utils.GetDB().Model(model.OAuthClient{}).Order("id").Find(&clients).Error; err != nil {
+		log.Errorf("ListOAuthClients failed: %v", err)
+		return nil, fmt.Errorf("ListOAuthClients failed: %v", err)
+	}
+	return clients, nil
+}
+
+// CreateOAuthClient 注册应用
+func CreateOAuthClient(client *model.OAuthClient) error {
+	if err := utils.GetDB().Create(client).Error; err != nil {
+		log.Errorf("CreateOAuthClient failed: %v", err)
+		return fmt.Errorf("CreateOAuthClient fail: %v", err)
+	}
+	return nil
+}
+
+// DeleteOAuthClient 删除应用及用户对它的授权记录
+func DeleteOAuthClient(clientID string) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("client_id=?", clientID).Delete(&model.OAuthConsent{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("client_id=?", clientID).Delete(&model.OAuthClient{}).Error
+	})
+	if err != nil {
+		log.Errorf("DeleteOAuthClient failed: %v", err)
+		return fmt.Errorf("DeleteOAuthClient fail: %v", err)
+	}
+	return nil
+}
+
+// GetOAuthConsent 查询用户对应用的授权记录，未授权时返回 nil
+func GetOAuthConsent(userID int, clientID string) (*model.OAuthConsent, error) {
+	consent := &model.OAuthConsent{}
+	err := utils.GetDB().Model(model.OAuthConsent{}).Where("user_id=? and client_id=?", userID, clientID).First(consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetOAuthConsent failed: %v", err)
+		return nil, fmt.Errorf("GetOAuthConsent failed: %v", err)
+	}
+	return consent, nil
+}
+
+// SaveOAuthConsent 保存授权记录，已存在时更新 scope
+func SaveOAuthConsent(consent *model.OAuthConsent) error {
+	err := utils.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "update_time"}),
+	}).Create(consent).Error
+	if err != nil {
+		log.Errorf("SaveOAuthConsent failed: %v", err)
+		return fmt.Errorf("SaveOAuthConsent fail: %v", err)
+	}
+	return nil
+}
+
+// ListOAuthConsents 查询用户授权过的全部应用
+func ListOAuthConsents(userID int) ([]*model.OAuthConsent, error) {
+	var list []*model.OAuthConsent
+	if err := utils.GetDB().Where("user_id=?", userID).Order("id").Find(&list).Error; err != nil {
+		log.Errorf("ListOAuthConsents failed: %v", err)
+		return nil, fmt.Errorf("ListOAuthConsents failed: %v", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,154 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// UserEvent 根据事务中写入后的用户数据生成领域事件，返回 nil 表示不写入。
+// 新建用户时自增 id 已经可用，修改时为修改后的数据，删除时为删除前的数据
+type UserEvent func(user *model.User) (*model.OutboxEvent, error)
+
+// writeUserEvents 在业务事务中写入领域事件，写入失败时整个事务回滚
+func writeUserEvents(tx *gorm.DB, user *model.User, events []UserEvent) error {
+	for _, ev := range events {
+		e, err := ev(user)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			continue
+		}
+		if err := tx.Create(e).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloadUser 事务中重新读取修改后的用户，没有需要写入的事件时不读取
+func reloadUser(tx *gorm.DB, where string, arg interface{}, events []UserEvent) (*model.User, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+	user := &model.User{}
+	if err := tx.Model(model.User{}).Where(where, arg).First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PendingOutboxEvents 按 id 顺序查询 now 时可以发布的事件。
+// 有事件在等待重试的用户，其全部事件都不返回，既保持同一用户的顺序，也不占用批次阻塞其他用户
+func PendingOutboxEvents(now time.Time, limit int) ([]*model.OutboxEvent, error) {
+	waiting := utils.GetDB().Model(model.OutboxEvent{}).Select("aggregate_id").
+		Where("published_at IS NULL AND dead_at IS NULL AND next_attempt_at > ?", now)
+	var list []*model.OutboxEvent
+	err := utils.GetDB().Where("published_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", now).
+		Where("aggregate_id NOT IN (?)", waiting).Order("id").Limit(limit).Find(&list).Error
+	if err != nil {
+		log.Errorf("PendingOutboxEvents failed: %v", err)
+		return nil, fmt.Errorf("PendingOutboxEvents failed: %v", err)
+	}
+	return list, nil
+}
+
+// MarkOutboxPublished 记录事件已发布
+func MarkOutboxPublished(id int64, t time.Time) error {
+	err := utils.GetDB().Model(model.OutboxEvent{}).Where("id=?", id).Updates(map[string]interface{}{
+		"published_at": t,
+		"last_error":   "",
+	}).Error
+	if err != nil {
+		log.Errorf("MarkOutboxPublished failed: %v", err)
+		return fmt.Errorf("MarkOutboxPublished fail: %v", err)
+	}
+	return nil
+}
+
+// FailOutboxEvent 记录一次发布失败和下次重试时间
+func FailOutboxEvent(id int64, attempts int, next time.Time, reason string) error {
+	err := utils.GetDB().Model(model.OutboxEvent{}).Where("id=?", id).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": next,
+		"last_error":      reason,
+	}).Error
+	if err != nil {
+		log.Errorf("FailOutboxEvent failed: %v", err)
+		return fmt.Errorf("FailOutboxEvent fail: %v", err)
+	}
+	return nil
+}
+
+// PurgeOutboxEvents 删除 before 之前发布的事件，返回删除的条数
+func PurgeOutboxEvents(before time.Time) (int64, error) {
+	res := utils.GetDB().Where("published_at < ?", before).Delete(&model.OutboxEvent{})
+	if res.Error != nil {
+		log.Errorf("PurgeOutboxEvents failed: %v", res.Error)
+		return 0, fmt.Errorf("PurgeOutboxEvents fail: %v", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// MarkOutboxDead 发布次数用尽，进入死信状态
+func MarkOutboxDead(id int64, attempts int, t time.Time, reason string) error {
+	err := utils.GetDB().Model(model.OutboxEvent{}).Where("id=?", id).Updates(map[string]interface{}{
+		"attempts":   attempts,
+		"dead_at":    t,
+		"last_error": reason,
+	}).Error
+	if err != nil {
+		log.Errorf("MarkOutboxDead failed: %v", err)
+		return fmt.Errorf("MarkOutboxDead fail: %v", err)
+	}
+	return nil
+}
+
+// FindDeadOutboxEvents 分页查询死信事件，按 id 倒序
+func FindDeadOutboxEvents(offset, limit int) ([]*model.OutboxEvent, int64, error) {
+	db := utils.GetDB().Model(model.OutboxEvent{}).Where("dead_at IS NOT NULL AND published_at IS NULL")
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("FindDeadOutboxEvents failed: %v", err)
+		return nil, 0, fmt.Errorf("FindDeadOutboxEvents failed: %v", err)
+	}
+	var list []*model.OutboxEvent
+	if err := db.Order("id desc").Offset(offset).Limit(limit).Find(&list).Error; err != nil {
+		log.Errorf("FindDeadOutboxEvents failed: %v", err)
+		return nil, 0, fmt.Errorf("FindDeadOutboxEvents failed: %v", err)
+	}
+	return list, total, nil
+}
+
+// GetOutboxEvent 根据 id 查询事件，不存在时返回 nil
+func GetOutboxEvent(id int64) (*model.OutboxEvent, error) {
+	e := &model.OutboxEvent{}
+	err := utils.GetDB().Model(model.OutboxEvent{}).Where("id=?", id).First(e).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetOutboxEvent failed: %v", err)
+		return nil, fmt.Errorf("GetOutboxEvent failed: %v", err)
+	}
+	return e, nil
+}
+
+// RequeueOutboxEvent 死信事件重新进入待发布状态并清零发布次数，用于手动重试
+func RequeueOutboxEvent(id int64, now time.Time) error {
+	err := utils.GetDB().Model(model.OutboxEvent{}).Where("id=?", id).Updates(map[string]interface{}{
+		"dead_at":         nil,
+		"attempts":        0,
+		"next_attempt_at": now,
+	}).Error
+	if err != nil {
+		log.Errorf("RequeueOutboxEvent failed: %v", err)
+		return fmt.Errorf("RequeueOutboxEvent fail: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// GetAccessTokenByHash 根据令牌摘要查询，不存在时返回 nil
+func GetAccessTokenByHash(hash string) (*model.AccessToken, error) {
+	token := &model.AccessToken{}
+	err := utils.GetDB().Model(model.AccessToken{}).Where("token_hash=?", hash).First(token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetAccessTokenByHash failed: %v", err)
+		return nil, fmt.Errorf("GetAccessTokenByHash failed: %v", err)
+	}
+	return token, nil
+}
+
+// ListAccessTokens 查询用户的全部令牌
+func ListAccessTokens(userID int) ([]*model.AccessToken, error) {
+	var tokens []*model.AccessToken
+	if err := utils.GetDB().Model(model.AccessToken{}).Where("user_id=?", userID).Order("id").Find(&tokens).Error; err != nil {
+		log.Errorf("ListAccessTokens failed: %v", err)
+		return nil, fmt.Errorf("ListAccessTokens failed: %v", err)
+	}
+	return tokens, nil
+}
+
+// CountAccessTokens 统计用户的令牌数
+func CountAccessTokens(userID int) (int64, error) {
+	var count int64
+	if err := utils.GetDB().Model(model.AccessToken{}).Where("user_id=?", userID).Count(&count).Error; err != nil {
+		log.Errorf("CountAccessTokens failed: %v", err)
+		return 0, fmt.Errorf("CountAccessTokens failed: %v", err)
+	}
+	return count, nil
+}
+
+// CreateAccessToken 保存令牌
+func CreateAccessToken(token *model.AccessToken) error {
+	if err := utils.GetDB().Create(token).Error; err != nil {
+		log.Errorf("CreateAccessToken failed: %v", err)
+		return fmt.Errorf("CreateAccessToken fail: %v", err)
+	}
+	return nil
+}
+
+// DeleteAccessToken 删除用户的令牌，返回是否删除了记录
+func DeleteAccessToken(userID, id int) (bool, error) {
+	res := utils.GetDB().Where("user_id=? and id=?", userID, id).Delete(&model.AccessToken{})
+	if res.Error != nil {
+		log.Errorf("DeleteAccessToken failed: %v", res.Error)
+		return false, fmt.Errorf("DeleteAccessToken fail: %v", res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// TouchAccessToken 记录令牌的最近使用时间和来源 IP
+func TouchAccessToken(id int, at time.Time, ip string) error {
+	err := utils.GetDB().Model(&model.AccessToken{}).Where("id=?", id).
+		Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+	if err != nil {
+		log.Errorf("TouchAccessToken failed: %v", err)
+		return fmt.Errorf("TouchAccessToken fail: %v", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"Gous/internal/model"
 	"Gous/internal/utils"
+	"Gous/pkg/constant"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -21,9 +22,18 @@ func GetUserByName(name string) (*model.User, error) {
 	return user, nil
 }
 
-// CreateUser 创建用户
-func CreateUser(user *model.User) error {
-	if err := utils.GetDB().Model(&model.User{}).Create(user).Error; err != nil {
+// CreateUser 创建用户，events 在同一事务中写入
+func CreateUser(user *model.User, events ...UserEvent) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := setUserIndexes(user); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).Create(user).Error; err != nil {
+			return err
+		}
+		return writeUserEvents(tx, user, events)
+	})
+	if err != nil {
 		log.Errorf("CreateUser failed: %v", err)
 		return fmt.Errorf("CreateUser fail: %v", err)
 	}
@@ -31,9 +41,12 @@ func CreateUser(user *model.User) error {
 	return nil
 }
 
-// DeleteUser 删除数据库的用户信息
-func DeleteUser(user *model.User) error {
-	if err := utils.GetDB().Model(&model.User{}).Delete(user).Error; err != nil {
+// DeleteUser 删除数据库的用户信息及其个人访问令牌、组成员关系，events 在同一事务中写入
+func DeleteUser(user *model.User, events ...UserEvent) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		return deleteUser(tx, user, events)
+	})
+	if err != nil {
 		log.Errorf("DeleteUser fail: %v", err)
 		return fmt.Errorf("deleteUser fail: %v", err)
 	}
@@ -42,7 +55,158 @@ func DeleteUser(user *model.User) error {
 	return nil
 }
 
-// UpdateUserInfo 更新昵称
-func UpdateUserInfo(userName string, user *model.User) int64 {
-	return utils.GetDB().Model(&model.User{}).Where("`name` = ?", userName).Updates(user).RowsAffected
+func deleteUser(tx *gorm.DB, user *model.User, events []UserEvent) error {
+	if err := writeUserEvents(tx, user, events); err != nil {
+		return err
+	}
+	if err := tx.Where("user_id=?", user.ID).Delete(&model.AccessToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id=?", user.ID).Delete(&model.GroupMember{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id=?", user.ID).Delete(&model.LoginHistory{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&model.User{}).Delete(user).Error
+}
+
+// UpdateUserInfo 更新昵称，有记录被更新时 events 在同一事务中写入
+func UpdateUserInfo(userName string, user *model.User, events ...UserEvent) int64 {
+	var affected int64
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		affected = tx.Model(&model.User{}).Where("`name` = ?", userName).Updates(user).RowsAffected
+		if affected != 1 {
+			return nil
+		}
+		updated, err := reloadUser(tx, "`name` = ?", userName, events)
+		if err != nil {
+			return err
+		}
+		return writeUserEvents(tx, updated, events)
+	})
+	if err != nil {
+		log.Errorf("UpdateUserInfo failed: %v", err)
+		return 0
+	}
+	return affected
+}
+
+// GetUserByEmail 根据邮箱获取用户
+func GetUserByEmail(email string) (*model.User, error) {
+	where, args, err := UserColumnEqual("email", email)
+	if err != nil {
+		log.Errorf("GetUserByEmail failed: %v", err)
+		return nil, fmt.Errorf("GetUserByEmail failed: %v", err)
+	}
+	user := &model.User{}
+	if err := utils.GetDB().Model(model.User{}).Where(where, args...).First(user).Error; err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			return nil, nil
+		}
+		log.Errorf("GetUserByEmail failed: %v", err)
+		return nil, fmt.Errorf("GetUserByEmail failed: %v", err)
+	}
+	return user, nil
+}
+
+// GetUserByID 根据 id 获取用户
+func GetUserByID(id int) (*model.User, error) {
+	user := &model.User{}
+	if err := utils.GetDB().Model(model.User{}).Where("id=?", id).First(user).Error; err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			return nil, nil
+		}
+		log.Errorf("GetUserByID failed: %v", err)
+		return nil, fmt.Errorf("GetUserByID failed: %v", err)
+	}
+	return user, nil
+}
+
+// UpdateUserColumns 按 id 更新指定字段，支持零值，events 在同一事务中写入
+func UpdateUserColumns(id int, columns map[string]interface{}, events ...UserEvent) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := encryptUserColumns(columns); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).Where("id=?", id).Updates(columns).Error; err != nil {
+			return err
+		}
+		updated, err := reloadUser(tx, "id=?", id, events)
+		if err != nil {
+			return err
+		}
+		return writeUserEvents(tx, updated, events)
+	})
+	if err != nil {
+		log.Errorf("UpdateUserColumns failed: %v", err)
+		return fmt.Errorf("UpdateUserColumns failed: %v", err)
+	}
+	return nil
+}
+
+// GetUserByIdent 根据登录标识获取用户，kind 见 constant.Ident*
+func GetUserByIdent(kind, value string) (*model.User, error) {
+	switch kind {
+	case constant.IdentUserName:
+		return GetUserByName(value)
+	case constant.IdentEmail:
+		return GetUserByEmail(value)
+	case constant.IdentPhone:
+		return GetUserByPhone(value)
+	}
+	return nil, fmt.Errorf("GetUserByIdent: unknown ident kind %s", kind)
+}
+
+// GetUserByPhone 根据手机号获取用户
+func GetUserByPhone(phone string) (*model.User, error) {
+	where, args, err := UserColumnEqual("phone", phone)
+	if err != nil {
+		log.Errorf("GetUserByPhone failed: %v", err)
+		return nil, fmt.Errorf("GetUserByPhone failed: %v", err)
+	}
+	user := &model.User{}
+	if err := utils.GetDB().Model(model.User{}).Where(where, args...).First(user).Error; err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			return nil, nil
+		}
+		log.Errorf("GetUserByPhone failed: %v", err)
+		return nil, fmt.Errorf("GetUserByPhone failed: %v", err)
+	}
+	return user, nil
+}
+
+// CreateUsers 在同一事务中批量创建用户，任一用户写入失败时全部回滚，events 对每个用户写入
+func CreateUsers(users []*model.User, events ...UserEvent) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			if err := setUserIndexes(user); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(users).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			if err := writeUserEvents(tx, user, events); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("CreateUsers failed: %v", err)
+		return fmt.Errorf("CreateUsers fail: %v", err)
+	}
+	return nil
+}
+
+// ListUsersAfter 按 id 顺序读取 afterID 之后的用户，用于分批遍历全部用户
+func ListUsersAfter(afterID, limit int) ([]*model.User, error) {
+	var users []*model.User
+	if err := utils.GetDB().Where("id > ?", afterID).Order("id").Limit(limit).Find(&users).Error; err != nil {
+		log.Errorf("ListUsersAfter failed: %v", err)
+		return nil, fmt.Errorf("ListUsersAfter failed: %v", err)
+	}
+	return users, nil
 }
@@ -0,0 +1,136 @@
+package dao
+
+import (
+	"Gous/internal/fieldcrypt"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+)
+
+// userEncryptedColumns t_user 中加密保存的字段及其盲索引字段，不需要按值查询的字段没有盲索引
+var userEncryptedColumns = map[string]string{
+	"nickname": "",
+	"age":      "",
+	"email":    "email_bidx",
+	"phone":    "phone_bidx",
+}
+
+// UserColumnEqual 按 t_user 字段等值查询的条件。开启加密后有盲索引的字段按盲索引查询，
+// 同时兼容尚未重新加密、盲索引为空的历史数据
+func UserColumnEqual(column, value string) (string, []interface{}, error) {
+	bidx := userEncryptedColumns[column]
+	if bidx == "" || !fieldcrypt.Enabled() {
+		return column + " = ?", []interface{}{value}, nil
+	}
+	idx, err := fieldcrypt.BlindIndex("t_user."+column, value)
+	if err != nil {
+		return "", nil, err
+	}
+	return "(" + bidx + " <=> ? OR " + bidx + " IS NULL AND " + column + " <=> ?)", []interface{}{idx, value}, nil
+}
+
+// setUserIndexes 按结构体写入前计算邮箱、手机号的盲索引
+func setUserIndexes(user *model.User) error {
+	var err error
+	if user.EmailIndex, err = blindIndex("email", user.Email); err != nil {
+		return err
+	}
+	user.PhoneIndex, err = blindIndex("phone", user.Phone)
+	return err
+}
+
+func blindIndex(column string, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	idx, err := fieldcrypt.BlindIndex("t_user."+column, *value)
+	if err != nil || idx == "" {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+// encryptUserColumns 按 map 更新时 gorm 不经过 serializer，在这里加密并同步更新盲索引
+func encryptUserColumns(columns map[string]interface{}) error {
+	for column, bidx := range userEncryptedColumns {
+		v, ok := columns[column]
+		if !ok {
+			continue
+		}
+		plain, valid := plainValue(v)
+		if !valid {
+			columns[column] = nil
+			if bidx != "" {
+				columns[bidx] = nil
+			}
+			continue
+		}
+		value, err := fieldcrypt.Encrypt("t_user."+column, plain)
+		if err != nil {
+			return err
+		}
+		columns[column] = value
+		if bidx != "" {
+			idx, err := blindIndex(column, &plain)
+			if err != nil {
+				return err
+			}
+			columns[bidx] = idx
+		}
+	}
+	return nil
+}
+
+// plainValue 字段值转换为字符串，nil 和空指针返回 false
+func plainValue(v interface{}) (string, bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return "", false
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	return fmt.Sprint(rv.Interface()), true
+}
+
+// EncryptedUserRow t_user 中加密字段和盲索引在数据库中的原始值，轮换密钥时使用
+type EncryptedUserRow struct {
+	ID         int     `gorm:"column:id"`
+	NickName   *string `gorm:"column:nickname"`
+	Age        *string `gorm:"column:age"`
+	Email      *string `gorm:"column:email"`
+	EmailIndex *string `gorm:"column:email_bidx"`
+	Phone      *string `gorm:"column:phone"`
+	PhoneIndex *string `gorm:"column:phone_bidx"`
+}
+
+// FindEncryptedUserRows 按 id 顺序读取 afterID 之后的用户，不解密
+func FindEncryptedUserRows(afterID, limit int) ([]*EncryptedUserRow, error) {
+	var rows []*EncryptedUserRow
+	err := utils.GetDB().Table("t_user").Select("id, nickname, age, email, email_bidx, phone, phone_bidx").
+		Where("id > ?", afterID).Order("id").Limit(limit).Find(&rows).Error
+	if err != nil {
+		log.Errorf("FindEncryptedUserRows failed: %v", err)
+		return nil, fmt.Errorf("FindEncryptedUserRows failed: %v", err)
+	}
+	return rows, nil
+}
+
+// UpdateEncryptedUserRow 写入重新加密的值，读取后字段已被修改时不更新并返回 false。
+// 只修改存储形式，不更新 update_time
+func UpdateEncryptedUserRow(old *EncryptedUserRow, columns map[string]interface{}) (bool, error) {
+	res := utils.GetDB().Table("t_user").
+		Where("id = ? AND nickname <=> ? AND age <=> ? AND email <=> ? AND phone <=> ?",
+			old.ID, old.NickName, old.Age, old.Email, old.Phone).
+		Updates(columns)
+	if res.Error != nil {
+		log.Errorf("UpdateEncryptedUserRow failed: %v", res.Error)
+		return false, fmt.Errorf("UpdateEncryptedUserRow failed: %v", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -0,0 +1,183 @@
+package dao
+
+import (
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 投递状态
+const (
+	WebhookPending = "pending" // 等待投递或重试
+	WebhookSuccess = "success" // 已投递成功
+	WebhookDead    = "dead"    // 重试次数用尽，等待手动重新投递
+)
+
+// GetWebhook 根据 id 查询订阅，不存在时返回 nil
+func GetWebhook(id int) (*model.Webhook, error) {
+	w := &model.Webhook{}
+	err := utils.GetDB().Model(model.Webhook{}).Where("id=?", id).First(w).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetWebhook failed: %v", err)
+		return nil, fmt.Errorf("GetWebhook failed: %v", err)
+	}
+	return w, nil
+}
+
+// ListWebhooks 查询订阅，onlyEnabled 为 true 时只返回启用的订阅
+func ListWebhooks(onlyEnabled bool) ([]*model.Webhook, error) {
+	db := utils.GetDB().Model(model.Webhook{})
+	if onlyEnabled {
+		db = db.Where("enabled=?", true)
+	}
+	var list []*model.Webhook
+	if err := db.Order("id").Find(&list).Error; err != nil {
+		log.Errorf("ListWebhooks failed: %v", err)
+		return nil, fmt.Errorf("ListWebhooks failed: %v", err)
+	}
+	return list, nil
+}
+
+// SaveWebhook 创建或更新订阅
+func SaveWebhook(w *model.Webhook) error {
+	if err := utils.GetDB().Save(w).Error; err != nil {
+		log.Errorf("SaveWebhook failed: %v", err)
+		return fmt.Errorf("SaveWebhook fail: %v", err)
+	}
+	return nil
+}
+
+// DeleteWebhook 删除订阅及其投递记录
+func DeleteWebhook(id int) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		sub := tx.Model(model.WebhookDelivery{}).Select("id").Where("webhook_id=?", id)
+		if err := tx.Where("delivery_id in (?)", sub).Delete(&model.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id=?", id).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id=?", id).Delete(&model.Webhook{}).Error
+	})
+	if err != nil {
+		log.Errorf("DeleteWebhook failed: %v", err)
+		return fmt.Errorf("DeleteWebhook fail: %v", err)
+	}
+	return nil
+}
+
+// CreateWebhookDeliveries 写入待投递记录
+func CreateWebhookDeliveries(list []*model.WebhookDelivery) error {
+	if len(list) == 0 {
+		return nil
+	}
+	if err := utils.GetDB().Create(&list).Error; err != nil {
+		log.Errorf("CreateWebhookDeliveries failed: %v", err)
+		return fmt.Errorf("CreateWebhookDeliveries fail: %v", err)
+	}
+	return nil
+}
+
+// DueWebhookDeliveries 查询已到投递时间的记录
+func DueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	var list []*model.WebhookDelivery
+	err := utils.GetDB().Where("status=? AND next_attempt_at<=?", WebhookPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&list).Error
+	if err != nil {
+		log.Errorf("DueWebhookDeliveries failed: %v", err)
+		return nil, fmt.Errorf("DueWebhookDeliveries failed: %v", err)
+	}
+	return list, nil
+}
+
+// ClaimWebhookDelivery 把下次投递时间推迟到 lease，抢占成功才由当前实例投递；
+// 投递过程中实例退出时，其他实例在 lease 之后重新投递
+func ClaimWebhookDelivery(d *model.WebhookDelivery, lease time.Time) (bool, error) {
+	res := utils.GetDB().Model(model.WebhookDelivery{}).
+		Where("id=? AND status=? AND next_attempt_at=?", d.ID, WebhookPending, d.NextAttemptAt).
+		Update("next_attempt_at", lease)
+	if res.Error != nil {
+		log.Errorf("ClaimWebhookDelivery failed: %v", res.Error)
+		return false, fmt.Errorf("ClaimWebhookDelivery fail: %v", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// FinishWebhookAttempt 记录一次投递尝试并更新投递状态
+func FinishWebhookAttempt(deliveryID int64, columns map[string]interface{}, attempt *model.WebhookAttempt) error {
+	err := utils.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(model.WebhookDelivery{}).Where("id=?", deliveryID).Updates(columns).Error
+	})
+	if err != nil {
+		log.Errorf("FinishWebhookAttempt failed: %v", err)
+		return fmt.Errorf("FinishWebhookAttempt fail: %v", err)
+	}
+	return nil
+}
+
+// FindWebhookDeliveries 分页查询订阅的投递记录，status 为空时不过滤，按时间倒序
+func FindWebhookDeliveries(webhookID int, status string, offset, limit int) ([]*model.WebhookDelivery, int64, error) {
+	db := utils.GetDB().Model(model.WebhookDelivery{}).Where("webhook_id=?", webhookID)
+	if status != "" {
+		db = db.Where("status=?", status)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		log.Errorf("FindWebhookDeliveries failed: %v", err)
+		return nil, 0, fmt.Errorf("FindWebhookDeliveries failed: %v", err)
+	}
+	var list []*model.WebhookDelivery
+	if err := db.Order("id desc").Offset(offset).Limit(limit).Find(&list).Error; err != nil {
+		log.Errorf("FindWebhookDeliveries failed: %v", err)
+		return nil, 0, fmt.Errorf("FindWebhookDeliveries failed: %v", err)
+	}
+	return list, total, nil
+}
+
+// GetWebhookDelivery 根据 id 查询投递记录，不存在时返回 nil
+func GetWebhookDelivery(id int64) (*model.WebhookDelivery, error) {
+	d := &model.WebhookDelivery{}
+	err := utils.GetDB().Model(model.WebhookDelivery{}).Where("id=?", id).First(d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Errorf("GetWebhookDelivery failed: %v", err)
+		return nil, fmt.Errorf("GetWebhookDelivery failed: %v", err)
+	}
+	return d, nil
+}
+
+// ListWebhookAttempts 查询投递记录的全部尝试
+func ListWebhookAttempts(deliveryID int64) ([]*model.WebhookAttempt, error) {
+	var list []*model.WebhookAttempt
+	if err := utils.GetDB().Where("delivery_id=?", deliveryID).Order("id").Find(&list).Error; err != nil {
+		log.Errorf("ListWebhookAttempts failed: %v", err)
+		return nil, fmt.Errorf("ListWebhookAttempts failed: %v", err)
+	}
+	return list, nil
+}
+
+// ResetWebhookDelivery 重置为待投递并清零投递次数，用于手动重新投递
+func ResetWebhookDelivery(id int64, now time.Time) error {
+	err := utils.GetDB().Model(model.WebhookDelivery{}).Where("id=?", id).Updates(map[string]interface{}{
+		"status":          WebhookPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+	}).Error
+	if err != nil {
+		log.Errorf("ResetWebhookDelivery failed: %v", err)
+		return fmt.Errorf("ResetWebhookDelivery fail: %v", err)
+	}
+	return nil
+}
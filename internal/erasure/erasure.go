@@ -0,0 +1,224 @@
+package erasure
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 发起清除的一方
+const (
+	RequesterUser  = "user" // 用户注销
+	RequesterScim  = "scim" // 身份源通过 SCIM 删除
+	RequesterAdmin = "admin"
+)
+
+const (
+	batchSize = 10
+	lease     = 10 * time.Minute // 执行中的实例退出后，其他实例在该时间后重新执行
+)
+
+// Subject 被清除的用户，执行期间保存在任务中，完成后清空
+type Subject struct {
+	UserID    int     `json:"user_id"`
+	UserName  string  `json:"user_name"`
+	Email     *string `json:"email,omitempty"`
+	Phone     *string `json:"phone,omitempty"`
+	Pseudonym string  `json:"-"` // 审计日志中替换用户名的假名
+}
+
+// Eraser 清除一个子系统中的个人数据，返回清除的条数。
+// 任务失败后会重试，Erase 必须可以重复执行，已清除的数据再次执行时不应报错
+type Eraser struct {
+	Name  string
+	Erase func(ctx context.Context, s *Subject) (int64, error)
+}
+
+var (
+	erasersMu sync.RWMutex
+	// erasers 按顺序执行，审计日志假名化放在最后
+	erasers = []Eraser{
+		{"sessions", eraseSessions},
+		{"oauth_refresh_tokens", eraseOAuthRefresh},
+		{"cache_keys", eraseCacheKeys},
+		Table("identities", &model.UserIdentity{}),
+		Table("oauth_consents", &model.OAuthConsent{}),
+		Table("access_tokens", &model.AccessToken{}),
+		Table("group_members", &model.GroupMember{}),
+		Table("login_history", &model.LoginHistory{}),
+		{"data_exports", eraseDataExports},
+		{"webhook_deliveries", eraseWebhookDeliveries},
+		{"outbox_events", eraseOutboxEvents},
+		{"audit_logs", pseudonymizeAuditLogs},
+	}
+)
+
+// Register 注册新的清除步骤，新增保存个人数据的表、对象存储、搜索索引等时在这里注册，
+// 注册的步骤在审计日志假名化之前执行，name 不能与已有的重复
+func Register(e Eraser) {
+	erasersMu.Lock()
+	defer erasersMu.Unlock()
+	last := erasers[len(erasers)-1]
+	erasers = append(erasers[:len(erasers)-1], e, last)
+}
+
+// Table 按 user_id 列删除 m 对应表中的记录
+func Table(name string, m interface{}) Eraser {
+	return Eraser{name, func(_ context.Context, s *Subject) (int64, error) {
+		return dao.DeleteUserRows(m, s.UserID)
+	}}
+}
+
+// StepResult 一个步骤最近一次执行的结果
+type StepResult struct {
+	Name   string    `json:"name"`
+	Status string    `json:"status"` // done、failed
+	Count  int64     `json:"count"`  // 清除的条数
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Steps 解析任务中保存的各步骤结果
+func Steps(r *model.ErasureRequest) []*StepResult {
+	steps := []*StepResult{}
+	if r.Steps != "" {
+		_ = json.Unmarshal([]byte(r.Steps), &steps)
+	}
+	return steps
+}
+
+// NewRequest 生成清除任务，requester 见 Requester*
+func NewRequest(user *model.User, requester string) (*model.ErasureRequest, error) {
+	suffix, err := utils.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := json.Marshal(&Subject{UserID: user.ID, UserName: user.Name, Email: user.Email, Phone: user.Phone})
+	if err != nil {
+		return nil, err
+	}
+	return &model.ErasureRequest{
+		UserID:        user.ID,
+		Pseudonym:     "erased-" + suffix,
+		Subject:       string(subject),
+		Status:        dao.ErasurePending,
+		NextAttemptAt: time.Now().Truncate(time.Second), // 与数据库中的值一致，抢占时按该值比较
+		Requester:     requester,
+	}, nil
+}
+
+// Process 抢占并执行任务，已被其他实例执行时直接返回。失败的步骤由后台任务重试
+func Process(ctx context.Context, r *model.ErasureRequest) {
+	ok, err := dao.ClaimErasureRequest(r, time.Now().Add(lease).Truncate(time.Second))
+	if err != nil || !ok {
+		return
+	}
+	execute(ctx, config.GetGlobalConf().Erasure, r)
+}
+
+// execute 执行尚未完成的步骤，各步骤互不依赖，某一步失败时继续执行其余步骤
+func execute(ctx context.Context, conf config.ErasureConf, r *model.ErasureRequest) {
+	subject := &Subject{}
+	if err := json.Unmarshal([]byte(r.Subject), subject); err != nil {
+		log.Errorf("erasure|request %d has invalid subject: %v", r.ID, err)
+		_ = dao.UpdateErasureRequest(r.ID, map[string]interface{}{"status": dao.ErasureFailed, "last_error": "invalid subject"})
+		return
+	}
+	subject.Pseudonym = r.Pseudonym
+
+	previous := map[string]*StepResult{}
+	for _, s := range Steps(r) {
+		previous[s.Name] = s
+	}
+	erasersMu.RLock()
+	list := make([]Eraser, len(erasers))
+	copy(list, erasers)
+	erasersMu.RUnlock()
+
+	var steps []*StepResult
+	var failed []string
+	for _, e := range list {
+		if p := previous[e.Name]; p != nil && p.Status == dao.ErasureDone {
+			steps = append(steps, p)
+			continue
+		}
+		if ctx.Err() != nil {
+			return // 停机时保持抢占状态，租约到期后重新执行
+		}
+		n, err := e.Erase(ctx, subject)
+		res := &StepResult{Name: e.Name, Status: dao.ErasureDone, Count: n, Time: time.Now()}
+		if err != nil {
+			res.Status = dao.ErasureFailed
+			res.Error = utils.Truncate(err.Error(), 255)
+			failed = append(failed, e.Name)
+			log.Warnf("erasure|request %d step %s err:%v", r.ID, e.Name, err)
+		}
+		steps = append(steps, res)
+	}
+
+	raw, _ := json.Marshal(steps)
+	attempts := r.Attempts + 1
+	now := time.Now()
+	columns := map[string]interface{}{"steps": string(raw), "attempts": attempts}
+	switch {
+	case len(failed) == 0:
+		columns["status"] = dao.ErasureDone
+		columns["finish_time"] = now
+		columns["last_error"] = ""
+		columns["subject"] = "" // 完成后不再保留用户名、邮箱等
+		log.Infof("erasure|request %d for user %d done as %s", r.ID, r.UserID, r.Pseudonym)
+	case attempts >= conf.MaxAttempts:
+		columns["status"] = dao.ErasureFailed
+		columns["last_error"] = "failed steps: " + strings.Join(failed, ", ")
+		log.Errorf("erasure|request %d for user %d failed after %d attempts: %s", r.ID, r.UserID, attempts, strings.Join(failed, ", "))
+	default:
+		columns["next_attempt_at"] = now.Add(backoff(conf).Delay(attempts)).Truncate(time.Second)
+		columns["last_error"] = "failed steps: " + strings.Join(failed, ", ")
+	}
+	_ = dao.UpdateErasureRequest(r.ID, columns)
+}
+
+// backoff 执行失败后的重试间隔
+func backoff(conf config.ErasureConf) utils.Backoff {
+	return utils.Backoff{Initial: time.Duration(conf.InitialBackoff) * time.Second, Max: time.Duration(conf.MaxBackoff) * time.Second}
+}
+
+var waker = utils.NewWaker()
+
+// Wakeup 有任务需要重试时立即扫描，不必等到下一个扫描周期
+func Wakeup() {
+	waker.Wake()
+}
+
+// Run 后台重试任务，定期执行到了重试时间的任务，多个实例可以同时运行
+func Run(ctx context.Context) {
+	for {
+		conf := config.GetGlobalConf().Erasure
+		if due, err := dao.DueErasureRequests(time.Now(), batchSize); err == nil {
+			for _, r := range due {
+				if ctx.Err() != nil {
+					return
+				}
+				ok, err := dao.ClaimErasureRequest(r, time.Now().Add(lease).Truncate(time.Second))
+				if err != nil || !ok {
+					continue
+				}
+				execute(ctx, conf, r)
+			}
+		}
+		interval := time.Duration(conf.PollInterval) * time.Second
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		if !waker.Sleep(ctx, interval) {
+			return
+		}
+	}
+}
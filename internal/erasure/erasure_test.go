@@ -0,0 +1,203 @@
+package erasure
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setErasers 用例执行期间替换清除步骤，结束后恢复
+func setErasers(t *testing.T, list ...Eraser) {
+	t.Helper()
+	erasersMu.Lock()
+	saved := erasers
+	erasers = list
+	erasersMu.Unlock()
+	t.Cleanup(func() {
+		erasersMu.Lock()
+		erasers = saved
+		erasersMu.Unlock()
+	})
+}
+
+// countingEraser 记录执行顺序，fail 返回 true 时本次执行失败
+func countingEraser(name string, calls *[]string, fail func() bool) Eraser {
+	return Eraser{name, func(_ context.Context, _ *Subject) (int64, error) {
+		*calls = append(*calls, name)
+		if fail != nil && fail() {
+			return 0, errors.New(name + " unavailable")
+		}
+		return 1, nil
+	}}
+}
+
+func createRequest(t *testing.T, user *model.User) *model.ErasureRequest {
+	t.Helper()
+	r, err := NewRequest(user, RequesterAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.GetDB().Create(r).Error; err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func getRequest(t *testing.T, id int) *model.ErasureRequest {
+	t.Helper()
+	r, err := dao.GetErasureRequest(id)
+	if err != nil || r == nil {
+		t.Fatalf("get erasure request %d: %v, %v", id, r, err)
+	}
+	return r
+}
+
+// makeDue 把下次执行时间提前，模拟等待重试的时间已过
+func makeDue(t *testing.T, r *model.ErasureRequest) *model.ErasureRequest {
+	t.Helper()
+	if err := dao.UpdateErasureRequest(r.ID, map[string]interface{}{"next_attempt_at": time.Now().Add(-time.Minute).Truncate(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	return getRequest(t, r.ID)
+}
+
+func stepNames(steps []*StepResult) []string {
+	var names []string
+	for _, s := range steps {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestRegister(t *testing.T) {
+	setErasers(t, Eraser{Name: "sessions"}, Eraser{Name: "audit_logs"})
+	Register(Eraser{Name: "search_index"})
+	Register(Eraser{Name: "object_storage"})
+	// 新注册的步骤按注册顺序执行，审计日志假名化始终在最后
+	want := []string{"sessions", "search_index", "object_storage", "audit_logs"}
+	var got []string
+	for _, e := range erasers {
+		got = append(got, e.Name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestProcessRetry(t *testing.T) {
+	var calls []string
+	failing := true
+	setErasers(t,
+		countingEraser("first", &calls, nil),
+		countingEraser("flaky", &calls, func() bool { return failing }),
+		countingEraser("last", &calls, nil),
+	)
+	r := createRequest(t, &model.User{ID: 9001, Name: "retry_user"})
+	stale := *r
+
+	// 第一次执行：失败的步骤不影响其余步骤，任务等待重试
+	Process(context.Background(), r)
+	if want := []string{"first", "flaky", "last"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls %v, want %v", calls, want)
+	}
+	got := getRequest(t, r.ID)
+	if got.Status != dao.ErasurePending || got.Attempts != 1 || got.LastError != "failed steps: flaky" || got.Subject == "" {
+		t.Fatalf("after partial failure: %+v", got)
+	}
+	if delay := time.Until(got.NextAttemptAt); delay < 50*time.Second || delay > 70*time.Second {
+		t.Fatalf("next attempt in %v, want about 60s", delay)
+	}
+	steps := Steps(got)
+	if !reflect.DeepEqual(stepNames(steps), []string{"first", "flaky", "last"}) ||
+		steps[0].Status != dao.ErasureDone || steps[1].Status != dao.ErasureFailed || steps[2].Status != dao.ErasureDone {
+		t.Fatalf("steps %+v", steps)
+	}
+
+	// 已被抢占或执行过的旧快照不能再次抢占
+	calls = nil
+	Process(context.Background(), &stale)
+	if len(calls) != 0 {
+		t.Fatalf("stale request executed steps %v", calls)
+	}
+
+	// 到期后重试：只执行失败的步骤，已完成的步骤保留原结果
+	failing = false
+	due := makeDue(t, got)
+	Process(context.Background(), due)
+	if want := []string{"flaky"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("retry calls %v, want %v", calls, want)
+	}
+	done := getRequest(t, r.ID)
+	if done.Status != dao.ErasureDone || done.Attempts != 2 || done.LastError != "" || done.FinishTime == nil {
+		t.Fatalf("after retry: %+v", done)
+	}
+	// 完成后不再保留用户名、邮箱等
+	if done.Subject != "" {
+		t.Fatalf("subject kept after done: %q", done.Subject)
+	}
+	if s := Steps(done); !s[0].Time.Equal(steps[0].Time) || s[1].Status != dao.ErasureDone {
+		t.Fatalf("steps after retry %+v", s)
+	}
+
+	// 已完成的任务不再执行
+	calls = nil
+	Process(context.Background(), done)
+	if len(calls) != 0 {
+		t.Fatalf("done request executed steps %v", calls)
+	}
+}
+
+func TestClaimErasureRequestOnce(t *testing.T) {
+	r := createRequest(t, &model.User{ID: 9002, Name: "claim_user"})
+	other := *r
+	lease := time.Now().Add(lease).Truncate(time.Second)
+	if ok, err := dao.ClaimErasureRequest(r, lease); err != nil || !ok {
+		t.Fatalf("first claim: %v, %v", ok, err)
+	}
+	// 其他实例持有同样的快照，租约期间抢占失败
+	if ok, err := dao.ClaimErasureRequest(&other, lease.Add(time.Second)); err != nil || ok {
+		t.Fatalf("second claim: %v, %v", ok, err)
+	}
+}
+
+func TestExecuteMaxAttempts(t *testing.T) {
+	var calls []string
+	setErasers(t,
+		countingEraser("ok", &calls, nil),
+		countingEraser("broken", &calls, func() bool { return true }),
+	)
+	conf := config.ErasureConf{MaxAttempts: 2, InitialBackoff: 1, MaxBackoff: 1}
+	r := createRequest(t, &model.User{ID: 9003, Name: "broken_user"})
+
+	execute(context.Background(), conf, r)
+	execute(context.Background(), conf, getRequest(t, r.ID))
+	got := getRequest(t, r.ID)
+	// 达到最多执行次数后停止自动重试，等待管理员处理
+	if got.Status != dao.ErasureFailed || got.Attempts != 2 || got.LastError != "failed steps: broken" {
+		t.Fatalf("got %+v", got)
+	}
+	if want := []string{"ok", "broken", "broken"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls %v, want %v", calls, want)
+	}
+	// 失败的任务不会被抢占，需要手动重试
+	if ok, err := dao.ClaimErasureRequest(got, time.Now().Add(lease)); err != nil || ok {
+		t.Fatalf("claimed failed request: %v, %v", ok, err)
+	}
+}
+
+func TestExecuteInvalidSubject(t *testing.T) {
+	var calls []string
+	setErasers(t, countingEraser("ok", &calls, nil))
+	r := createRequest(t, &model.User{ID: 9004, Name: "invalid_subject"})
+	r.Subject = "{"
+	execute(context.Background(), config.ErasureConf{MaxAttempts: 3}, r)
+	if got := getRequest(t, r.ID); got.Status != dao.ErasureFailed || len(calls) != 0 {
+		t.Fatalf("got %+v, calls %v", got, calls)
+	}
+}
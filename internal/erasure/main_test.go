@@ -0,0 +1,104 @@
+package erasure
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/utils"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var createIndexPattern = regexp.MustCompile("^CREATE (UNIQUE )?INDEX `(\\w+)` ON `(\\w+)`")
+
+// testRedis 测试使用的内存 redis
+var testRedis *miniredis.Miniredis
+
+// TestMain 使用内存 redis 和 SQLite 代替外部依赖，配置在首次读取前写入临时文件
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gous-erasure-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	testRedis, err = miniredis.Run()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer testRedis.Close()
+
+	confFile := filepath.Join(dir, "app.yml")
+	if err := os.WriteFile(confFile, []byte(testConfig(testRedis.Port(), dir)), 0600); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	config.SetConfigFile(confFile)
+	config.GetGlobalConf()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")+"?_pragma=busy_timeout(5000)"),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	// MySQL 的索引名只需表内唯一，SQLite 要求全库唯一，建索引时加上表名前缀；
+	// SQLite 驱动只按 datetime 类型解析时间，审计日志的 datetime(3) 列建表时去掉精度
+	err = db.Callback().Raw().Before("gorm:raw").Register("test:index_name", func(tx *gorm.DB) {
+		sql := tx.Statement.SQL.String()
+		if m := createIndexPattern.FindStringSubmatch(sql); m != nil {
+			sql = strings.Replace(sql, "`"+m[2]+"`", "`"+m[3]+"_"+m[2]+"`", 1)
+		} else if strings.HasPrefix(sql, "CREATE TABLE") {
+			sql = strings.ReplaceAll(sql, "datetime(3)", "datetime")
+		}
+		tx.Statement.SQL.Reset()
+		tx.Statement.SQL.WriteString(sql)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	utils.SetDB(db)
+	if err := dao.Migrate(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return m.Run()
+}
+
+func testConfig(redisPort, dir string) string {
+	return fmt.Sprintf(`
+redis:
+  rhost: 127.0.0.1
+  rport: %s
+cache:
+  session_expired: 3600
+  user_expired: 3600
+audit:
+  enabled: true
+  hmac_key: "test-audit-key"
+login_history:
+  enabled: false
+webhook:
+  enabled: false
+data_export:
+  dir: %q
+erasure:
+  max_attempts: 3
+  initial_backoff: 60
+  max_backoff: 3600
+`, redisPort, dir)
+}
@@ -0,0 +1,191 @@
+package erasure
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/export"
+	"Gous/internal/model"
+	"Gous/pkg/constant"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	pageSize = 500
+	erased   = "[erased]" // 替换审计日志中个人数据的内容
+)
+
+// eraseSessions 删除用户在所有设备上的会话及 CSRF token
+func eraseSessions(_ context.Context, s *Subject) (int64, error) {
+	ttls, err := cache.UserSessionTTLs(s.UserName)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ttls)), cache.DelUserSessions(s.UserName)
+}
+
+func eraseOAuthRefresh(_ context.Context, s *Subject) (int64, error) {
+	return cache.DelUserOAuthRefresh(s.UserID)
+}
+
+// eraseCacheKeys 删除以用户名、邮箱、手机号为 key 的缓存：用户信息、登录标识映射、验证码、发送频率限制
+func eraseCacheKeys(_ context.Context, s *Subject) (int64, error) {
+	name := cache.EscapePattern(s.UserName)
+	patterns := []string{
+		constant.UserInfoPrefix + name,
+		constant.VerifyResendKey + name,
+		constant.VerifyCountKey + name + "_*",
+	}
+	for kind, value := range map[string]*string{constant.IdentEmail: s.Email, constant.IdentPhone: s.Phone} {
+		if value == nil || *value == "" {
+			continue
+		}
+		target := kind + "_" + cache.EscapePattern(*value)
+		patterns = append(patterns,
+			constant.UserIdentPrefix+target,
+			constant.OtpKeyPrefix+target,
+			constant.OtpCooldownKey+target,
+		)
+	}
+	var total int64
+	for _, p := range patterns {
+		n, err := cache.DelKeysByPattern(p)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// eraseDataExports 删除导出文件和导出记录，导出进行中时等待其结束后重试
+func eraseDataExports(_ context.Context, s *Subject) (int64, error) {
+	list, err := dao.ListDataExports(s.UserID, pageSize)
+	if err != nil {
+		return 0, err
+	}
+	conf := config.GetGlobalConf().DataExport
+	for _, e := range list {
+		if e.Status == dao.ExportRunning {
+			return 0, fmt.Errorf("export %d is running", e.ID)
+		}
+		if e.File == "" {
+			continue
+		}
+		if err := os.Remove(export.Path(conf, e.File)); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	return dao.DeleteUserRows(&model.DataExport{}, s.UserID)
+}
+
+func eraseWebhookDeliveries(_ context.Context, s *Subject) (int64, error) {
+	n, pending, err := dao.DeleteUserWebhookDeliveries(s.UserID)
+	if err == nil && pending > 0 {
+		err = fmt.Errorf("%d deliveries are still pending", pending)
+	}
+	return n, err
+}
+
+func eraseOutboxEvents(_ context.Context, s *Subject) (int64, error) {
+	n, pending, err := dao.DeleteUserOutboxEvents(strconv.Itoa(s.UserID))
+	if err == nil && pending > 0 {
+		err = fmt.Errorf("%d events are not published yet", pending)
+	}
+	return n, err
+}
+
+// pseudonymizeAuditLogs 审计日志需要保留操作记录，不删除，把用户名替换为假名，
+// 清空用户自己操作时的 IP、User-Agent，以及对其资料修改前后的值
+func pseudonymizeAuditLogs(ctx context.Context, s *Subject) (int64, error) {
+	key := config.GetGlobalConf().Audit.HmacKey
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		// 处理过的记录不再匹配条件，每次都取第一页
+		list, _, err := dao.FindAuditLogs("actor = ? OR target = ?", []interface{}{s.UserName, s.UserName}, 0, pageSize)
+		if err != nil {
+			return total, err
+		}
+		changed := 0
+		for _, e := range list {
+			before := e.Redacted
+			audit.Redact(e, s.auditValues(e), key)
+			if e.Redacted == before {
+				continue
+			}
+			if err := dao.UpdateAuditLogRedaction(e); err != nil {
+				return total, err
+			}
+			changed++
+		}
+		total += int64(changed)
+		// 数据库按排序规则匹配，与用户名写法不同但仍匹配的记录无法处理时避免死循环
+		if changed == 0 && len(list) > 0 {
+			return total, fmt.Errorf("audit log %d matches the user but was not pseudonymized", list[0].ID)
+		}
+		if len(list) < pageSize {
+			return total, nil
+		}
+	}
+}
+
+// auditValues 记录中需要替换的字段及替换后的内容
+func (s *Subject) auditValues(e *model.AuditLog) map[string]string {
+	values := map[string]string{audit.FieldReason: s.scrub(e.Reason)}
+	// 数据库中用户名比较不区分大小写
+	if strings.EqualFold(e.Actor, s.UserName) {
+		values[audit.FieldActor] = s.Pseudonym
+		values[audit.FieldIP] = ""
+		values[audit.FieldUserAgent] = ""
+	}
+	if strings.EqualFold(e.Target, s.UserName) {
+		values[audit.FieldTarget] = s.Pseudonym
+		values[audit.FieldChanges] = scrubChanges(e.Changes)
+	}
+	return values
+}
+
+// scrub 替换文本中的用户名、邮箱、手机号
+func (s *Subject) scrub(text string) string {
+	// 同一位置按参数顺序匹配，邮箱可能以用户名开头，先替换邮箱
+	var pairs []string
+	if s.Email != nil && *s.Email != "" {
+		pairs = append(pairs, *s.Email, erased)
+	}
+	if s.Phone != nil && *s.Phone != "" {
+		pairs = append(pairs, *s.Phone, erased)
+	}
+	pairs = append(pairs, s.UserName, s.Pseudonym)
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// scrubChanges 保留修改了哪些字段，清除修改前后的值
+func scrubChanges(changes string) string {
+	if changes == "" {
+		return ""
+	}
+	m := map[string]audit.Change{}
+	if err := json.Unmarshal([]byte(changes), &m); err != nil {
+		return ""
+	}
+	for k, c := range m {
+		if c.From != nil {
+			c.From = erased
+		}
+		if c.To != nil {
+			c.To = erased
+		}
+		m[k] = c
+	}
+	raw, _ := json.Marshal(m)
+	return string(raw)
+}
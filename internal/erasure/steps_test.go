@@ -0,0 +1,234 @@
+package erasure
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestScrubChanges(t *testing.T) {
+	cases := []struct {
+		name, changes, want string
+	}{
+		{"empty", "", ""},
+		{"invalid", "{", ""},
+		{"values", `{"email":{"from":"a@example.com","to":"b@example.com"}}`, `{"email":{"from":"[erased]","to":"[erased]"}}`},
+		// 新增或清空的字段保留 null，仍能看出修改的方向
+		{"null", `{"phone":{"from":null,"to":"13800000000"},"nickname":{"from":"Babs","to":null}}`,
+			`{"nickname":{"from":"[erased]","to":null},"phone":{"from":null,"to":"[erased]"}}`},
+	}
+	for _, c := range cases {
+		if got := scrubChanges(c.changes); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestAuditValues(t *testing.T) {
+	s := &Subject{UserName: "bjensen", Email: strPtr("bjensen@example.com"), Phone: strPtr("13800000000"), Pseudonym: "erased-1"}
+	changes := `{"email":{"from":"bjensen@example.com","to":"babs@example.com"}}`
+	cases := []struct {
+		name string
+		log  *model.AuditLog
+		want map[string]string
+	}{
+		{"actor", &model.AuditLog{Actor: "BJensen", Target: "client-1", Reason: "bjensen sent code to 13800000000", Changes: changes},
+			map[string]string{
+				audit.FieldActor: "erased-1", audit.FieldIP: "", audit.FieldUserAgent: "",
+				audit.FieldReason: "erased-1 sent code to [erased]",
+			}},
+		{"target", &model.AuditLog{Actor: "admin", Target: "bjensen", Reason: "bjensen@example.com is taken", Changes: changes},
+			map[string]string{
+				audit.FieldTarget: "erased-1", audit.FieldChanges: `{"email":{"from":"[erased]","to":"[erased]"}}`,
+				audit.FieldReason: "[erased] is taken",
+			}},
+		{"both", &model.AuditLog{Actor: "bjensen", Target: "bjensen"},
+			map[string]string{
+				audit.FieldActor: "erased-1", audit.FieldIP: "", audit.FieldUserAgent: "",
+				audit.FieldTarget: "erased-1", audit.FieldChanges: "", audit.FieldReason: "",
+			}},
+	}
+	for _, c := range cases {
+		if got := s.auditValues(c.log); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func findLogs(t *testing.T, where string, args ...interface{}) []*model.AuditLog {
+	t.Helper()
+	list, _, err := dao.FindAuditLogs(where, args, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestPseudonymizeAuditLogs(t *testing.T) {
+	ctx := audit.WithSource(context.Background(), &audit.Source{IP: "203.0.113.7", UserAgent: "curl/8.0"})
+	audit.Record(ctx, &audit.Event{Action: constant.AuditLogin, Actor: "audit_user", Target: "audit_user"})
+	audit.Record(ctx, &audit.Event{Action: constant.AuditProfileUpdate, Actor: "admin", Target: "audit_user",
+		Changes: map[string]audit.Change{"nickname": {From: "Audit", To: "Auditor"}}})
+	audit.Record(ctx, &audit.Event{Action: constant.AuditLogin, Actor: "audit_other", Target: "audit_other"})
+	before := findLogs(t, "")
+	other := findLogs(t, "actor = ?", "audit_other")
+
+	s := &Subject{UserName: "audit_user", Pseudonym: "erased-audit"}
+	n, err := pseudonymizeAuditLogs(context.Background(), s)
+	if err != nil || n != 2 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	// 记录不删除，用户名替换为假名，其他用户的记录不受影响
+	if after := findLogs(t, ""); len(after) != len(before) {
+		t.Fatalf("%d audit logs before, %d after", len(before), len(after))
+	}
+	if list := findLogs(t, "actor = ? OR target = ?", s.UserName, s.UserName); len(list) != 0 {
+		t.Fatalf("%d audit logs still name the user", len(list))
+	}
+	for _, e := range findLogs(t, "target = ?", s.Pseudonym) {
+		if e.Redacted == "" || strings.Contains(e.Changes, "Audit") {
+			t.Fatalf("not pseudonymized: %+v", e)
+		}
+		if e.Actor == s.Pseudonym && (e.IP != "" || e.UserAgent != "") {
+			t.Fatalf("source kept: %+v", e)
+		}
+		if e.Actor == "admin" && e.IP == "" {
+			t.Fatalf("admin source cleared: %+v", e)
+		}
+	}
+	if got := findLogs(t, "actor = ?", "audit_other"); !reflect.DeepEqual(got, other) {
+		t.Fatalf("other user's logs changed: %+v", got[0])
+	}
+	// 哈希链保持完整，假名化的记录仍可校验
+	report, err := audit.Verify(context.Background(), 100, config.GetGlobalConf().Audit.HmacKey, 0, "")
+	if err != nil || len(report.Problems) != 0 || report.Redacted < 2 {
+		t.Fatalf("verify: %+v, %v", report, err)
+	}
+
+	// 再次执行没有需要处理的记录
+	if n, err := pseudonymizeAuditLogs(context.Background(), s); err != nil || n != 0 {
+		t.Fatalf("repeat: %d, %v", n, err)
+	}
+}
+
+func countRows(t *testing.T, m interface{}, userID int) int64 {
+	t.Helper()
+	var n int64
+	if err := utils.GetDB().Model(m).Where("user_id=?", userID).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestEraseUser(t *testing.T) {
+	user := &model.User{Name: "erase_user", PassWord: "secret-password", Email: strPtr("erase@example.com"), Status: constant.UserStatusActive}
+	if err := dao.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.CreateUserIdentity(&model.UserIdentity{UserID: user.ID, Provider: "mock", Subject: "erase-sub"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.CreateAccessToken(&model.AccessToken{UserID: user.ID, TokenHash: "erase-token-hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.CreateLoginHistory(&model.LoginHistory{UserID: user.ID, Result: constant.AuditSuccess, Fingerprint: "fp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.SetSessionInfo(user, "erase-session"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.SetUserIdent(constant.IdentEmail, *user.Email, user.Name); err != nil {
+		t.Fatal(err)
+	}
+	audit.Record(context.Background(), &audit.Event{Action: constant.AuditLogin, Actor: user.Name, Target: user.Name})
+	// 尚未发布的用户删除事件，清除任务等待其发布后才能删除
+	event := &model.OutboxEvent{EventID: "erase-deleted", AggregateID: strconv.Itoa(user.ID), EventType: constant.EventUserDeleted, Payload: "{}", NextAttemptAt: time.Now()}
+	if err := utils.GetDB().Create(event).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRequest(user, RequesterUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.EraseUser(user, r); err != nil {
+		t.Fatal(err)
+	}
+	Process(context.Background(), r)
+
+	got := getRequest(t, r.ID)
+	if got.Status != dao.ErasurePending || got.LastError != "failed steps: outbox_events" {
+		t.Fatalf("after first run: %+v", got)
+	}
+	for _, m := range []interface{}{&model.UserIdentity{}, &model.AccessToken{}, &model.LoginHistory{}} {
+		if n := countRows(t, m, user.ID); n != 0 {
+			t.Fatalf("%T: %d rows left", m, n)
+		}
+	}
+	if _, err := cache.GetSessionInfo("erase-session"); err == nil {
+		t.Fatal("session not erased")
+	}
+	if name, _ := cache.GetUserNameByIdent(constant.IdentEmail, *user.Email); name != "" {
+		t.Fatalf("ident cache not erased: %s", name)
+	}
+	// 某一步失败时审计日志仍然完成假名化
+	logs := findLogs(t, "actor = ?", got.Pseudonym)
+	if len(logs) != 1 || logs[0].Target != got.Pseudonym {
+		t.Fatalf("audit logs %+v", logs)
+	}
+	first := Steps(got)
+
+	// 事件发布后重试：只重新执行失败的步骤，已清除的数据和已假名化的记录不再变化
+	now := time.Now()
+	if err := utils.GetDB().Model(event).Update("published_at", &now).Error; err != nil {
+		t.Fatal(err)
+	}
+	Process(context.Background(), makeDue(t, got))
+	done := getRequest(t, r.ID)
+	if done.Status != dao.ErasureDone || done.Subject != "" {
+		t.Fatalf("after retry: %+v", done)
+	}
+	for i, s := range Steps(done) {
+		if s.Status != dao.ErasureDone {
+			t.Fatalf("step %s: %+v", s.Name, s)
+		}
+		if s.Name != "outbox_events" && !reflect.DeepEqual(s, first[i]) {
+			t.Fatalf("step %s ran again: %+v, was %+v", s.Name, s, first[i])
+		}
+	}
+	if after := findLogs(t, "actor = ?", got.Pseudonym); !reflect.DeepEqual(after, logs) {
+		t.Fatalf("audit logs changed on retry: %+v", after[0])
+	}
+	var n int64
+	utils.GetDB().Model(model.OutboxEvent{}).Where("aggregate_id=?", strconv.Itoa(user.ID)).Count(&n)
+	if n != 0 {
+		t.Fatalf("%d outbox events left", n)
+	}
+
+	// 数据已清除，所有步骤再次执行也不报错
+	s := &Subject{UserID: user.ID, UserName: user.Name, Email: user.Email, Pseudonym: got.Pseudonym}
+	for _, e := range erasers {
+		if _, err := e.Erase(context.Background(), s); err != nil {
+			t.Fatalf("repeat %s: %v", e.Name, err)
+		}
+	}
+	raw, _ := json.Marshal(findLogs(t, "actor = ?", got.Pseudonym))
+	if strings.Contains(string(raw), user.Name) {
+		t.Fatalf("user name left in audit logs: %s", raw)
+	}
+}
@@ -0,0 +1,258 @@
+package export
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const pageSize = 500 // 登录记录、审计日志等分页读取时每页的条数
+
+// Section 导出文件中的一部分个人数据，写入 <name>.json
+type Section struct {
+	Name    string
+	Collect func(ctx context.Context, user *model.User) (interface{}, error)
+}
+
+var (
+	sectionsMu sync.RWMutex
+	// sections 按顺序写入导出文件，新增保存个人数据的表时在这里或通过 Register 添加
+	sections = []Section{
+		{"user", collectUser},
+		{"identities", collectIdentities},
+		{"access_tokens", collectAccessTokens},
+		{"oauth_consents", collectOAuthConsents},
+		{"groups", collectGroups},
+		{"sessions", collectSessions},
+		{"login_history", collectLoginHistory},
+		{"audit_logs", collectAuditLogs},
+	}
+)
+
+// Register 注册新的导出内容，name 不能与已有的重复
+func Register(s Section) {
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	sections = append(sections, s)
+}
+
+// manifest 导出文件的说明，写入 manifest.json
+type manifest struct {
+	UserID      int       `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// Write 收集用户的全部个人数据，写入 zip 文件
+func Write(ctx context.Context, user *model.User, w io.Writer) error {
+	sectionsMu.RLock()
+	list := make([]Section, len(sections))
+	copy(list, sections)
+	sectionsMu.RUnlock()
+
+	zw := zip.NewWriter(w)
+	m := &manifest{UserID: user.ID, UserName: user.Name, GeneratedAt: time.Now()}
+	for _, s := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := s.Collect(ctx, user)
+		if err != nil {
+			return fmt.Errorf("collect %s: %v", s.Name, err)
+		}
+		name := s.Name + ".json"
+		if err := writeJSON(zw, name, data); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, name)
+	}
+	if err := writeJSON(zw, "manifest.json", m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, data interface{}) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// collectUser 账号资料，不含密码
+func collectUser(_ context.Context, u *model.User) (interface{}, error) {
+	return map[string]interface{}{
+		"id":             u.ID,
+		"user_name":      u.Name,
+		"nickname":       u.NickName,
+		"gender":         u.Gender,
+		"age":            u.Age,
+		"email":          u.Email,
+		"email_verified": u.EmailVerified,
+		"phone":          u.Phone,
+		"phone_verified": u.PhoneVerified,
+		"status":         u.Status,
+		"source":         u.Source,
+		"role":           u.Role,
+		"external_id":    u.ExternalID,
+		"create_time":    u.CreateTime,
+		"update_time":    u.UpdateTime,
+	}, nil
+}
+
+func collectIdentities(_ context.Context, u *model.User) (interface{}, error) {
+	list, err := dao.ListUserIdentities(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, 0, len(list))
+	for _, i := range list {
+		items = append(items, map[string]interface{}{
+			"provider":    i.Provider,
+			"subject":     i.Subject,
+			"email":       i.Email,
+			"create_time": i.CreateTime,
+		})
+	}
+	return items, nil
+}
+
+// collectAccessTokens 个人访问令牌，不含令牌摘要
+func collectAccessTokens(_ context.Context, u *model.User) (interface{}, error) {
+	list, err := dao.ListAccessTokens(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, 0, len(list))
+	for _, t := range list {
+		items = append(items, map[string]interface{}{
+			"name":         t.Name,
+			"hint":         t.Hint,
+			"scopes":       strings.Fields(t.Scopes),
+			"expire_time":  t.ExpireTime,
+			"last_used_at": t.LastUsedAt,
+			"last_used_ip": t.LastUsedIP,
+			"create_time":  t.CreateTime,
+		})
+	}
+	return items, nil
+}
+
+func collectOAuthConsents(_ context.Context, u *model.User) (interface{}, error) {
+	list, err := dao.ListOAuthConsents(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, 0, len(list))
+	for _, c := range list {
+		item := map[string]interface{}{
+			"client_id":   c.ClientID,
+			"scopes":      strings.Fields(c.Scopes),
+			"update_time": c.UpdateTime,
+		}
+		if client, err := dao.GetOAuthClient(c.ClientID); err == nil && client != nil {
+			item["client_name"] = client.Name
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func collectGroups(_ context.Context, u *model.User) (interface{}, error) {
+	list, err := dao.ListGroupMembers(nil, []int{u.ID})
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(list))
+	for _, m := range list {
+		groups = append(groups, m.DisplayName)
+	}
+	return groups, nil
+}
+
+// collectSessions 当前有效的会话，会话 id 可以直接用于登录，只保留前几位
+func collectSessions(_ context.Context, u *model.User) (interface{}, error) {
+	ttls, err := cache.UserSessionTTLs(u.Name)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, 0, len(ttls))
+	for s, ttl := range ttls {
+		if len(s) > 8 {
+			s = s[:8] + "..."
+		}
+		items = append(items, map[string]interface{}{
+			"session":     s,
+			"expire_time": time.Now().Add(ttl).Truncate(time.Second),
+		})
+	}
+	return items, nil
+}
+
+func collectLoginHistory(_ context.Context, u *model.User) (interface{}, error) {
+	items := []map[string]interface{}{}
+	for offset := 0; ; offset += pageSize {
+		list, _, err := dao.ListLoginHistory(u.ID, offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range list {
+			items = append(items, map[string]interface{}{
+				"time":       h.CreateTime,
+				"method":     h.Method,
+				"result":     h.Result,
+				"reason":     h.Reason,
+				"ip":         h.IP,
+				"user_agent": h.UserAgent,
+				"browser":    h.Browser,
+				"os":         h.OS,
+				"device":     h.Device,
+			})
+		}
+		if len(list) < pageSize {
+			return items, nil
+		}
+	}
+}
+
+// collectAuditLogs 用户作为操作者或被操作对象的审计日志
+func collectAuditLogs(_ context.Context, u *model.User) (interface{}, error) {
+	items := []map[string]interface{}{}
+	for offset := 0; ; offset += pageSize {
+		list, _, err := dao.FindAuditLogs("actor = ? OR target = ?", []interface{}{u.Name, u.Name}, offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			item := map[string]interface{}{
+				"time":       e.CreateTime,
+				"action":     e.Action,
+				"result":     e.Result,
+				"actor":      e.Actor,
+				"target":     e.Target,
+				"ip":         e.IP,
+				"user_agent": e.UserAgent,
+				"reason":     e.Reason,
+			}
+			if e.Changes != "" {
+				item["changes"] = json.RawMessage(e.Changes)
+			}
+			items = append(items, item)
+		}
+		if len(list) < pageSize {
+			return items, nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package export
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	batchSize  = 10
+	staleAfter = 30 * time.Minute // 执行超过该时间的任务视为实例已退出，重新执行
+)
+
+var waker = utils.NewWaker()
+
+// Wakeup 有新的导出任务时立即扫描，不必等到下一个扫描周期
+func Wakeup() {
+	waker.Wake()
+}
+
+// Run 后台导出任务，定期执行等待中的导出并删除过期文件，多个实例可以同时运行
+func Run(ctx context.Context) {
+	for {
+		conf := config.GetGlobalConf().DataExport
+		if conf.Enabled {
+			runOnce(ctx, conf)
+		}
+		interval := time.Duration(conf.PollInterval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		if !waker.Sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+func runOnce(ctx context.Context, conf config.DataExportConf) {
+	_ = dao.ResetStaleDataExports(time.Now().Add(-staleAfter))
+	list, err := dao.PendingDataExports(batchSize)
+	if err != nil {
+		return
+	}
+	for _, e := range list {
+		if ctx.Err() != nil {
+			return
+		}
+		ok, err := dao.ClaimDataExport(e.ID, time.Now())
+		if err != nil || !ok {
+			continue
+		}
+		process(ctx, conf, e)
+	}
+	removeExpired(conf)
+}
+
+// process 执行导出任务，先写入临时文件，完成后再改名，避免下载到不完整的文件
+func process(ctx context.Context, conf config.DataExportConf, e *model.DataExport) {
+	file, size, err := writeFile(ctx, conf, e)
+	now := time.Now()
+	if err != nil {
+		log.Errorf("export|export %d for %s err:%v", e.ID, e.UserName, err)
+		_ = dao.UpdateDataExport(e.ID, map[string]interface{}{
+			"status":      dao.ExportFailed,
+			"error":       utils.Truncate(err.Error(), 512),
+			"finish_time": now,
+		})
+		return
+	}
+	log.Infof("export|export %d for %s done, %d bytes", e.ID, e.UserName, size)
+	_ = dao.UpdateDataExport(e.ID, map[string]interface{}{
+		"status":      dao.ExportDone,
+		"file":        file,
+		"size":        size,
+		"finish_time": now,
+		"expire_time": now.Add(time.Duration(conf.Retention) * time.Hour),
+	})
+}
+
+func writeFile(ctx context.Context, conf config.DataExportConf, e *model.DataExport) (string, int64, error) {
+	user, err := dao.GetUserByID(e.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+	if user == nil {
+		return "", 0, fmt.Errorf("user %d not found", e.UserID)
+	}
+	if err := os.MkdirAll(conf.Dir, 0700); err != nil {
+		return "", 0, err
+	}
+	// 文件名带随机数，避免被猜到
+	suffix, err := utils.RandomToken(8)
+	if err != nil {
+		return "", 0, err
+	}
+	file := fmt.Sprintf("%d-%s.zip", e.ID, suffix)
+	path := Path(conf, file)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+	err = Write(ctx, user, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", 0, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return file, st.Size(), nil
+}
+
+// removeExpired 删除超过保留时间的导出文件
+func removeExpired(conf config.DataExportConf) {
+	list, err := dao.ExpiredDataExports(time.Now(), batchSize)
+	if err != nil {
+		return
+	}
+	for _, e := range list {
+		if err := os.Remove(Path(conf, e.File)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("export|remove %s err:%v", e.File, err)
+			continue
+		}
+		_ = dao.UpdateDataExport(e.ID, map[string]interface{}{"status": dao.ExportExpired})
+	}
+}
+
+// Path 导出文件的完整路径
+func Path(conf config.DataExportConf, file string) string {
+	return filepath.Join(conf.Dir, filepath.Base(file))
+}
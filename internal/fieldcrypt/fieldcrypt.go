@@ -0,0 +1,367 @@
+package fieldcrypt
+
+import (
+	"Gous/config"
+	"Gous/internal/model"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 密文格式为 enc:v1:<数据密钥 id>:<base64(nonce|密文)>，不带前缀的值视为加密前写入的明文
+const prefix = "enc:v1:"
+
+// 数据密钥的用途和状态
+const (
+	PurposeData  = "data"  // 加密字段
+	PurposeIndex = "index" // 计算盲索引，不轮换，更换后需要重新计算全部盲索引
+	KeyActive    = "active"
+	KeyRetired   = "retired" // 只用于解密，数据全部重新加密后仍保留，避免备份中的数据无法读取
+)
+
+const indexKeyName = "blind-index"
+
+// RefreshInterval 定期重新读取数据密钥，轮换后其他实例在该时间内切换到新密钥
+const RefreshInterval = time.Minute
+
+// Store 数据密钥的存储，由 dao 注册，避免 dao 与本包循环依赖
+type Store interface {
+	ListDataKeys() ([]*model.DataKey, error)
+	// CreateDataKey 创建密钥，retire 为 true 时在同一事务中把其他同用途的密钥标记为 retired
+	CreateDataKey(k *model.DataKey, retire bool) error
+	// RewrapDataKey 更换加密数据密钥的主密钥，密钥已被其他实例修改时返回 false
+	RewrapDataKey(k *model.DataKey, masterKeyID, wrapped string) (bool, error)
+}
+
+var store Store
+
+// SetStore 注册数据密钥的存储
+func SetStore(s Store) {
+	store = s
+}
+
+// keyring 已解密的数据密钥，加载后不再修改，重新加载时整体替换
+type keyring struct {
+	keys     map[int][]byte // 数据密钥 id -> 密钥
+	active   int            // 加密新数据使用的数据密钥
+	index    []byte         // 盲索引密钥
+	loadTime time.Time
+}
+
+var (
+	current atomic.Pointer[keyring]
+	loadMu  sync.Mutex
+)
+
+// Enabled 是否加密写入
+func Enabled() bool {
+	return config.GetGlobalConf().Encryption.Enabled
+}
+
+// Encrypt 加密字段值，column 为 表名.字段名，作为附加数据防止密文被挪到其他字段。
+// 未开启加密或值为空时原样返回
+func Encrypt(column, plain string) (string, error) {
+	if plain == "" || !Enabled() {
+		return plain, nil
+	}
+	r, err := load(RefreshInterval)
+	if err != nil {
+		return "", err
+	}
+	key, ok := r.keys[r.active]
+	if !ok {
+		return "", fmt.Errorf("encrypt %s: no active data key", column)
+	}
+	data, err := seal(key, []byte(column), []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return prefix + strconv.Itoa(r.active) + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt 解密字段值，不是密文时原样返回，关闭加密后已加密的数据仍可读取
+func Decrypt(column, value string) (string, error) {
+	id, data, ok, err := parse(value)
+	if err != nil || !ok {
+		return value, err
+	}
+	r, err := load(RefreshInterval)
+	if err != nil {
+		return "", err
+	}
+	key, ok := r.keys[id]
+	if !ok {
+		// 其他实例刚创建的密钥
+		if r, err = load(time.Second); err != nil {
+			return "", err
+		}
+		if key, ok = r.keys[id]; !ok {
+			return "", fmt.Errorf("decrypt %s: data key %d not found", column, id)
+		}
+	}
+	plain, err := open(key, []byte(column), data)
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %v", column, err)
+	}
+	return string(plain), nil
+}
+
+// KeyID 返回加密该值的数据密钥 id，不是密文时 ok 为 false
+func KeyID(value string) (id int, ok bool) {
+	id, _, ok, err := parse(value)
+	return id, ok && err == nil
+}
+
+// ActiveKeyID 当前加密新数据使用的数据密钥 id
+func ActiveKeyID() (int, error) {
+	r, err := load(RefreshInterval)
+	if err != nil {
+		return 0, err
+	}
+	return r.active, nil
+}
+
+// BlindIndex 计算用于等值查询的盲索引，不区分大小写，与数据库排序规则一致。
+// 未开启加密或值为空时返回空字符串
+func BlindIndex(column, value string) (string, error) {
+	if value == "" || !Enabled() {
+		return "", nil
+	}
+	r, err := load(RefreshInterval)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, r.index)
+	mac.Write([]byte(column + ":" + strings.ToLower(value)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// NewDataKey 生成新的数据密钥用于加密，其余数据密钥改为只用于解密，返回新密钥的 id
+func NewDataKey() (int, error) {
+	masters, err := masterKeys()
+	if err != nil {
+		return 0, err
+	}
+	k, err := newKey(masters[0], PurposeData, fmt.Sprintf("data-%d", time.Now().UnixNano()))
+	if err != nil {
+		return 0, err
+	}
+	if err := store.CreateDataKey(k, true); err != nil {
+		return 0, err
+	}
+	if _, err := load(0); err != nil {
+		return 0, err
+	}
+	return k.ID, nil
+}
+
+// RewrapKeys 用当前主密钥重新加密其他主密钥加密的数据密钥，完成后旧主密钥可以从配置中移除
+func RewrapKeys() (int, error) {
+	masters, err := masterKeys()
+	if err != nil {
+		return 0, err
+	}
+	list, err := store.ListDataKeys()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, k := range list {
+		if k.MasterKeyID == masters[0].ID {
+			continue
+		}
+		key, err := unwrap(masters, k)
+		if err != nil {
+			return n, err
+		}
+		wrapped, err := wrap(masters[0], k.Name, key)
+		if err != nil {
+			return n, err
+		}
+		ok, err := store.RewrapDataKey(k, masters[0].ID, wrapped)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	_, err = load(0)
+	return n, err
+}
+
+// load 返回已加载的密钥，超过 maxAge 时重新从数据库读取
+func load(maxAge time.Duration) (*keyring, error) {
+	if r := current.Load(); r != nil && time.Since(r.loadTime) < maxAge {
+		return r, nil
+	}
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if r := current.Load(); r != nil && time.Since(r.loadTime) < maxAge {
+		return r, nil
+	}
+	r, err := loadKeyring()
+	if err != nil {
+		// 数据库暂时不可用时继续使用已加载的密钥
+		if old := current.Load(); old != nil {
+			log.Warnf("fieldcrypt|reload data keys err:%v", err)
+			return old, nil
+		}
+		return nil, err
+	}
+	current.Store(r)
+	return r, nil
+}
+
+// loadKeyring 读取并解密全部数据密钥，开启加密时缺少的密钥自动创建
+func loadKeyring() (*keyring, error) {
+	masters, err := masterKeys()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		list, err := store.ListDataKeys()
+		if err != nil {
+			return nil, err
+		}
+		r := &keyring{keys: map[int][]byte{}, loadTime: time.Now()}
+		for _, k := range list {
+			key, err := unwrap(masters, k)
+			if err != nil {
+				// 缺少主密钥时只影响用该数据密钥加密的数据
+				log.Errorf("fieldcrypt|data key %d: %v", k.ID, err)
+				continue
+			}
+			switch {
+			case k.Purpose == PurposeIndex && k.Name == indexKeyName:
+				r.index = key
+			case k.Purpose == PurposeData:
+				r.keys[k.ID] = key
+				if k.Status == KeyActive && k.ID > r.active {
+					r.active = k.ID
+				}
+			}
+		}
+		if !Enabled() || r.index != nil && r.active != 0 {
+			return r, nil
+		}
+		if i > 0 {
+			return nil, fmt.Errorf("no usable data key, check encryption.master_keys")
+		}
+		// 多个实例同时创建时盲索引密钥按名称去重，数据密钥使用 id 最大的
+		if r.index == nil {
+			if k, err := newKey(masters[0], PurposeIndex, indexKeyName); err == nil {
+				_ = store.CreateDataKey(k, false)
+			}
+		}
+		if r.active == 0 {
+			k, err := newKey(masters[0], PurposeData, fmt.Sprintf("data-%d", time.Now().UnixNano()))
+			if err != nil {
+				return nil, err
+			}
+			if err := store.CreateDataKey(k, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func masterKeys() ([]config.MasterKey, error) {
+	if store == nil {
+		return nil, fmt.Errorf("data key store is not registered")
+	}
+	return config.ParseMasterKeys(config.GetGlobalConf().Encryption.MasterKeys)
+}
+
+// newKey 生成随机密钥并用主密钥加密
+func newKey(master config.MasterKey, purpose, name string) (*model.DataKey, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := wrap(master, name, key)
+	if err != nil {
+		return nil, err
+	}
+	return &model.DataKey{Name: name, Purpose: purpose, MasterKeyID: master.ID, WrappedKey: wrapped, Status: KeyActive}, nil
+}
+
+func wrap(master config.MasterKey, name string, key []byte) (string, error) {
+	data, err := seal(master.Key, []byte("t_data_key."+name), key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func unwrap(masters []config.MasterKey, k *model.DataKey) ([]byte, error) {
+	for _, m := range masters {
+		if m.ID != k.MasterKeyID {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(k.WrappedKey)
+		if err != nil {
+			return nil, err
+		}
+		return open(m.Key, []byte("t_data_key."+k.Name), data)
+	}
+	return nil, fmt.Errorf("master key %s is not configured", k.MasterKeyID)
+}
+
+// parse 解析密文，不是密文时 ok 为 false
+func parse(value string) (id int, data []byte, ok bool, err error) {
+	if !strings.HasPrefix(value, prefix) {
+		return 0, nil, false, nil
+	}
+	idStr, encoded, found := strings.Cut(value[len(prefix):], ":")
+	if id, err = strconv.Atoi(idStr); err != nil || !found {
+		return 0, nil, true, fmt.Errorf("invalid ciphertext")
+	}
+	if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+		return 0, nil, true, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	return id, data, true, nil
+}
+
+// seal AES-256-GCM 加密，返回 nonce|密文
+func seal(key, aad, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plain)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, aad), nil
+}
+
+func open(key, aad, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,384 @@
+package fieldcrypt
+
+import (
+	"Gous/config"
+	"Gous/internal/model"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// 第一个主密钥 new 为当前主密钥，old 模拟轮换前的主密钥
+var (
+	newMaster = bytes.Repeat([]byte{1}, 32)
+	oldMaster = bytes.Repeat([]byte{2}, 32)
+)
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gous-fieldcrypt-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	confFile := filepath.Join(dir, "app.yml")
+	conf := fmt.Sprintf("encryption:\n  enabled: true\n  master_keys: \"new:%s,old:%s\"\n",
+		base64.StdEncoding.EncodeToString(newMaster), base64.StdEncoding.EncodeToString(oldMaster))
+	if err := os.WriteFile(confFile, []byte(conf), 0600); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	config.SetConfigFile(confFile)
+	config.GetGlobalConf()
+	return m.Run()
+}
+
+// memStore 内存中的数据密钥存储，与 dao 的实现一样按名称去重
+type memStore struct {
+	keys []*model.DataKey
+}
+
+func (s *memStore) ListDataKeys() ([]*model.DataKey, error) {
+	list := make([]*model.DataKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		c := *k
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+func (s *memStore) CreateDataKey(k *model.DataKey, retire bool) error {
+	for _, old := range s.keys {
+		if old.Name == k.Name {
+			return fmt.Errorf("duplicate data key %s", k.Name)
+		}
+	}
+	if retire {
+		for _, old := range s.keys {
+			if old.Purpose == k.Purpose && old.Status == KeyActive {
+				old.Status = KeyRetired
+			}
+		}
+	}
+	k.ID = len(s.keys) + 1
+	c := *k
+	s.keys = append(s.keys, &c)
+	return nil
+}
+
+func (s *memStore) RewrapDataKey(k *model.DataKey, masterKeyID, wrapped string) (bool, error) {
+	for _, old := range s.keys {
+		if old.ID == k.ID && old.WrappedKey == k.WrappedKey {
+			old.MasterKeyID, old.WrappedKey = masterKeyID, wrapped
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newStore 使用空的密钥存储，并丢弃已加载的密钥
+func newStore() *memStore {
+	s := &memStore{}
+	SetStore(s)
+	current.Store(nil)
+	return s
+}
+
+func masters(t *testing.T) []config.MasterKey {
+	t.Helper()
+	list, err := masterKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func mustEncrypt(t *testing.T, column, plain string) string {
+	t.Helper()
+	v, err := Encrypt(column, plain)
+	if err != nil {
+		t.Fatalf("Encrypt(%s, %q): %v", column, plain, err)
+	}
+	return v
+}
+
+func mustDecrypt(t *testing.T, column, value string) string {
+	t.Helper()
+	plain, err := Decrypt(column, value)
+	if err != nil {
+		t.Fatalf("Decrypt(%s, %q): %v", column, value, err)
+	}
+	return plain
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	s := newStore()
+	for _, plain := range []string{"bjensen", "张三", "+8613900000000", "a:b,c", strings.Repeat("x", 300)} {
+		v := mustEncrypt(t, "t_user.nickname", plain)
+		if !strings.HasPrefix(v, prefix) || strings.Contains(v, plain) {
+			t.Fatalf("Encrypt(%q) = %q", plain, v)
+		}
+		// nonce 随机，相同明文每次加密结果不同
+		if v2 := mustEncrypt(t, "t_user.nickname", plain); v2 == v {
+			t.Fatalf("Encrypt(%q) is deterministic", plain)
+		}
+		if got := mustDecrypt(t, "t_user.nickname", v); got != plain {
+			t.Fatalf("Decrypt(Encrypt(%q)) = %q", plain, got)
+		}
+	}
+	if v := mustEncrypt(t, "t_user.nickname", ""); v != "" {
+		t.Fatalf("Encrypt(\"\") = %q", v)
+	}
+
+	// 首次使用时自动创建盲索引密钥和数据密钥，都用当前主密钥加密
+	if len(s.keys) != 2 {
+		t.Fatalf("data keys %d, want 2", len(s.keys))
+	}
+	for _, k := range s.keys {
+		if k.MasterKeyID != "new" || k.Status != KeyActive {
+			t.Fatalf("data key %+v", k)
+		}
+	}
+	v := mustEncrypt(t, "t_user.email", "a@example.com")
+	id, ok := KeyID(v)
+	if active, err := ActiveKeyID(); !ok || err != nil || id != active {
+		t.Fatalf("KeyID = %d %v, active %d %v", id, ok, active, err)
+	}
+
+	// 字段名作为附加数据，密文挪到其他字段后无法解密
+	if _, err := Decrypt("t_user.phone", v); err == nil {
+		t.Fatal("ciphertext of t_user.email decrypted as t_user.phone")
+	}
+	// 篡改密文
+	data, _ := base64.StdEncoding.DecodeString(v[strings.LastIndex(v, ":")+1:])
+	data[len(data)-1] ^= 1
+	tampered := v[:strings.LastIndex(v, ":")+1] + base64.StdEncoding.EncodeToString(data)
+	if _, err := Decrypt("t_user.email", tampered); err == nil {
+		t.Fatal("tampered ciphertext decrypted")
+	}
+}
+
+func TestDecryptPlaintext(t *testing.T) {
+	newStore()
+	// 开启加密前写入的明文原样返回
+	for _, v := range []string{"", "bjensen", "18", "a@example.com", "enc:v2:1:AAAA", "ENC:V1:1:AAAA"} {
+		if got := mustDecrypt(t, "t_user.nickname", v); got != v {
+			t.Errorf("Decrypt(%q) = %q", v, got)
+		}
+		if _, ok := KeyID(v); ok {
+			t.Errorf("KeyID(%q) ok", v)
+		}
+	}
+
+	unknown := prefix + "99:" + base64.StdEncoding.EncodeToString(make([]byte, 40))
+	for _, v := range []string{"enc:v1:", "enc:v1:1", "enc:v1:x:AAAA", "enc:v1:1:!!!", "enc:v1:1:AAAA", unknown} {
+		if got, err := Decrypt("t_user.nickname", v); err == nil {
+			t.Errorf("Decrypt(%q) = %q, want error", v, got)
+		}
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	newStore()
+	idx := func(column, value string) string {
+		t.Helper()
+		v, err := BlindIndex(column, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	a := idx("t_user.email", "Bjensen@Example.com")
+	if len(a) != 64 || strings.Contains(a, "example") {
+		t.Fatalf("BlindIndex = %q", a)
+	}
+	if b := idx("t_user.email", "bjensen@example.com"); b != a {
+		t.Fatal("blind index is case sensitive")
+	}
+	if b := idx("t_user.email", "other@example.com"); b == a {
+		t.Fatal("different values share a blind index")
+	}
+	if b := idx("t_user.phone", "bjensen@example.com"); b == a {
+		t.Fatal("different columns share a blind index")
+	}
+	if b := idx("t_user.email", ""); b != "" {
+		t.Fatalf("BlindIndex(\"\") = %q", b)
+	}
+
+	// 数据密钥轮换不影响盲索引
+	if _, err := NewDataKey(); err != nil {
+		t.Fatal(err)
+	}
+	if b := idx("t_user.email", "bjensen@example.com"); b != a {
+		t.Fatal("blind index changed after data key rotation")
+	}
+}
+
+func TestNewDataKey(t *testing.T) {
+	s := newStore()
+	old := mustEncrypt(t, "t_user.nickname", "bjensen")
+	oldID, _ := KeyID(old)
+
+	id, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, err := ActiveKeyID(); err != nil || id == oldID || active != id {
+		t.Fatalf("NewDataKey = %d, active %d %v, old %d", id, active, err, oldID)
+	}
+	for _, k := range s.keys {
+		if k.Purpose == PurposeData && (k.ID == id) != (k.Status == KeyActive) {
+			t.Fatalf("data key %d status %s after rotation", k.ID, k.Status)
+		}
+	}
+	v := mustEncrypt(t, "t_user.nickname", "bjensen")
+	if newID, _ := KeyID(v); newID != id {
+		t.Fatalf("encrypted with key %d, want %d", newID, id)
+	}
+	// 旧密钥只用于解密
+	if got := mustDecrypt(t, "t_user.nickname", old); got != "bjensen" {
+		t.Fatalf("Decrypt(old) = %q", got)
+	}
+
+	// 其他实例创建的密钥，本实例未到刷新时间也能解密，距上次加载不足 1 秒时不重新读取
+	k, err := newKey(masters(t)[0], PurposeData, "data-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateDataKey(k, true); err != nil {
+		t.Fatal(err)
+	}
+	other, err := seal(mustUnwrap(t, masters(t), k), []byte("t_user.nickname"), []byte("babs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v = fmt.Sprintf("%s%d:%s", prefix, k.ID, base64.StdEncoding.EncodeToString(other))
+	r := *current.Load()
+	r.loadTime = time.Now().Add(-time.Second)
+	current.Store(&r)
+	if got := mustDecrypt(t, "t_user.nickname", v); got != "babs" {
+		t.Fatalf("Decrypt(other) = %q", got)
+	}
+}
+
+func mustUnwrap(t *testing.T, masters []config.MasterKey, k *model.DataKey) []byte {
+	t.Helper()
+	key, err := unwrap(masters, k)
+	if err != nil {
+		t.Fatalf("unwrap data key %s: %v", k.Name, err)
+	}
+	return key
+}
+
+func TestWrap(t *testing.T) {
+	m := masters(t)
+	k, err := newKey(m[1], PurposeData, "data-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := mustUnwrap(t, m, k)
+	if len(key) != 32 || k.MasterKeyID != "old" || strings.Contains(k.WrappedKey, base64.StdEncoding.EncodeToString(key)) {
+		t.Fatalf("data key %+v", k)
+	}
+	// 缺少主密钥
+	if _, err := unwrap(m[:1], k); err == nil {
+		t.Fatal("unwrapped without its master key")
+	}
+	// 密钥名称作为附加数据，不能替换成其他密钥
+	renamed := *k
+	renamed.Name = "data-2"
+	if _, err := unwrap(m, &renamed); err == nil {
+		t.Fatal("unwrapped a renamed data key")
+	}
+	// 主密钥 id 相同但内容不同
+	wrong := []config.MasterKey{{ID: "old", Key: newMaster}}
+	if _, err := unwrap(wrong, k); err == nil {
+		t.Fatal("unwrapped with a wrong master key")
+	}
+}
+
+func TestRewrapKeys(t *testing.T) {
+	s := newStore()
+	m := masters(t)
+	// 轮换前用旧主密钥创建的密钥
+	for _, k := range []struct{ purpose, name string }{{PurposeIndex, indexKeyName}, {PurposeData, "data-old"}} {
+		dk, err := newKey(m[1], k.purpose, k.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateDataKey(dk, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := map[int][]byte{}
+	for _, k := range s.keys {
+		before[k.ID] = mustUnwrap(t, m, k)
+	}
+	v := mustEncrypt(t, "t_user.email", "a@example.com")
+	idx, err := BlindIndex("t_user.email", "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := RewrapKeys()
+	if err != nil || n != 2 {
+		t.Fatalf("RewrapKeys = %d %v, want 2", n, err)
+	}
+	// 重新加密后只需要当前主密钥，密钥本身不变
+	for _, k := range s.keys {
+		if k.MasterKeyID != "new" || !bytes.Equal(mustUnwrap(t, m[:1], k), before[k.ID]) {
+			t.Fatalf("data key %s not rewrapped", k.Name)
+		}
+	}
+	current.Store(nil)
+	if got := mustDecrypt(t, "t_user.email", v); got != "a@example.com" {
+		t.Fatalf("Decrypt after rewrap = %q", got)
+	}
+	if got, err := BlindIndex("t_user.email", "a@example.com"); err != nil || got != idx {
+		t.Fatal("blind index changed after rewrap")
+	}
+	if n, err := RewrapKeys(); err != nil || n != 0 {
+		t.Fatalf("second RewrapKeys = %d %v, want 0", n, err)
+	}
+}
+
+func TestMissingMasterKey(t *testing.T) {
+	s := newStore()
+	// 主密钥已从配置中移除的数据密钥不影响其他数据，用它加密的数据无法解密
+	gone := config.MasterKey{ID: "gone", Key: bytes.Repeat([]byte{3}, 32)}
+	k, err := newKey(gone, PurposeData, "data-gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateDataKey(k, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := seal(mustUnwrap(t, []config.MasterKey{gone}, k), []byte("t_user.nickname"), []byte("bjensen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := fmt.Sprintf("%s%d:%s", prefix, k.ID, base64.StdEncoding.EncodeToString(data))
+
+	v := mustEncrypt(t, "t_user.nickname", "babs")
+	if id, _ := KeyID(v); id == k.ID {
+		t.Fatal("encrypted with a data key whose master key is missing")
+	}
+	if got := mustDecrypt(t, "t_user.nickname", v); got != "babs" {
+		t.Fatalf("Decrypt = %q", got)
+	}
+	if _, err := Decrypt("t_user.nickname", lost); err == nil {
+		t.Fatal("decrypted without the master key")
+	}
+	if _, err := RewrapKeys(); err == nil {
+		t.Fatal("RewrapKeys succeeded without the master key")
+	}
+}
@@ -0,0 +1,93 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strconv"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer 字段加密，在 gorm 标签中使用 serializer:encrypted，支持 string、*string 和整数字段。
+// 只在按结构体写入和读取时生效，Updates(map) 和查询条件中的值需要自行调用 Encrypt、BlindIndex
+type Serializer struct{}
+
+// Scan 解密数据库中的值，NULL 对应零值
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	rv := field.ReflectValueOf(ctx, dst)
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+		rv.Set(reflect.Zero(field.FieldType))
+		return nil
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		value = fmt.Sprint(v)
+	}
+	plain, err := Decrypt(Column(field), value)
+	if err != nil {
+		return err
+	}
+	return setValue(rv, plain)
+}
+
+// Value 加密写入数据库的值，nil 指针写入 NULL
+func (Serializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(fieldValue)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	var plain string
+	switch rv.Kind() {
+	case reflect.String:
+		plain = rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		plain = strconv.FormatInt(rv.Int(), 10)
+	default:
+		return nil, fmt.Errorf("encrypted field %s: unsupported type %v", field.Name, field.FieldType)
+	}
+	return Encrypt(Column(field), plain)
+}
+
+// Column 字段对应的 表名.字段名
+func Column(field *schema.Field) string {
+	return field.Schema.Table + "." + field.DBName
+}
+
+func setValue(rv reflect.Value, plain string) error {
+	if rv.Kind() == reflect.Ptr {
+		v := reflect.New(rv.Type().Elem())
+		if err := setValue(v.Elem(), plain); err != nil {
+			return err
+		}
+		rv.Set(v)
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(plain)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if plain == "" {
+			rv.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(plain, 10, 64)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported type %v", rv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package fieldcrypt
+
+import (
+	"Gous/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// rawUser 数据库中保存的原始值
+type rawUser struct {
+	NickName string  `gorm:"column:nickname"`
+	Age      string  `gorm:"column:age"`
+	Email    *string `gorm:"column:email"`
+	Phone    *string `gorm:"column:phone"`
+}
+
+func TestSerializer(t *testing.T) {
+	newStore()
+	db := openDB(t)
+	email := "bjensen@example.com"
+	u := &model.User{Name: "bjensen", NickName: "Barbara", Age: 30, Email: &email}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	raw := rawUser{}
+	if err := db.Table("t_user").Select("nickname, age, email, phone").Where("id=?", u.ID).Scan(&raw).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 整数字段加密后保存为字符串，nil 指针保存为 NULL
+	for _, v := range []string{raw.NickName, raw.Age, *raw.Email} {
+		if !strings.HasPrefix(v, prefix) {
+			t.Fatalf("stored plaintext %q", v)
+		}
+	}
+	if raw.Phone != nil {
+		t.Fatalf("nil phone stored as %q", *raw.Phone)
+	}
+
+	got := &model.User{}
+	if err := db.First(got, u.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.NickName != "Barbara" || got.Age != 30 || got.Email == nil || *got.Email != email || got.Phone != nil {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestSerializerPlaintext(t *testing.T) {
+	newStore()
+	db := openDB(t)
+	// 开启加密前写入的数据，age 为迁移到 varchar 前的整数
+	err := db.Exec("INSERT INTO t_user (name, nickname, age, email, creator, modifier) VALUES (?, ?, ?, ?, '', '')", "babs", "Babs", 42, "babs@example.com").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO t_user (name, nickname, creator, modifier) VALUES (?, ?, '', '')", "empty", "").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := &model.User{}
+	if err := db.Where("name=?", "babs").First(got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.NickName != "Babs" || got.Age != 42 || got.Email == nil || *got.Email != "babs@example.com" {
+		t.Fatalf("got %+v", got)
+	}
+	// 重新保存后加密
+	if err := db.Save(got).Error; err != nil {
+		t.Fatal(err)
+	}
+	raw := rawUser{}
+	if err := db.Table("t_user").Select("nickname, age, email").Where("id=?", got.ID).Scan(&raw).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw.NickName, prefix) || !strings.HasPrefix(raw.Age, prefix) || !strings.HasPrefix(*raw.Email, prefix) {
+		t.Fatalf("not encrypted after save: %+v", raw)
+	}
+
+	// age、email 为 NULL 时读取为零值
+	empty := &model.User{}
+	if err := db.Where("name=?", "empty").First(empty).Error; err != nil {
+		t.Fatal(err)
+	}
+	if empty.NickName != "" || empty.Age != 0 || empty.Email != nil {
+		t.Fatalf("got %+v", empty)
+	}
+}
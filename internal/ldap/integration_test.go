@@ -0,0 +1,210 @@
+package ldap
+
+import (
+	"Gous/config"
+	"errors"
+	"fmt"
+	goldap "github.com/go-ldap/ldap/v3"
+	"os"
+	"testing"
+	"time"
+)
+
+// 连接真实目录的集成测试，设置 GOUS_TEST_LDAP_URL 时运行，例如：
+//
+//	docker run -d -p 389:389 -e LDAP_DOMAIN=example.org -e LDAP_ADMIN_PASSWORD=admin osixia/openldap:1.5.0
+//	GOUS_TEST_LDAP_URL=ldap://localhost:389 go test ./internal/ldap -run Integration
+//
+// 管理员账号和根节点默认与上面的容器一致，可以用 GOUS_TEST_LDAP_ADMIN_DN、GOUS_TEST_LDAP_ADMIN_PASSWORD、
+// GOUS_TEST_LDAP_BASE_DN 修改。测试在根节点下创建临时的 ou，结束后删除
+type testDirectory struct {
+	conn     *goldap.Conn
+	url      string
+	adminDN  string
+	adminPwd string
+	baseDN   string // 本次测试创建的 ou
+	entries  []string
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	url := os.Getenv("GOUS_TEST_LDAP_URL")
+	if url == "" {
+		t.Skip("GOUS_TEST_LDAP_URL not set")
+	}
+	d := &testDirectory{
+		url:      url,
+		adminDN:  envOr("GOUS_TEST_LDAP_ADMIN_DN", "cn=admin,dc=example,dc=org"),
+		adminPwd: envOr("GOUS_TEST_LDAP_ADMIN_PASSWORD", "admin"),
+	}
+	d.baseDN = fmt.Sprintf("ou=gous-test-%d,%s", time.Now().UnixNano(), envOr("GOUS_TEST_LDAP_BASE_DN", "dc=example,dc=org"))
+
+	conn, err := goldap.DialURL(url)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	d.conn = conn
+	if err := conn.Bind(d.adminDN, d.adminPwd); err != nil {
+		conn.Close()
+		t.Fatalf("admin bind: %v", err)
+	}
+	t.Cleanup(d.close)
+
+	d.add(t, d.baseDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	d.add(t, "ou=people,"+d.baseDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	d.add(t, "ou=groups,"+d.baseDN, map[string][]string{"objectClass": {"organizationalUnit"}})
+	return d
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func (d *testDirectory) add(t *testing.T, dn string, attrs map[string][]string) {
+	t.Helper()
+	req := goldap.NewAddRequest(dn, nil)
+	for k, v := range attrs {
+		req.Attribute(k, v)
+	}
+	if err := d.conn.Add(req); err != nil {
+		t.Fatalf("add %s: %v", dn, err)
+	}
+	d.entries = append(d.entries, dn)
+}
+
+// addUser 在 ou=people 下创建用户，返回 DN
+func (d *testDirectory) addUser(t *testing.T, uid, password string) string {
+	dn := fmt.Sprintf("uid=%s,ou=people,%s", uid, d.baseDN)
+	d.add(t, dn, map[string][]string{
+		"objectClass":     {"inetOrgPerson"},
+		"uid":             {uid},
+		"cn":              {uid},
+		"sn":              {uid},
+		"displayName":     {"Test " + uid},
+		"mail":            {uid + "@example.org"},
+		"telephoneNumber": {"+8613900000000"},
+		"userPassword":    {password},
+	})
+	return dn
+}
+
+// addGroup 在 ou=groups 下创建组，返回 DN
+func (d *testDirectory) addGroup(t *testing.T, cn string, members ...string) string {
+	dn := fmt.Sprintf("cn=%s,ou=groups,%s", cn, d.baseDN)
+	d.add(t, dn, map[string][]string{"objectClass": {"groupOfNames"}, "cn": {cn}, "member": members})
+	return dn
+}
+
+// close 按创建的逆序删除节点
+func (d *testDirectory) close() {
+	for i := len(d.entries) - 1; i >= 0; i-- {
+		_ = d.conn.Del(goldap.NewDelRequest(d.entries[i], nil))
+	}
+	d.conn.Close()
+}
+
+func (d *testDirectory) conf(mode string) config.LdapConf {
+	return config.LdapConf{
+		Enabled:        true,
+		Url:            d.url,
+		Timeout:        5,
+		Mode:           mode,
+		UserDNTemplate: "uid=%s,ou=people," + d.baseDN,
+		BindDN:         d.adminDN,
+		BindPassword:   d.adminPwd,
+		BaseDN:         "ou=people," + d.baseDN,
+		UserFilter:     "(uid=%s)",
+		GroupBaseDN:    "ou=groups," + d.baseDN,
+		GroupFilter:    "(member=%s)",
+		DefaultRole:    "user",
+		Attributes: config.LdapAttributeConf{
+			Name:     "uid",
+			Email:    "mail",
+			NickName: "displayName",
+			Phone:    "telephoneNumber",
+		},
+	}
+}
+
+func TestIntegrationAuthenticate(t *testing.T) {
+	dir := newTestDirectory(t)
+	aliceDN := dir.addUser(t, "alice", "alice-password")
+	dir.addUser(t, "bob", "bob-password")
+	admins := dir.addGroup(t, "admins", aliceDN)
+
+	for _, mode := range []string{"search", "bind"} {
+		t.Run(mode, func(t *testing.T) {
+			conf := dir.conf(mode)
+			conf.GroupRoles = []config.LdapGroupRole{{Group: admins, Role: "admin"}}
+
+			entry, err := Authenticate(conf, "alice", "alice-password")
+			if err != nil {
+				t.Fatalf("alice: %v", err)
+			}
+			if !sameDN(entry.DN, aliceDN) {
+				t.Fatalf("dn = %s, want %s", entry.DN, aliceDN)
+			}
+			want := map[string]string{"uid": "alice", "mail": "alice@example.org", "displayName": "Test alice", "telephoneNumber": "+8613900000000"}
+			for k, v := range want {
+				if entry.Attributes[k] != v {
+					t.Fatalf("attribute %s = %q, want %q", k, entry.Attributes[k], v)
+				}
+			}
+			if MapRole(conf, entry.Groups) != "admin" {
+				t.Fatalf("groups %v not mapped to admin", entry.Groups)
+			}
+
+			entry, err = Authenticate(conf, "bob", "bob-password")
+			if err != nil {
+				t.Fatalf("bob: %v", err)
+			}
+			if len(entry.Groups) != 0 || MapRole(conf, entry.Groups) != "user" {
+				t.Fatalf("bob groups %v", entry.Groups)
+			}
+
+			if _, err := Authenticate(conf, "alice", "wrong-password"); err != ErrInvalidCredentials {
+				t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+			}
+			// search 模式能区分用户不存在，bind 模式只能得到密码错误
+			wantMissing := ErrUserNotFound
+			if mode == "bind" {
+				wantMissing = ErrInvalidCredentials
+			}
+			if _, err := Authenticate(conf, "nobody", "password"); err != wantMissing {
+				t.Fatalf("unknown user: got %v, want %v", err, wantMissing)
+			}
+			// 用户名中的过滤器和 DN 特殊字符被转义，不能匹配到其他用户
+			if _, err := Authenticate(conf, "*", "alice-password"); err == nil {
+				t.Fatal("wildcard user name authenticated")
+			}
+		})
+	}
+}
+
+func TestIntegrationAuthenticateServiceAccount(t *testing.T) {
+	dir := newTestDirectory(t)
+	dir.addUser(t, "carol", "carol-password")
+
+	// 服务账号密码错误属于配置问题，不能当作用户密码错误
+	conf := dir.conf("search")
+	conf.BindPassword = "wrong-admin-password"
+	_, err := Authenticate(conf, "carol", "carol-password")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got %v, want a service account bind error", err)
+	}
+
+	// 未配置 group_base_dn 时读取用户的 memberOf 属性，carol 不属于任何组
+	conf = dir.conf("search")
+	conf.GroupBaseDN = ""
+	conf.Attributes.Groups = "memberOf"
+	entry, err := Authenticate(conf, "carol", "carol-password")
+	if err != nil {
+		t.Fatalf("carol: %v", err)
+	}
+	if MapRole(conf, entry.Groups) != "user" {
+		t.Fatalf("groups %v", entry.Groups)
+	}
+}
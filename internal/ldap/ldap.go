@@ -0,0 +1,203 @@
+package ldap
+
+import (
+	"Gous/config"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	goldap "github.com/go-ldap/ldap/v3"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUserNotFound 目录中没有该用户
+	ErrUserNotFound = errors.New("ldap: user not found")
+	// ErrInvalidCredentials 用户存在但密码错误
+	ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+)
+
+// Entry 认证通过的目录用户
+type Entry struct {
+	DN         string
+	Attributes map[string]string // 配置中映射的属性，取第一个值
+	Groups     []string          // 所属组的 DN
+}
+
+// Authenticate 按配置的 bind 或 search 模式校验用户名和密码，成功后读取映射的属性和所属组
+func Authenticate(conf config.LdapConf, username, password string) (*Entry, error) {
+	// 空密码会变成匿名绑定，服务端通常直接返回成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := dial(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var userDN string
+	switch conf.Mode {
+	case "bind":
+		userDN = fmt.Sprintf(conf.UserDNTemplate, goldap.EscapeDN(username))
+	default:
+		if conf.BindDN != "" {
+			if err := conn.Bind(conf.BindDN, conf.BindPassword); err != nil {
+				return nil, fmt.Errorf("ldap: service account bind: %w", err)
+			}
+		}
+		if userDN, err = searchUser(conn, conf, username); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			// bind 模式下无法区分用户不存在和密码错误
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: user bind: %w", err)
+	}
+
+	// 以用户身份读取自己的属性
+	entry, err := readEntry(conn, conf, userDN)
+	if err != nil {
+		return nil, err
+	}
+	if conf.GroupBaseDN != "" {
+		if entry.Groups, err = searchGroups(conn, conf, userDN); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// dial 建立连接，按配置使用 ldaps 或 StartTLS
+func dial(conf config.LdapConf) (*goldap.Conn, error) {
+	timeout := time.Duration(conf.Timeout) * time.Second
+	tlsConf, err := tlsConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := goldap.DialURL(conf.Url,
+		goldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		goldap.DialWithTLSConfig(tlsConf))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: dial %s: %w", conf.Url, err)
+	}
+	conn.SetTimeout(timeout)
+	if conf.StartTLS {
+		if err := conn.StartTLS(tlsConf); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func tlsConfig(conf config.LdapConf) (*tls.Config, error) {
+	tlsConf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if u, err := url.Parse(conf.Url); err == nil {
+		tlsConf.ServerName = u.Hostname()
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ldap: no certificate found in %s", conf.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	return tlsConf, nil
+}
+
+// searchUser 查找用户 DN，找不到或不唯一时视为用户不存在
+func searchUser(conn *goldap.Conn, conf config.LdapConf, username string) (string, error) {
+	req := goldap.NewSearchRequest(conf.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, int(conf.Timeout), false,
+		fmt.Sprintf(conf.UserFilter, goldap.EscapeFilter(username)), []string{"dn"}, nil)
+	res, err := conn.Search(req)
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return "", fmt.Errorf("ldap: search user: %w", err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return "", ErrUserNotFound
+	}
+	return res.Entries[0].DN, nil
+}
+
+// readEntry 读取用户节点上映射的属性
+func readEntry(conn *goldap.Conn, conf config.LdapConf, userDN string) (*Entry, error) {
+	attrs := conf.Attributes
+	var names []string
+	for _, a := range []string{attrs.Name, attrs.Email, attrs.NickName, attrs.Phone, attrs.Groups} {
+		if a != "" {
+			names = append(names, a)
+		}
+	}
+	req := goldap.NewSearchRequest(userDN, goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, int(conf.Timeout), false,
+		"(objectClass=*)", names, nil)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: read user entry: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrUserNotFound
+	}
+	e := res.Entries[0]
+	entry := &Entry{DN: e.DN, Attributes: map[string]string{}}
+	for _, a := range names {
+		if v := e.GetAttributeValue(a); v != "" {
+			entry.Attributes[a] = v
+		}
+	}
+	if attrs.Groups != "" {
+		entry.Groups = e.GetAttributeValues(attrs.Groups)
+	}
+	return entry, nil
+}
+
+// searchGroups 在 group_base_dn 下查找包含该用户的组
+func searchGroups(conn *goldap.Conn, conf config.LdapConf, userDN string) ([]string, error) {
+	req := goldap.NewSearchRequest(conf.GroupBaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(conf.Timeout), false,
+		fmt.Sprintf(conf.GroupFilter, goldap.EscapeFilter(userDN)), []string{"dn"}, nil)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: search groups: %w", err)
+	}
+	groups := make([]string, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+// MapRole 按配置顺序返回第一个匹配组对应的角色，组 DN 比较时忽略大小写和空格
+func MapRole(conf config.LdapConf, groups []string) string {
+	for _, gr := range conf.GroupRoles {
+		for _, g := range groups {
+			if sameDN(gr.Group, g) {
+				return gr.Role
+			}
+		}
+	}
+	return conf.DefaultRole
+}
+
+func sameDN(a, b string) bool {
+	da, errA := goldap.ParseDN(a)
+	db, errB := goldap.ParseDN(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+	return da.EqualFold(db)
+}
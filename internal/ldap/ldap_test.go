@@ -0,0 +1,81 @@
+package ldap
+
+import (
+	"Gous/config"
+	"errors"
+	"testing"
+)
+
+func TestSameDN(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"cn=admins,ou=groups,dc=example,dc=org", "cn=admins,ou=groups,dc=example,dc=org", true},
+		{"CN=Admins,OU=Groups,DC=Example,DC=Org", "cn=admins,ou=groups,dc=example,dc=org", true},
+		{"cn=admins, ou=groups, dc=example, dc=org", "cn=admins,ou=groups,dc=example,dc=org", true},
+		{"cn = admins,ou = groups,dc=example,dc=org", "cn=admins,ou=groups,dc=example,dc=org", true},
+		{"cn=admins,ou=groups,dc=example,dc=org", "cn=users,ou=groups,dc=example,dc=org", false},
+		{"cn=admins,ou=groups,dc=example,dc=org", "cn=admins,ou=groups,dc=example,dc=com", false},
+		// 只比较完整的 DN，前缀相同不算
+		{"cn=admins,dc=example,dc=org", "cn=admins,ou=groups,dc=example,dc=org", false},
+		// 转义的逗号属于属性值
+		{`cn=a\,b,dc=example,dc=org`, "cn=a,b,dc=example,dc=org", false},
+		// 无法解析时按去掉首尾空格、忽略大小写比较
+		{" Not A DN ", "not a dn", true},
+		{"not a dn", "cn=admins,dc=example,dc=org", false},
+	}
+	for _, tt := range tests {
+		if got := sameDN(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameDN(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMapRole(t *testing.T) {
+	conf := config.LdapConf{
+		DefaultRole: "user",
+		GroupRoles: []config.LdapGroupRole{
+			{Group: "cn=admins,ou=groups,dc=example,dc=org", Role: "admin"},
+			{Group: "cn=auditors,ou=groups,dc=example,dc=org", Role: "auditor"},
+		},
+	}
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{name: "no groups", want: "user"},
+		{name: "unmapped group", groups: []string{"cn=staff,ou=groups,dc=example,dc=org"}, want: "user"},
+		{name: "single match", groups: []string{"cn=auditors,ou=groups,dc=example,dc=org"}, want: "auditor"},
+		{name: "case and spaces", groups: []string{"CN=Admins, OU=Groups, DC=example, DC=org"}, want: "admin"},
+		// 按配置顺序取第一个匹配，与用户所属组的顺序无关
+		{name: "config order wins", groups: []string{"cn=auditors,ou=groups,dc=example,dc=org", "cn=admins,ou=groups,dc=example,dc=org"}, want: "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MapRole(conf, tt.groups); got != tt.want {
+				t.Fatalf("MapRole(%v) = %q, want %q", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateEmptyCredentials(t *testing.T) {
+	// 不连接目录，地址无效也直接返回密码错误
+	conf := config.LdapConf{Url: "ldap://127.0.0.1:1", Mode: "bind", UserDNTemplate: "uid=%s,dc=example,dc=org", Timeout: 1}
+	for _, c := range [][2]string{{"", "password"}, {"alice", ""}} {
+		if _, err := Authenticate(conf, c[0], c[1]); err != ErrInvalidCredentials {
+			t.Fatalf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", c[0], c[1], err)
+		}
+	}
+}
+
+func TestAuthenticateUnreachable(t *testing.T) {
+	// 目录不可用时返回的错误与用户不存在、密码错误区分开，调用方据此决定是否回退
+	conf := config.LdapConf{Url: "ldap://127.0.0.1:1", Mode: "bind", UserDNTemplate: "uid=%s,dc=example,dc=org", Timeout: 1}
+	_, err := Authenticate(conf, "alice", "password")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got %v, want a connection error", err)
+	}
+}
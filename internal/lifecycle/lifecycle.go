@@ -0,0 +1,115 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ready int32 // 服务是否就绪，1 表示可以接收流量
+
+	workersMu           sync.Mutex
+	workers             []*worker                                  // 已注册的后台任务，按注册顺序保存
+	rootCtx, rootCancel = context.WithCancel(context.Background()) // 后台任务共享的根上下文
+)
+
+// worker 后台任务
+type worker struct {
+	name string
+	done chan struct{}
+}
+
+// SetReady 设置服务就绪状态，停机前先置为 false 让负载均衡摘除流量
+func SetReady(r bool) {
+	if r {
+		atomic.StoreInt32(&ready, 1)
+		return
+	}
+	atomic.StoreInt32(&ready, 0)
+}
+
+// IsReady 服务是否就绪
+func IsReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
+// Go 启动一个后台任务，fn 需要在 ctx 结束后尽快返回
+func Go(name string, fn func(ctx context.Context)) {
+	w := &worker{name: name, done: make(chan struct{})}
+	workersMu.Lock()
+	workers = append(workers, w)
+	workersMu.Unlock()
+
+	go func() {
+		defer close(w.done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("worker %s panic: %v", name, r)
+			}
+		}()
+		log.Infof("worker %s started", name)
+		fn(rootCtx)
+		log.Infof("worker %s stopped", name)
+	}()
+}
+
+// StopWorkers 通知所有后台任务退出，并按注册的逆序等待其结束
+func StopWorkers(ctx context.Context) error {
+	rootCancel()
+
+	workersMu.Lock()
+	ws := make([]*worker, len(workers))
+	copy(ws, workers)
+	workersMu.Unlock()
+
+	var pending []string
+	for i := len(ws) - 1; i >= 0; i-- {
+		select {
+		case <-ws[i].done:
+		case <-ctx.Done():
+			pending = append(pending, ws[i].name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("workers not stopped in time: %v", pending)
+	}
+	return nil
+}
+
+var (
+	depsMu sync.RWMutex
+	deps   = map[string]error{} // 依赖名 -> 最近一次检测结果，nil 表示正常
+)
+
+// SetDependency 记录依赖的健康状态
+func SetDependency(name string, err error) {
+	depsMu.Lock()
+	defer depsMu.Unlock()
+	deps[name] = err
+}
+
+// Dependencies 返回依赖健康状态快照
+func Dependencies() map[string]error {
+	depsMu.RLock()
+	defer depsMu.RUnlock()
+	m := make(map[string]error, len(deps))
+	for k, v := range deps {
+		m[k] = v
+	}
+	return m
+}
+
+// IsDegraded 是否有依赖处于不可用状态
+func IsDegraded() bool {
+	depsMu.RLock()
+	defer depsMu.RUnlock()
+	for _, err := range deps {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package mailer
+
+import (
+	"Gous/config"
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+// logMailer 只把邮件内容打印到日志，用于开发和测试环境
+type logMailer struct{}
+
+func newLogMailer(config.MailConf) Mailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(_ context.Context, msg *Message) error {
+	log.Infof("mail to=%s|subject=%s|text=%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
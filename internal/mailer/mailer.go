@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"Gous/config"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Message 邮件内容，Text 和 HTML 至少填写一个
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer 邮件发送接口，新的发送方式实现该接口后通过 Register 注册
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]func(conf config.MailConf) Mailer{
+		"log":  newLogMailer,
+		"smtp": newSmtpMailer,
+	}
+)
+
+// Register 注册邮件发送方式，name 对应配置 mail.provider
+func Register(name string, factory func(conf config.MailConf) Mailer) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// Get 根据当前配置获取邮件发送器
+func Get() (Mailer, error) {
+	conf := config.GetGlobalConf().Mail
+	providersMu.RLock()
+	factory, ok := providers[conf.Provider]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown mail provider %q", conf.Provider)
+	}
+	return factory(conf), nil
+}
+
+// SendTemplate 使用模板渲染邮件并发送
+func SendTemplate(ctx context.Context, to, name string, data interface{}) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	m, err := Get()
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
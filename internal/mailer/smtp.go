@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"Gous/config"
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtpMailer 通过 smtp 发送邮件，服务端支持时自动使用 STARTTLS
+type smtpMailer struct {
+	conf config.MailConf
+}
+
+func newSmtpMailer(conf config.MailConf) Mailer {
+	return &smtpMailer{conf: conf}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	addr := net.JoinHostPort(m.conf.SmtpHost, strconv.Itoa(m.conf.SmtpPort))
+	var auth smtp.Auth
+	if m.conf.SmtpUser != "" {
+		auth = smtp.PlainAuth("", m.conf.SmtpUser, m.conf.SmtpPassword, m.conf.SmtpHost)
+	}
+	from, err := mailAddress(m.conf.From)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, from, []string{msg.To}, buildMIME(m.conf.From, msg))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("smtp send err: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mailAddress 从 "Name <addr>" 中取出地址
+func mailAddress(from string) (string, error) {
+	if i, j := bytes.IndexByte([]byte(from), '<'), bytes.IndexByte([]byte(from), '>'); i >= 0 && j > i {
+		return from[i+1 : j], nil
+	}
+	if from == "" {
+		return "", fmt.Errorf("mail.from is empty")
+	}
+	return from, nil
+}
+
+// buildMIME 组装 multipart/alternative 邮件
+func buildMIME(from string, msg *Message) []byte {
+	const boundary = "gous-mail-boundary"
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", boundary)
+	if msg.Text != "" {
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, msg.Text)
+	}
+	if msg.HTML != "" {
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", boundary, msg.HTML)
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes()
+}
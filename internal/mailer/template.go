@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// 邮件模板，每个模板由 <name>.txt 和 <name>.html 组成，
+// txt 中需定义 subject 和 body 两个块，html 为可选的 HTML 正文
+//
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Render 渲染指定名称的邮件模板
+func Render(name string, data interface{}) (*Message, error) {
+	txt := textTemplates.Lookup(name + ".txt")
+	if txt == nil {
+		return nil, fmt.Errorf("mail template %s not found", name)
+	}
+	var subject, body bytes.Buffer
+	if err := txt.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return nil, fmt.Errorf("render %s subject err: %w", name, err)
+	}
+	if err := txt.ExecuteTemplate(&body, name+".body", data); err != nil {
+		return nil, fmt.Errorf("render %s body err: %w", name, err)
+	}
+	msg := &Message{Subject: strings.TrimSpace(subject.String()), Text: strings.TrimSpace(body.String())}
+
+	if html := htmlTemplates.Lookup(name + ".html"); html != nil {
+		var buf bytes.Buffer
+		if err := html.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("render %s html err: %w", name, err)
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
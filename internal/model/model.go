@@ -21,11 +21,280 @@ type User struct {
 	ID       int    `gorm:"column:id"`
 	Name     string `gorm:"column:name"`
 	Gender   string `gorm:"column:gender"`
-	Age      int    `gorm:"column:age"`
+	Age      int    `gorm:"column:age;type:varchar(128);serializer:encrypted"` // 加密后保存为字符串，已有部署的整数列由 gous keys migrate 修改
 	PassWord string `gorm:"column:password"`
-	NickName string `gorm:"column:nickname"`
+	NickName string `gorm:"column:nickname;serializer:encrypted"`
+
+	// 标记 serializer:encrypted 的字段开启 encryption 后加密存储，见 fieldcrypt
+	Email      *string `gorm:"column:email;type:varchar(512);uniqueIndex:uk_email;serializer:encrypted"` // 邮箱，未填写时为 NULL
+	EmailIndex *string `gorm:"column:email_bidx;type:char(64);uniqueIndex:uk_email_bidx" json:"-"`       // 邮箱的盲索引，加密后按邮箱查询和保证唯一
+	Phone      *string `gorm:"column:phone;type:varchar(128);uniqueIndex:uk_phone;serializer:encrypted"` // 手机号，E.164 格式，未填写时为 NULL
+	PhoneIndex *string `gorm:"column:phone_bidx;type:char(64);uniqueIndex:uk_phone_bidx" json:"-"`       // 手机号的盲索引
+
+	EmailVerified bool      `gorm:"column:email_verified;not null;default:false"`               // 邮箱是否已验证
+	PhoneVerified bool      `gorm:"column:phone_verified;not null;default:false"`               // 手机号是否已验证
+	Status        string    `gorm:"column:status;type:varchar(20);not null;default:active"`     // 账号状态，见 constant.UserStatus*
+	Source        string    `gorm:"column:source;type:varchar(20);not null;default:local"`      // 账号来源，见 constant.UserSource*
+	Role          string    `gorm:"column:role;type:varchar(32);not null;default:user"`         // 角色，LDAP 账号按组映射
+	ExternalID    *string   `gorm:"column:external_id;type:varchar(255);index:idx_external_id"` // 身份提供方中的 ID，SCIM 同步时使用
+	UpdateTime    time.Time `gorm:"column:update_time;autoUpdateTime"`                          // 最近修改时间
 }
 
 func (t *User) TableName() string {
 	return "t_user"
 }
+
+// UserIdentity 用户绑定的第三方身份，同一身份提供方下 subject 唯一
+type UserIdentity struct {
+	ID         int       `gorm:"column:id"`
+	UserID     int       `gorm:"column:user_id;not null;index:idx_user_id"`
+	Provider   string    `gorm:"column:provider;type:varchar(64);not null;uniqueIndex:uk_provider_subject"` // 身份提供方名称，对应配置 oidc.providers[].name
+	Subject    string    `gorm:"column:subject;type:varchar(255);not null;uniqueIndex:uk_provider_subject"` // ID token 中的 sub
+	Email      string    `gorm:"column:email;type:varchar(255);not null;default ''"`                        // 绑定时身份提供方返回的邮箱，仅作展示
+	CreateTime time.Time `gorm:"autoCreateTime"`
+}
+
+func (t *UserIdentity) TableName() string {
+	return "t_user_identity"
+}
+
+// OAuthClient 接入统一登录的应用
+type OAuthClient struct {
+	ID           int       `gorm:"column:id"`
+	ClientID     string    `gorm:"column:client_id;type:varchar(64);not null;uniqueIndex:uk_client_id"`
+	SecretHash   string    `gorm:"column:secret_hash;type:varchar(64);not null;default ''"`  // 客户端密钥的 sha256，公开客户端为空
+	Name         string    `gorm:"column:name;type:varchar(100);not null;default ''"`        // 应用名称，展示在授权确认页
+	RedirectURIs string    `gorm:"column:redirect_uris;type:text"`                           // 允许的回调地址，空格分隔，需完全匹配
+	GrantTypes   string    `gorm:"column:grant_types;type:varchar(255);not null;default ''"` // 允许的授权方式，空格分隔
+	Scopes       string    `gorm:"column:scopes;type:varchar(255);not null;default ''"`      // 允许申请的 scope，空格分隔
+	SkipConsent  bool      `gorm:"column:skip_consent;not null;default:false"`               // 内部可信应用跳过授权确认
+	CreateTime   time.Time `gorm:"autoCreateTime"`
+}
+
+func (t *OAuthClient) TableName() string {
+	return "t_oauth_client"
+}
+
+// OAuthConsent 用户同意授权给应用的 scope
+type OAuthConsent struct {
+	ID         int       `gorm:"column:id"`
+	UserID     int       `gorm:"column:user_id;not null;uniqueIndex:uk_user_client"`
+	ClientID   string    `gorm:"column:client_id;type:varchar(64);not null;uniqueIndex:uk_user_client"`
+	Scopes     string    `gorm:"column:scopes;type:varchar(255);not null;default ''"` // 空格分隔
+	UpdateTime time.Time `gorm:"autoUpdateTime"`
+}
+
+func (t *OAuthConsent) TableName() string {
+	return "t_oauth_consent"
+}
+
+// AccessToken 用户创建的个人访问令牌，只保存摘要
+type AccessToken struct {
+	ID         int        `gorm:"column:id"`
+	UserID     int        `gorm:"column:user_id;not null;index:idx_user_id"`
+	Name       string     `gorm:"column:name;type:varchar(100);not null;default ''"`                // 令牌名称，便于用户区分用途
+	TokenHash  string     `gorm:"column:token_hash;type:varchar(64);not null;uniqueIndex:uk_token"` // 令牌的 sha256
+	Hint       string     `gorm:"column:hint;type:varchar(32);not null;default ''"`                 // 前缀加令牌前几位，用于在列表中辨认
+	Scopes     string     `gorm:"column:scopes;type:varchar(255);not null;default ''"`              // 空格分隔
+	ExpireTime *time.Time `gorm:"column:expire_time"`                                               // 过期时间，NULL 表示永不过期
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`                                              // 最近使用时间
+	LastUsedIP string     `gorm:"column:last_used_ip;type:varchar(64);not null;default ''"`         // 最近使用的来源 IP
+	CreateTime time.Time  `gorm:"autoCreateTime"`
+}
+
+func (t *AccessToken) TableName() string {
+	return "t_access_token"
+}
+
+// Group 用户组，由企业身份提供方通过 SCIM 同步
+type Group struct {
+	ID          int       `gorm:"column:id"`
+	DisplayName string    `gorm:"column:display_name;type:varchar(255);not null;uniqueIndex:uk_display_name"`
+	ExternalID  *string   `gorm:"column:external_id;type:varchar(255);index:idx_external_id"` // 身份提供方中的 ID
+	CreateTime  time.Time `gorm:"autoCreateTime"`
+	UpdateTime  time.Time `gorm:"column:update_time;autoUpdateTime"`
+}
+
+func (t *Group) TableName() string {
+	return "t_group"
+}
+
+// GroupMember 组成员
+type GroupMember struct {
+	ID      int `gorm:"column:id"`
+	GroupID int `gorm:"column:group_id;not null;uniqueIndex:uk_group_user"`
+	UserID  int `gorm:"column:user_id;not null;uniqueIndex:uk_group_user;index:idx_user_id"`
+}
+
+func (t *GroupMember) TableName() string {
+	return "t_group_member"
+}
+
+// AuditLog 审计日志，只追加不修改；每条记录的哈希覆盖前一条的哈希，删改任意记录都会使之后的校验失败。
+// 唯一的例外是清除用户个人数据时对其记录假名化，见 HashVersion 和 Redacted
+type AuditLog struct {
+	ID          int64     `gorm:"column:id;primaryKey;autoIncrement:false"`                           // 连续递增，由写入时指定，缺号说明有记录被删除
+	Action      string    `gorm:"column:action;type:varchar(64);not null;index:idx_action"`           // 操作，见 constant.Audit*
+	Result      string    `gorm:"column:result;type:varchar(16);not null"`                            // success 或 failure
+	Actor       string    `gorm:"column:actor;type:varchar(255);not null;default '';index:idx_actor"` // 操作者，用户名或 admin、scim 等
+	Target      string    `gorm:"column:target;type:varchar(255);not null;default '';index:idx_target"`
+	IP          string    `gorm:"column:ip;type:varchar(64);not null;default ''"`
+	UserAgent   string    `gorm:"column:user_agent;type:varchar(512);not null;default ''"`
+	RequestID   string    `gorm:"column:request_id;type:varchar(64);not null;default '';index:idx_request_id"`
+	Reason      string    `gorm:"column:reason;type:varchar(512);not null;default ''"` // 失败原因
+	Changes     string    `gorm:"column:changes;type:text"`                            // 修改前后的值，JSON
+	CreateTime  time.Time `gorm:"column:create_time;type:datetime(3);not null;index:idx_create_time"`
+	PrevHash    string    `gorm:"column:prev_hash;type:varchar(64);not null;default ''"`
+	Hash        string    `gorm:"column:hash;type:varchar(64);not null"`
+	HashVersion int       `gorm:"column:hash_version;not null;default:1"` // 1 哈希覆盖字段内容；2 覆盖个人数据字段的摘要，假名化后仍可用原摘要校验
+	Redacted    string    `gorm:"column:redacted;type:text"`              // 被假名化字段原内容的摘要，JSON，为空表示未假名化
+}
+
+func (t *AuditLog) TableName() string {
+	return "t_audit_log"
+}
+
+// LoginHistory 用户的登录记录，用于用户自查和识别新设备
+type LoginHistory struct {
+	ID          int64     `gorm:"column:id"`
+	UserID      int       `gorm:"column:user_id;not null;index:idx_user_fingerprint,priority:1"`
+	Method      string    `gorm:"column:method;type:varchar(64);not null;default ''"` // 登录方式：password、otp、oidc:<provider>
+	Result      string    `gorm:"column:result;type:varchar(16);not null"`            // success 或 failure
+	Reason      string    `gorm:"column:reason;type:varchar(255);not null;default ''"`
+	IP          string    `gorm:"column:ip;type:varchar(64);not null;default ''"`
+	UserAgent   string    `gorm:"column:user_agent;type:varchar(512);not null;default ''"`
+	Browser     string    `gorm:"column:browser;type:varchar(64);not null;default ''"`
+	OS          string    `gorm:"column:os;type:varchar(64);not null;default ''"`
+	Device      string    `gorm:"column:device;type:varchar(16);not null;default ''"`                                 // desktop、mobile、tablet、bot、other
+	Fingerprint string    `gorm:"column:fingerprint;type:varchar(64);not null;index:idx_user_fingerprint,priority:2"` // 浏览器、系统、设备类型的摘要，不含版本号
+	CreateTime  time.Time `gorm:"column:create_time;autoCreateTime;index:idx_create_time"`
+}
+
+func (t *LoginHistory) TableName() string {
+	return "t_login_history"
+}
+
+// Webhook 事件订阅
+type Webhook struct {
+	ID          int       `gorm:"column:id"`
+	Url         string    `gorm:"column:url;type:varchar(1024);not null"`
+	Secret      string    `gorm:"column:secret;type:varchar(128);not null"`            // 签名密钥，订阅方用来校验请求
+	Events      string    `gorm:"column:events;type:varchar(512);not null;default ''"` // 订阅的事件，空格分隔
+	Description string    `gorm:"column:description;type:varchar(255);not null;default ''"`
+	Enabled     bool      `gorm:"column:enabled;not null;default:true"`
+	CreateTime  time.Time `gorm:"column:create_time;autoCreateTime"`
+	UpdateTime  time.Time `gorm:"column:update_time;autoUpdateTime"`
+}
+
+func (t *Webhook) TableName() string {
+	return "t_webhook"
+}
+
+// WebhookDelivery 一个事件对一个订阅的投递，同时作为待投递队列
+type WebhookDelivery struct {
+	ID             int64      `gorm:"column:id"`
+	WebhookID      int        `gorm:"column:webhook_id;not null;index:idx_webhook_id"`
+	EventID        string     `gorm:"column:event_id;type:varchar(64);not null"` // 同一事件投递给不同订阅时相同，订阅方可用于去重
+	EventType      string     `gorm:"column:event_type;type:varchar(64);not null"`
+	Payload        string     `gorm:"column:payload;type:mediumtext"`
+	Status         string     `gorm:"column:status;type:varchar(16);not null;index:idx_status_next,priority:1"` // pending、success、dead
+	Attempts       int        `gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt  time.Time  `gorm:"column:next_attempt_at;not null;index:idx_status_next,priority:2"`
+	LastStatusCode int        `gorm:"column:last_status_code;not null;default:0"`
+	LastError      string     `gorm:"column:last_error;type:varchar(512);not null;default ''"`
+	LastAttemptAt  *time.Time `gorm:"column:last_attempt_at"`
+	CreateTime     time.Time  `gorm:"column:create_time;autoCreateTime"`
+}
+
+func (t *WebhookDelivery) TableName() string {
+	return "t_webhook_delivery"
+}
+
+// WebhookAttempt 每次投递尝试的记录
+type WebhookAttempt struct {
+	ID           int64     `gorm:"column:id"`
+	DeliveryID   int64     `gorm:"column:delivery_id;not null;index:idx_delivery_id"`
+	StatusCode   int       `gorm:"column:status_code;not null;default:0"` // 0 表示没有收到响应
+	Error        string    `gorm:"column:error;type:varchar(512);not null;default ''"`
+	ResponseBody string    `gorm:"column:response_body;type:text"`     // 响应体前 1KB，便于排查
+	Duration     int       `gorm:"column:duration;not null;default:0"` // 耗时（ms）
+	CreateTime   time.Time `gorm:"column:create_time;autoCreateTime"`
+}
+
+func (t *WebhookAttempt) TableName() string {
+	return "t_webhook_attempt"
+}
+
+// OutboxEvent 待发布的领域事件，与业务数据在同一事务中写入
+type OutboxEvent struct {
+	ID            int64      `gorm:"column:id"`                                             // 自增，同一用户的事件按 id 顺序发布
+	EventID       string     `gorm:"column:event_id;type:varchar(64);not null;uniqueIndex"` // 幂等键，消费方据此去重
+	AggregateID   string     `gorm:"column:aggregate_id;type:varchar(64);not null"`         // 事件所属的用户 id
+	EventType     string     `gorm:"column:event_type;type:varchar(64);not null"`
+	Payload       string     `gorm:"column:payload;type:mediumtext"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null"`
+	LastError     string     `gorm:"column:last_error;type:varchar(512);not null;default ''"`
+	PublishedAt   *time.Time `gorm:"column:published_at;index:idx_published_at"` // 为空表示未发布
+	DeadAt        *time.Time `gorm:"column:dead_at"`                             // 发布次数用尽的时间，不为空时不再自动发布
+	CreateTime    time.Time  `gorm:"column:create_time;autoCreateTime"`
+}
+
+func (t *OutboxEvent) TableName() string {
+	return "t_outbox_event"
+}
+
+// DataExport 个人数据导出任务
+type DataExport struct {
+	ID         int        `gorm:"column:id"`
+	UserID     int        `gorm:"column:user_id;not null;index:idx_user_id"`
+	UserName   string     `gorm:"column:user_name;type:varchar(255);not null"`
+	Status     string     `gorm:"column:status;type:varchar(16);not null;index:idx_status"` // pending、running、done、failed、expired
+	File       string     `gorm:"column:file;type:varchar(255);not null;default ''"`        // 导出目录下的文件名
+	Size       int64      `gorm:"column:size;not null;default:0"`
+	Error      string     `gorm:"column:error;type:varchar(512);not null;default ''"`
+	StartTime  *time.Time `gorm:"column:start_time"`
+	FinishTime *time.Time `gorm:"column:finish_time"`
+	ExpireTime *time.Time `gorm:"column:expire_time"` // 文件删除时间
+	CreateTime time.Time  `gorm:"column:create_time;autoCreateTime"`
+}
+
+func (t *DataExport) TableName() string {
+	return "t_data_export"
+}
+
+// ErasureRequest 账号注销后清除个人数据的任务，按步骤执行，失败的步骤重试，完成的步骤不重复执行
+type ErasureRequest struct {
+	ID            int        `gorm:"column:id"`
+	UserID        int        `gorm:"column:user_id;not null;index:idx_user_id"`
+	Pseudonym     string     `gorm:"column:pseudonym;type:varchar(64);not null"`                               // 审计日志中替换用户名的假名
+	Subject       string     `gorm:"column:subject;type:text"`                                                 // 执行清除需要的用户名、邮箱等，完成后清空
+	Status        string     `gorm:"column:status;type:varchar(16);not null;index:idx_status_next,priority:1"` // pending、done、failed
+	Steps         string     `gorm:"column:steps;type:text"`                                                   // 各步骤的执行结果，JSON
+	Attempts      int        `gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null;index:idx_status_next,priority:2"`
+	LastError     string     `gorm:"column:last_error;type:varchar(512);not null;default ''"`
+	Requester     string     `gorm:"column:requester;type:varchar(64);not null;default ''"` // user（用户注销）、scim 或 admin
+	FinishTime    *time.Time `gorm:"column:finish_time"`
+	CreateTime    time.Time  `gorm:"column:create_time;autoCreateTime"`
+}
+
+func (t *ErasureRequest) TableName() string {
+	return "t_erasure_request"
+}
+
+// DataKey 加密用户个人信息的数据密钥，由主密钥加密后保存
+type DataKey struct {
+	ID          int       `gorm:"column:id"`
+	Name        string    `gorm:"column:name;type:varchar(64);not null;uniqueIndex:uk_name"`
+	Purpose     string    `gorm:"column:purpose;type:varchar(16);not null"`               // data（加密字段）、index（计算盲索引）
+	MasterKeyID string    `gorm:"column:master_key_id;type:varchar(64);not null"`         // 加密该密钥的主密钥 id
+	WrappedKey  string    `gorm:"column:wrapped_key;type:varchar(255);not null"`          // 主密钥加密后的密钥，base64
+	Status      string    `gorm:"column:status;type:varchar(16);not null;default:active"` // active、retired，retired 的密钥只用于解密
+	CreateTime  time.Time `gorm:"column:create_time;autoCreateTime"`
+	UpdateTime  time.Time `gorm:"column:update_time;autoUpdateTime"`
+}
+
+func (t *DataKey) TableName() string {
+	return "t_data_key"
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"Gous/config"
+	"Gous/internal/mailer"
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+// mailNotifier 发送邮件到用户已验证的邮箱，没有已验证邮箱时不发送
+type mailNotifier struct{}
+
+func (mailNotifier) NewDeviceLogin(ctx context.Context, n *NewDeviceLogin) error {
+	if n.Email == "" {
+		log.Infof("notify|user %s has no verified email, skip new device notification", n.UserName)
+		return nil
+	}
+	return mailer.SendTemplate(ctx, n.Email, "new_device_login", map[string]interface{}{
+		"AppName":  config.GetGlobalConf().AppConfig.AppName,
+		"UserName": n.UserName,
+		"Time":     n.Time.Format("2006-01-02 15:04:05 MST"),
+		"Method":   n.Method,
+		"IP":       n.IP,
+		"Browser":  n.Browser,
+		"OS":       n.OS,
+		"Device":   n.Device,
+	})
+}
+
+// logNotifier 只记录日志，用于开发和测试环境
+type logNotifier struct{}
+
+func (logNotifier) NewDeviceLogin(_ context.Context, n *NewDeviceLogin) error {
+	log.Infof("notify|new device login user=%s|ip=%s|browser=%s|os=%s|device=%s", n.UserName, n.IP, n.Browser, n.OS, n.Device)
+	return nil
+}
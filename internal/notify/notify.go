@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"Gous/config"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// NewDeviceLogin 新设备登录通知的内容
+type NewDeviceLogin struct {
+	UserName string
+	Email    string // 已验证的邮箱，未验证时为空
+	Time     time.Time
+	Method   string
+	IP       string
+	Browser  string
+	OS       string
+	Device   string
+}
+
+// Notifier 用户通知接口，新的通知方式（短信、站内信、推送）实现该接口后通过 Register 注册
+type Notifier interface {
+	NewDeviceLogin(ctx context.Context, n *NewDeviceLogin) error
+}
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   = map[string]func() Notifier{
+		"mail": func() Notifier { return mailNotifier{} },
+		"log":  func() Notifier { return logNotifier{} },
+	}
+)
+
+// Register 注册通知方式，name 对应配置 login_history.notifier
+func Register(name string, factory func() Notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers[name] = factory
+}
+
+// Get 根据当前配置获取通知方式
+func Get() (Notifier, error) {
+	name := config.GetGlobalConf().LoginHistory.Notifier
+	notifiersMu.RLock()
+	factory, ok := notifiers[name]
+	notifiersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier %q", name)
+	}
+	return factory(), nil
+}
@@ -0,0 +1,106 @@
+package oauth
+
+import (
+	"Gous/config"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-jose/go-jose/v3"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sync"
+)
+
+// signingKey 签名令牌使用的密钥
+type signingKey struct {
+	kid    string
+	key    *rsa.PrivateKey
+	signer jose.Signer
+}
+
+var (
+	keyOnce sync.Once
+	key     *signingKey
+	keyErr  error
+)
+
+// getSigningKey 首次使用时加载 oauth.signing_key_file，未配置时生成临时密钥
+func getSigningKey() (*signingKey, error) {
+	keyOnce.Do(func() {
+		key, keyErr = loadSigningKey(config.GetGlobalConf().OAuth.SigningKeyFile)
+	})
+	return key, keyErr
+}
+
+func loadSigningKey(file string) (*signingKey, error) {
+	var priv *rsa.PrivateKey
+	if file == "" {
+		log.Warnf("oauth.signing_key_file not set, generate a temporary key, issued tokens become invalid after restart")
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("generate oauth signing key: %w", err)
+		}
+		priv = k
+	} else {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read oauth signing key: %w", err)
+		}
+		if priv, err = parseRSAKey(data); err != nil {
+			return nil, fmt.Errorf("parse oauth signing key %s: %w", file, err)
+		}
+	}
+
+	// kid 取公钥 JWK 指纹，换密钥后客户端能据此刷新 JWKS
+	thumb, err := (&jose.JSONWebKey{Key: &priv.PublicKey}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	kid := base64.RawURLEncoding.EncodeToString(thumb)
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: priv},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", kid),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: kid, key: priv, signer: signer}, nil
+}
+
+// parseRSAKey 支持 PKCS#1 和 PKCS#8 格式的 PEM 私钥
+func parseRSAKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key must be RSA")
+	}
+	return rsaKey, nil
+}
+
+// JWKS 返回用于校验令牌签名的公钥集合
+func JWKS() (*jose.JSONWebKeySet, error) {
+	k, err := getSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &k.key.PublicKey,
+		KeyID:     k.kid,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}}, nil
+}
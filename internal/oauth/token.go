@@ -0,0 +1,110 @@
+package oauth
+
+import (
+	"Gous/config"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"strings"
+	"time"
+)
+
+// clockSkew 校验令牌有效期时允许的时钟误差
+const clockSkew = 30 * time.Second
+
+// AccessClaims access token 中的声明
+type AccessClaims struct {
+	jwt.Claims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id"`
+}
+
+// Issuer 授权服务器的 issuer，去掉末尾的 /
+func Issuer() string {
+	return strings.TrimRight(config.GetGlobalConf().OAuth.Issuer, "/")
+}
+
+// Sign 使用当前密钥签名 JWT
+func Sign(claims interface{}) (string, error) {
+	k, err := getSigningKey()
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(k.signer).Claims(claims).CompactSerialize()
+}
+
+// ParseAccessToken 校验 access token 的签名、issuer 和有效期
+func ParseAccessToken(raw string) (*AccessClaims, error) {
+	k, err := getSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := jwt.ParseSigned(raw)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	if len(tok.Headers) != 1 || tok.Headers[0].Algorithm != string(jose.RS256) {
+		return nil, fmt.Errorf("unexpected token algorithm")
+	}
+	claims := &AccessClaims{}
+	if err := tok.Claims(&k.key.PublicKey, claims); err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+	expected := jwt.Expected{Issuer: Issuer(), Time: time.Now()}
+	if err := claims.ValidateWithLeeway(expected, clockSkew); err != nil {
+		return nil, err
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("token has no jti")
+	}
+	return claims, nil
+}
+
+// HashSecret 客户端密钥、授权码、refresh token 都是高熵随机串，只保存 sha256 摘要
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSecret 常量时间比较密钥和保存的摘要
+func CheckSecret(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
+
+// CheckPKCE 校验 code_verifier 是否与授权请求中的 S256 code_challenge 对应
+func CheckPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// SplitList 拆分空格分隔的 scope、回调地址等列表
+func SplitList(s string) []string {
+	return strings.Fields(s)
+}
+
+// Contains 空格分隔的列表中是否包含 v
+func Contains(list, v string) bool {
+	for _, item := range strings.Fields(list) {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Subset want 中的每一项是否都在 list 中
+func Subset(want []string, list string) bool {
+	for _, v := range want {
+		if !Contains(list, v) {
+			return false
+		}
+	}
+	return true
+}
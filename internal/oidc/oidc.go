@@ -0,0 +1,133 @@
+package oidc
+
+import (
+	"Gous/config"
+	"context"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTimeout 服务发现请求超时
+const discoveryTimeout = 10 * time.Second
+
+// Client 已完成服务发现的身份提供方客户端
+type Client struct {
+	conf     config.OidcProviderConf
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Claims 从 ID token 中读取的用户信息
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Nonce             string `json:"nonce"`
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]*Client{}
+)
+
+// Get 获取身份提供方客户端，首次使用时做服务发现并缓存，配置变化后重新发现
+func Get(name string) (*Client, error) {
+	conf := config.GetGlobalConf().Oidc
+	if !conf.Enabled {
+		return nil, fmt.Errorf("oidc login is disabled")
+	}
+	var pc *config.OidcProviderConf
+	for i := range conf.Providers {
+		if conf.Providers[i].Name == name {
+			pc = &conf.Providers[i]
+			break
+		}
+	}
+	if pc == nil {
+		return nil, fmt.Errorf("unknown oidc provider %q", name)
+	}
+	redirectUrl := strings.TrimRight(conf.RedirectBaseUrl, "/") + "/user/oidc/" + name + "/callback"
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[name]; ok && sameProvider(c.conf, *pc) && c.oauth2.RedirectURL == redirectUrl {
+		return c, nil
+	}
+
+	// 服务发现的结果会被后续请求复用，不跟随单个请求取消
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, pc.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", name, err)
+	}
+	c := &Client{
+		conf: *pc,
+		oauth2: &oauth2.Config{
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectUrl,
+			Scopes:       append([]string{oidc.ScopeOpenID}, pc.Scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: pc.ClientID}),
+	}
+	clients[name] = c
+	return c, nil
+}
+
+// sameProvider 判断缓存的客户端是否仍与配置一致
+func sameProvider(a, b config.OidcProviderConf) bool {
+	return a.Issuer == b.Issuer && a.ClientID == b.ClientID && a.ClientSecret == b.ClientSecret &&
+		strings.Join(a.Scopes, " ") == strings.Join(b.Scopes, " ")
+}
+
+// Name 身份提供方名称
+func (c *Client) Name() string {
+	return c.conf.Name
+}
+
+// AutoProvision 首次登录时是否自动创建账号
+func (c *Client) AutoProvision() bool {
+	return c.conf.AutoProvision
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址，带上 state、nonce 和 PKCE challenge
+func (c *Client) AuthCodeURL(state, nonce, verifier string) string {
+	return c.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange 用授权码换取令牌，校验 ID token 的签名、issuer、audience、有效期和 nonce
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	token, err := c.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	claims := &Claims{}
+	if err := idToken.Claims(claims); err != nil {
+		return nil, fmt.Errorf("parse id_token claims: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// GenerateVerifier 生成 PKCE code verifier
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
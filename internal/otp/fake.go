@@ -0,0 +1,32 @@
+package otp
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+// Fake 测试用的发送方式，验证码只保存在内存中，可通过 LastCode 取出
+var Fake = &FakeProvider{codes: map[string]string{}}
+
+// FakeProvider 不真正发送验证码，记录每个接收方最近一次收到的验证码
+type FakeProvider struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func (p *FakeProvider) Send(_ context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[msg.To] = msg.Code
+	log.Debugf("otp fake provider|channel=%s|to=%s", msg.Channel, msg.To)
+	return nil
+}
+
+// LastCode 返回接收方最近一次收到的验证码
+func (p *FakeProvider) LastCode(to string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code, ok := p.codes[to]
+	return code, ok
+}
@@ -0,0 +1,64 @@
+package otp
+
+import (
+	"Gous/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// httpProvider 通用 http 发送方式，将验证码 POST 给短信网关或自建的通知服务
+type httpProvider struct {
+	conf   config.OtpHttpConf
+	client *http.Client
+}
+
+// httpPayload 请求体
+type httpPayload struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newHttpProvider(conf config.OtpConf) Provider {
+	return &httpProvider{
+		conf:   conf.Http,
+		client: &http.Client{Timeout: time.Duration(conf.Http.Timeout) * time.Second},
+	}
+}
+
+func (p *httpProvider) Send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(&httpPayload{
+		Channel: msg.Channel,
+		To:      msg.To,
+		Code:    msg.Code,
+		Message: fmt.Sprintf("【%s】你的登录验证码为 %s，%d 分钟内有效，请勿泄露给他人。",
+			config.GetGlobalConf().AppConfig.AppName, msg.Code, int(msg.TTL.Minutes())),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.conf.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.conf.Token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otp http provider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otp http provider: status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
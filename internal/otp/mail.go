@@ -0,0 +1,26 @@
+package otp
+
+import (
+	"Gous/config"
+	"Gous/internal/mailer"
+	"context"
+	"fmt"
+)
+
+// mailProvider 通过邮件配置发送邮箱验证码
+type mailProvider struct{}
+
+func newMailProvider(config.OtpConf) Provider {
+	return mailProvider{}
+}
+
+func (mailProvider) Send(ctx context.Context, msg *Message) error {
+	if msg.Channel != ChannelEmail {
+		return fmt.Errorf("mail provider can not send %s code", msg.Channel)
+	}
+	return mailer.SendTemplate(ctx, msg.To, "otp_code", map[string]interface{}{
+		"AppName":       config.GetGlobalConf().AppConfig.AppName,
+		"Code":          msg.Code,
+		"ExpireMinutes": int(msg.TTL.Minutes()),
+	})
+}
@@ -0,0 +1,74 @@
+package otp
+
+import (
+	"Gous/config"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 验证码发送渠道
+const (
+	ChannelEmail = "email"
+	ChannelSms   = "sms"
+)
+
+// Message 待发送的验证码
+type Message struct {
+	Channel string        // 发送渠道：email、sms
+	To      string        // 邮箱或 E.164 格式手机号
+	Code    string        // 验证码明文
+	TTL     time.Duration // 有效期，用于提示用户
+}
+
+// Provider 验证码发送接口，新的短信、邮件网关实现该接口后通过 Register 注册
+type Provider interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]func(conf config.OtpConf) Provider{
+		"mail": newMailProvider,
+		"http": newHttpProvider,
+		"fake": func(config.OtpConf) Provider { return Fake },
+	}
+)
+
+// Register 注册验证码发送方式，name 对应配置 otp.email_provider、otp.sms_provider
+func Register(name string, factory func(conf config.OtpConf) Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// Get 根据当前配置获取指定渠道的发送方式
+func Get(channel string) (Provider, error) {
+	conf := config.GetGlobalConf().Otp
+	var name string
+	switch channel {
+	case ChannelEmail:
+		name = conf.EmailProvider
+	case ChannelSms:
+		name = conf.SmsProvider
+	default:
+		return nil, fmt.Errorf("unknown otp channel %q", channel)
+	}
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown otp provider %q", name)
+	}
+	return factory(conf), nil
+}
+
+// Send 通过对应渠道的发送方式发送验证码
+func Send(ctx context.Context, msg *Message) error {
+	p, err := Get(msg.Channel)
+	if err != nil {
+		return err
+	}
+	return p.Send(ctx, msg)
+}
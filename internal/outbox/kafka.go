@@ -0,0 +1,43 @@
+package outbox
+
+import (
+	"Gous/config"
+	"context"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// kafkaPublisher 发布到 Kafka，用户 id 作为消息 key，同一用户的事件进入同一分区，保持顺序。
+// 事件 id 放在消息头 id 中，消费方据此去重
+type kafkaPublisher struct {
+	w *kafka.Writer
+}
+
+func newKafkaPublisher(conf config.OutboxConf) (Publisher, error) {
+	return &kafkaPublisher{w: &kafka.Writer{
+		Addr:         kafka.TCP(conf.KafkaBrokers...),
+		Topic:        conf.KafkaTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// 由 relay 负责重试，保证同一用户的事件按顺序发布
+		MaxAttempts: 1,
+		// 每次只写一条消息，不等待凑批
+		BatchTimeout: 10 * time.Millisecond,
+	}}, nil
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, msg *Message) error {
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(msg.Key),
+		Value: msg.Payload,
+		Time:  msg.CreatedAt,
+		Headers: []kafka.Header{
+			{Key: "id", Value: []byte(msg.ID)},
+			{Key: "type", Value: []byte(msg.Type)},
+		},
+	})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.w.Close()
+}
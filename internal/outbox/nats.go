@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"Gous/config"
+	"context"
+	"github.com/nats-io/nats.go"
+	"time"
+)
+
+// natsPublisher 发布到 NATS JetStream，主题为 <nats_subject>.<事件类型>。
+// 事件 id 作为 Nats-Msg-Id，stream 在去重窗口内丢弃重复发布的消息
+type natsPublisher struct {
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func newNatsPublisher(conf config.OutboxConf) (Publisher, error) {
+	// 启动时 NATS 不可用不影响服务，后台重连，期间发布失败按退避重试
+	nc, err := nats.Connect(conf.NatsUrl,
+		nats.Name("gous-outbox"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &natsPublisher{nc: nc, js: js, subject: conf.NatsSubject}, nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, msg *Message) error {
+	m := nats.NewMsg(p.subject + "." + msg.Type)
+	m.Data = msg.Payload
+	m.Header.Set("Gous-Event-Type", msg.Type)
+	m.Header.Set("Gous-Key", msg.Key)
+	m.Header.Set("Gous-Created-At", msg.CreatedAt.Format(time.RFC3339Nano))
+	// 收到 JetStream 的确认才算发布成功
+	_, err := p.js.PublishMsg(m, nats.MsgId(msg.ID), nats.Context(ctx))
+	return err
+}
+
+func (p *natsPublisher) Close() error {
+	p.nc.Close()
+	return nil
+}
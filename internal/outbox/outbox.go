@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"Gous/config"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Message 发布的领域事件
+type Message struct {
+	ID        string    // 事件 id，作为幂等键，重复发布时不变，消费方据此去重
+	Type      string    // 事件类型，见 constant.Event*
+	Key       string    // 事件所属的用户 id，同一 key 的事件按顺序发布，可用作分区键
+	Payload   []byte    // 事件数据，JSON
+	CreatedAt time.Time // 事件产生时间
+}
+
+// Publisher 事件发布接口，其他消息系统实现该接口后通过 Register 注册。
+// Publish 返回 nil 表示消息已被消息系统持久化，返回错误时会重试，因此可能重复发布
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+	Close() error
+}
+
+var (
+	publishersMu sync.RWMutex
+	publishers   = map[string]func(conf config.OutboxConf) (Publisher, error){}
+)
+
+func init() {
+	Register("redis", newRedisPublisher)
+	Register("nats", newNatsPublisher)
+	Register("kafka", newKafkaPublisher)
+	Register("stdout", newStdoutPublisher)
+}
+
+// Register 注册发布方式，name 对应配置 outbox.publisher，配置校验只接受注册过的名称
+func Register(name string, factory func(conf config.OutboxConf) (Publisher, error)) {
+	publishersMu.Lock()
+	defer publishersMu.Unlock()
+	publishers[name] = factory
+	config.RegisterName("outbox.publisher", name)
+}
+
+// Get 根据配置创建发布方式
+func Get(conf config.OutboxConf) (Publisher, error) {
+	publishersMu.RLock()
+	factory, ok := publishers[conf.Publisher]
+	publishersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown publisher %q", conf.Publisher)
+	}
+	return factory(conf)
+}
+
+// NewEvent 生成待写入的领域事件，未开启 outbox 时返回 nil
+func NewEvent(eventType, key string, data interface{}) (*model.OutboxEvent, error) {
+	if !config.GetGlobalConf().Outbox.Enabled {
+		return nil, nil
+	}
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s event: %v", eventType, err)
+	}
+	return &model.OutboxEvent{
+		EventID:       id,
+		AggregateID:   key,
+		EventType:     eventType,
+		Payload:       string(payload),
+		NextAttemptAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"Gous/config"
+	"Gous/internal/utils"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"sync"
+	"time"
+)
+
+// redisPublisher 发布到 Redis Streams，消费方使用 XREADGROUP 消费
+type redisPublisher struct {
+	stream string
+	maxLen int64
+}
+
+func newRedisPublisher(conf config.OutboxConf) (Publisher, error) {
+	return &redisPublisher{stream: conf.Stream, maxLen: conf.MaxLen}, nil
+}
+
+func (p *redisPublisher) Publish(ctx context.Context, msg *Message) error {
+	return utils.GetRedisCLi().XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: []interface{}{
+			"id", msg.ID,
+			"type", msg.Type,
+			"key", msg.Key,
+			"created_at", msg.CreatedAt.Format(time.RFC3339Nano),
+			"payload", string(msg.Payload),
+		},
+	}).Err()
+}
+
+// Close 使用服务共用的 redis 连接，由服务停机时关闭
+func (p *redisPublisher) Close() error {
+	return nil
+}
+
+// stdoutPublisher 每个事件输出一行 JSON，用于调试或由日志采集转发
+type stdoutPublisher struct {
+	mu sync.Mutex
+}
+
+func newStdoutPublisher(config.OutboxConf) (Publisher, error) {
+	return &stdoutPublisher{}, nil
+}
+
+func (p *stdoutPublisher) Publish(_ context.Context, msg *Message) error {
+	line, err := json.Marshal(map[string]interface{}{
+		"id":         msg.ID,
+		"type":       msg.Type,
+		"key":        msg.Key,
+		"created_at": msg.CreatedAt,
+		"payload":    json.RawMessage(msg.Payload),
+	})
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = os.Stdout.Write(append(line, '\n'))
+	return err
+}
+
+func (p *stdoutPublisher) Close() error {
+	return nil
+}
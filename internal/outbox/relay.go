@@ -0,0 +1,172 @@
+package outbox
+
+import (
+	"Gous/config"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	lockTTL         = 30 * time.Second // 实例退出后其他实例最多等待该时间接手发布
+	publishTimeout  = 5 * time.Second  // 单条消息的发布超时
+	cleanupInterval = time.Hour
+)
+
+// relay 发布任务的状态
+type relay struct {
+	conf      config.OutboxConf
+	pub       Publisher
+	token     string
+	held      bool      // 是否持有锁
+	renewedAt time.Time // 上次加锁或续期的时间
+	lockErr   string    // 上次加锁的错误，redis 不可用时只在错误变化时记录日志
+}
+
+// Relay 后台发布任务，按 id 顺序发布未发布的事件，至少发布一次。
+// 多个实例通过 redis 锁保证同一时间只有一个实例发布，同一用户的事件发布失败时，其后续事件等待其发布成功或进入死信状态
+func Relay(ctx context.Context) {
+	conf := config.GetGlobalConf().Outbox
+	pub, err := Get(conf)
+	if err != nil {
+		log.Errorf("outbox|init publisher err:%v", err)
+		return
+	}
+	defer pub.Close()
+	token, err := utils.RandomToken(16)
+	if err != nil {
+		log.Errorf("outbox|%v", err)
+		return
+	}
+	r := &relay{conf: conf, pub: pub, token: token}
+	defer r.release()
+
+	interval := time.Duration(conf.PollInterval) * time.Millisecond
+	var lastCleanup time.Time
+	for {
+		full := false
+		if r.lock() {
+			full = r.publishBatch(ctx)
+			if conf.Retention > 0 && time.Since(lastCleanup) > cleanupInterval {
+				r.cleanup()
+				lastCleanup = time.Now()
+			}
+		}
+		// 一批发满时说明还有积压，立即继续
+		if full {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lock 加锁或续期，redis 不可用时视为未持有锁
+func (r *relay) lock() bool {
+	ok, err := cache.AcquireLock(constant.OutboxRelayLock, r.token, lockTTL)
+	if err != nil {
+		if err.Error() != r.lockErr {
+			log.Warnf("outbox|acquire lock err:%v", err)
+		}
+		r.lockErr = err.Error()
+		ok = false
+	} else {
+		r.lockErr = ""
+	}
+	if ok != r.held {
+		log.Infof("outbox|relay lock held=%v", ok)
+	}
+	r.held = ok
+	if ok {
+		r.renewedAt = time.Now()
+	}
+	return ok
+}
+
+func (r *relay) release() {
+	if r.held {
+		if err := cache.ReleaseLock(constant.OutboxRelayLock, r.token); err != nil {
+			log.Warnf("outbox|release lock err:%v", err)
+		}
+	}
+}
+
+// publishBatch 发布一批事件，返回这一批是否取满
+func (r *relay) publishBatch(ctx context.Context) bool {
+	events, err := dao.PendingOutboxEvents(time.Now(), r.conf.BatchSize)
+	if err != nil {
+		return false
+	}
+	blocked := map[string]bool{} // 本批中发布失败、后续事件需要等待的用户
+	for _, e := range events {
+		if ctx.Err() != nil {
+			return false
+		}
+		if blocked[e.AggregateID] {
+			continue
+		}
+		// 发布耗时较长时及时续期，锁丢失后停止发布，避免与接手的实例乱序
+		if time.Since(r.renewedAt) > lockTTL/3 && !r.lock() {
+			return false
+		}
+		if err := r.publish(ctx, e); err != nil {
+			r.fail(e, err, blocked)
+			continue
+		}
+		// 标记失败时下一轮会重复发布，由消费方按幂等键去重
+		_ = dao.MarkOutboxPublished(e.ID, time.Now())
+	}
+	return len(events) == r.conf.BatchSize && len(blocked) == 0
+}
+
+// fail 记录发布失败。未用尽次数时等待重试，期间该用户的后续事件不发布；
+// 用尽次数后进入死信状态，后续事件照常发布，死信事件需要手动重试
+func (r *relay) fail(e *model.OutboxEvent, err error, blocked map[string]bool) {
+	attempts := e.Attempts + 1
+	reason := utils.Truncate(err.Error(), 512)
+	if r.conf.MaxAttempts > 0 && attempts >= r.conf.MaxAttempts {
+		log.Errorf("outbox|%s %s (id=%d) is dead after %d attempts: %v", e.EventType, e.EventID, e.ID, attempts, err)
+		_ = dao.MarkOutboxDead(e.ID, attempts, time.Now(), reason)
+		return
+	}
+	blocked[e.AggregateID] = true
+	log.Warnf("outbox|publish %s %s (id=%d) attempt %d err:%v", e.EventType, e.EventID, e.ID, attempts, err)
+	_ = dao.FailOutboxEvent(e.ID, attempts, time.Now().Add(backoff(r.conf).Delay(attempts)), reason)
+}
+
+func (r *relay) publish(ctx context.Context, e *model.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	return r.pub.Publish(ctx, &Message{
+		ID:        e.EventID,
+		Type:      e.EventType,
+		Key:       e.AggregateID,
+		Payload:   []byte(e.Payload),
+		CreatedAt: e.CreateTime,
+	})
+}
+
+// backoff 发布失败后的重试间隔
+func backoff(conf config.OutboxConf) utils.Backoff {
+	return utils.Backoff{Initial: time.Duration(conf.InitialBackoff) * time.Second, Max: time.Duration(conf.MaxBackoff) * time.Second}
+}
+
+// cleanup 删除超过保留天数的已发布事件
+func (r *relay) cleanup() {
+	before := time.Now().AddDate(0, 0, -r.conf.Retention)
+	n, err := dao.PurgeOutboxEvents(before)
+	if err == nil && n > 0 {
+		log.Infof("outbox|purged %d published events before %s", n, before.Format(time.RFC3339))
+	}
+}
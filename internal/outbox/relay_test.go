@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gous-outbox-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := db.AutoMigrate(&model.OutboxEvent{}); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	utils.SetDB(db)
+	return m.Run()
+}
+
+// fakePublisher 记录发布成功的事件，failing 中的事件总是发布失败
+type fakePublisher struct {
+	failing   map[string]bool
+	published []string
+}
+
+func (p *fakePublisher) Publish(_ context.Context, msg *Message) error {
+	if p.failing[msg.ID] {
+		return errors.New("message rejected")
+	}
+	p.published = append(p.published, msg.ID)
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func addEvents(t *testing.T, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		e := &model.OutboxEvent{EventID: id, AggregateID: id[:1], EventType: "user.updated", Payload: "{}", NextAttemptAt: time.Now().Add(-time.Second)}
+		if err := utils.GetDB().Create(e).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getEvent(t *testing.T, id string) *model.OutboxEvent {
+	t.Helper()
+	e := &model.OutboxEvent{}
+	if err := utils.GetDB().Where("event_id=?", id).First(e).Error; err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRelayFailingEventDoesNotBlockOtherUsers(t *testing.T) {
+	utils.GetDB().Where("1=1").Delete(&model.OutboxEvent{})
+	// 事件 id 的首字母作为用户 id，a1 总是发布失败
+	addEvents(t, "a1", "a2", "b1", "b2", "b3")
+	pub := &fakePublisher{failing: map[string]bool{"a1": true}}
+	r := &relay{
+		conf:      config.OutboxConf{BatchSize: 2, InitialBackoff: 60, MaxBackoff: 60, MaxAttempts: 3},
+		pub:       pub,
+		renewedAt: time.Now(),
+	}
+
+	for i := 0; i < 4; i++ {
+		r.publishBatch(context.Background())
+	}
+	if want := []string{"b1", "b2", "b3"}; !reflect.DeepEqual(pub.published, want) {
+		t.Fatalf("published %v, want %v", pub.published, want)
+	}
+	// 等待重试期间 a2 不能先于 a1 发布
+	a1 := getEvent(t, "a1")
+	if a1.Attempts != 1 || a1.DeadAt != nil || !a1.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("a1 after first failure: %+v", a1)
+	}
+	if a2 := getEvent(t, "a2"); a2.PublishedAt != nil || a2.Attempts != 0 {
+		t.Fatalf("a2 published while a1 is waiting: %+v", a2)
+	}
+}
+
+func TestRelayDeadEvent(t *testing.T) {
+	utils.GetDB().Where("1=1").Delete(&model.OutboxEvent{})
+	addEvents(t, "c1", "c2")
+	pub := &fakePublisher{failing: map[string]bool{"c1": true}}
+	r := &relay{
+		conf:      config.OutboxConf{BatchSize: 10, InitialBackoff: 60, MaxBackoff: 60, MaxAttempts: 2},
+		pub:       pub,
+		renewedAt: time.Now(),
+	}
+
+	r.publishBatch(context.Background())
+	if len(pub.published) != 0 {
+		t.Fatalf("published %v before c1", pub.published)
+	}
+	// 跳过等待，第二次失败后进入死信状态，同一批中 c2 随即发布
+	utils.GetDB().Model(&model.OutboxEvent{}).Where("event_id=?", "c1").Update("next_attempt_at", time.Now().Add(-time.Second))
+	r.publishBatch(context.Background())
+	if !reflect.DeepEqual(pub.published, []string{"c2"}) {
+		t.Fatalf("published %v, want [c2]", pub.published)
+	}
+	c1 := getEvent(t, "c1")
+	if c1.DeadAt == nil || c1.Attempts != 2 || c1.LastError != "message rejected" {
+		t.Fatalf("c1 not dead: %+v", c1)
+	}
+	list, total, err := dao.FindDeadOutboxEvents(0, 10)
+	if err != nil || total != 1 || len(list) != 1 || list[0].EventID != "c1" {
+		t.Fatalf("dead events %v total %d err %v", list, total, err)
+	}
+
+	// 死信事件不再自动发布，手动重试后重新发布
+	r.publishBatch(context.Background())
+	if len(pub.published) != 1 {
+		t.Fatalf("dead event published: %v", pub.published)
+	}
+	if err := dao.RequeueOutboxEvent(c1.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	delete(pub.failing, "c1")
+	r.publishBatch(context.Background())
+	if !reflect.DeepEqual(pub.published, []string{"c2", "c1"}) {
+		t.Fatalf("published %v, want [c2 c1]", pub.published)
+	}
+}
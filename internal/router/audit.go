@@ -0,0 +1,26 @@
+package router
+
+import (
+	"Gous/internal/audit"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"github.com/gin-gonic/gin"
+	"regexp"
+)
+
+// requestIDPattern 接受上游网关传入的请求 ID，格式不合法时重新生成，避免写入日志的内容被伪造
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestSourceMiddleWare 为请求分配请求 ID 并在响应头中返回，同时把来源 IP、User-Agent 放入请求上下文供审计日志使用
+func RequestSourceMiddleWare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(constant.RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID, _ = utils.RandomToken(16)
+		}
+		c.Header(constant.RequestIDHeader, requestID)
+		src := &audit.Source{IP: c.ClientIP(), UserAgent: c.Request.UserAgent(), RequestID: requestID}
+		c.Request = c.Request.WithContext(audit.WithSource(c.Request.Context(), src))
+		c.Next()
+	}
+}
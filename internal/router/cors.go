@@ -0,0 +1,148 @@
+package router
+
+import (
+	"Gous/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// corsRule 某个请求生效的跨域规则
+type corsRule struct {
+	origins          []string
+	allowMethods     []string
+	allowHeaders     []string
+	exposeHeaders    []string
+	allowCredentials bool
+	maxAge           int
+	disabled         bool
+}
+
+// CorsMiddleWare 跨域中间件，允许的源来自 cors_origin，支持精确匹配和 *.example.com 形式的子域名通配。
+// 每次请求读取当前配置，配置热加载后立即生效；cors.groups 按路由前缀覆盖默认规则。
+func CorsMiddleWare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" { // 非跨域请求
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+
+		rule := matchCorsRule(config.GetGlobalConf(), c.Request.URL.Path)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if rule.disabled || !originAllowed(rule.origins, origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next() // 不返回 CORS 头，由浏览器拦截响应
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		if rule.allowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if len(rule.exposeHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(rule.exposeHeaders, ", "))
+			}
+			c.Next()
+			return
+		}
+
+		// 预检请求直接返回
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", strings.Join(rule.allowMethods, ", "))
+		if len(rule.allowHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(rule.allowHeaders, ", "))
+		}
+		if rule.maxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(rule.maxAge))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// matchCorsRule 以默认配置为基础，叠加路由前缀最长匹配的分组配置
+func matchCorsRule(conf *config.GlobalConfig, path string) corsRule {
+	rule := corsRule{
+		origins:          conf.CorsOrigin,
+		allowMethods:     conf.Cors.AllowMethods,
+		allowHeaders:     conf.Cors.AllowHeaders,
+		exposeHeaders:    conf.Cors.ExposeHeaders,
+		allowCredentials: conf.Cors.AllowCredentials,
+		maxAge:           conf.Cors.MaxAge,
+	}
+
+	var group *config.CorsGroupConf
+	for i := range conf.Cors.Groups {
+		g := &conf.Cors.Groups[i]
+		if strings.HasPrefix(path, g.PathPrefix) && (group == nil || len(g.PathPrefix) > len(group.PathPrefix)) {
+			group = g
+		}
+	}
+	if group == nil {
+		return rule
+	}
+	if len(group.Origins) > 0 {
+		rule.origins = group.Origins
+	}
+	if len(group.AllowMethods) > 0 {
+		rule.allowMethods = group.AllowMethods
+	}
+	if len(group.AllowHeaders) > 0 {
+		rule.allowHeaders = group.AllowHeaders
+	}
+	if group.AllowCredentials != nil {
+		rule.allowCredentials = *group.AllowCredentials
+	}
+	rule.disabled = group.Disabled
+	return rule
+}
+
+// originAllowed 判断请求源是否在允许列表中。
+// 列表项可以是 *、完整的源（https://a.example.com）、主机名（a.example.com）或子域名通配（*.example.com、https://*.example.com），
+// 通配只匹配子域名，不匹配 example.com 本身。
+func originAllowed(patterns []string, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "*" {
+			return true
+		}
+		scheme := ""
+		if i := strings.Index(p, "://"); i >= 0 {
+			scheme, p = p[:i], p[i+3:]
+		}
+		if scheme != "" && scheme != u.Scheme {
+			continue
+		}
+		// 列表项带端口时需要端口一致
+		if strings.Contains(p, ":") {
+			if p == strings.ToLower(u.Host) {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(p, "*.") {
+			if strings.HasSuffix(host, p[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == p {
+			return true
+		}
+	}
+	return false
+}
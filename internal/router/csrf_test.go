@@ -0,0 +1,122 @@
+package router
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// csrfRouter 在业务路由之外注册只经过认证和 CSRF 校验的测试路由
+func csrfRouter() *gin.Engine {
+	r := NewRouter()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		r.Handle(method, "/test/csrf", AuthMiddleWare(), CsrfMiddleWare(), ok)
+	}
+	return r
+}
+
+func TestCsrfMiddleWare(t *testing.T) {
+	user := createTestUser(t, "csrf_user")
+	session, token := login(t, user)
+	_, otherToken := login(t, createTestUser(t, "csrf_other"))
+	r := csrfRouter()
+
+	tests := []struct {
+		name    string
+		method  string
+		token   string
+		origin  string
+		referer string
+		want    int
+	}{
+		{name: "missing token", method: http.MethodPost, want: http.StatusForbidden},
+		{name: "wrong token", method: http.MethodPost, token: "wrong", want: http.StatusForbidden},
+		{name: "token of another session", method: http.MethodPost, token: otherToken, want: http.StatusForbidden},
+		{name: "valid token", method: http.MethodPost, token: token, want: http.StatusOK},
+		{name: "put without token", method: http.MethodPut, want: http.StatusForbidden},
+		{name: "delete without token", method: http.MethodDelete, want: http.StatusForbidden},
+		{name: "safe method", method: http.MethodGet, want: http.StatusOK},
+		// 来源校验先于 token 校验，两者都要通过
+		{name: "same origin", method: http.MethodPost, token: token, origin: "http://example.com", want: http.StatusOK},
+		{name: "same origin without token", method: http.MethodPost, origin: "http://example.com", want: http.StatusForbidden},
+		{name: "cross site origin", method: http.MethodPost, token: token, origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "lookalike origin", method: http.MethodPost, token: token, origin: "https://app.example.com.evil.example", want: http.StatusForbidden},
+		{name: "cors origin", method: http.MethodPost, token: token, origin: "https://app.example.com", want: http.StatusOK},
+		{name: "trusted origin", method: http.MethodPost, token: token, origin: "https://admin.example.com", want: http.StatusOK},
+		{name: "same site referer", method: http.MethodPost, token: token, referer: "http://example.com/profile", want: http.StatusOK},
+		{name: "cross site referer", method: http.MethodPost, token: token, referer: "https://evil.example/page", want: http.StatusForbidden},
+		{name: "null origin falls back to referer", method: http.MethodPost, token: token, origin: "null", referer: "https://evil.example/page", want: http.StatusForbidden},
+		{name: "invalid referer", method: http.MethodPost, token: token, referer: "not a url", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/test/csrf", nil)
+		req.AddCookie(sessionCookie(session))
+		if tt.token != "" {
+			req.Header.Set("X-CSRF-Token", tt.token)
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.referer != "" {
+			req.Header.Set("Referer", tt.referer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+// 使用 Bearer token 的请求跳过 CSRF 校验，同时带上的会话 cookie 不能被使用
+func TestCsrfBearerWithSessionCookie(t *testing.T) {
+	victim := createTestUser(t, "csrf_victim")
+	session, _ := login(t, victim)
+	attacker := createTestUser(t, "csrf_attacker")
+	_, raw := createAccessToken(t, attacker, "user:read user:write", nil)
+	r := csrfRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		body   string
+		want   int
+	}{
+		{name: "invalid bearer", method: http.MethodPost, path: "/test/csrf", auth: "Bearer gous_pat_invalid", want: http.StatusUnauthorized},
+		{name: "not a personal access token", method: http.MethodPost, path: "/test/csrf", auth: "Bearer " + session, want: http.StatusUnauthorized},
+		// 未声明 scope 的路由只能使用会话访问
+		{name: "session only route", method: http.MethodPost, path: "/test/csrf", auth: "Bearer " + raw, want: http.StatusForbidden},
+		{name: "logout", method: http.MethodPost, path: "/user/logout", auth: "Bearer " + raw, body: `{"user_name":"csrf_victim"}`, want: http.StatusForbidden},
+		{name: "logoff", method: http.MethodPost, path: "/user/logoff", auth: "Bearer " + raw, body: `{"user_name":"csrf_victim"}`, want: http.StatusForbidden},
+		// 令牌认证的请求只作用于令牌所属用户，不能改写 cookie 对应的会话
+		{name: "update nickname", method: http.MethodPost, path: "/user/update_nick_name", auth: "Bearer " + raw,
+			body: `{"user_name":"csrf_attacker","new_nick_name":"pwned"}`, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", tt.auth)
+		req.AddCookie(sessionCookie(session))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if u, err := cache.GetSessionInfo(session); err != nil || u.Name != victim.Name || u.NickName != victim.NickName {
+			t.Fatalf("%s: victim session changed: %+v, %v", tt.name, u, err)
+		}
+	}
+	if u, err := dao.GetUserByName(attacker.Name); err != nil || u.NickName != "pwned" {
+		t.Fatalf("attacker nickname not updated: %+v, %v", u, err)
+	}
+	if u, err := dao.GetUserByName(victim.Name); err != nil || u == nil || u.NickName != victim.NickName {
+		t.Fatalf("victim changed: %+v, %v", u, err)
+	}
+}
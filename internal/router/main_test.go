@@ -0,0 +1,157 @@
+package router
+
+import (
+	"Gous/config"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/oauth"
+	"Gous/internal/service"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var createIndexPattern = regexp.MustCompile("^CREATE (UNIQUE )?INDEX `(\\w+)` ON `(\\w+)`")
+
+// TestMain 使用内存 redis 和 SQLite 代替外部依赖，配置在首次读取前写入临时文件
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gous-router-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	rds, err := miniredis.Run()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer rds.Close()
+
+	confFile := filepath.Join(dir, "app.yml")
+	if err := os.WriteFile(confFile, []byte(testConfig(rds.Port())), 0600); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	config.SetConfigFile(confFile)
+	config.GetGlobalConf()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")+"?_pragma=busy_timeout(5000)"),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	// MySQL 的索引名只需表内唯一，SQLite 要求全库唯一，建索引时加上表名前缀
+	err = db.Callback().Raw().Before("gorm:raw").Register("test:index_name", func(tx *gorm.DB) {
+		sql := tx.Statement.SQL.String()
+		if m := createIndexPattern.FindStringSubmatch(sql); m != nil {
+			tx.Statement.SQL.Reset()
+			tx.Statement.SQL.WriteString(strings.Replace(sql, "`"+m[2]+"`", "`"+m[3]+"_"+m[2]+"`", 1))
+		}
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	utils.SetDB(db)
+	if err := dao.Migrate(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return m.Run()
+}
+
+func testConfig(redisPort string) string {
+	return fmt.Sprintf(`
+app:
+  run_mode: test
+  trusted_proxies: [10.0.0.0/8, 192.168.1.1]
+redis:
+  rhost: 127.0.0.1
+  rport: %s
+cache:
+  session_expired: 3600
+  user_expired: 3600
+cors_origin: ["https://app.example.com"]
+csrf:
+  trusted_origins: ["https://admin.example.com"]
+access_token:
+  enabled: true
+audit:
+  enabled: false
+login_history:
+  enabled: false
+webhook:
+  enabled: false
+`, redisPort)
+}
+
+// createTestUser 直接写入数据库创建用户，name 在各用例间不能重复
+func createTestUser(t *testing.T, name string) *model.User {
+	t.Helper()
+	user := &model.User{Name: name, NickName: name, PassWord: "secret-password", Status: constant.UserStatusActive}
+	if err := dao.CreateUser(user); err != nil {
+		t.Fatalf("create user %s: %v", name, err)
+	}
+	return user
+}
+
+// login 为用户创建会话并签发 CSRF token
+func login(t *testing.T, user *model.User) (session, csrf string) {
+	t.Helper()
+	session, err := utils.RandomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.SetSessionInfo(user, session); err != nil {
+		t.Fatal(err)
+	}
+	if csrf, err = service.IssueCsrfToken(session); err != nil {
+		t.Fatal(err)
+	}
+	return session, csrf
+}
+
+func sessionCookie(session string) *http.Cookie {
+	return &http.Cookie{Name: constant.SessionKey, Value: session}
+}
+
+// createAccessToken 直接写入数据库创建个人访问令牌，返回令牌明文
+func createAccessToken(t *testing.T, user *model.User, scopes string, expire *time.Time) (*model.AccessToken, string) {
+	t.Helper()
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := constant.AccessTokenPrefix + random
+	token := &model.AccessToken{
+		UserID:     user.ID,
+		Name:       "test",
+		TokenHash:  oauth.HashSecret(raw),
+		Hint:       raw[:len(constant.AccessTokenPrefix)+6],
+		Scopes:     scopes,
+		ExpireTime: expire,
+	}
+	if err := dao.CreateAccessToken(token); err != nil {
+		t.Fatal(err)
+	}
+	return token, raw
+}
@@ -3,35 +3,92 @@ package router
 import (
 	api "Gous/api/http/v1"
 	"Gous/config"
+	"Gous/internal/oauth"
+	"Gous/internal/service"
 	"Gous/pkg/constant"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"net/http"
-	"strconv"
+	"strings"
 )
 
-// InitRouterAndServer 路由配置、启动服务
-func InitRouterAndServer() {
+// NewRouter 路由配置
+func NewRouter() *gin.Engine {
 	// 设置运行模式
 	setAppRunMode()
 
 	// 路由配置
 	r := gin.Default()
+	setTrustedProxies(r)
+	// 安全响应头、请求体大小限制
+	r.Use(SecurityMiddleWare())
+	// 跨域
+	r.Use(CorsMiddleWare())
+	// 请求 ID 和来源，供审计日志使用
+	r.Use(RequestSourceMiddleWare())
 
 	// 健康检查
 	r.GET("/ping", api.Ping)
+	// 存活探针
+	r.GET("/healthz", api.Healthz)
+	// 就绪探针，停机排空阶段返回失败
+	r.GET("/readyz", api.Readyz)
+	// CSP 违规上报
+	r.POST(cspReportPath, api.CspReport)
 	// 用户注册
 	r.POST("/user/register", api.Register)
+	// 邮箱验证
+	r.GET("/user/verify_email", api.VerifyEmail)
+	// 重新发送验证邮件
+	r.POST("/user/resend_verification", api.ResendVerification)
 	// 用户登录
 	r.POST("/user/login", api.Login)
+	// 发送登录验证码
+	r.POST("/user/otp/send", api.OtpSend)
+	// 验证码登录
+	r.POST("/user/otp/verify", api.OtpVerify)
+	// 第三方登录
+	r.GET("/user/oidc/:provider/login", api.OidcLogin)
+	r.GET("/user/oidc/:provider/callback", api.OidcCallback)
+	// 已登录用户绑定第三方身份
+	r.POST("/user/oidc/:provider/link", AuthMiddleWare(), CsrfMiddleWare(), api.OidcLink)
+
+	// OAuth2 / OIDC 授权服务器
+	r.GET("/.well-known/openid-configuration", api.OpenIDConfiguration)
+	r.GET("/oauth/jwks", api.OAuthJWKS)
+	// 授权确认页表单自带 CSRF token，在处理函数中校验
+	r.GET("/oauth/authorize", api.OAuthAuthorize)
+	r.POST("/oauth/authorize", api.OAuthConsent)
+	r.POST("/oauth/token", api.OAuthToken)
+	r.GET("/oauth/userinfo", api.OAuthUserInfo)
+	r.POST("/oauth/userinfo", api.OAuthUserInfo)
+	r.POST("/oauth/introspect", api.OAuthIntrospect)
+	r.POST("/oauth/revoke", api.OAuthRevoke)
+
+	// SCIM 2.0 用户同步，使用 scim.token 认证
+	registerScimRoutes(r)
+
 	// 用户登出
-	r.POST("/user/logout", AuthMiddleWare(), api.Logout)
+	r.POST("/user/logout", AuthMiddleWare(), CsrfMiddleWare(), api.Logout)
 	// 用户注销
-	r.POST("/user/logoff", AuthMiddleWare(), api.Logoff)
+	r.POST("/user/logoff", AuthMiddleWare(), CsrfMiddleWare(), VerifiedMiddleWare(), api.Logoff)
+	// 重新获取 CSRF token
+	r.GET("/user/csrf_token", AuthMiddleWare(), api.GetCsrfToken)
 	// 获取用户信息
-	r.GET("/user/get_user_info", AuthMiddleWare(), api.GetUserInfo)
+	r.GET("/user/get_user_info", AuthMiddleWare(constant.ScopeUserRead), api.GetUserInfo)
 	// 更新用户信息
-	r.POST("/user/update_nick_name", AuthMiddleWare(), api.UpdateNickName)
+	r.POST("/user/update_nick_name", AuthMiddleWare(constant.ScopeUserWrite), CsrfMiddleWare(), VerifiedMiddleWare(), api.UpdateNickName)
+	// 个人访问令牌管理，只能使用会话访问
+	r.POST("/user/tokens", AuthMiddleWare(), CsrfMiddleWare(), api.CreateAccessToken)
+	r.GET("/user/tokens", AuthMiddleWare(), api.ListAccessTokens)
+	r.DELETE("/user/tokens/:id", AuthMiddleWare(), CsrfMiddleWare(), api.RevokeAccessToken)
+	// 登录历史
+	r.GET("/user/login_history", AuthMiddleWare(constant.ScopeUserRead), api.ListLoginHistory)
+	// 个人数据导出，只能使用会话访问，下载链接带签名，不需要登录
+	r.POST("/user/exports", AuthMiddleWare(), CsrfMiddleWare(), api.RequestDataExport)
+	r.GET("/user/exports", AuthMiddleWare(), api.ListDataExports)
+	r.GET("/user/exports/download", api.DownloadDataExport)
 	// 更新用户头像
 	r.POST("/user/upload", api.UpLoad)
 
@@ -39,13 +96,55 @@ func InitRouterAndServer() {
 	r.Static("/static/", "./web/static")
 	r.Static("/upload/images/", "./web/upload/images")
 
-	// 启动 server
-	port := config.GetGlobalConf().AppConfig.Port
-	if err := r.Run(":" + strconv.Itoa(port)); err != nil {
-		log.Error("start server err:" + err.Error())
+	return r
+}
+
+// setTrustedProxies 只信任配置的反向代理转发的 X-Forwarded-For，gin 默认信任所有来源，
+// 客户端可以随意伪造 c.ClientIP()
+func setTrustedProxies(r *gin.Engine) {
+	proxies := config.GetGlobalConf().AppConfig.TrustedProxies
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Errorf("invalid app.trusted_proxies %v, trust no proxy: %v", proxies, err)
+		_ = r.SetTrustedProxies(nil)
 	}
 }
 
+// NewAdminRouter 管理端口路由配置
+func NewAdminRouter() *gin.Engine {
+	r := gin.New()
+	setTrustedProxies(r)
+	r.Use(gin.Logger(), gin.Recovery(), RequestSourceMiddleWare())
+
+	r.GET("/healthz", api.Healthz)
+	r.GET("/readyz", api.Readyz)
+	// 热加载配置
+	r.POST("/admin/config/reload", api.ReloadConfig)
+	// 授权服务器接入应用管理
+	r.POST("/admin/oauth/clients", api.CreateOAuthClient)
+	r.GET("/admin/oauth/clients", api.ListOAuthClients)
+	r.DELETE("/admin/oauth/clients/:client_id", api.DeleteOAuthClient)
+	// 审计日志查询
+	r.GET("/admin/audit_logs", api.ListAuditLogs)
+	// 事件订阅管理和投递记录
+	r.POST("/admin/webhooks", api.CreateWebhook)
+	r.GET("/admin/webhooks", api.ListWebhooks)
+	r.PUT("/admin/webhooks/:id", api.UpdateWebhook)
+	r.DELETE("/admin/webhooks/:id", api.DeleteWebhook)
+	r.GET("/admin/webhooks/:id/deliveries", api.ListWebhookDeliveries)
+	r.GET("/admin/webhook_deliveries/:id", api.GetWebhookDelivery)
+	r.POST("/admin/webhook_deliveries/:id/redeliver", api.RedeliverWebhook)
+	// 发布次数用尽的领域事件，查询和手动重试
+	r.GET("/admin/outbox/dead_events", api.ListOutboxDeadEvents)
+	r.POST("/admin/outbox/dead_events/:id/retry", api.RetryOutboxEvent)
+	// 删除用户并清除个人数据，查询清除报告
+	r.POST("/admin/users/:name/erase", api.EraseUser)
+	r.GET("/admin/erasures", api.ListErasures)
+	r.GET("/admin/erasures/:id", api.GetErasure)
+	r.POST("/admin/erasures/:id/retry", api.RetryErasure)
+
+	return r
+}
+
 // 根据配置文件的设置来设置运行模式
 func setAppRunMode() {
 	if config.GetGlobalConf().AppConfig.RunMode == "release" {
@@ -59,9 +158,51 @@ func setAppRunMode() {
 	}
 }
 
-// AuthMiddleWare 检测用户释放处理登录状态
-func AuthMiddleWare() gin.HandlerFunc {
+// VerifiedMiddleWare 未完成邮箱验证的账号不能访问，需放在 AuthMiddleWare 之后
+func VerifiedMiddleWare() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !config.GetGlobalConf().EmailVerify.Enabled {
+			c.Next()
+			return
+		}
+		var err error
+		if userName := c.GetString(constant.AuthUserKey); userName != "" {
+			err = service.CheckUserVerified(userName)
+		} else {
+			session, _ := c.Cookie(constant.SessionKey)
+			err = service.CheckVerified(session)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthMiddleWare 检测用户释放处理登录状态。
+// 也接受 Authorization: Bearer 个人访问令牌，令牌需包含路由声明的全部 scope；未声明 scope 的路由只能使用会话访问
+func AuthMiddleWare(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isBearerRequest(c) {
+			user, granted, err := service.AuthenticateAccessToken(strings.TrimSpace(c.GetHeader("Authorization")[7:]), c.ClientIP())
+			if err != nil {
+				log.Warnf("AuthMiddleWare|%s %s|%v", c.Request.Method, c.Request.URL.Path, err)
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+				return
+			}
+			if len(scopes) == 0 || !oauth.Subset(scopes, strings.Join(granted, " ")) {
+				c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
+				return
+			}
+			c.Set(constant.AuthUserKey, user.Name)
+			// 令牌认证的请求跳过了 CSRF 校验，丢弃同时携带的 cookie，后续处理不能读写 cookie 对应的会话
+			c.Request.Header.Del("Cookie")
+			c.Next()
+			return
+		}
 		//使用了 c.Cookie(constant.SessionKey) 方法来获取名为 constant.SessionKey 的 cookie 的值和错误信息
 		if session, err := c.Cookie(constant.SessionKey); err == nil {
 			if session != "" { //没有错误信息且session不为空，说明已经登录
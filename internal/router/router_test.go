@@ -0,0 +1,41 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.5:1234", want: "203.0.113.5"},
+		{name: "forged header from client", remote: "203.0.113.5:1234", xff: "198.51.100.7", want: "203.0.113.5"},
+		{name: "trusted cidr", remote: "10.1.2.3:1234", xff: "198.51.100.7", want: "198.51.100.7"},
+		{name: "trusted ip", remote: "192.168.1.1:1234", xff: "198.51.100.7", want: "198.51.100.7"},
+		{name: "untrusted ip in same subnet", remote: "192.168.1.2:1234", xff: "198.51.100.7", want: "192.168.1.2"},
+		// 从右往左跳过可信代理，客户端自己加在最左边的地址不被采用
+		{name: "proxy chain", remote: "10.1.2.3:1234", xff: "1.1.1.1, 198.51.100.7, 10.0.0.2", want: "198.51.100.7"},
+	}
+	for _, newEngine := range []func() *gin.Engine{NewRouter, NewAdminRouter} {
+		r := newEngine()
+		r.GET("/test/client_ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodGet, "/test/client_ip", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("%s: client ip = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package router
+
+import (
+	api "Gous/api/http/v1"
+	"Gous/config"
+	"Gous/internal/scim"
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// ScimAuthMiddleWare SCIM 接口只接受配置的 Bearer 令牌，未开启时返回 404
+func ScimAuthMiddleWare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := config.GetGlobalConf().Scim
+		if !conf.Enabled {
+			api.ScimError(c, scim.NewError(http.StatusNotFound, "", "scim is disabled"))
+			return
+		}
+		token := ""
+		if isBearerRequest(c) {
+			token = strings.TrimSpace(c.GetHeader("Authorization")[7:])
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(conf.Token)) != 1 {
+			log.Warnf("ScimAuthMiddleWare|%s %s|invalid token from %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			api.ScimError(c, scim.NewError(http.StatusUnauthorized, "", "invalid bearer token"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerScimRoutes SCIM 2.0 用户同步接口
+func registerScimRoutes(r *gin.Engine) {
+	g := r.Group("/scim/v2", ScimAuthMiddleWare())
+	g.GET("/ServiceProviderConfig", api.ScimServiceProviderConfig)
+	g.GET("/ResourceTypes", api.ScimResourceTypes)
+
+	g.GET("/Users", api.ScimListUsers)
+	g.POST("/Users", api.ScimCreateUser)
+	g.GET("/Users/:id", api.ScimGetUser)
+	g.PUT("/Users/:id", api.ScimReplaceUser)
+	g.PATCH("/Users/:id", api.ScimPatchUser)
+	g.DELETE("/Users/:id", api.ScimDeleteUser)
+
+	g.GET("/Groups", api.ScimListGroups)
+	g.POST("/Groups", api.ScimCreateGroup)
+	g.GET("/Groups/:id", api.ScimGetGroup)
+	g.PUT("/Groups/:id", api.ScimReplaceGroup)
+	g.PATCH("/Groups/:id", api.ScimPatchGroup)
+	g.DELETE("/Groups/:id", api.ScimDeleteGroup)
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"Gous/config"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// cspReportPath CSP 违规上报地址
+const cspReportPath = "/csp-report"
+
+// SecurityMiddleWare 下发安全响应头并限制请求体大小
+func SecurityMiddleWare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sc := config.GetGlobalConf().Security
+
+		// 请求体大小限制，Content-Length 超限时直接拒绝，否则读取超限时报错
+		if sc.MaxBodySize > 0 {
+			if c.Request.ContentLength > sc.MaxBodySize {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, sc.MaxBodySize)
+		}
+
+		h := c.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if sc.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", sc.ReferrerPolicy)
+		}
+		if sc.PermissionsPolicy != "" {
+			h.Set("Permissions-Policy", sc.PermissionsPolicy)
+		}
+		if sc.HstsMaxAge > 0 && isHTTPS(c.Request) {
+			h.Set("Strict-Transport-Security", hstsValue(sc))
+		}
+		h.Set("X-Frame-Options", xFrameOptions(sc))
+		if csp := cspValue(sc); csp != "" {
+			if sc.CspReportOnly {
+				h.Set("Content-Security-Policy-Report-Only", csp)
+			} else {
+				h.Set("Content-Security-Policy", csp)
+			}
+		}
+		c.Next()
+	}
+}
+
+// isHTTPS 请求是否通过 https 到达，兼容前置代理终止 TLS 的情况
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// xFrameOptions 始终下发 X-Frame-Options：旧浏览器不支持 CSP frame-ancestors，
+// 只上报模式下 frame-ancestors 也不生效。允许其他来源嵌入时取 SAMEORIGIN，
+// 执行 CSP 的浏览器以 frame-ancestors 为准
+func xFrameOptions(sc config.SecurityConf) string {
+	if sc.FrameAncestors == "'none'" {
+		return "DENY"
+	}
+	return "SAMEORIGIN"
+}
+
+func hstsValue(sc config.SecurityConf) string {
+	v := fmt.Sprintf("max-age=%d", sc.HstsMaxAge)
+	if sc.HstsIncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if sc.HstsPreload {
+		v += "; preload"
+	}
+	return v
+}
+
+// cspValue 拼接 CSP 策略、frame-ancestors 和上报地址
+func cspValue(sc config.SecurityConf) string {
+	var parts []string
+	if p := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sc.ContentSecurityPolicy), ";")); p != "" {
+		parts = append(parts, p)
+	}
+	if sc.FrameAncestors != "" {
+		parts = append(parts, "frame-ancestors "+sc.FrameAncestors)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	parts = append(parts, "report-uri "+cspReportPath)
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,129 @@
+package router
+
+import (
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/oauth"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func bearerRequest(method, path, auth, remote string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return req
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	user := createTestUser(t, "pat_user")
+	_, read := createAccessToken(t, user, "user:read", nil)
+	_, write := createAccessToken(t, user, "user:write", nil)
+	_, both := createAccessToken(t, user, "user:read user:write", nil)
+	expired := time.Now().Add(-time.Minute)
+	_, old := createAccessToken(t, user, "user:read", &expired)
+	revokedToken, revoked := createAccessToken(t, user, "user:read", nil)
+	if ok, err := dao.DeleteAccessToken(user.ID, revokedToken.ID); err != nil || !ok {
+		t.Fatalf("revoke: %v, %v", ok, err)
+	}
+	suspended := createTestUser(t, "pat_suspended")
+	_, suspendedToken := createAccessToken(t, suspended, "user:read", nil)
+	if err := utils.GetDB().Model(&model.User{}).Where("id=?", suspended.ID).Update("status", constant.UserStatusSuspended).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := NewRouter()
+
+	const userInfo = "/user/get_user_info?username=pat_user"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		want   int
+		header string // 期望的 WWW-Authenticate
+	}{
+		{name: "read scope", method: http.MethodGet, path: userInfo, auth: "Bearer " + read, want: http.StatusOK},
+		{name: "case insensitive scheme", method: http.MethodGet, path: userInfo, auth: "bearer " + both, want: http.StatusOK},
+		{name: "wrong scope", method: http.MethodGet, path: userInfo, auth: "Bearer " + write, want: http.StatusForbidden,
+			header: `Bearer error="insufficient_scope", scope="user:read"`},
+		// 未声明 scope 的路由只能使用会话访问
+		{name: "session only route", method: http.MethodGet, path: "/user/tokens", auth: "Bearer " + both, want: http.StatusForbidden},
+		{name: "session only csrf route", method: http.MethodPost, path: "/user/tokens", auth: "Bearer " + both, want: http.StatusForbidden},
+		{name: "expired", method: http.MethodGet, path: userInfo, auth: "Bearer " + old, want: http.StatusUnauthorized,
+			header: `Bearer error="invalid_token"`},
+		{name: "revoked", method: http.MethodGet, path: userInfo, auth: "Bearer " + revoked, want: http.StatusUnauthorized},
+		{name: "suspended owner", method: http.MethodGet, path: "/user/get_user_info?username=pat_suspended", auth: "Bearer " + suspendedToken, want: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, path: userInfo, auth: "Bearer " + constant.AccessTokenPrefix + "unknown", want: http.StatusUnauthorized},
+		{name: "no credentials", method: http.MethodGet, path: userInfo, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, bearerRequest(tt.method, tt.path, tt.auth, "203.0.113.5:1234"))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if tt.header != "" && w.Header().Get("WWW-Authenticate") != tt.header {
+			t.Errorf("%s: WWW-Authenticate %q, want %q", tt.name, w.Header().Get("WWW-Authenticate"), tt.header)
+		}
+	}
+}
+
+func TestAccessTokenUserInfo(t *testing.T) {
+	user := createTestUser(t, "pat_info_user")
+	_, raw := createAccessToken(t, user, "user:read", nil)
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, bearerRequest(http.MethodGet, "/user/get_user_info?username=pat_info_user", "Bearer "+raw, "203.0.113.5:1234"))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"user_name":"pat_info_user"`) {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "pass") || strings.Contains(w.Body.String(), "secret-password") {
+		t.Fatalf("password returned: %s", w.Body.String())
+	}
+}
+
+func TestAccessTokenLastUsed(t *testing.T) {
+	user := createTestUser(t, "pat_touch_user")
+	_, raw := createAccessToken(t, user, "user:read", nil)
+	r := NewRouter()
+	get := func(remote string) *model.AccessToken {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, bearerRequest(http.MethodGet, "/user/get_user_info?username=pat_touch_user", "Bearer "+raw, remote))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		token, err := dao.GetAccessTokenByHash(oauth.HashSecret(raw))
+		if err != nil || token == nil {
+			t.Fatalf("token: %v, %v", token, err)
+		}
+		return token
+	}
+
+	first := get("203.0.113.5:1234")
+	if first.LastUsedAt == nil || time.Since(*first.LastUsedAt) > time.Minute || first.LastUsedIP != "203.0.113.5" {
+		t.Fatalf("last used not recorded: %+v", first)
+	}
+	// 同一 IP 一分钟内不重复写库
+	if second := get("203.0.113.5:1234"); !second.LastUsedAt.Equal(*first.LastUsedAt) {
+		t.Fatalf("last used updated within touch interval: %v -> %v", first.LastUsedAt, second.LastUsedAt)
+	}
+	// IP 变化时立即更新
+	if third := get("198.51.100.7:1234"); third.LastUsedIP != "198.51.100.7" {
+		t.Fatalf("last used ip not updated: %+v", third)
+	}
+	// 超过间隔后更新时间
+	past := time.Now().Add(-2 * time.Minute)
+	if err := dao.TouchAccessToken(first.ID, past, "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if fourth := get("198.51.100.7:1234"); !fourth.LastUsedAt.After(past.Add(time.Minute)) {
+		t.Fatalf("last used not refreshed: %v", fourth.LastUsedAt)
+	}
+}
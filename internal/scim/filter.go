@@ -0,0 +1,453 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Filter 过滤表达式（RFC 7644 3.4.2.2），属性路径统一为小写
+type Filter struct {
+	Op    string // and、or、not，或 eq、ne、co、sw、ew、gt、ge、lt、le、pr
+	Left  *Filter
+	Right *Filter
+	Attr  string
+	Value interface{}
+}
+
+// Attr 过滤属性到数据库字段的映射
+type Attr struct {
+	Column string
+	// Expr 不直接对应字段的属性，如 active，自行生成条件
+	Expr func(op string, value interface{}) (string, []interface{}, error)
+}
+
+var compareOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+func invalidFilter(format string, args ...interface{}) *Error {
+	return NewError(http.StatusBadRequest, "invalidFilter", format, args...)
+}
+
+// ParseFilter 解析过滤表达式，支持 and、or、not、括号以及 emails[type eq "work"] 形式的值路径
+func ParseFilter(s string) (*Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, invalidFilter("unexpected %q", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+// tokenize 拆分为属性、运算符、括号和值，字符串值保留引号，由解析时按 JSON 解码
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("()[]", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, invalidFilter("unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t()[]\"", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, invalidFilter("empty filter")
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) expect(t string) error {
+	if got := p.next(); got != t {
+		return invalidFilter("expected %q, got %q", t, got)
+	}
+	return nil
+}
+
+// parseOr prefix 为值路径中的父属性，如 emails[type eq "work"] 中的 emails
+func (p *filterParser) parseOr(prefix string) (*Filter, error) {
+	left, err := p.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd(prefix string) (*Filter, error) {
+	left, err := p.parseUnary(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseUnary(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary(prefix string) (*Filter, error) {
+	switch t := p.peek(); {
+	case t == "(":
+		p.next()
+		f, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case strings.EqualFold(t, "not"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "not", Left: f}, p.expect(")")
+	case t == "" || t == ")" || t == "]":
+		return nil, invalidFilter("attribute expected")
+	}
+
+	attr := NormalizeAttr(p.next())
+	if prefix != "" {
+		attr = prefix + "." + attr
+	}
+	if p.peek() == "[" {
+		if prefix != "" {
+			return nil, invalidFilter("nested value path is not supported")
+		}
+		p.next()
+		f, err := p.parseOr(attr)
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect("]")
+	}
+
+	op := strings.ToLower(p.next())
+	if op == "pr" {
+		return &Filter{Op: op, Attr: attr}, nil
+	}
+	if !compareOps[op] {
+		return nil, invalidFilter("unsupported operator %q", op)
+	}
+	raw := p.next()
+	if raw == "" {
+		return nil, invalidFilter("value expected after %s", op)
+	}
+	value, err := parseValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Op: op, Attr: attr, Value: value}, nil
+}
+
+// parseValue 值为 JSON 字符串、数字、true、false 或 null
+func parseValue(raw string) (interface{}, error) {
+	switch strings.ToLower(raw) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		var s string
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			return nil, invalidFilter("invalid string %s", raw)
+		}
+		return s, nil
+	}
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		return n, nil
+	}
+	return nil, invalidFilter("invalid value %q", raw)
+}
+
+// NormalizeAttr 去掉 schema URN 前缀并转小写，如 urn:...:User:userName 转为 username
+func NormalizeAttr(attr string) string {
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if len(attr) > len(schema) && strings.EqualFold(attr[:len(schema)+1], schema+":") {
+			attr = attr[len(schema)+1:]
+			break
+		}
+	}
+	return strings.ToLower(attr)
+}
+
+// ToSQL 把过滤表达式转换为 SQL 条件，attrs 中没有的属性不支持过滤
+func (f *Filter) ToSQL(attrs map[string]Attr) (string, []interface{}, error) {
+	switch f.Op {
+	case "and", "or":
+		l, la, err := f.Left.ToSQL(attrs)
+		if err != nil {
+			return "", nil, err
+		}
+		r, ra, err := f.Right.ToSQL(attrs)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + l + " " + strings.ToUpper(f.Op) + " " + r + ")", append(la, ra...), nil
+	case "not":
+		l, la, err := f.Left.ToSQL(attrs)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + l, la, nil
+	}
+
+	a, ok := attrs[f.Attr]
+	if !ok {
+		return "", nil, invalidFilter("filtering on %q is not supported", f.Attr)
+	}
+	if a.Expr != nil {
+		return a.Expr(f.Op, f.Value)
+	}
+	return ColumnSQL(a.Column, f.Op, f.Value)
+}
+
+// ColumnSQL 按字段生成比较条件，op 为 eq、ne、co、sw、ew、gt、ge、lt、le、pr
+func ColumnSQL(col, op string, value interface{}) (string, []interface{}, error) {
+	switch op {
+	case "pr":
+		return "(" + col + " IS NOT NULL AND " + col + " <> '')", nil, nil
+	case "eq", "ne":
+		if value == nil {
+			if op == "eq" {
+				return col + " IS NULL", nil, nil
+			}
+			return col + " IS NOT NULL", nil, nil
+		}
+		if op == "eq" {
+			return col + " = ?", []interface{}{value}, nil
+		}
+		return col + " <> ?", []interface{}{value}, nil
+	case "co", "sw", "ew":
+		s, ok := value.(string)
+		if !ok {
+			return "", nil, invalidFilter("%s requires a string value", op)
+		}
+		s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+		switch op {
+		case "co":
+			s = "%" + s + "%"
+		case "sw":
+			s = s + "%"
+		default:
+			s = "%" + s
+		}
+		return col + " LIKE ?", []interface{}{s}, nil
+	}
+	sqlOps := map[string]string{"gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+	return col + " " + sqlOps[op] + " ?", []interface{}{value}, nil
+}
+
+// Match 在内存中判断资源是否满足过滤条件，用于 PATCH 路径中的值筛选；字符串比较不区分大小写
+func (f *Filter) Match(doc map[string]interface{}) bool {
+	switch f.Op {
+	case "and":
+		return f.Left.Match(doc) && f.Right.Match(doc)
+	case "or":
+		return f.Left.Match(doc) || f.Right.Match(doc)
+	case "not":
+		return !f.Left.Match(doc)
+	}
+	values := lookup(doc, strings.Split(f.Attr, "."))
+	if f.Op == "pr" {
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if len(values) == 0 {
+		values = []interface{}{nil}
+	}
+	for _, v := range values {
+		if compare(f.Op, v, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup 按路径取值，多值属性展开为多个值
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		if list, ok := v.([]interface{}); ok {
+			return list
+		}
+		return []interface{}{v}
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		key, ok := findKey(t, path[0])
+		if !ok {
+			return nil
+		}
+		return lookup(t[key], path[1:])
+	case []interface{}:
+		var out []interface{}
+		for _, item := range t {
+			out = append(out, lookup(item, path)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func compare(op string, actual, expected interface{}) bool {
+	if expected == nil || actual == nil {
+		switch op {
+		case "eq":
+			return actual == expected
+		case "ne":
+			return actual != expected
+		}
+		return false
+	}
+	switch e := expected.(type) {
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return op == "ne"
+		}
+		a, e = strings.ToLower(a), strings.ToLower(e)
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		a, ok := actual.(bool)
+		switch op {
+		case "eq":
+			return ok && a == e
+		case "ne":
+			return !ok || a != e
+		}
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return op == "ne"
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	}
+	return false
+}
+
+// findKey 属性名不区分大小写，返回 map 中实际的 key
+func findKey(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// String 便于日志输出
+func (f *Filter) String() string {
+	switch f.Op {
+	case "and", "or":
+		return fmt.Sprintf("(%s %s %s)", f.Left, f.Op, f.Right)
+	case "not":
+		return fmt.Sprintf("not(%s)", f.Left)
+	case "pr":
+		return f.Attr + " pr"
+	}
+	return fmt.Sprintf("%s %s %v", f.Attr, f.Op, f.Value)
+}
@@ -0,0 +1,265 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // Filter.String() 的结果
+	}{
+		{`userName eq "bjensen"`, `username eq bjensen`},
+		{`userName EQ "bjensen"`, `username eq bjensen`},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "J"`, `username sw J`},
+		{`name.familyName co "O'Malley"`, `name.familyname co O'Malley`},
+		{`title pr`, `title pr`},
+		{`displayName eq "say \"hi\" \\ bye"`, `displayname eq say "hi" \ bye`},
+		{`displayName eq "a(b)[c] and d"`, `displayname eq a(b)[c] and d`},
+		{`active eq true`, `active eq true`},
+		{`active ne FALSE`, `active ne false`},
+		{`externalId eq null`, `externalid eq <nil>`},
+		{`meta.version gt 1.5`, `meta.version gt 1.5`},
+		{`meta.lastModified ge "2011-05-13T04:42:34Z"`, `meta.lastmodified ge 2011-05-13T04:42:34Z`},
+		// and 的优先级高于 or，同级从左到右结合
+		{`a eq 1 or b eq 2 and c pr`, `(a eq 1 or (b eq 2 and c pr))`},
+		{`a eq 1 and b eq 2 or c pr`, `((a eq 1 and b eq 2) or c pr)`},
+		{`a pr and b pr and c pr`, `((a pr and b pr) and c pr)`},
+		{`(a eq 1 or b eq 2) and c pr`, `((a eq 1 or b eq 2) and c pr)`},
+		{`a pr AND b pr Or c pr`, `((a pr and b pr) or c pr)`},
+		{`not (active eq false)`, `not(active eq false)`},
+		{`NOT(a pr) and not (b pr or c pr)`, `(not(a pr) and not((b pr or c pr)))`},
+		// 值路径中的属性带上父属性前缀
+		{`emails[type eq "work"]`, `emails.type eq work`},
+		{`emails[type eq "work" and value co "@example.com"] or userName eq "x"`, `((emails.type eq work and emails.value co @example.com) or username eq x)`},
+		{`emails[not (type eq "home")]`, `not(emails.type eq home)`},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.in)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.in, err)
+			continue
+		}
+		if got := f.String(); got != tt.want {
+			t.Errorf("ParseFilter(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterValueTypes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{`a eq "1"`, "1"},
+		{`a eq 1`, float64(1)},
+		{`a eq -2.5e1`, float64(-25)},
+		{`a eq true`, true},
+		{`a eq False`, false},
+		{`a eq null`, nil},
+		{`a eq "é"`, "é"},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.in)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(f.Value, tt.want) {
+			t.Errorf("ParseFilter(%q) value = %#v, want %#v", tt.in, f.Value, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`   `,
+		`userName`,
+		`userName eq`,
+		`userName zz "x"`,
+		`userName eq bjensen`,
+		`userName eq "bjensen`,
+		`userName eq "x" extra`,
+		`userName eq "x" and`,
+		`(userName eq "x"`,
+		`userName eq "x")`,
+		`not userName eq "x"`,
+		`emails[type eq "work"`,
+		`emails[type eq "work"]]`,
+		`emails[value[type eq "x"]]`,
+		`and userName eq "x"`,
+		`()`,
+	} {
+		_, err := ParseFilter(in)
+		var se *Error
+		if !errors.As(err, &se) || se.ScimType != "invalidFilter" || se.StatusCode() != 400 {
+			t.Errorf("ParseFilter(%q) = %v, want invalidFilter", in, err)
+		}
+	}
+}
+
+var testAttrs = map[string]Attr{
+	"username":          {Column: "name"},
+	"emails.value":      {Column: "email"},
+	"meta.lastmodified": {Column: "update_time"},
+	"active": {Expr: func(op string, value interface{}) (string, []interface{}, error) {
+		b, ok := value.(bool)
+		if op != "eq" || !ok {
+			return "", nil, invalidFilter("active only supports eq with a boolean")
+		}
+		if b {
+			return "status = ?", []interface{}{"active"}, nil
+		}
+		return "status <> ?", []interface{}{"active"}, nil
+	}},
+}
+
+func TestToSQL(t *testing.T) {
+	tests := []struct {
+		in   string
+		sql  string
+		args []interface{}
+	}{
+		{`userName eq "bjensen"`, "name = ?", []interface{}{"bjensen"}},
+		{`userName ne "bjensen"`, "name <> ?", []interface{}{"bjensen"}},
+		{`userName eq null`, "name IS NULL", nil},
+		{`userName ne null`, "name IS NOT NULL", nil},
+		{`userName pr`, "(name IS NOT NULL AND name <> '')", nil},
+		{`userName co "jen"`, "name LIKE ?", []interface{}{"%jen%"}},
+		{`userName sw "bj"`, "name LIKE ?", []interface{}{"bj%"}},
+		{`userName ew "sen"`, "name LIKE ?", []interface{}{"%sen"}},
+		// LIKE 中的通配符和转义符按字面匹配
+		{`userName co "50%_off\\"`, "name LIKE ?", []interface{}{`%50\%\_off\\%`}},
+		{`userName sw "a_b"`, "name LIKE ?", []interface{}{`a\_b%`}},
+		{`meta.lastModified gt "2024-01-01"`, "update_time > ?", []interface{}{"2024-01-01"}},
+		{`meta.lastModified ge "2024-01-01"`, "update_time >= ?", []interface{}{"2024-01-01"}},
+		{`meta.lastModified lt "2024-01-01"`, "update_time < ?", []interface{}{"2024-01-01"}},
+		{`meta.lastModified le "2024-01-01"`, "update_time <= ?", []interface{}{"2024-01-01"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "x"`, "name = ?", []interface{}{"x"}},
+		{`emails[value eq "a@example.com"]`, "email = ?", []interface{}{"a@example.com"}},
+		{`emails.value eq "a@example.com"`, "email = ?", []interface{}{"a@example.com"}},
+		{`active eq true`, "status = ?", []interface{}{"active"}},
+		{`active eq false`, "status <> ?", []interface{}{"active"}},
+		{`userName eq "a" or userName eq "b"`, "(name = ? OR name = ?)", []interface{}{"a", "b"}},
+		{
+			`userName eq "a" and (emails.value co "x" or not (userName sw "b"))`,
+			"(name = ? AND (email LIKE ? OR NOT name LIKE ?))",
+			[]interface{}{"a", "%x%", "b%"},
+		},
+		{
+			`not (userName pr and active eq true) or emails[value ew "@example.com"]`,
+			"(NOT ((name IS NOT NULL AND name <> '') AND status = ?) OR email LIKE ?)",
+			[]interface{}{"active", "%@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.in)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.in, err)
+			continue
+		}
+		sql, args, err := f.ToSQL(testAttrs)
+		if err != nil {
+			t.Errorf("ToSQL(%q): %v", tt.in, err)
+			continue
+		}
+		if sql != tt.sql || fmt.Sprint(args) != fmt.Sprint(tt.args) || len(args) != len(tt.args) {
+			t.Errorf("ToSQL(%q) = %q %v, want %q %v", tt.in, sql, args, tt.sql, tt.args)
+		}
+	}
+}
+
+func TestToSQLErrors(t *testing.T) {
+	for _, in := range []string{
+		`title eq "x"`,
+		`emails.type eq "work"`,
+		`userName eq "a" and title pr`,
+		`not (title pr)`,
+		`userName co 1`,
+		`userName sw true`,
+		`active eq "yes"`,
+	} {
+		f, err := ParseFilter(in)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", in, err)
+			continue
+		}
+		_, _, err = f.ToSQL(testAttrs)
+		var se *Error
+		if !errors.As(err, &se) || se.ScimType != "invalidFilter" {
+			t.Errorf("ToSQL(%q) = %v, want invalidFilter", in, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"userName": "bjensen",
+		"active": true,
+		"logins": 3,
+		"name": {"givenName": "Barbara", "familyName": "Jensen"},
+		"emails": [
+			{"value": "bjensen@example.com", "type": "work", "primary": true},
+			{"value": "babs@home.example", "type": "home"}
+		]
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{`userName eq "bjensen"`, true},
+		{`USERNAME eq "BJensen"`, true},
+		{`userName ne "bjensen"`, false},
+		{`userName co "JEN"`, true},
+		{`userName sw "bj"`, true},
+		{`userName ew "sen"`, true},
+		{`userName ew "bj"`, false},
+		{`userName gt "a"`, true},
+		{`userName lt "a"`, false},
+		{`name.givenName sw "bar"`, true},
+		{`name.familyName eq "Smith"`, false},
+		{`active eq true`, true},
+		{`active ne true`, false},
+		{`logins gt 2`, true},
+		{`logins le 2`, false},
+		{`logins eq 3`, true},
+		// 类型不同时只有 ne 成立
+		{`userName eq 1`, false},
+		{`userName ne 1`, true},
+		{`logins eq "3"`, false},
+		{`userName pr`, true},
+		{`title pr`, false},
+		{`name.middleName pr`, false},
+		{`title eq null`, true},
+		{`userName eq null`, false},
+		{`title ne null`, false},
+		// 多值属性中任意一个元素满足即可
+		{`emails.type eq "home"`, true},
+		{`emails.value ew "@example.com"`, true},
+		{`emails.type eq "other"`, false},
+		{`emails.primary eq true`, true},
+		{`emails[type eq "work" and value co "example.com"]`, true},
+		{`userName eq "x" or emails.type eq "home"`, true},
+		{`userName eq "bjensen" and active eq false`, false},
+		{`not (active eq false)`, true},
+		{`not (userName pr)`, false},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.in)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.in, err)
+			continue
+		}
+		if got := f.Match(doc); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package scim
+
+import (
+	"net/http"
+	"strings"
+)
+
+func invalidPath(format string, args ...interface{}) *Error {
+	return NewError(http.StatusBadRequest, "invalidPath", format, args...)
+}
+
+// patchPath 解析后的 PATCH 路径：attr[filter].sub
+type patchPath struct {
+	attr   string
+	filter *Filter
+	sub    string
+}
+
+func parsePatchPath(path string) (*patchPath, error) {
+	p := &patchPath{}
+	rest := path
+	// URN 前缀中含有 .，需要先去掉再拆分
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if len(rest) > len(schema) && strings.EqualFold(rest[:len(schema)+1], schema+":") {
+			rest = rest[len(schema)+1:]
+			break
+		}
+	}
+	if i := strings.Index(rest, "["); i >= 0 {
+		j := strings.LastIndex(rest, "]")
+		if j < i {
+			return nil, invalidPath("unbalanced brackets in %q", path)
+		}
+		f, err := ParseFilter(rest[i+1 : j])
+		if err != nil {
+			return nil, invalidPath("invalid filter in %q: %v", path, err)
+		}
+		p.attr, p.filter = rest[:i], f
+		rest = strings.TrimPrefix(rest[j+1:], ".")
+		p.sub = rest
+	} else if i := strings.Index(rest, "."); i >= 0 {
+		p.attr, p.sub = rest[:i], rest[i+1:]
+	} else {
+		p.attr = rest
+	}
+	if p.attr == "" || strings.Contains(p.sub, ".") {
+		return nil, invalidPath("unsupported path %q", path)
+	}
+	return p, nil
+}
+
+// ApplyPatch 在资源 map 上依次执行 PATCH 操作（RFC 7644 3.5.2），属性名不区分大小写
+func ApplyPatch(doc map[string]interface{}, ops []PatchOperation) error {
+	if len(ops) == 0 {
+		return NewError(http.StatusBadRequest, "invalidSyntax", "no operations")
+	}
+	for _, op := range ops {
+		name := strings.ToLower(op.Op)
+		switch name {
+		case "add", "replace", "remove":
+		default:
+			return NewError(http.StatusBadRequest, "invalidSyntax", "unsupported op %q", op.Op)
+		}
+		if op.Path == "" {
+			if name == "remove" {
+				return NewError(http.StatusBadRequest, "noTarget", "remove requires a path")
+			}
+			values, ok := op.Value.(map[string]interface{})
+			if !ok {
+				return NewError(http.StatusBadRequest, "invalidValue", "value must be an object when path is empty")
+			}
+			// 部分身份提供方在 value 的 key 中使用路径，如 name.givenName
+			for k, v := range values {
+				if err := applyPath(doc, name, k, v); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := applyPath(doc, name, op.Path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyPath(doc map[string]interface{}, op, path string, value interface{}) error {
+	p, err := parsePatchPath(path)
+	if err != nil {
+		return err
+	}
+	key, exists := findKey(doc, p.attr)
+	if !exists {
+		key = p.attr
+	}
+	if p.filter != nil {
+		return applyFiltered(doc, key, op, p, value)
+	}
+
+	if p.sub == "" {
+		switch op {
+		case "remove":
+			// 部分身份提供方删除组成员时在 value 中列出要删除的元素
+			if list, ok := doc[key].([]interface{}); ok && value != nil {
+				doc[key] = removeValues(list, value)
+				return nil
+			}
+			delete(doc, key)
+		case "add":
+			// 多值属性追加，其余属性直接设置
+			if list, ok := doc[key].([]interface{}); ok {
+				if add, ok := value.([]interface{}); ok {
+					doc[key] = append(list, add...)
+				} else {
+					doc[key] = append(list, value)
+				}
+				return nil
+			}
+			doc[key] = value
+		default:
+			doc[key] = value
+		}
+		return nil
+	}
+
+	// 复杂属性的子属性，如 name.givenName
+	parent, ok := doc[key].(map[string]interface{})
+	if !exists || doc[key] == nil {
+		if op == "remove" {
+			return nil
+		}
+		parent, ok = map[string]interface{}{}, true
+		doc[key] = parent
+	}
+	if !ok {
+		return invalidPath("%q is not a complex attribute", p.attr)
+	}
+	subKey, found := findKey(parent, p.sub)
+	if !found {
+		subKey = p.sub
+	}
+	if op == "remove" {
+		delete(parent, subKey)
+	} else {
+		parent[subKey] = value
+	}
+	return nil
+}
+
+// applyFiltered 处理 emails[type eq "work"].value、members[value eq "1"] 形式的路径
+func applyFiltered(doc map[string]interface{}, key, op string, p *patchPath, value interface{}) error {
+	list, _ := doc[key].([]interface{})
+	matched := 0
+	kept := list[:0:0]
+	for _, item := range list {
+		elem, ok := item.(map[string]interface{})
+		if !ok || !p.filter.Match(elem) {
+			kept = append(kept, item)
+			continue
+		}
+		matched++
+		switch {
+		case op == "remove" && p.sub == "":
+			continue // 删除整个元素
+		case op == "remove":
+			if k, ok := findKey(elem, p.sub); ok {
+				delete(elem, k)
+			}
+		case p.sub != "":
+			k, ok := findKey(elem, p.sub)
+			if !ok {
+				k = p.sub
+			}
+			elem[k] = value
+		default:
+			update, ok := value.(map[string]interface{})
+			if !ok {
+				return NewError(http.StatusBadRequest, "invalidValue", "value must be an object for %q", p.attr)
+			}
+			for k, v := range update {
+				elem[k] = v
+			}
+		}
+		kept = append(kept, elem)
+	}
+
+	if matched == 0 {
+		if op == "remove" {
+			return nil
+		}
+		// 没有匹配的元素时，按过滤条件中的 eq 新建一个，如 emails[type eq "work"].value
+		elem := map[string]interface{}{}
+		if !fillFromFilter(elem, p.filter) {
+			return NewError(http.StatusBadRequest, "noTarget", "no value matches %q", p.attr)
+		}
+		if p.sub != "" {
+			elem[p.sub] = value
+		} else if update, ok := value.(map[string]interface{}); ok {
+			for k, v := range update {
+				elem[k] = v
+			}
+		}
+		kept = append(kept, elem)
+	}
+	doc[key] = kept
+	return nil
+}
+
+// fillFromFilter 用只含 eq 和 and 的过滤条件填充新元素
+func fillFromFilter(elem map[string]interface{}, f *Filter) bool {
+	switch f.Op {
+	case "and":
+		return fillFromFilter(elem, f.Left) && fillFromFilter(elem, f.Right)
+	case "eq":
+		if strings.Contains(f.Attr, ".") {
+			return false
+		}
+		elem[f.Attr] = f.Value
+		return true
+	}
+	return false
+}
+
+// removeValues 从多值属性中删除 value 相同的元素
+func removeValues(list []interface{}, value interface{}) []interface{} {
+	remove, ok := value.([]interface{})
+	if !ok {
+		remove = []interface{}{value}
+	}
+	drop := map[string]bool{}
+	for _, r := range remove {
+		if v := elemValue(r); v != "" {
+			drop[v] = true
+		}
+	}
+	kept := list[:0:0]
+	for _, item := range list {
+		if !drop[elemValue(item)] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func elemValue(item interface{}) string {
+	if m, ok := item.(map[string]interface{}); ok {
+		if k, ok := findKey(m, "value"); ok {
+			v, _ := m[k].(string)
+			return v
+		}
+	}
+	return ""
+}
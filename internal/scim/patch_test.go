@@ -0,0 +1,262 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func jsonMap(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatalf("invalid json %s: %v", s, err)
+	}
+	return doc
+}
+
+func jsonValue(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid json %s: %v", s, err)
+	}
+	return v
+}
+
+const patchUser = `{
+	"userName": "bjensen",
+	"active": true,
+	"name": {"givenName": "Barbara", "familyName": "Jensen"},
+	"emails": [
+		{"value": "bjensen@example.com", "type": "work", "primary": true},
+		{"value": "babs@home.example", "type": "home"}
+	]
+}`
+
+const patchGroup = `{
+	"displayName": "admins",
+	"members": [{"value": "1"}, {"value": "2"}, {"value": "3"}]
+}`
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		op    string
+		path  string
+		value string // JSON，为空时没有 value
+		want  string
+	}{
+		{
+			name: "replace attribute",
+			doc:  `{"userName": "bjensen", "active": true}`,
+			op:   "replace", path: "active", value: `false`,
+			want: `{"userName": "bjensen", "active": false}`,
+		},
+		{
+			name: "attribute name is case insensitive",
+			doc:  `{"userName": "bjensen"}`,
+			op:   "Replace", path: "USERNAME", value: `"barbara"`,
+			want: `{"userName": "barbara"}`,
+		},
+		{
+			name: "schema urn prefix",
+			doc:  `{"name": {"familyName": "Jensen"}}`,
+			op:   "replace", path: "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName", value: `"Smith"`,
+			want: `{"name": {"familyName": "Smith"}}`,
+		},
+		{
+			name: "add sub attribute creates parent",
+			doc:  `{"userName": "bjensen"}`,
+			op:   "add", path: "name.givenName", value: `"Barbara"`,
+			want: `{"userName": "bjensen", "name": {"givenName": "Barbara"}}`,
+		},
+		{
+			name: "remove sub attribute",
+			doc:  `{"name": {"givenName": "Barbara", "familyName": "Jensen"}}`,
+			op:   "remove", path: "name.givenname",
+			want: `{"name": {"familyName": "Jensen"}}`,
+		},
+		{
+			name: "remove sub attribute of missing parent",
+			doc:  `{"userName": "bjensen"}`,
+			op:   "remove", path: "name.givenName",
+			want: `{"userName": "bjensen"}`,
+		},
+		{
+			name: "remove attribute",
+			doc:  `{"userName": "bjensen", "displayName": "Babs"}`,
+			op:   "remove", path: "displayName",
+			want: `{"userName": "bjensen"}`,
+		},
+		{
+			name: "add without path",
+			doc:  `{"userName": "bjensen", "name": {"familyName": "Jensen"}}`,
+			op:   "add", value: `{"displayName": "Babs", "name.givenName": "Barbara"}`,
+			want: `{"userName": "bjensen", "displayName": "Babs", "name": {"givenName": "Barbara", "familyName": "Jensen"}}`,
+		},
+		{
+			name: "add appends to multi valued attribute",
+			doc:  `{"emails": [{"value": "a@example.com", "type": "work"}]}`,
+			op:   "add", path: "emails", value: `[{"value": "b@example.com", "type": "home"}]`,
+			want: `{"emails": [{"value": "a@example.com", "type": "work"}, {"value": "b@example.com", "type": "home"}]}`,
+		},
+		{
+			name: "add single value to multi valued attribute",
+			doc:  patchGroup,
+			op:   "add", path: "members", value: `{"value": "4"}`,
+			want: `{"displayName": "admins", "members": [{"value": "1"}, {"value": "2"}, {"value": "3"}, {"value": "4"}]}`,
+		},
+		{
+			name: "replace multi valued attribute",
+			doc:  patchGroup,
+			op:   "replace", path: "members", value: `[{"value": "9"}]`,
+			want: `{"displayName": "admins", "members": [{"value": "9"}]}`,
+		},
+		{
+			name: "remove members listed in value",
+			doc:  patchGroup,
+			op:   "remove", path: "members", value: `[{"value": "1"}, {"value": "3"}]`,
+			want: `{"displayName": "admins", "members": [{"value": "2"}]}`,
+		},
+		{
+			name: "remove members by filter",
+			doc:  patchGroup,
+			op:   "remove", path: `members[value eq "2"]`,
+			want: `{"displayName": "admins", "members": [{"value": "1"}, {"value": "3"}]}`,
+		},
+		{
+			name: "remove by filter without match",
+			doc:  patchGroup,
+			op:   "remove", path: `members[value eq "7"]`,
+			want: patchGroup,
+		},
+		{
+			name: "replace sub attribute of filtered element",
+			doc:  patchUser,
+			op:   "replace", path: `emails[type eq "work"].value`, value: `"barbara@example.com"`,
+			want: `{"userName": "bjensen", "active": true, "name": {"givenName": "Barbara", "familyName": "Jensen"}, "emails": [
+				{"value": "barbara@example.com", "type": "work", "primary": true},
+				{"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "filter value is case insensitive",
+			doc:  patchUser,
+			op:   "replace", path: `emails[TYPE eq "HOME"].value`, value: `"b@home.example"`,
+			want: `{"userName": "bjensen", "active": true, "name": {"givenName": "Barbara", "familyName": "Jensen"}, "emails": [
+				{"value": "bjensen@example.com", "type": "work", "primary": true},
+				{"value": "b@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "replace every element matching an or filter",
+			doc:  patchUser,
+			op:   "replace", path: `emails[type eq "work" or type eq "home"].primary`, value: `false`,
+			want: `{"userName": "bjensen", "active": true, "name": {"givenName": "Barbara", "familyName": "Jensen"}, "emails": [
+				{"value": "bjensen@example.com", "type": "work", "primary": false},
+				{"value": "babs@home.example", "type": "home", "primary": false}]}`,
+		},
+		{
+			name: "merge object into filtered element",
+			doc:  patchUser,
+			op:   "replace", path: `emails[value ew "home.example"]`, value: `{"primary": true, "display": "Home"}`,
+			want: `{"userName": "bjensen", "active": true, "name": {"givenName": "Barbara", "familyName": "Jensen"}, "emails": [
+				{"value": "bjensen@example.com", "type": "work", "primary": true},
+				{"value": "babs@home.example", "type": "home", "primary": true, "display": "Home"}]}`,
+		},
+		{
+			name: "remove sub attribute of filtered element",
+			doc:  patchUser,
+			op:   "remove", path: `emails[type eq "work"].primary`,
+			want: `{"userName": "bjensen", "active": true, "name": {"givenName": "Barbara", "familyName": "Jensen"}, "emails": [
+				{"value": "bjensen@example.com", "type": "work"},
+				{"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "remove filtered element",
+			doc:  patchUser,
+			op:   "remove", path: `emails[type eq "home" and value co "babs"]`,
+			want: `{"userName": "bjensen", "active": true, "name": {"givenName": "Barbara", "familyName": "Jensen"}, "emails": [
+				{"value": "bjensen@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "add creates element from eq filter",
+			doc:  `{"userName": "bjensen"}`,
+			op:   "add", path: `phoneNumbers[type eq "mobile"].value`, value: `"+8613900000000"`,
+			want: `{"userName": "bjensen", "phoneNumbers": [{"type": "mobile", "value": "+8613900000000"}]}`,
+		},
+		{
+			name: "replace creates element from and filter",
+			doc:  `{"emails": [{"value": "a@example.com", "type": "work"}]}`,
+			op:   "replace", path: `emails[type eq "home" and primary eq false]`, value: `{"value": "b@home.example"}`,
+			want: `{"emails": [{"value": "a@example.com", "type": "work"}, {"type": "home", "primary": false, "value": "b@home.example"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := jsonMap(t, tt.doc)
+			op := PatchOperation{Op: tt.op, Path: tt.path}
+			if tt.value != "" {
+				op.Value = jsonValue(t, tt.value)
+			}
+			if err := ApplyPatch(doc, []PatchOperation{op}); err != nil {
+				t.Fatalf("ApplyPatch: %v", err)
+			}
+			if want := jsonMap(t, tt.want); !reflect.DeepEqual(doc, want) {
+				got, _ := json.Marshal(doc)
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchSequence(t *testing.T) {
+	// 多个操作按顺序执行，后面的操作看到前面的结果
+	doc := jsonMap(t, patchGroup)
+	ops := []PatchOperation{
+		{Op: "remove", Path: "members", Value: jsonValue(t, `[{"value": "1"}]`)},
+		{Op: "add", Path: "members", Value: jsonValue(t, `[{"value": "5"}]`)},
+		{Op: "replace", Path: "displayName", Value: "operators"},
+		{Op: "remove", Path: `members[value eq "2"]`},
+	}
+	if err := ApplyPatch(doc, ops); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonMap(t, `{"displayName": "operators", "members": [{"value": "3"}, {"value": "5"}]}`)
+	if !reflect.DeepEqual(doc, want) {
+		got, _ := json.Marshal(doc)
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		ops      []PatchOperation
+		scimType string
+	}{
+		{name: "no operations", doc: patchUser, scimType: "invalidSyntax"},
+		{name: "unsupported op", doc: patchUser, ops: []PatchOperation{{Op: "move", Path: "userName", Value: "x"}}, scimType: "invalidSyntax"},
+		{name: "remove without path", doc: patchUser, ops: []PatchOperation{{Op: "remove"}}, scimType: "noTarget"},
+		{name: "no path and scalar value", doc: patchUser, ops: []PatchOperation{{Op: "replace", Value: "x"}}, scimType: "invalidValue"},
+		{name: "unbalanced brackets", doc: patchUser, ops: []PatchOperation{{Op: "replace", Path: `emails[type eq "work"`, Value: "x"}}, scimType: "invalidPath"},
+		{name: "invalid filter", doc: patchUser, ops: []PatchOperation{{Op: "replace", Path: `emails[type zz "work"].value`, Value: "x"}}, scimType: "invalidPath"},
+		{name: "path too deep", doc: patchUser, ops: []PatchOperation{{Op: "replace", Path: "name.givenName.first", Value: "x"}}, scimType: "invalidPath"},
+		{name: "sub attribute of simple attribute", doc: patchUser, ops: []PatchOperation{{Op: "replace", Path: "userName.first", Value: "x"}}, scimType: "invalidPath"},
+		{name: "element value must be an object", doc: patchUser, ops: []PatchOperation{{Op: "replace", Path: `emails[type eq "work"]`, Value: "x"}}, scimType: "invalidValue"},
+		// 没有匹配的元素、过滤条件也无法确定新元素时不能新建
+		{name: "no match for non eq filter", doc: patchUser, ops: []PatchOperation{{Op: "replace", Path: `emails[type ne "work" and type ne "home"].value`, Value: "x"}}, scimType: "noTarget"},
+		{name: "no match for or filter", doc: patchUser, ops: []PatchOperation{{Op: "add", Path: `emails[type eq "a" or type eq "b"].value`, Value: "x"}}, scimType: "noTarget"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ApplyPatch(jsonMap(t, tt.doc), tt.ops)
+			var se *Error
+			if !errors.As(err, &se) || se.ScimType != tt.scimType || se.StatusCode() != 400 {
+				t.Fatalf("got %v, want %s", err, tt.scimType)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 资源和消息的 schema
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// ContentType SCIM 请求和响应的媒体类型
+const ContentType = "application/scim+json"
+
+// Error SCIM 错误响应（RFC 7644 3.12）
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	code     int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("scim %s %s: %s", e.Status, e.ScimType, e.Detail)
+}
+
+// StatusCode 错误对应的 HTTP 状态码
+func (e *Error) StatusCode() int {
+	return e.code
+}
+
+// NewError 创建 SCIM 错误，scimType 见 RFC 7644 表 9，可以为空
+func NewError(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{
+		Schemas:  []string{SchemaError},
+		Status:   fmt.Sprint(status),
+		ScimType: scimType,
+		Detail:   fmt.Sprintf(format, args...),
+		code:     status,
+	}
+}
+
+// 常用错误
+var (
+	ErrNotFound           = NewError(http.StatusNotFound, "", "resource not found")
+	ErrPreconditionFailed = NewError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+)
+
+// Meta 资源元数据
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+	Version      string     `json:"version,omitempty"`
+}
+
+// Name 用户姓名
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue 邮箱、手机号等多值属性
+type MultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Ref 对其他资源的引用，用于组成员和用户所属组
+type Ref struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// User 用户资源
+type User struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id,omitempty"`
+	ExternalID   string       `json:"externalId,omitempty"`
+	UserName     string       `json:"userName"`
+	Name         *Name        `json:"name,omitempty"`
+	DisplayName  string       `json:"displayName,omitempty"`
+	Active       *bool        `json:"active,omitempty"`
+	Password     string       `json:"password,omitempty"` // 只写，响应中不返回
+	Emails       []MultiValue `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+	Groups       []Ref        `json:"groups,omitempty"` // 只读
+	Meta         *Meta        `json:"meta,omitempty"`
+}
+
+// Group 组资源
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Ref    `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// ListResponse 列表和查询的响应
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// PatchOperation PATCH 请求中的单个操作
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// PatchRequest PATCH 请求
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// Version 根据资源内容生成弱 ETag，资源的任何属性变化都会改变版本
+func Version(resource interface{}) (string, error) {
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// ToMap 把资源转换成 map，用于执行 PATCH
+func ToMap(resource interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	err = json.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// FromMap 把执行 PATCH 后的 map 转回资源
+func FromMap(doc map[string]interface{}, out interface{}) error {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return NewError(http.StatusBadRequest, "invalidValue", "%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/fieldcrypt"
+	"Gous/internal/lifecycle"
+	"Gous/internal/utils"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dependency 启动时需要检测的外部依赖
+type dependency struct {
+	name  string
+	ping  func(ctx context.Context) error
+	ready func() error // 依赖可用后执行的初始化，如建表
+}
+
+// depResult 依赖初始化结果
+type depResult struct {
+	name     string
+	attempts int
+	elapsed  time.Duration
+	err      error
+}
+
+var dependencies = []dependency{
+	{name: "mysql", ping: utils.PingDB, ready: dbReady},
+	{name: "redis", ping: utils.PingRedis},
+}
+
+// InitDependencies 启动时并发初始化所有依赖，失败时带退避重试，最后汇总输出结果。
+// 开启降级模式时，失败的依赖交给后台任务持续重连，不阻止服务启动。
+func InitDependencies() error {
+	startConf := config.GetGlobalConf().Startup
+	backoff := utils.Backoff{
+		MaxRetries: startConf.MaxRetries,
+		Initial:    time.Duration(startConf.InitialBackoff) * time.Millisecond,
+		Max:        time.Duration(startConf.MaxBackoff) * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(startConf.Timeout))
+	defer cancel()
+
+	results := make([]depResult, len(dependencies))
+	var wg sync.WaitGroup
+	for i, dep := range dependencies {
+		wg.Add(1)
+		go func(i int, dep dependency) {
+			defer wg.Done()
+			start := time.Now()
+			attempts, err := utils.Retry(ctx, dep.name, backoff, dep.ping)
+			results[i] = depResult{name: dep.name, attempts: attempts, elapsed: time.Since(start), err: err}
+			lifecycle.SetDependency(dep.name, err)
+		}(i, dep)
+	}
+	wg.Wait()
+
+	var failed []dependency
+	var report strings.Builder
+	report.WriteString("dependency init report:")
+	for i, r := range results {
+		status := "ok"
+		if r.err != nil {
+			status = "FAILED: " + r.err.Error()
+			failed = append(failed, dependencies[i])
+		}
+		report.WriteString(fmt.Sprintf("\n  %-6s attempts=%d elapsed=%s %s", r.name, r.attempts, r.elapsed.Round(time.Millisecond), status))
+	}
+
+	if len(failed) == 0 {
+		log.Info(report.String())
+	} else {
+		log.Error(report.String())
+	}
+	for i, dep := range dependencies {
+		if results[i].err == nil && dep.ready != nil {
+			if err := dep.ready(); err != nil {
+				return fmt.Errorf("%s: %w", dep.name, err)
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	if !startConf.AllowDegraded {
+		return fmt.Errorf("%d of %d dependencies unavailable, see report above", len(failed), len(dependencies))
+	}
+	log.Warnf("starting in degraded mode")
+	for _, dep := range failed {
+		lifecycle.Go("reconnect-"+dep.name, reconnect(dep, backoff.Max))
+	}
+	return nil
+}
+
+// dbReady 数据库可用时按配置自动建表，开启字段加密时加载数据密钥，主密钥有误时尽早发现
+func dbReady() error {
+	conf := config.GetGlobalConf()
+	if conf.DbConfig.AutoMigrate {
+		if err := dao.Migrate(); err != nil {
+			return err
+		}
+	}
+	if conf.Encryption.Enabled {
+		if err := dao.CheckUserAgeColumn(); err != nil {
+			return err
+		}
+		if _, err := fieldcrypt.ActiveKeyID(); err != nil {
+			return fmt.Errorf("load data keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// reconnect 降级模式下定期检测依赖，恢复后更新状态并退出
+func reconnect(dep dependency, interval time.Duration) func(ctx context.Context) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := dep.ping(ctx)
+			if err == nil && dep.ready != nil {
+				err = dep.ready()
+			}
+			lifecycle.SetDependency(dep.name, err)
+			if err == nil {
+				log.Infof("dependency %s recovered", dep.name)
+				return
+			}
+			log.Warnf("dependency %s still unavailable: %v", dep.name, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"Gous/config"
+	"Gous/internal/erasure"
+	"Gous/internal/export"
+	"Gous/internal/lifecycle"
+	"Gous/internal/outbox"
+	"Gous/internal/router"
+	"Gous/internal/utils"
+	"Gous/internal/webhook"
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Run 启动 http 服务和管理端口服务，阻塞直到收到退出信号并完成优雅停机
+func Run() {
+	conf := config.GetGlobalConf()
+	appConf, tc := conf.AppConfig, conf.Tls
+
+	srv := newServer(":"+strconv.Itoa(appConf.Port), router.NewRouter(), appConf)
+	var admin *http.Server
+	if appConf.AdminPort > 0 {
+		addr := net.JoinHostPort(appConf.AdminHost, strconv.Itoa(appConf.AdminPort))
+		admin = newServer(addr, router.NewAdminRouter(), appConf)
+	}
+	servers := []*http.Server{srv}
+	if admin != nil {
+		servers = append(servers, admin)
+	}
+
+	if tc.Enabled {
+		reloader, err := newCertReloader(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			log.Fatalf("init tls err:%v", err)
+		}
+		enableTLS(srv, newTLSConfig(tc, reloader), tc.Http2)
+		if admin != nil {
+			adminTLS, err := newAdminTLSConfig(tc, reloader)
+			if err != nil {
+				log.Fatalf("init admin tls err:%v", err)
+			}
+			enableTLS(admin, adminTLS, tc.Http2)
+		}
+		if tc.RedirectPort > 0 {
+			servers = append(servers, newRedirectServer(appConf, tc))
+		}
+		if tc.ReloadInterval > 0 {
+			lifecycle.Go("tls-cert-reloader", reloader.watch(seconds(tc.ReloadInterval)))
+		}
+	}
+
+	// 投递事件回调，未开启时任务空转，热加载开启后开始投递
+	lifecycle.Go("webhook-dispatcher", webhook.Dispatch)
+	// 发布 outbox 中的领域事件
+	if conf.Outbox.Enabled {
+		lifecycle.Go("outbox-relay", outbox.Relay)
+	}
+	// 重试未完成的个人数据清除任务
+	lifecycle.Go("erasure", erasure.Run)
+	// 生成个人数据导出文件，删除过期文件
+	if conf.DataExport.Enabled {
+		lifecycle.Go("data-export", export.Run)
+	}
+
+	// 监听配置文件变化，热加载允许热更新的配置
+	config.WatchConfig()
+
+	// 监听退出信号
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *http.Server) {
+			var err error
+			if s.TLSConfig != nil {
+				log.Infof("server listen on %s (https)", s.Addr)
+				err = s.ListenAndServeTLS("", "") // 证书由 TLSConfig.GetCertificate 提供
+			} else {
+				log.Infof("server listen on %s", s.Addr)
+				err = s.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+			}
+		}(s)
+	}
+	lifecycle.SetReady(true)
+
+	select {
+	case <-ctx.Done():
+		log.Infof("received shutdown signal")
+	case err := <-errCh:
+		log.Errorf("start server err:%v", err)
+	}
+	stop() // 再次收到信号时直接退出进程
+
+	shutdown(servers, appConf)
+}
+
+func newServer(addr string, handler http.Handler, appConf config.AppConf) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       seconds(appConf.ReadTimeout),
+		ReadHeaderTimeout: seconds(appConf.ReadHeaderTimeout),
+		WriteTimeout:      seconds(appConf.WriteTimeout),
+		IdleTimeout:       seconds(appConf.IdleTimeout),
+	}
+}
+
+// shutdown 按顺序停机：摘除流量 -> 排空请求 -> 停止后台任务 -> 关闭 redis -> 关闭数据库
+func shutdown(servers []*http.Server, appConf config.AppConf) {
+	// 先让 /readyz 失败，等待负载均衡感知后再停止接收连接
+	lifecycle.SetReady(false)
+	if drain := seconds(appConf.DrainPeriod); drain > 0 {
+		log.Infof("draining for %s", drain)
+		time.Sleep(drain)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(appConf.ShutdownTimeout))
+	defer cancel()
+
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			log.Errorf("shutdown http server %s err:%v", s.Addr, err)
+		}
+	}
+	if err := lifecycle.StopWorkers(ctx); err != nil {
+		log.Errorf("stop workers err:%v", err)
+	}
+	if err := utils.CloseRedis(); err != nil {
+		log.Errorf("close redis err:%v", err)
+	}
+	if err := utils.CloseDB(); err != nil {
+		log.Errorf("close db err:%v", err)
+	}
+	log.Infof("server exited")
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
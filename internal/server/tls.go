@@ -0,0 +1,148 @@
+package server
+
+import (
+	"Gous/config"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certReloader 持有当前证书，证书文件变化后重新加载，握手时通过 GetCertificate 获取最新证书
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load 读取证书和私钥，失败时保留原证书
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls cert err: %w", err)
+	}
+	modTime := r.latestModTime()
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// latestModTime 证书和私钥文件中较新的修改时间
+func (r *certReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		if fi, err := os.Stat(f); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// GetCertificate 供 tls.Config 使用
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch 定期检查证书文件修改时间，有变化时重新加载
+func (r *certReloader) watch(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			r.mu.RLock()
+			changed := r.latestModTime().After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.load(); err != nil {
+				log.Errorf("reload tls cert failed, keep current cert: %v", err)
+				continue
+			}
+			log.Infof("tls cert reloaded from %s", r.certFile)
+		}
+	}
+}
+
+// newTLSConfig 根据配置生成服务端 tls.Config
+func newTLSConfig(tc config.TlsConf, reloader *certReloader) *tls.Config {
+	tlsConf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if tc.MinVersion == "1.3" {
+		tlsConf.MinVersion = tls.VersionTLS13
+	}
+	for _, name := range tc.CipherSuites {
+		if id, ok := config.CipherSuiteID(name); ok {
+			tlsConf.CipherSuites = append(tlsConf.CipherSuites, id)
+		}
+	}
+	return tlsConf
+}
+
+// newAdminTLSConfig 管理端口的 tls.Config，配置了客户端 CA 时要求双向认证
+func newAdminTLSConfig(tc config.TlsConf, reloader *certReloader) (*tls.Config, error) {
+	tlsConf := newTLSConfig(tc, reloader)
+	if tc.AdminClientCA == "" {
+		return tlsConf, nil
+	}
+	pem, err := os.ReadFile(tc.AdminClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("read admin client ca err: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", tc.AdminClientCA)
+	}
+	tlsConf.ClientCAs = pool
+	tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConf, nil
+}
+
+// enableTLS 为服务设置 tls 配置，关闭 HTTP/2 时清空 TLSNextProto
+func enableTLS(srv *http.Server, tlsConf *tls.Config, http2 bool) {
+	srv.TLSConfig = tlsConf
+	if !http2 {
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+}
+
+// newRedirectServer http 跳转 https 的服务
+func newRedirectServer(appConf config.AppConf, tc config.TlsConf) *http.Server {
+	return newServer(":"+strconv.Itoa(tc.RedirectPort), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if appConf.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(appConf.Port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}), appConf)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"encoding/json"
+	"strings"
+)
+
+// ListAuditLogs 按条件分页查询审计日志，按时间倒序
+func ListAuditLogs(req *ListAuditLogsRequest) (*AuditLogListResponse, error) {
+	var conds []string
+	var args []interface{}
+	eq := func(column, value string) {
+		if value != "" {
+			conds = append(conds, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	eq("actor", req.Actor)
+	eq("target", req.Target)
+	eq("result", req.Result)
+	eq("ip", req.IP)
+	eq("request_id", req.RequestID)
+	if strings.HasSuffix(req.Action, ".") {
+		conds = append(conds, "action LIKE ?")
+		args = append(args, strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(req.Action)+"%")
+	} else {
+		eq("action", req.Action)
+	}
+	if req.Since != nil {
+		conds = append(conds, "create_time >= ?")
+		args = append(args, *req.Since)
+	}
+	if req.Until != nil {
+		conds = append(conds, "create_time < ?")
+		args = append(args, *req.Until)
+	}
+
+	page, size := req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 20
+	} else if size > 100 {
+		size = 100
+	}
+	logs, total, err := dao.FindAuditLogs(strings.Join(conds, " AND "), args, (page-1)*size, size)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &AuditLogListResponse{Total: total, Items: make([]*AuditLogResponse, 0, len(logs))}
+	for _, l := range logs {
+		rsp.Items = append(rsp.Items, auditLogResponse(l))
+	}
+	return rsp, nil
+}
+
+func auditLogResponse(l *model.AuditLog) *AuditLogResponse {
+	rsp := &AuditLogResponse{
+		ID:         l.ID,
+		Action:     l.Action,
+		Result:     l.Result,
+		Actor:      l.Actor,
+		Target:     l.Target,
+		IP:         l.IP,
+		UserAgent:  l.UserAgent,
+		RequestID:  l.RequestID,
+		Reason:     l.Reason,
+		CreateTime: l.CreateTime,
+		Hash:       l.Hash,
+	}
+	if l.Changes != "" && json.Valid([]byte(l.Changes)) {
+		rsp.Changes = json.RawMessage(l.Changes)
+	}
+	return rsp
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/ldap"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// errInvalidCredentials 登录失败时统一返回，不区分用户不存在和密码错误
+var errInvalidCredentials = errors.New("user name or password is not correct")
+
+// Authenticator 密码登录的认证方式，认证通过后返回对应的本地用户
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, ident, password string) (*model.User, error)
+}
+
+// localAuthenticator 校验本地数据库中的账号密码
+type localAuthenticator struct{}
+
+func (localAuthenticator) Name() string { return constant.UserSourceLocal }
+
+func (localAuthenticator) Authenticate(ctx context.Context, ident, password string) (*model.User, error) {
+	user, err := getUserByIdent(ident)
+	if err != nil {
+		log.Infof("localAuthenticator|%s|%v", ident, err)
+		return nil, errInvalidCredentials
+	}
+	// 目录同步的账号只能通过目录认证，SCIM 创建的账号在设置了密码时可以使用密码登录
+	if user.Source != "" && user.Source != constant.UserSourceLocal && user.Source != constant.UserSourceScim {
+		log.Infof("localAuthenticator|user %s comes from %s", user.Name, user.Source)
+		return nil, errInvalidCredentials
+	}
+	// 缓存中不保存密码，从数据库读取后校验
+	stored, err := dao.GetUserByName(user.Name)
+	if err != nil || stored == nil {
+		log.Infof("localAuthenticator|%s|%v", ident, err)
+		return nil, errInvalidCredentials
+	}
+	if password == "" || subtle.ConstantTimeCompare([]byte(password), []byte(stored.PassWord)) != 1 {
+		return nil, errInvalidCredentials
+	}
+	return stored, nil
+}
+
+// ldapAuthenticator 通过 LDAP 目录认证，首次登录时创建本地账号，之后每次登录同步属性和角色
+type ldapAuthenticator struct {
+	conf config.LdapConf
+}
+
+func (a ldapAuthenticator) Name() string { return constant.UserSourceLdap }
+
+func (a ldapAuthenticator) Authenticate(ctx context.Context, ident, password string) (*model.User, error) {
+	// 邮箱、手机号标识不在目录中查找
+	kind, value, err := parseIdent(ident)
+	if err != nil || kind != constant.IdentUserName {
+		return nil, ldap.ErrUserNotFound
+	}
+	entry, err := ldap.Authenticate(a.conf, value, password)
+	if err != nil {
+		return nil, err
+	}
+	return a.syncUser(value, entry)
+}
+
+// syncUser 把目录中的属性和角色同步到本地账号
+func (a ldapAuthenticator) syncUser(ident string, entry *ldap.Entry) (*model.User, error) {
+	attrs := a.conf.Attributes
+	name := ident
+	if v := entry.Attributes[attrs.Name]; attrs.Name != "" && v != "" {
+		name = v
+	}
+	role := ldap.MapRole(a.conf, entry.Groups)
+
+	user, err := dao.GetUserByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("ldapAuthenticator|%v", err)
+	}
+	if user == nil {
+		return a.provisionUser(name, role, entry)
+	}
+	// 同名的本地账号不能被目录账号接管
+	if user.Source != constant.UserSourceLdap {
+		log.Errorf("ldapAuthenticator|local user %s conflicts with directory entry %s", name, entry.DN)
+		return nil, fmt.Errorf("user %s already exists as a %s account", name, user.Source)
+	}
+
+	columns := map[string]interface{}{}
+	if user.Role != role {
+		columns["role"] = role
+	}
+	if v := entry.Attributes[attrs.NickName]; attrs.NickName != "" && v != user.NickName {
+		columns["nickname"] = v
+	}
+	if email := a.email(entry); email != nil && (user.Email == nil || *user.Email != *email) {
+		columns["email"] = *email
+		columns["email_verified"] = true
+	}
+	if phone := a.phone(entry); phone != nil && (user.Phone == nil || *user.Phone != *phone) {
+		columns["phone"] = *phone
+	}
+	if len(columns) == 0 {
+		return user, nil
+	}
+	fields := make([]string, 0, len(columns))
+	for k := range columns {
+		fields = append(fields, k)
+	}
+	columns["modifier"] = constant.UserSourceLdap
+	if err := dao.UpdateUserColumns(user.ID, columns, userOutbox(constant.EventUserUpdated, fields...)); err != nil {
+		return nil, err
+	}
+	if err := cache.DelUserCacheInfo(user); err != nil {
+		log.Errorf("ldapAuthenticator|del user cache err:%v", err)
+	}
+	log.Infof("ldapAuthenticator|synced user %s from %s: %v", user.Name, entry.DN, columns)
+	synced, err := dao.GetUserByID(user.ID)
+	if err == nil && synced != nil {
+		emitUserEvent(constant.EventUserUpdated, synced, fields...)
+	}
+	return synced, err
+}
+
+// provisionUser 目录用户首次登录时创建本地账号
+func (a ldapAuthenticator) provisionUser(name, role string, entry *ldap.Entry) (*model.User, error) {
+	if kind, _, _ := parseIdent(name); kind != constant.IdentUserName {
+		return nil, fmt.Errorf("directory user name %q looks like %s", name, kind)
+	}
+	// 目录账号不使用本地密码，设置一个随机密码
+	password, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	email := a.email(entry)
+	user := &model.User{
+		CreateModel:   model.CreateModel{Creator: constant.UserSourceLdap},
+		ModifyModel:   model.ModifyModel{Modifier: constant.UserSourceLdap},
+		Name:          name,
+		PassWord:      password,
+		NickName:      entry.Attributes[a.conf.Attributes.NickName],
+		Email:         email,
+		EmailVerified: email != nil,
+		Phone:         a.phone(entry),
+		Status:        constant.UserStatusActive,
+		Source:        constant.UserSourceLdap,
+		Role:          role,
+	}
+	if err := dao.CreateUser(user, userOutbox(constant.EventUserCreated)); err != nil {
+		return nil, fmt.Errorf("ldapAuthenticator|%v", err)
+	}
+	log.Infof("ldapAuthenticator|created user %s for %s with role %s", user.Name, entry.DN, role)
+	emitUserEvent(constant.EventUserCreated, user)
+	return user, nil
+}
+
+// email 目录中的邮箱，格式不对或已被其他账号使用时不同步
+func (a ldapAuthenticator) email(entry *ldap.Entry) *string {
+	raw := entry.Attributes[a.conf.Attributes.Email]
+	if a.conf.Attributes.Email == "" || raw == "" {
+		return nil
+	}
+	email, err := normalizeEmail(raw)
+	if err != nil {
+		return nil
+	}
+	if existed, err := dao.GetUserByEmail(email); err != nil || existed != nil && existed.Source != constant.UserSourceLdap {
+		log.Warnf("ldapAuthenticator|skip email %s of %s", email, entry.DN)
+		return nil
+	}
+	return &email
+}
+
+// phone 目录中的手机号，格式不对或已被其他账号使用时不同步
+func (a ldapAuthenticator) phone(entry *ldap.Entry) *string {
+	raw := entry.Attributes[a.conf.Attributes.Phone]
+	if a.conf.Attributes.Phone == "" || raw == "" {
+		return nil
+	}
+	phone, err := normalizePhone(raw)
+	if err != nil {
+		return nil
+	}
+	if existed, err := dao.GetUserByPhone(phone); err != nil || existed != nil && existed.Source != constant.UserSourceLdap {
+		log.Warnf("ldapAuthenticator|skip phone %s of %s", phone, entry.DN)
+		return nil
+	}
+	return &phone
+}
+
+// authenticators 按配置返回依次尝试的认证方式
+func authenticators() []Authenticator {
+	ldapConf := config.GetGlobalConf().Ldap
+	if !ldapConf.Enabled {
+		return []Authenticator{localAuthenticator{}}
+	}
+	chain := []Authenticator{ldapAuthenticator{conf: ldapConf}}
+	if ldapConf.LocalFallback {
+		chain = append(chain, localAuthenticator{})
+	}
+	return chain
+}
+
+// authenticate 按配置的认证方式依次尝试
+func authenticate(ctx context.Context, ident, password string) (*model.User, error) {
+	return authenticateWith(ctx, authenticators(), config.GetGlobalConf().Ldap.Mode, ident, password)
+}
+
+// authenticateWith 依次尝试各认证方式。
+// 目录中密码错误直接失败；目录中没有该用户或目录不可用时，才尝试下一种方式。
+// bind 模式无法区分用户不存在和密码错误，两种情况都会继续尝试
+func authenticateWith(ctx context.Context, chain []Authenticator, mode, ident, password string) (*model.User, error) {
+	for _, a := range chain {
+		user, err := a.Authenticate(ctx, ident, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, ldap.ErrInvalidCredentials) && mode != "bind":
+			return nil, errInvalidCredentials
+		case errors.Is(err, ldap.ErrInvalidCredentials), errors.Is(err, ldap.ErrUserNotFound), errors.Is(err, errInvalidCredentials):
+		default:
+			log.Errorf("authenticate|%s|%s|%v", a.Name(), ident, err)
+		}
+	}
+	return nil, errInvalidCredentials
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"Gous/internal/ldap"
+	"Gous/internal/model"
+	"Gous/pkg/constant"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// fakeAuthenticator 返回固定结果的认证方式，记录被调用的次数
+type fakeAuthenticator struct {
+	name  string
+	user  *model.User
+	err   error
+	calls int
+}
+
+func (f *fakeAuthenticator) Name() string { return f.name }
+
+func (f *fakeAuthenticator) Authenticate(ctx context.Context, ident, password string) (*model.User, error) {
+	f.calls++
+	return f.user, f.err
+}
+
+func TestAuthenticateWith(t *testing.T) {
+	dirUser := &model.User{Name: "dir_user"}
+	localUser := &model.User{Name: "local_user"}
+	errDirectory := errors.New("ldap: dial ldap://ldap.test:389: connection refused")
+
+	tests := []struct {
+		name      string
+		mode      string
+		ldapErr   error
+		localErr  error
+		want      *model.User
+		wantLocal int // 本地认证被调用的次数
+	}{
+		{name: "directory ok", mode: "search", want: dirUser, wantLocal: 0},
+		{name: "search wrong password stops", mode: "search", ldapErr: ldap.ErrInvalidCredentials, wantLocal: 0},
+		{name: "bind wrong password falls back", mode: "bind", ldapErr: ldap.ErrInvalidCredentials, want: localUser, wantLocal: 1},
+		{name: "search not found falls back", mode: "search", ldapErr: ldap.ErrUserNotFound, want: localUser, wantLocal: 1},
+		{name: "bind not found falls back", mode: "bind", ldapErr: ldap.ErrUserNotFound, want: localUser, wantLocal: 1},
+		{name: "directory down falls back", mode: "search", ldapErr: errDirectory, want: localUser, wantLocal: 1},
+		{name: "wrapped not found falls back", mode: "search", ldapErr: fmt.Errorf("sync: %w", ldap.ErrUserNotFound), want: localUser, wantLocal: 1},
+		{name: "both fail", mode: "bind", ldapErr: ldap.ErrInvalidCredentials, localErr: errInvalidCredentials, wantLocal: 1},
+		{name: "directory down and local fails", mode: "search", ldapErr: errDirectory, localErr: errInvalidCredentials, wantLocal: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := &fakeAuthenticator{name: constant.UserSourceLdap, err: tt.ldapErr}
+			if tt.ldapErr == nil {
+				dir.user = dirUser
+			}
+			local := &fakeAuthenticator{name: constant.UserSourceLocal, err: tt.localErr}
+			if tt.localErr == nil {
+				local.user = localUser
+			}
+			got, err := authenticateWith(context.Background(), []Authenticator{dir, local}, tt.mode, "someone", "password")
+			if tt.want == nil {
+				// 失败时统一返回 errInvalidCredentials，不暴露目录错误
+				if got != nil || err != errInvalidCredentials {
+					t.Fatalf("got %v, %v, want errInvalidCredentials", got, err)
+				}
+			} else if err != nil || got != tt.want {
+				t.Fatalf("got %v, %v, want %v", got, err, tt.want)
+			}
+			if dir.calls != 1 || local.calls != tt.wantLocal {
+				t.Fatalf("calls directory=%d local=%d, want 1 and %d", dir.calls, local.calls, tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithoutFallback(t *testing.T) {
+	dir := &fakeAuthenticator{name: constant.UserSourceLdap, err: ldap.ErrUserNotFound}
+	if _, err := authenticateWith(context.Background(), []Authenticator{dir}, "search", "someone", "password"); err != errInvalidCredentials {
+		t.Fatalf("got %v, want errInvalidCredentials", err)
+	}
+}
+
+func TestLocalAuthenticatorRejectsDirectoryUsers(t *testing.T) {
+	createTestUser(t, &model.User{Name: "auth_local", PassWord: "local-password"})
+	createTestUser(t, &model.User{Name: "auth_ldap", PassWord: "ldap-password", Source: constant.UserSourceLdap})
+
+	tests := []struct {
+		ident, password string
+		ok              bool
+	}{
+		{"auth_local", "local-password", true},
+		{"auth_local", "wrong-password", false},
+		{"auth_local", "", false},
+		{"auth_missing", "local-password", false},
+		// 目录账号的本地随机密码不能用于登录
+		{"auth_ldap", "ldap-password", false},
+	}
+	for _, tt := range tests {
+		user, err := localAuthenticator{}.Authenticate(context.Background(), tt.ident, tt.password)
+		if tt.ok && (err != nil || user == nil || user.Name != tt.ident) {
+			t.Fatalf("%s/%s: got %v, %v, want success", tt.ident, tt.password, user, err)
+		}
+		if !tt.ok && err != errInvalidCredentials {
+			t.Fatalf("%s/%s: got %v, want errInvalidCredentials", tt.ident, tt.password, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/utils"
+	"crypto/subtle"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// IssueCsrfToken 为会话生成新的 CSRF token 并缓存，登录成功或前端主动获取时调用
+func IssueCsrfToken(session string) (string, error) {
+	if session == "" {
+		return "", fmt.Errorf("IssueCsrfToken|session is empty")
+	}
+	if _, err := cache.GetSessionInfo(session); err != nil {
+		return "", fmt.Errorf("IssueCsrfToken|GetSessionInfo err:%v", err)
+	}
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("IssueCsrfToken|generate token err:%v", err)
+	}
+	if err := cache.SetCsrfToken(session, token); err != nil {
+		log.Errorf("IssueCsrfToken|SetCsrfToken err:%v", err)
+		return "", fmt.Errorf("IssueCsrfToken|SetCsrfToken err:%v", err)
+	}
+	return token, nil
+}
+
+// CheckCsrfToken 校验请求携带的 CSRF token 是否与会话绑定的一致
+func CheckCsrfToken(session, token string) error {
+	if session == "" || token == "" {
+		return fmt.Errorf("csrf token missing")
+	}
+	expected, err := cache.GetCsrfToken(session)
+	if err != nil {
+		return fmt.Errorf("csrf token not found for session")
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		return fmt.Errorf("csrf token mismatch")
+	}
+	return nil
+}
+
+// CurrentCsrfToken 返回会话当前的 CSRF token，没有时签发新的，用于服务端渲染的表单
+func CurrentCsrfToken(session string) (string, error) {
+	if token, err := cache.GetCsrfToken(session); err == nil && token != "" {
+		return token, nil
+	}
+	return IssueCsrfToken(session)
+}
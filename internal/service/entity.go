@@ -1,5 +1,11 @@
 package service
 
+import (
+	"Gous/internal/erasure"
+	"encoding/json"
+	"time"
+)
+
 // RegisterRequest 注册请求
 type RegisterRequest struct {
 	UserName string `json:"user_name"`
@@ -7,12 +13,15 @@ type RegisterRequest struct {
 	Age      int    `json:"age"`
 	Gender   string `json:"gender"`
 	NickName string `json:"nick_name"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
 }
 
-// LoginRequest 登录请求
+// LoginRequest 登录请求，Identifier 可以是用户名、已验证的邮箱或已验证的手机号（E.164），为空时使用 UserName
 type LoginRequest struct {
-	UserName string `json:"user_name"`
-	PassWord string `json:"pass_word"`
+	UserName   string `json:"user_name"`
+	Identifier string `json:"identifier"`
+	PassWord   string `json:"pass_word"`
 }
 
 // LogoutRequest 登出请求
@@ -20,7 +29,7 @@ type LogoutRequest struct {
 	UserName string `json:"user_name"`
 }
 
-// LogoffRequest 注销请求
+// LogoffRequest 注销请求，UserName 可以为空，不为空时需与当前登录的用户一致
 type LogoffRequest struct {
 	UserName string `json:"user_name"`
 }
@@ -35,8 +44,9 @@ type GetUserInfoResponse struct {
 	UserName string `json:"user_name"`
 	Age      int    `json:"age"`
 	Gender   string `json:"gender"`
-	PassWord string `json:"pass_word"`
 	NickName string `json:"nick_name"`
+	Email    string `json:"email"`
+	Verified bool   `json:"email_verified"`
 }
 
 // UpdateNickNameRequest 修改用户信息返回结构
@@ -44,3 +54,275 @@ type UpdateNickNameRequest struct {
 	UserName    string `json:"user_name"`
 	NewNickName string `json:"new_nick_name"`
 }
+
+// ResendVerificationRequest 重新发送验证邮件请求
+type ResendVerificationRequest struct {
+	UserName string `json:"user_name"`
+}
+
+// OtpSendRequest 发送登录验证码请求
+type OtpSendRequest struct {
+	Identifier string `json:"identifier"` // 邮箱或手机号
+}
+
+// OtpVerifyRequest 验证码登录请求
+type OtpVerifyRequest struct {
+	Identifier string `json:"identifier"`
+	Code       string `json:"code"`
+}
+
+// AuthorizeRequest OAuth 授权请求，查询参数与授权确认页提交的表单字段相同
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// TokenRequest OAuth 令牌请求，客户端密钥也可以通过 HTTP Basic 传递
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// TokenResponse OAuth 令牌响应
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// CreateOAuthClientRequest 注册应用请求
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`  // 默认 authorization_code、refresh_token
+	Scopes       []string `json:"scopes"`       // 默认 openid、profile、email
+	Public       bool     `json:"public"`       // 公开客户端（单页应用、移动端）没有密钥，必须使用 PKCE
+	SkipConsent  bool     `json:"skip_consent"` // 内部可信应用跳过授权确认
+}
+
+// OAuthClientResponse 应用信息，密钥只在注册时返回一次
+type OAuthClientResponse struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	SkipConsent  bool     `json:"skip_consent"`
+}
+
+// CreateAccessTokenRequest 创建个人访问令牌请求
+type CreateAccessTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn *int     `json:"expires_in"` // 有效期（天），不传使用默认值，0 表示永不过期
+}
+
+// AccessTokenResponse 个人访问令牌信息，令牌明文只在创建时返回一次
+type AccessTokenResponse struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpireTime *time.Time `json:"expire_time"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreateTime time.Time  `json:"create_time"`
+}
+
+// ListAuditLogsRequest 审计日志查询条件，条件为空时不过滤
+type ListAuditLogsRequest struct {
+	Actor     string     `form:"actor"`
+	Target    string     `form:"target"`
+	Action    string     `form:"action"` // 以 . 结尾时按前缀匹配，如 admin.
+	Result    string     `form:"result"`
+	IP        string     `form:"ip"`
+	RequestID string     `form:"request_id"`
+	Since     *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"` // RFC 3339
+	Until     *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page      int        `form:"page"`      // 从 1 开始
+	PageSize  int        `form:"page_size"` // 默认 20，最大 100
+}
+
+// AuditLogResponse 审计日志
+type AuditLogResponse struct {
+	ID         int64           `json:"id"`
+	Action     string          `json:"action"`
+	Result     string          `json:"result"`
+	Actor      string          `json:"actor"`
+	Target     string          `json:"target"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	Reason     string          `json:"reason,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+	CreateTime time.Time       `json:"create_time"`
+	Hash       string          `json:"hash"`
+}
+
+// AuditLogListResponse 审计日志分页结果
+type AuditLogListResponse struct {
+	Total int64               `json:"total"`
+	Items []*AuditLogResponse `json:"items"`
+}
+
+// LoginHistoryResponse 一次登录记录
+type LoginHistoryResponse struct {
+	Time    time.Time `json:"time"`
+	Method  string    `json:"method"`
+	Result  string    `json:"result"`
+	Reason  string    `json:"reason,omitempty"`
+	IP      string    `json:"ip"`
+	Browser string    `json:"browser"`
+	OS      string    `json:"os"`
+	Device  string    `json:"device"`
+}
+
+// LoginHistoryListResponse 登录记录分页结果
+type LoginHistoryListResponse struct {
+	Total int64                   `json:"total"`
+	Items []*LoginHistoryResponse `json:"items"`
+}
+
+// WebhookRequest 创建或修改事件订阅的请求，修改时未传的字段保持不变
+type WebhookRequest struct {
+	Url         *string  `json:"url"`
+	Secret      *string  `json:"secret"` // 创建时不传则随机生成
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"` // 创建时默认启用
+}
+
+// WebhookResponse 事件订阅，密钥只在创建时返回
+type WebhookResponse struct {
+	ID          int       `json:"id"`
+	Url         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	CreateTime  time.Time `json:"create_time"`
+	UpdateTime  time.Time `json:"update_time"`
+}
+
+// ListWebhookDeliveriesRequest 投递记录查询条件
+type ListWebhookDeliveriesRequest struct {
+	Status   string `form:"status"`    // pending、success、dead，为空时不过滤
+	Page     int    `form:"page"`      // 从 1 开始
+	PageSize int    `form:"page_size"` // 默认 20，最大 100
+}
+
+// WebhookDeliveryResponse 投递记录
+type WebhookDeliveryResponse struct {
+	ID             int64                     `json:"id"`
+	WebhookID      int                       `json:"webhook_id"`
+	EventID        string                    `json:"event_id"`
+	EventType      string                    `json:"event_type"`
+	Payload        json.RawMessage           `json:"payload,omitempty"`
+	Status         string                    `json:"status"`
+	Attempts       int                       `json:"attempts"`
+	NextAttemptAt  *time.Time                `json:"next_attempt_at,omitempty"`
+	LastStatusCode int                       `json:"last_status_code"`
+	LastError      string                    `json:"last_error,omitempty"`
+	LastAttemptAt  *time.Time                `json:"last_attempt_at,omitempty"`
+	CreateTime     time.Time                 `json:"create_time"`
+	History        []*WebhookAttemptResponse `json:"history,omitempty"`
+}
+
+// WebhookAttemptResponse 一次投递尝试
+type WebhookAttemptResponse struct {
+	Time         time.Time `json:"time"`
+	StatusCode   int       `json:"status_code"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	Duration     int       `json:"duration"` // 耗时（ms）
+}
+
+// WebhookDeliveryListResponse 投递记录分页结果
+type WebhookDeliveryListResponse struct {
+	Total int64                      `json:"total"`
+	Items []*WebhookDeliveryResponse `json:"items"`
+}
+
+// ListOutboxDeadEventsRequest 死信事件查询条件
+type ListOutboxDeadEventsRequest struct {
+	Page     int `form:"page"`      // 从 1 开始
+	PageSize int `form:"page_size"` // 默认 20，最大 100
+}
+
+// OutboxEventResponse 领域事件
+type OutboxEventResponse struct {
+	ID          int64           `json:"id"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	AggregateID string          `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	DeadAt      *time.Time      `json:"dead_at,omitempty"`
+	CreateTime  time.Time       `json:"create_time"`
+}
+
+// OutboxEventListResponse 领域事件分页结果
+type OutboxEventListResponse struct {
+	Total int64                  `json:"total"`
+	Items []*OutboxEventResponse `json:"items"`
+}
+
+// DataExportResponse 个人数据导出任务，完成后返回限时下载链接
+type DataExportResponse struct {
+	ID             int        `json:"id"`
+	Status         string     `json:"status"` // pending、running、done、failed、expired
+	Size           int64      `json:"size,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreateTime     time.Time  `json:"create_time"`
+	FinishTime     *time.Time `json:"finish_time,omitempty"`
+	ExpireTime     *time.Time `json:"expire_time,omitempty"` // 文件删除时间
+	DownloadUrl    string     `json:"download_url,omitempty"`
+	LinkExpireTime *time.Time `json:"link_expire_time,omitempty"`
+}
+
+// ListErasuresRequest 分页查询清除任务的条件
+type ListErasuresRequest struct {
+	Status   string `form:"status"`    // pending、done、failed，为空时不过滤
+	Page     int    `form:"page"`      // 从 1 开始
+	PageSize int    `form:"page_size"` // 默认 20，最大 100
+}
+
+// ErasureResponse 个人数据清除任务及各步骤的执行结果
+type ErasureResponse struct {
+	ID            int                   `json:"id"`
+	UserID        int                   `json:"user_id"`
+	Pseudonym     string                `json:"pseudonym"` // 审计日志中替换用户名的假名
+	Requester     string                `json:"requester"`
+	Status        string                `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt *time.Time            `json:"next_attempt_at,omitempty"`
+	LastError     string                `json:"last_error,omitempty"`
+	Steps         []*erasure.StepResult `json:"steps"`
+	CreateTime    time.Time             `json:"create_time"`
+	FinishTime    *time.Time            `json:"finish_time,omitempty"`
+}
+
+// ErasureListResponse 清除任务分页结果
+type ErasureListResponse struct {
+	Total int64              `json:"total"`
+	Items []*ErasureResponse `json:"items"`
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/erasure"
+	"Gous/internal/model"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// eraseUser 删除用户，并创建清除其余个人数据的任务交给后台执行。
+// ev 为发起方的审计事件，在开始清除前写入，这条记录同样会被假名化
+func eraseUser(ctx context.Context, user *model.User, requester string, ev *audit.Event) (*model.ErasureRequest, error) {
+	req, err := erasure.NewRequest(user, requester)
+	if err == nil {
+		err = dao.EraseUser(user, req, userOutbox(constant.EventUserDeleted))
+	}
+	if err != nil {
+		ev.Err = err
+		audit.Record(ctx, ev)
+		return nil, err
+	}
+	audit.Record(ctx, ev)
+	// 会话立即失效，其余数据由清除任务处理
+	if err := cache.DelUserSessions(user.Name); err != nil {
+		log.Errorf("eraseUser|revoke sessions of %s err:%v", user.Name, err)
+	}
+	if err := cache.DelUserCacheInfo(user); err != nil {
+		log.Errorf("eraseUser|del user cache err:%v", err)
+	}
+	log.Infof("eraseUser|user %d deleted by %s, erasure %d created", user.ID, requester, req.ID)
+	emitUserEvent(constant.EventUserDeleted, user)
+	erasure.Wakeup()
+	return req, nil
+}
+
+// EraseUser 管理员删除用户并清除其个人数据
+func EraseUser(ctx context.Context, userName string) (*ErasureResponse, error) {
+	user, err := dao.GetUserByName(userName)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userName)
+	}
+	req, err := eraseUser(ctx, user, erasure.RequesterAdmin, &audit.Event{
+		Action: constant.AuditUserErase,
+		Actor:  constant.AuditActorAdmin,
+		Target: user.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return erasureResponse(req), nil
+}
+
+// ListErasures 分页查询清除任务，按时间倒序
+func ListErasures(req *ListErasuresRequest) (*ErasureListResponse, error) {
+	switch req.Status {
+	case "", dao.ErasurePending, dao.ErasureDone, dao.ErasureFailed:
+	default:
+		return nil, fmt.Errorf("invalid status %q", req.Status)
+	}
+	page, size := req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 20
+	} else if size > 100 {
+		size = 100
+	}
+	list, total, err := dao.FindErasureRequests(req.Status, (page-1)*size, size)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &ErasureListResponse{Total: total, Items: make([]*ErasureResponse, 0, len(list))}
+	for _, r := range list {
+		rsp.Items = append(rsp.Items, erasureResponse(r))
+	}
+	return rsp, nil
+}
+
+// GetErasure 查询清除任务及各步骤的执行结果
+func GetErasure(id int) (*ErasureResponse, error) {
+	r, err := dao.GetErasureRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, fmt.Errorf("erasure %d not found", id)
+	}
+	return erasureResponse(r), nil
+}
+
+// RetryErasure 重新执行失败的清除任务，执行次数清零，已完成的步骤不再执行
+func RetryErasure(ctx context.Context, id int) error {
+	r, err := dao.GetErasureRequest(id)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("erasure %d not found", id)
+	}
+	if r.Status == dao.ErasureDone {
+		return fmt.Errorf("erasure %d is already done", id)
+	}
+	err = dao.UpdateErasureRequest(id, map[string]interface{}{
+		"status":          dao.ErasurePending,
+		"attempts":        0,
+		"next_attempt_at": time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditErasureRetry,
+		Actor:   constant.AuditActorAdmin,
+		Target:  r.Pseudonym,
+		Changes: map[string]audit.Change{"erasure_id": {To: r.ID}, "status": {From: r.Status, To: dao.ErasurePending}},
+	})
+	erasure.Wakeup()
+	return nil
+}
+
+func erasureResponse(r *model.ErasureRequest) *ErasureResponse {
+	rsp := &ErasureResponse{
+		ID:         r.ID,
+		UserID:     r.UserID,
+		Pseudonym:  r.Pseudonym,
+		Requester:  r.Requester,
+		Status:     r.Status,
+		Attempts:   r.Attempts,
+		LastError:  r.LastError,
+		Steps:      erasure.Steps(r),
+		CreateTime: r.CreateTime,
+		FinishTime: r.FinishTime,
+	}
+	if r.Status == dao.ErasurePending {
+		rsp.NextAttemptAt = &r.NextAttemptAt
+	}
+	return rsp
+}
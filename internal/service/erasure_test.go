@@ -0,0 +1,93 @@
+package service
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/erasure"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func logoffContext(t *testing.T, user *model.User) (context.Context, string) {
+	t.Helper()
+	session, err := createSession(context.Background(), user, loginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return context.WithValue(context.Background(), constant.SessionKey, session), session
+}
+
+func erasureRequestsOf(t *testing.T, userID int) []*model.ErasureRequest {
+	t.Helper()
+	var list []*model.ErasureRequest
+	if err := utils.GetDB().Where("user_id=?", userID).Order("id").Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestLogoffOtherUserRejected(t *testing.T) {
+	attacker := createTestUser(t, &model.User{Name: "logoff_attacker"})
+	victim := createTestUser(t, &model.User{Name: "logoff_victim"})
+	ctx, session := logoffContext(t, attacker)
+
+	if err := Logoff(&LogoffRequest{UserName: victim.Name}, ctx); err == nil {
+		t.Fatal("logoff of another user accepted")
+	}
+	// 两个账号都不受影响，会话仍然有效
+	for _, u := range []*model.User{attacker, victim} {
+		if got, err := dao.GetUserByName(u.Name); err != nil || got == nil {
+			t.Fatalf("user %s: got %v, %v", u.Name, got, err)
+		}
+		if list := erasureRequestsOf(t, u.ID); len(list) != 0 {
+			t.Fatalf("user %s has erasure requests %+v", u.Name, list)
+		}
+	}
+	if u, err := cache.GetSessionInfo(session); err != nil || u.Name != attacker.Name {
+		t.Fatalf("session: got %v, %v", u, err)
+	}
+}
+
+func TestLogoff(t *testing.T) {
+	// 用户名可以省略，省略时注销当前会话的账号
+	for _, omit := range []bool{true, false} {
+		user := createTestUser(t, &model.User{Name: fmt.Sprintf("logoff_self_%v", omit)})
+		ctx, session := logoffContext(t, user)
+		req := &LogoffRequest{UserName: user.Name}
+		if omit {
+			req.UserName = ""
+		}
+		if err := Logoff(req, ctx); err != nil {
+			t.Fatalf("logoff %q: %v", req.UserName, err)
+		}
+		if got, err := dao.GetUserByName(user.Name); err != nil || got != nil {
+			t.Fatalf("user not deleted: %v, %v", got, err)
+		}
+		if _, err := cache.GetSessionInfo(session); err == nil {
+			t.Fatal("session still valid after logoff")
+		}
+		// SQLite 会复用已删除用户的 id，取最新的任务
+		list := erasureRequestsOf(t, user.ID)
+		if len(list) == 0 {
+			t.Fatal("no erasure request created")
+		}
+		if r := list[len(list)-1]; r.Requester != erasure.RequesterUser || r.Status != dao.ErasurePending {
+			t.Fatalf("erasure request %+v", r)
+		}
+	}
+}
+
+func TestLogoffWithoutSession(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "logoff_no_session"})
+	ctx := context.WithValue(context.Background(), constant.SessionKey, "unknown-session")
+	if err := Logoff(&LogoffRequest{UserName: user.Name}, ctx); err == nil {
+		t.Fatal("logoff without a valid session accepted")
+	}
+	if got, err := dao.GetUserByName(user.Name); err != nil || got == nil {
+		t.Fatalf("user %s: got %v, %v", user.Name, got, err)
+	}
+}
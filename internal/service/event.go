@@ -0,0 +1,50 @@
+package service
+
+import (
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/outbox"
+	"Gous/internal/webhook"
+	"sort"
+	"strconv"
+)
+
+// userEventData 用户事件的数据，不含密码
+type userEventData struct {
+	ID       int      `json:"id"`
+	UserName string   `json:"user_name"`
+	NickName string   `json:"nickname"`
+	Email    *string  `json:"email"`
+	Phone    *string  `json:"phone"`
+	Status   string   `json:"status"`
+	Source   string   `json:"source"`
+	Role     string   `json:"role"`
+	Changes  []string `json:"changes,omitempty"` // user.updated 事件中修改过的字段
+}
+
+func newUserEventData(user *model.User, changes []string) *userEventData {
+	sort.Strings(changes)
+	return &userEventData{
+		ID:       user.ID,
+		UserName: user.Name,
+		NickName: user.NickName,
+		Email:    user.Email,
+		Phone:    user.Phone,
+		Status:   user.Status,
+		Source:   user.Source,
+		Role:     user.Role,
+		Changes:  changes,
+	}
+}
+
+// emitUserEvent 在用户数据提交成功后生成事件回调
+func emitUserEvent(eventType string, user *model.User, changes ...string) {
+	webhook.Emit(eventType, newUserEventData(user, changes))
+}
+
+// userOutbox 生成与用户数据在同一事务中写入的领域事件，以用户 id 作为顺序发布的 key
+func userOutbox(eventType string, changes ...string) dao.UserEvent {
+	return func(user *model.User) (*model.OutboxEvent, error) {
+		return outbox.NewEvent(eventType, strconv.Itoa(user.ID), newUserEventData(user, changes))
+	}
+}
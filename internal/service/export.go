@@ -0,0 +1,148 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/dao"
+	"Gous/internal/export"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const exportTokenPurpose = "data_export"
+
+// exportLink 下载链接中签名的内容
+type exportLink struct {
+	ID     int `json:"id"`
+	UserID int `json:"uid"`
+}
+
+// RequestDataExport 创建个人数据导出任务，由后台任务异步生成
+func RequestDataExport(ctx context.Context, session string) (*DataExportResponse, error) {
+	conf := config.GetGlobalConf().DataExport
+	if !conf.Enabled {
+		return nil, fmt.Errorf("data export is disabled")
+	}
+	user, err := requestUser(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	last, err := dao.ListDataExports(user.ID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(last) > 0 {
+		e := last[0]
+		if e.Status == dao.ExportPending || e.Status == dao.ExportRunning {
+			return nil, fmt.Errorf("export %d is in progress", e.ID)
+		}
+		if wait := time.Duration(conf.MinInterval)*time.Second - time.Since(e.CreateTime); wait > 0 {
+			return nil, fmt.Errorf("too many exports, retry after %s", wait.Round(time.Second))
+		}
+	}
+	e := &model.DataExport{UserID: user.ID, UserName: user.Name, Status: dao.ExportPending}
+	if err := dao.CreateDataExport(e); err != nil {
+		return nil, err
+	}
+	log.Infof("RequestDataExport|export %d created for %s", e.ID, user.Name)
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditDataExport,
+		Actor:   user.Name,
+		Target:  user.Name,
+		Changes: map[string]audit.Change{"export_id": {To: e.ID}},
+	})
+	export.Wakeup()
+	return dataExportResponse(conf, e), nil
+}
+
+// ListDataExports 查询用户最近的导出任务，已完成的任务返回新签发的下载链接
+func ListDataExports(ctx context.Context, session string) ([]*DataExportResponse, error) {
+	user, err := requestUser(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	exports, err := dao.ListDataExports(user.ID, 10)
+	if err != nil {
+		return nil, err
+	}
+	conf := config.GetGlobalConf().DataExport
+	list := make([]*DataExportResponse, 0, len(exports))
+	for _, e := range exports {
+		list = append(list, dataExportResponse(conf, e))
+	}
+	return list, nil
+}
+
+// DownloadDataExport 校验下载链接，返回导出文件路径和下载文件名。
+// 链接本身即凭证，不要求登录，因此只在签名有效、任务属于签名中的用户且文件未过期时返回
+func DownloadDataExport(ctx context.Context, token string) (string, string, error) {
+	conf := config.GetGlobalConf().DataExport
+	if !conf.Enabled {
+		return "", "", fmt.Errorf("data export is disabled")
+	}
+	var link exportLink
+	if err := utils.VerifyToken(exportTokenPurpose, token, &link); err != nil {
+		return "", "", fmt.Errorf("invalid download link: %v", err)
+	}
+	e, err := dao.GetDataExport(link.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if e == nil || e.UserID != link.UserID || e.Status != dao.ExportDone ||
+		e.ExpireTime == nil || !e.ExpireTime.After(time.Now()) {
+		return "", "", fmt.Errorf("export not found or expired")
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditExportDownload,
+		Actor:   e.UserName,
+		Target:  e.UserName,
+		Changes: map[string]audit.Change{"export_id": {To: e.ID}},
+	})
+	name := fmt.Sprintf("gous-export-%s-%s.zip", e.UserName, e.CreateTime.Format("20060102"))
+	return export.Path(conf, e.File), name, nil
+}
+
+func dataExportResponse(conf config.DataExportConf, e *model.DataExport) *DataExportResponse {
+	rsp := &DataExportResponse{
+		ID:         e.ID,
+		Status:     e.Status,
+		Size:       e.Size,
+		Error:      e.Error,
+		CreateTime: e.CreateTime,
+		FinishTime: e.FinishTime,
+		ExpireTime: e.ExpireTime,
+	}
+	if e.Status != dao.ExportDone || e.ExpireTime == nil {
+		return rsp
+	}
+	// 链接有效期不超过文件保留时间
+	ttl := time.Duration(conf.LinkTTL) * time.Second
+	if left := time.Until(*e.ExpireTime); left < ttl {
+		ttl = left
+	}
+	if ttl <= 0 {
+		return rsp
+	}
+	token, err := utils.SignToken(exportTokenPurpose, &exportLink{ID: e.ID, UserID: e.UserID}, ttl)
+	if err != nil {
+		log.Errorf("dataExportResponse|sign export %d err:%v", e.ID, err)
+		return rsp
+	}
+	linkExpire := time.Now().Add(ttl)
+	rsp.DownloadUrl = strings.TrimRight(conf.BaseUrl, "/") + "/user/exports/download?token=" + url.QueryEscape(token)
+	rsp.LinkExpireTime = &linkExpire
+	return rsp
+}
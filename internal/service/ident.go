@@ -0,0 +1,88 @@
+package service
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/pkg/constant"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// e164Pattern E.164 手机号格式：+ 国家码 + 号码，最长 15 位
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// normalizePhone 去掉空格、横线、括号，00 前缀换成 +，并校验 E.164 格式
+func normalizePhone(phone string) (string, error) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !e164Pattern.MatchString(phone) {
+		return "", fmt.Errorf("invalid phone, E.164 format like +8613800138000 required: %s", phone)
+	}
+	return phone, nil
+}
+
+// parseIdent 识别登录标识的类型：含 @ 为邮箱，以 + 或 00 开头为手机号，其余为用户名
+func parseIdent(ident string) (kind, value string, err error) {
+	ident = strings.TrimSpace(ident)
+	switch {
+	case ident == "":
+		return "", "", fmt.Errorf("login identifier is empty")
+	case strings.Contains(ident, "@"):
+		value, err = normalizeEmail(ident)
+		return constant.IdentEmail, value, err
+	case strings.HasPrefix(ident, "+") || strings.HasPrefix(ident, "00"):
+		value, err = normalizePhone(ident)
+		return constant.IdentPhone, value, err
+	default:
+		return constant.IdentUserName, ident, nil
+	}
+}
+
+// identMatches 用户的邮箱、手机号是否与登录标识一致且已验证
+func identMatches(user *model.User, kind, value string) bool {
+	switch kind {
+	case constant.IdentEmail:
+		return user.Email != nil && *user.Email == value && user.EmailVerified
+	case constant.IdentPhone:
+		return user.Phone != nil && *user.Phone == value && user.PhoneVerified
+	}
+	return user.Name == value
+}
+
+// getUserByIdent 根据用户名、已验证邮箱或已验证手机号查询用户，优先查缓存
+func getUserByIdent(ident string) (*model.User, error) {
+	kind, value, err := parseIdent(ident)
+	if err != nil {
+		return nil, err
+	}
+	if kind == constant.IdentUserName {
+		return getUserInfo(value)
+	}
+
+	// 缓存中记录了标识到用户名的映射，取到用户后再核对一次，防止邮箱、手机号变更后命中旧映射
+	if userName, err := cache.GetUserNameByIdent(kind, value); err == nil {
+		if user, err := getUserInfo(userName); err == nil && identMatches(user, kind, value) {
+			return user, nil
+		}
+	}
+
+	user, err := dao.GetUserByIdent(kind, value)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !identMatches(user, kind, value) {
+		return nil, fmt.Errorf("用户尚未注册或%s未验证", kind)
+	}
+	if err := cache.SetUserCacheInfo(user); err != nil {
+		log.Errorf("getUserByIdent|cache userinfo failed for user:%s err:%v", user.Name, err)
+	}
+	if err := cache.SetUserIdent(kind, value, user.Name); err != nil {
+		log.Errorf("getUserByIdent|cache %s ident failed for user:%s err:%v", kind, user.Name, err)
+	}
+	return user, nil
+}
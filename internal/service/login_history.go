@@ -0,0 +1,142 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/notify"
+	"Gous/internal/useragent"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// 登录方式，第三方登录为 oidc:<provider>
+const (
+	loginMethodPassword = "password"
+	loginMethodOtp      = "otp"
+	loginMethodOidc     = "oidc:"
+)
+
+// recordLogin 记录登录结果；首次从未见过的设备登录成功时异步通知用户，用户第一次登录不通知
+func recordLogin(ctx context.Context, user *model.User, method string, loginErr error) {
+	conf := config.GetGlobalConf().LoginHistory
+	if !conf.Enabled {
+		return
+	}
+	src := audit.SourceFrom(ctx)
+	ua := useragent.Parse(src.UserAgent)
+	h := &model.LoginHistory{
+		UserID:      user.ID,
+		Method:      method,
+		Result:      constant.AuditSuccess,
+		IP:          src.IP,
+		UserAgent:   utils.Truncate(src.UserAgent, 512),
+		Browser:     utils.Truncate(ua.Browser, 64),
+		OS:          ua.OS,
+		Device:      ua.Device,
+		Fingerprint: ua.Fingerprint(),
+	}
+	if loginErr != nil {
+		h.Result = constant.AuditFailure
+		h.Reason = utils.Truncate(loginErr.Error(), 255)
+	}
+
+	// 写入本次记录前查询，避免把本次登录当作见过的设备
+	notifyNew := false
+	if loginErr == nil && conf.NotifyNewDevice {
+		seen, first, err := dao.LoginDeviceSeen(user.ID, h.Fingerprint)
+		if err != nil {
+			log.Errorf("recordLogin|%v", err)
+		}
+		notifyNew = err == nil && !seen && !first
+	}
+	if err := dao.CreateLoginHistory(h); err != nil {
+		log.Errorf("recordLogin|user %s: %v", user.Name, err)
+	}
+	if !notifyNew {
+		return
+	}
+
+	n := &notify.NewDeviceLogin{
+		UserName: user.Name,
+		Time:     time.Now(),
+		Method:   method,
+		IP:       h.IP,
+		Browser:  h.Browser,
+		OS:       h.OS,
+		Device:   h.Device,
+	}
+	if user.Email != nil && user.EmailVerified {
+		n.Email = *user.Email
+	}
+	// 通知失败不影响登录，也不阻塞登录响应
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		notifier, err := notify.Get()
+		if err == nil {
+			err = notifier.NewDeviceLogin(ctx, n)
+		}
+		if err != nil {
+			log.Errorf("recordLogin|notify user %s of new device err:%v", n.UserName, err)
+		}
+	}()
+}
+
+// recordLoginFailure 登录失败时按登录标识查找用户并记录，标识不对应任何用户时不记录
+func recordLoginFailure(ctx context.Context, ident, method string, loginErr error) {
+	if !config.GetGlobalConf().LoginHistory.Enabled {
+		return
+	}
+	kind, value, err := parseIdent(ident)
+	if err != nil {
+		return
+	}
+	user, err := dao.GetUserByIdent(kind, value)
+	if err != nil || user == nil {
+		return
+	}
+	recordLogin(ctx, user, method, loginErr)
+}
+
+// ListLoginHistory 分页查询当前用户的登录记录
+func ListLoginHistory(ctx context.Context, session string, page, pageSize int) (*LoginHistoryListResponse, error) {
+	if !config.GetGlobalConf().LoginHistory.Enabled {
+		return nil, fmt.Errorf("login history is disabled")
+	}
+	user, err := requestUser(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	} else if pageSize > 100 {
+		pageSize = 100
+	}
+	list, total, err := dao.ListLoginHistory(user.ID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &LoginHistoryListResponse{Total: total, Items: make([]*LoginHistoryResponse, 0, len(list))}
+	for _, h := range list {
+		rsp.Items = append(rsp.Items, &LoginHistoryResponse{
+			Time:    h.CreateTime,
+			Method:  h.Method,
+			Result:  h.Result,
+			Reason:  h.Reason,
+			IP:      h.IP,
+			Browser: h.Browser,
+			OS:      h.OS,
+			Device:  h.Device,
+		})
+	}
+	return rsp, nil
+}
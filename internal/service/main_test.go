@@ -0,0 +1,137 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var createIndexPattern = regexp.MustCompile("^CREATE (UNIQUE )?INDEX `(\\w+)` ON `(\\w+)`")
+
+// testRedis 测试使用的内存 redis，用例可以快进时间或直接检查键
+var testRedis *miniredis.Miniredis
+
+// TestMain 使用内存 redis、SQLite 和 mock 身份提供方代替外部依赖，配置在首次读取前写入临时文件
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gous-service-test")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	testRedis, err = miniredis.Run()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer testRedis.Close()
+
+	issuer := newMockIssuer()
+	defer issuer.Close()
+
+	confFile := filepath.Join(dir, "app.yml")
+	if err := os.WriteFile(confFile, []byte(testConfig(testRedis.Port(), issuer.URL)), 0600); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	config.SetConfigFile(confFile)
+	config.GetGlobalConf()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")+"?_pragma=busy_timeout(5000)"),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	// MySQL 的索引名只需表内唯一，SQLite 要求全库唯一，建索引时加上表名前缀
+	err = db.Callback().Raw().Before("gorm:raw").Register("test:index_name", func(tx *gorm.DB) {
+		sql := tx.Statement.SQL.String()
+		if m := createIndexPattern.FindStringSubmatch(sql); m != nil {
+			tx.Statement.SQL.Reset()
+			tx.Statement.SQL.WriteString(strings.Replace(sql, "`"+m[2]+"`", "`"+m[3]+"_"+m[2]+"`", 1))
+		}
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	utils.SetDB(db)
+	if err := dao.Migrate(); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return m.Run()
+}
+
+func testConfig(redisPort, issuerURL string) string {
+	return fmt.Sprintf(`
+redis:
+  rhost: 127.0.0.1
+  rport: %s
+secret:
+  signing_key: "test-signing-key-0123456789abcdef"
+otp:
+  enabled: true
+  code_ttl: 300
+  max_attempts: 3
+  resend_cooldown: 60
+  email_provider: fake
+  sms_provider: fake
+oidc:
+  enabled: true
+  redirect_base_url: "http://gous.test"
+  state_ttl: 600
+  providers:
+    - name: mock
+      issuer: %q
+      client_id: gous
+      client_secret: secret
+      scopes: [email, profile]
+      auto_provision: true
+oauth:
+  enabled: true
+  issuer: "http://gous.test"
+audit:
+  enabled: false
+login_history:
+  enabled: false
+webhook:
+  enabled: false
+`, redisPort, issuerURL)
+}
+
+// createTestUser 直接写入数据库创建用户，name 在各用例间不能重复
+func createTestUser(t *testing.T, user *model.User) *model.User {
+	t.Helper()
+	if user.PassWord == "" {
+		user.PassWord = "secret-password"
+	}
+	if user.Status == "" {
+		user.Status = constant.UserStatusActive
+	}
+	if err := dao.CreateUser(user); err != nil {
+		t.Fatalf("create user %s: %v", user.Name, err)
+	}
+	return user
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/oauth"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 授权方式
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+	grantClientCredentials = "client_credentials"
+)
+
+// OAuthScopes 支持的标准 scope，应用注册时还可以声明自定义的接口 scope
+var OAuthScopes = []string{"openid", "profile", "email", "phone"}
+
+// OAuthError 按 RFC 6749 返回给客户端的错误
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Redirect    bool   `json:"-"` // 应用和回调地址已校验通过，可以把错误带回回调地址
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// oauthServerError 内部错误只记录日志，不把细节返回给客户端
+func oauthServerError(err error) *OAuthError {
+	log.Errorf("oauth|%v", err)
+	return &OAuthError{Code: "server_error"}
+}
+
+// oauthCode 授权码关联的授权信息
+type oauthCode struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	UserID        int    `json:"uid"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"code_challenge,omitempty"`
+}
+
+// oauthEnabled 授权服务器未开启时各端点统一返回的错误
+func oauthEnabled() error {
+	if !config.GetGlobalConf().OAuth.Enabled {
+		return &OAuthError{Code: "temporarily_unavailable", Description: "oauth server is disabled"}
+	}
+	return nil
+}
+
+// ValidateAuthorize 校验授权请求，返回应用和申请的 scope。
+// 应用或回调地址无效时不能重定向，其余错误带回应用的回调地址
+func ValidateAuthorize(req *AuthorizeRequest) (*model.OAuthClient, []string, error) {
+	if err := oauthEnabled(); err != nil {
+		return nil, nil, err
+	}
+	client, err := dao.GetOAuthClient(req.ClientID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ValidateAuthorize|%v", err)
+	}
+	if client == nil {
+		return nil, nil, &OAuthError{Code: "invalid_request", Description: "unknown client_id"}
+	}
+	if req.RedirectURI == "" || !oauth.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, &OAuthError{Code: "invalid_request", Description: "redirect_uri not registered for this client"}
+	}
+
+	if req.ResponseType != "code" {
+		return nil, nil, &OAuthError{Code: "unsupported_response_type", Description: "only response_type=code is supported", Redirect: true}
+	}
+	if !oauth.Contains(client.GrantTypes, grantAuthorizationCode) {
+		return nil, nil, &OAuthError{Code: "unauthorized_client", Description: "authorization_code grant not allowed", Redirect: true}
+	}
+	scopes := oauth.SplitList(req.Scope)
+	if len(scopes) == 0 || !oauth.Subset(scopes, client.Scopes) {
+		return nil, nil, &OAuthError{Code: "invalid_scope", Description: "scope empty or not allowed for this client", Redirect: true}
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != "S256" {
+		return nil, nil, &OAuthError{Code: "invalid_request", Description: "only code_challenge_method=S256 is supported", Redirect: true}
+	}
+	if req.CodeChallenge == "" && client.SecretHash == "" {
+		return nil, nil, &OAuthError{Code: "invalid_request", Description: "public clients must use PKCE", Redirect: true}
+	}
+	return client, scopes, nil
+}
+
+// AuthorizeErrorURL 把错误带回应用的回调地址
+func AuthorizeErrorURL(req *AuthorizeRequest, e *OAuthError) string {
+	q := url.Values{"error": {e.Code}}
+	if e.Description != "" {
+		q.Set("error_description", e.Description)
+	}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, q)
+}
+
+// appendQuery 在回调地址上追加参数，保留地址中已有的参数
+func appendQuery(rawUrl string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(rawUrl, "?") {
+		sep = "&"
+	}
+	return rawUrl + sep + q.Encode()
+}
+
+// SessionUser 根据会话获取当前登录用户
+func SessionUser(session string) (*model.User, error) {
+	if session == "" {
+		return nil, fmt.Errorf("not logged in")
+	}
+	sessionUser, err := cache.GetSessionInfo(session)
+	if err != nil {
+		return nil, fmt.Errorf("not logged in")
+	}
+	return getUserInfo(sessionUser.Name)
+}
+
+// NeedConsent 用户是否需要确认授权：可信应用或已同意过全部 scope 时不需要
+func NeedConsent(user *model.User, client *model.OAuthClient, scopes []string) (bool, error) {
+	if client.SkipConsent {
+		return false, nil
+	}
+	consent, err := dao.GetOAuthConsent(user.ID, client.ClientID)
+	if err != nil {
+		return false, fmt.Errorf("NeedConsent|%v", err)
+	}
+	return consent == nil || !oauth.Subset(scopes, consent.Scopes), nil
+}
+
+// ApproveAuthorize 用户同意授权后记录授权并签发授权码，返回带授权码的回调地址
+func ApproveAuthorize(user *model.User, client *model.OAuthClient, req *AuthorizeRequest, scopes []string, saveConsent bool) (string, error) {
+	if saveConsent {
+		consent := &model.OAuthConsent{UserID: user.ID, ClientID: client.ClientID, Scopes: strings.Join(scopes, " ")}
+		if err := dao.SaveOAuthConsent(consent); err != nil {
+			return "", fmt.Errorf("ApproveAuthorize|%v", err)
+		}
+	}
+	code, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	data := &oauthCode{
+		ClientID:      client.ClientID,
+		RedirectURI:   req.RedirectURI,
+		UserID:        user.ID,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+	}
+	ttl := time.Duration(config.GetGlobalConf().OAuth.CodeTTL) * time.Second
+	if err := cache.SetOAuthCode(oauth.HashSecret(code), data, ttl); err != nil {
+		return "", fmt.Errorf("ApproveAuthorize|save code err:%v", err)
+	}
+	log.Infof("ApproveAuthorize|user %s authorized client %s scope=%s", user.Name, client.ClientID, data.Scope)
+	q := url.Values{"code": {code}}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, q), nil
+}
+
+// CreateOAuthClient 注册应用，返回的密钥只展示这一次
+func CreateOAuthClient(ctx context.Context, req *CreateOAuthClientRequest) (*OAuthClientResponse, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{grantAuthorizationCode, grantRefreshToken}
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{"openid", "profile", "email"}
+	}
+	for _, g := range req.GrantTypes {
+		switch g {
+		case grantAuthorizationCode, grantRefreshToken:
+		case grantClientCredentials:
+			if req.Public {
+				return nil, fmt.Errorf("public clients can not use client_credentials")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported grant type %q", g)
+		}
+	}
+	if oauth.Contains(strings.Join(req.GrantTypes, " "), grantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return nil, fmt.Errorf("redirect_uris is required for authorization_code")
+	}
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" || u.Host == "" && u.Opaque == "" || u.Fragment != "" || strings.ContainsAny(uri, " ") {
+			return nil, fmt.Errorf("invalid redirect uri %q, absolute uri without fragment required", uri)
+		}
+	}
+	for _, s := range req.Scopes {
+		if s == "" || strings.ContainsAny(s, " \"\\") {
+			return nil, fmt.Errorf("invalid scope %q", s)
+		}
+	}
+
+	clientID, err := utils.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	client := &model.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		GrantTypes:   strings.Join(req.GrantTypes, " "),
+		Scopes:       strings.Join(req.Scopes, " "),
+		SkipConsent:  req.SkipConsent,
+	}
+	var secret string
+	if !req.Public {
+		if secret, err = utils.RandomToken(32); err != nil {
+			return nil, err
+		}
+		client.SecretHash = oauth.HashSecret(secret)
+	}
+	if err := dao.CreateOAuthClient(client); err != nil {
+		return nil, err
+	}
+	log.Infof("CreateOAuthClient|client %s (%s) registered", client.ClientID, client.Name)
+	audit.Record(ctx, &audit.Event{
+		Action: constant.AuditOAuthClientCreate,
+		Actor:  constant.AuditActorAdmin,
+		Target: client.ClientID,
+		Changes: map[string]audit.Change{
+			"name":          {To: client.Name},
+			"redirect_uris": {To: client.RedirectURIs},
+			"grant_types":   {To: client.GrantTypes},
+			"scopes":        {To: client.Scopes},
+			"skip_consent":  {To: client.SkipConsent},
+		},
+	})
+	rsp := oauthClientResponse(client)
+	rsp.ClientSecret = secret
+	return rsp, nil
+}
+
+// ListOAuthClients 查询已注册的应用
+func ListOAuthClients() ([]*OAuthClientResponse, error) {
+	clients, err := dao.ListOAuthClients()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*OAuthClientResponse, 0, len(clients))
+	for _, c := range clients {
+		list = append(list, oauthClientResponse(c))
+	}
+	return list, nil
+}
+
+// DeleteOAuthClient 删除应用，之后该应用的 refresh token 无法再使用
+func DeleteOAuthClient(ctx context.Context, clientID string) error {
+	client, err := dao.GetOAuthClient(clientID)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("client %s not found", clientID)
+	}
+	if err := dao.DeleteOAuthClient(clientID); err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditOAuthClientDelete,
+		Actor:   constant.AuditActorAdmin,
+		Target:  clientID,
+		Changes: map[string]audit.Change{"name": {From: client.Name}},
+	})
+	return nil
+}
+
+func oauthClientResponse(c *model.OAuthClient) *OAuthClientResponse {
+	return &OAuthClientResponse{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: oauth.SplitList(c.RedirectURIs),
+		GrantTypes:   oauth.SplitList(c.GrantTypes),
+		Scopes:       oauth.SplitList(c.Scopes),
+		Public:       c.SecretHash == "",
+		SkipConsent:  c.SkipConsent,
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+// testVerifier PKCE code_verifier，长度至少 43
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func testChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// createTestClient 注册应用，public 为 true 时没有密钥
+func createTestClient(t *testing.T, public bool) (client *model.OAuthClient, secret string) {
+	t.Helper()
+	rsp, err := CreateOAuthClient(context.Background(), &CreateOAuthClientRequest{
+		Name:         "test app",
+		RedirectURIs: []string{testRedirectURI, "https://app.example.com/other?tab=1"},
+		Scopes:       []string{"openid", "profile", "email"},
+		Public:       public,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = dao.GetOAuthClient(rsp.ClientID)
+	if err != nil || client == nil {
+		t.Fatal(err)
+	}
+	return client, rsp.ClientSecret
+}
+
+// authorize 用户同意授权，返回授权码
+func authorize(t *testing.T, user *model.User, client *model.OAuthClient, challenge string) string {
+	t.Helper()
+	req := &AuthorizeRequest{
+		ResponseType: "code", ClientID: client.ClientID, RedirectURI: testRedirectURI,
+		Scope: "openid profile", State: "xyz", Nonce: "n-1",
+	}
+	if challenge != "" {
+		req.CodeChallenge, req.CodeChallengeMethod = challenge, "S256"
+	}
+	_, scopes, err := ValidateAuthorize(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := ApproveAuthorize(user, client, req, scopes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, testRedirectURI+"?") || u.Query().Get("state") != "xyz" {
+		t.Fatalf("redirect %s", location)
+	}
+	return u.Query().Get("code")
+}
+
+// wantOAuthError 校验返回的 OAuth 错误码
+func wantOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+	var oe *OAuthError
+	if !errors.As(err, &oe) || oe.Code != code {
+		t.Fatalf("got %v, want %s", err, code)
+	}
+}
+
+func TestValidateAuthorizeRedirectURI(t *testing.T) {
+	client, _ := createTestClient(t, false)
+	tests := []struct {
+		uri string
+		ok  bool
+	}{
+		{testRedirectURI, true},
+		{"https://app.example.com/other?tab=1", true},
+		{"", false},
+		{testRedirectURI + "/", false},
+		{testRedirectURI + "?next=https://evil.example", false},
+		{testRedirectURI + "#frag", false},
+		{"https://app.example.com/Callback", false},
+		{"http://app.example.com/callback", false},
+		{"https://app.example.com.evil.example/callback", false},
+		{"https://app.example.com/other", false},
+	}
+	for _, tt := range tests {
+		_, _, err := ValidateAuthorize(&AuthorizeRequest{ResponseType: "code", ClientID: client.ClientID, RedirectURI: tt.uri, Scope: "openid"})
+		if tt.ok {
+			if err != nil {
+				t.Errorf("redirect_uri %q: %v", tt.uri, err)
+			}
+			continue
+		}
+		// 回调地址无效时不能把错误带回该地址
+		var oe *OAuthError
+		if !errors.As(err, &oe) || oe.Code != "invalid_request" || oe.Redirect {
+			t.Errorf("redirect_uri %q: got %v, want invalid_request without redirect", tt.uri, err)
+		}
+	}
+}
+
+func TestValidateAuthorizePKCE(t *testing.T) {
+	public, _ := createTestClient(t, true)
+	confidential, _ := createTestClient(t, false)
+	tests := []struct {
+		name      string
+		client    *model.OAuthClient
+		challenge string
+		method    string
+		err       string
+	}{
+		{name: "public client without pkce", client: public, err: "invalid_request"},
+		{name: "public client with plain method", client: public, challenge: testVerifier, method: "plain", err: "invalid_request"},
+		{name: "public client with s256", client: public, challenge: testChallenge(testVerifier), method: "S256"},
+		{name: "confidential client without pkce", client: confidential},
+	}
+	for _, tt := range tests {
+		_, _, err := ValidateAuthorize(&AuthorizeRequest{
+			ResponseType: "code", ClientID: tt.client.ClientID, RedirectURI: testRedirectURI, Scope: "openid",
+			CodeChallenge: tt.challenge, CodeChallengeMethod: tt.method,
+		})
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var oe *OAuthError
+		if !errors.As(err, &oe) || oe.Code != tt.err || !oe.Redirect {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAuthorizationCodeSingleUse(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "oauth_code_user"})
+	client, secret := createTestClient(t, false)
+	code := authorize(t, user, client, "")
+	req := &TokenRequest{GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, ClientID: client.ClientID, ClientSecret: secret}
+
+	rsp, err := Token(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.AccessToken == "" || rsp.RefreshToken == "" || rsp.IDToken == "" || rsp.Scope != "openid profile" {
+		t.Fatalf("token response %+v", rsp)
+	}
+	_, err = Token(req)
+	wantOAuthError(t, err, "invalid_grant")
+
+	// 换取令牌时的回调地址必须与授权时一致，失败后授权码同样作废
+	code = authorize(t, user, client, "")
+	_, err = Token(&TokenRequest{GrantType: "authorization_code", Code: code, RedirectURI: "https://app.example.com/other?tab=1",
+		ClientID: client.ClientID, ClientSecret: secret})
+	wantOAuthError(t, err, "invalid_grant")
+	req.Code = code
+	_, err = Token(req)
+	wantOAuthError(t, err, "invalid_grant")
+
+	// 授权码只能由申请的应用使用
+	other, otherSecret := createTestClient(t, false)
+	code = authorize(t, user, client, "")
+	_, err = Token(&TokenRequest{GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, ClientID: other.ClientID, ClientSecret: otherSecret})
+	wantOAuthError(t, err, "invalid_grant")
+
+	// 客户端密钥错误
+	code = authorize(t, user, client, "")
+	_, err = Token(&TokenRequest{GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI, ClientID: client.ClientID, ClientSecret: "wrong"})
+	wantOAuthError(t, err, "invalid_client")
+}
+
+func TestAuthorizationCodePKCE(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "oauth_pkce_user"})
+	client, _ := createTestClient(t, true)
+	tests := []struct {
+		name     string
+		verifier string
+		err      string
+	}{
+		{name: "missing verifier", err: "invalid_grant"},
+		{name: "wrong verifier", verifier: strings.Repeat("a", 43), err: "invalid_grant"},
+		{name: "challenge used as verifier", verifier: testChallenge(testVerifier), err: "invalid_grant"},
+		{name: "valid verifier", verifier: testVerifier},
+	}
+	for _, tt := range tests {
+		code := authorize(t, user, client, testChallenge(testVerifier))
+		_, err := Token(&TokenRequest{GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI,
+			ClientID: client.ClientID, CodeVerifier: tt.verifier})
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var oe *OAuthError
+		if !errors.As(err, &oe) || oe.Code != tt.err {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.err)
+		}
+	}
+
+	// 公开客户端不能携带密钥
+	code := authorize(t, user, client, testChallenge(testVerifier))
+	_, err := Token(&TokenRequest{GrantType: "authorization_code", Code: code, RedirectURI: testRedirectURI,
+		ClientID: client.ClientID, ClientSecret: "secret", CodeVerifier: testVerifier})
+	wantOAuthError(t, err, "invalid_client")
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "oauth_refresh_user"})
+	client, secret := createTestClient(t, false)
+	first, err := Token(&TokenRequest{GrantType: "authorization_code", Code: authorize(t, user, client, ""),
+		RedirectURI: testRedirectURI, ClientID: client.ClientID, ClientSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh := func(token, scope string) (*TokenResponse, error) {
+		return Token(&TokenRequest{GrantType: "refresh_token", RefreshToken: token, Scope: scope, ClientID: client.ClientID, ClientSecret: secret})
+	}
+
+	second, err := refresh(first.RefreshToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken || second.Scope != "openid profile" {
+		t.Fatalf("refresh response %+v", second)
+	}
+	// 旧 refresh token 已作废
+	_, err = refresh(first.RefreshToken, "")
+	wantOAuthError(t, err, "invalid_grant")
+
+	// 缩小 scope 可以，扩大不行，失败时 refresh token 同样作废
+	third, err := refresh(second.RefreshToken, "profile")
+	if err != nil || third.Scope != "profile" || third.IDToken != "" {
+		t.Fatalf("narrowed refresh %+v, %v", third, err)
+	}
+	_, err = refresh(third.RefreshToken, "profile email")
+	wantOAuthError(t, err, "invalid_scope")
+	_, err = refresh(third.RefreshToken, "")
+	wantOAuthError(t, err, "invalid_grant")
+
+	// 其他应用不能使用
+	other, otherSecret := createTestClient(t, false)
+	fourth, err := Token(&TokenRequest{GrantType: "authorization_code", Code: authorize(t, user, client, ""),
+		RedirectURI: testRedirectURI, ClientID: client.ClientID, ClientSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Token(&TokenRequest{GrantType: "refresh_token", RefreshToken: fourth.RefreshToken, ClientID: other.ClientID, ClientSecret: otherSecret})
+	wantOAuthError(t, err, "invalid_grant")
+}
+
+func TestIntrospectAndRevokeOwnTokens(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "oauth_introspect_user"})
+	client, secret := createTestClient(t, false)
+	other, otherSecret := createTestClient(t, false)
+	public, _ := createTestClient(t, true)
+	tokens, err := Token(&TokenRequest{GrantType: "authorization_code", Code: authorize(t, user, client, ""),
+		RedirectURI: testRedirectURI, ClientID: client.ClientID, ClientSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := func(clientID, secret, token string) bool {
+		t.Helper()
+		result, err := Introspect(clientID, secret, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result["active"] == true
+	}
+
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if !active(client.ClientID, secret, token) {
+			t.Fatal("own token inactive")
+		}
+		if active(other.ClientID, otherSecret, token) {
+			t.Fatal("token of another client introspected")
+		}
+	}
+	if active(client.ClientID, secret, "garbage") {
+		t.Fatal("garbage token active")
+	}
+	_, err = Introspect(public.ClientID, "", tokens.AccessToken)
+	wantOAuthError(t, err, "invalid_client")
+	_, err = Introspect(client.ClientID, "wrong", tokens.AccessToken)
+	wantOAuthError(t, err, "invalid_client")
+
+	// 撤销其他应用的令牌视为成功，但不生效
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if err := Revoke(other.ClientID, otherSecret, token); err != nil {
+			t.Fatal(err)
+		}
+		if !active(client.ClientID, secret, token) {
+			t.Fatal("token revoked by another client")
+		}
+	}
+	if _, err := UserInfo(tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if err := Revoke(client.ClientID, secret, token); err != nil {
+			t.Fatal(err)
+		}
+		if active(client.ClientID, secret, token) {
+			t.Fatal("revoked token still active")
+		}
+	}
+	_, err = UserInfo(tokens.AccessToken)
+	wantOAuthError(t, err, "invalid_token")
+	_, err = Token(&TokenRequest{GrantType: "refresh_token", RefreshToken: tokens.RefreshToken, ClientID: client.ClientID, ClientSecret: secret})
+	wantOAuthError(t, err, "invalid_grant")
+}
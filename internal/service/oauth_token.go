@@ -0,0 +1,353 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/oauth"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"fmt"
+	"github.com/go-jose/go-jose/v3/jwt"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// oauthRefresh refresh token 关联的授权信息
+type oauthRefresh struct {
+	ClientID string `json:"client_id"`
+	UserID   int    `json:"uid"`
+	Scope    string `json:"scope"`
+}
+
+// authenticateClient 校验客户端身份，机密客户端必须提供正确的密钥，公开客户端不能提供密钥
+func authenticateClient(clientID, secret string) (*model.OAuthClient, error) {
+	if clientID == "" {
+		return nil, &OAuthError{Code: "invalid_client", Description: "client authentication required"}
+	}
+	client, err := dao.GetOAuthClient(clientID)
+	if err != nil {
+		return nil, oauthServerError(err)
+	}
+	if client == nil || client.SecretHash == "" && secret != "" ||
+		client.SecretHash != "" && !oauth.CheckSecret(secret, client.SecretHash) {
+		return nil, &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	}
+	return client, nil
+}
+
+// Token 令牌端点，支持授权码、refresh token 和客户端凭证三种方式
+func Token(req *TokenRequest) (*TokenResponse, error) {
+	if err := oauthEnabled(); err != nil {
+		return nil, err
+	}
+	client, err := authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !oauth.Contains(client.GrantTypes, req.GrantType) {
+		switch req.GrantType {
+		case grantAuthorizationCode, grantRefreshToken, grantClientCredentials:
+			return nil, &OAuthError{Code: "unauthorized_client", Description: req.GrantType + " grant not allowed for this client"}
+		}
+		return nil, &OAuthError{Code: "unsupported_grant_type"}
+	}
+
+	switch req.GrantType {
+	case grantAuthorizationCode:
+		return exchangeAuthCode(client, req)
+	case grantRefreshToken:
+		return refreshToken(client, req)
+	default:
+		return clientCredentials(client, req)
+	}
+}
+
+func exchangeAuthCode(client *model.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	data := &oauthCode{}
+	if err := cache.TakeOAuthCode(oauth.HashSecret(req.Code), data); err != nil {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "authorization code invalid or expired"}
+	}
+	if data.ClientID != client.ClientID || data.RedirectURI != req.RedirectURI {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "authorization code was issued to another client or redirect_uri"}
+	}
+	if data.CodeChallenge != "" && !oauth.CheckPKCE(req.CodeVerifier, data.CodeChallenge) ||
+		data.CodeChallenge == "" && req.CodeVerifier != "" {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "code_verifier mismatch"}
+	}
+	user, err := dao.GetUserByID(data.UserID)
+	if err != nil {
+		return nil, oauthServerError(err)
+	}
+	if user == nil || user.Status == constant.UserStatusSuspended {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "user no longer exists or is suspended"}
+	}
+	return issueTokens(client, user, data.Scope, data.Nonce)
+}
+
+func refreshToken(client *model.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	// 每个 refresh token 只能使用一次，刷新时换发新的
+	data := &oauthRefresh{}
+	if err := cache.TakeOAuthRefresh(oauth.HashSecret(req.RefreshToken), data); err != nil {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "refresh token invalid or expired"}
+	}
+	if data.ClientID != client.ClientID {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "refresh token was issued to another client"}
+	}
+	scope := data.Scope
+	if req.Scope != "" {
+		if !oauth.Subset(oauth.SplitList(req.Scope), data.Scope) {
+			return nil, &OAuthError{Code: "invalid_scope", Description: "scope exceeds the original grant"}
+		}
+		scope = req.Scope
+	}
+	user, err := dao.GetUserByID(data.UserID)
+	if err != nil {
+		return nil, oauthServerError(err)
+	}
+	if user == nil || user.Status == constant.UserStatusSuspended {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "user no longer exists or is suspended"}
+	}
+	return issueTokens(client, user, scope, "")
+}
+
+func clientCredentials(client *model.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	if client.SecretHash == "" {
+		return nil, &OAuthError{Code: "unauthorized_client", Description: "public clients can not use client_credentials"}
+	}
+	scopes := oauth.SplitList(req.Scope)
+	if !oauth.Subset(scopes, client.Scopes) || oauth.Contains(req.Scope, "openid") {
+		return nil, &OAuthError{Code: "invalid_scope", Description: "scope not allowed for client_credentials"}
+	}
+	return issueTokens(client, nil, strings.Join(scopes, " "), "")
+}
+
+// issueTokens 签发 access token；有用户时按需签发 refresh token 和 ID token
+func issueTokens(client *model.OAuthClient, user *model.User, scope, nonce string) (*TokenResponse, error) {
+	conf := config.GetGlobalConf().OAuth
+	now := time.Now()
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	subject := client.ClientID
+	if user != nil {
+		subject = strconv.Itoa(user.ID)
+	}
+	accessTTL := time.Duration(conf.AccessTokenTTL) * time.Second
+	access := &oauth.AccessClaims{
+		Claims: jwt.Claims{
+			Issuer:   oauth.Issuer(),
+			Subject:  subject,
+			Audience: jwt.Audience{client.ClientID},
+			Expiry:   jwt.NewNumericDate(now.Add(accessTTL)),
+			IssuedAt: jwt.NewNumericDate(now),
+			ID:       jti,
+		},
+		Scope:    scope,
+		ClientID: client.ClientID,
+	}
+	rsp := &TokenResponse{TokenType: "Bearer", ExpiresIn: conf.AccessTokenTTL, Scope: scope}
+	if rsp.AccessToken, err = oauth.Sign(access); err != nil {
+		return nil, oauthServerError(err)
+	}
+	if user == nil {
+		return rsp, nil
+	}
+
+	if oauth.Contains(client.GrantTypes, grantRefreshToken) {
+		refresh, err := utils.RandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		data := &oauthRefresh{ClientID: client.ClientID, UserID: user.ID, Scope: scope}
+		ttl := time.Duration(conf.RefreshTokenTTL) * time.Second
+		if err := cache.SetOAuthRefresh(oauth.HashSecret(refresh), data, ttl); err != nil {
+			return nil, oauthServerError(err)
+		}
+		rsp.RefreshToken = refresh
+	}
+
+	if oauth.Contains(scope, "openid") {
+		claims := userClaims(user, scope)
+		claims["iss"] = oauth.Issuer()
+		claims["aud"] = client.ClientID
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(time.Duration(conf.IDTokenTTL) * time.Second).Unix()
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		if rsp.IDToken, err = oauth.Sign(claims); err != nil {
+			return nil, oauthServerError(err)
+		}
+	}
+	log.Infof("issueTokens|client=%s|sub=%s|scope=%s", client.ClientID, subject, scope)
+	return rsp, nil
+}
+
+// userClaims 按 scope 返回用户信息声明，用于 ID token 和 userinfo
+func userClaims(user *model.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": strconv.Itoa(user.ID)}
+	if oauth.Contains(scope, "profile") {
+		claims["preferred_username"] = user.Name
+		claims["name"] = user.Name
+		if user.NickName != "" {
+			claims["nickname"] = user.NickName
+		}
+		if user.Gender != "" {
+			claims["gender"] = user.Gender
+		}
+	}
+	if oauth.Contains(scope, "email") && user.Email != nil {
+		claims["email"] = *user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if oauth.Contains(scope, "phone") && user.Phone != nil {
+		claims["phone_number"] = *user.Phone
+		claims["phone_number_verified"] = user.PhoneVerified
+	}
+	return claims
+}
+
+// parseActiveAccessToken 校验 access token 且未被撤销
+func parseActiveAccessToken(raw string) (*oauth.AccessClaims, error) {
+	claims, err := oauth.ParseAccessToken(raw)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := cache.IsAccessTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("token revoked")
+	}
+	return claims, nil
+}
+
+// UserInfo userinfo 端点，根据 access token 返回用户信息
+func UserInfo(accessToken string) (map[string]interface{}, error) {
+	if err := oauthEnabled(); err != nil {
+		return nil, err
+	}
+	claims, err := parseActiveAccessToken(accessToken)
+	if err != nil {
+		return nil, &OAuthError{Code: "invalid_token", Description: err.Error()}
+	}
+	if !oauth.Contains(claims.Scope, "openid") {
+		return nil, &OAuthError{Code: "insufficient_scope", Description: "openid scope required"}
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, &OAuthError{Code: "invalid_token", Description: "token has no user subject"}
+	}
+	user, err := dao.GetUserByID(userID)
+	if err != nil {
+		return nil, oauthServerError(err)
+	}
+	if user == nil || user.Status == constant.UserStatusSuspended {
+		return nil, &OAuthError{Code: "invalid_token", Description: "user no longer exists or is suspended"}
+	}
+	return userClaims(user, claims.Scope), nil
+}
+
+// Introspect 令牌内省（RFC 7662），只允许机密客户端调用，只能查询签发给自己的令牌，其他令牌返回 active=false
+func Introspect(clientID, secret, token string) (map[string]interface{}, error) {
+	if err := oauthEnabled(); err != nil {
+		return nil, err
+	}
+	client, err := authenticateClient(clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if client.SecretHash == "" {
+		return nil, &OAuthError{Code: "invalid_client", Description: "public clients can not introspect tokens"}
+	}
+	inactive := map[string]interface{}{"active": false}
+
+	if claims, err := parseActiveAccessToken(token); err == nil && claims.ClientID == client.ClientID {
+		return map[string]interface{}{
+			"active":     true,
+			"token_type": "access_token",
+			"scope":      claims.Scope,
+			"client_id":  claims.ClientID,
+			"sub":        claims.Subject,
+			"aud":        claims.Audience,
+			"iss":        claims.Issuer,
+			"exp":        claims.Expiry.Time().Unix(),
+			"iat":        claims.IssuedAt.Time().Unix(),
+			"jti":        claims.ID,
+		}, nil
+	}
+
+	data := &oauthRefresh{}
+	if err := cache.GetOAuthRefresh(oauth.HashSecret(token), data); err == nil && data.ClientID == client.ClientID {
+		return map[string]interface{}{
+			"active":     true,
+			"token_type": "refresh_token",
+			"scope":      data.Scope,
+			"client_id":  data.ClientID,
+			"sub":        strconv.Itoa(data.UserID),
+		}, nil
+	}
+	return inactive, nil
+}
+
+// Revoke 撤销令牌（RFC 7009），只能撤销签发给自己的令牌，令牌无效时同样视为成功
+func Revoke(clientID, secret, token string) error {
+	if err := oauthEnabled(); err != nil {
+		return err
+	}
+	client, err := authenticateClient(clientID, secret)
+	if err != nil {
+		return err
+	}
+
+	hash := oauth.HashSecret(token)
+	data := &oauthRefresh{}
+	if err := cache.GetOAuthRefresh(hash, data); err == nil {
+		if data.ClientID == client.ClientID {
+			if err := cache.DelOAuthRefresh(hash); err != nil {
+				return oauthServerError(err)
+			}
+			log.Infof("Revoke|client %s revoked a refresh token", client.ClientID)
+		}
+		return nil
+	}
+
+	claims, err := oauth.ParseAccessToken(token)
+	if err != nil || claims.ClientID != client.ClientID {
+		return nil
+	}
+	if err := cache.RevokeAccessToken(claims.ID, time.Until(claims.Expiry.Time())+time.Minute); err != nil {
+		return oauthServerError(err)
+	}
+	log.Infof("Revoke|client %s revoked access token %s", client.ClientID, claims.ID)
+	return nil
+}
+
+// Discovery OpenID Provider 元数据，供客户端自动发现各端点
+func Discovery() map[string]interface{} {
+	issuer := oauth.Issuer()
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/oauth/jwks",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{grantAuthorizationCode, grantRefreshToken, grantClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      OAuthScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{"sub", "iss", "aud", "exp", "iat", "nonce", "name", "preferred_username",
+			"nickname", "gender", "email", "email_verified", "phone_number", "phone_number_verified"},
+	}
+}
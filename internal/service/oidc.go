@@ -0,0 +1,220 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/oidc"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// oidcState 跳转到身份提供方前保存的状态，回调时取回
+type oidcState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	LinkUser string `json:"link_user,omitempty"` // 绑定流程中发起绑定的用户名，登录流程为空
+}
+
+// userNameInvalidChars 自动开户时用户名中不允许出现的字符
+var userNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// OidcAuthURL 生成跳转到身份提供方的授权地址，返回地址和本次跳转的 state。
+// session 不为空时为已登录用户绑定第三方身份
+func OidcAuthURL(provider, session string) (string, string, error) {
+	client, err := oidc.Get(provider)
+	if err != nil {
+		return "", "", err
+	}
+	st := &oidcState{Provider: provider, Verifier: oidc.GenerateVerifier()}
+	if session != "" {
+		user, err := cache.GetSessionInfo(session)
+		if err != nil {
+			return "", "", fmt.Errorf("OidcAuthURL|GetSessionInfo err:%v", err)
+		}
+		st.LinkUser = user.Name
+	}
+	state, err := utils.RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	if st.Nonce, err = utils.RandomToken(16); err != nil {
+		return "", "", err
+	}
+	ttl := time.Duration(config.GetGlobalConf().Oidc.StateTTL) * time.Second
+	if err := cache.SetOidcState(state, st, ttl); err != nil {
+		return "", "", fmt.Errorf("OidcAuthURL|save state err:%v", err)
+	}
+	return client.AuthCodeURL(state, st.Nonce, st.Verifier), state, nil
+}
+
+// OidcCallback 处理身份提供方回调：校验 state，用授权码换取并校验 ID token，再按绑定关系登录、绑定或自动开户。
+// 登录时返回新会话，绑定时返回空会话
+func OidcCallback(ctx context.Context, provider, state, code string) (string, error) {
+	st := &oidcState{}
+	if err := cache.TakeOidcState(state, st); err != nil {
+		return "", fmt.Errorf("login request expired or invalid, please try again")
+	}
+	if st.Provider != provider {
+		return "", fmt.Errorf("oidc state provider mismatch")
+	}
+	client, err := oidc.Get(provider)
+	if err != nil {
+		return "", err
+	}
+	claims, err := client.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		log.Errorf("OidcCallback|provider=%s|%v", provider, err)
+		return "", fmt.Errorf("oidc login failed")
+	}
+
+	identity, err := dao.GetUserIdentity(provider, claims.Subject)
+	if err != nil {
+		return "", fmt.Errorf("OidcCallback|%v", err)
+	}
+
+	if st.LinkUser != "" {
+		return "", linkIdentity(ctx, st.LinkUser, provider, identity, claims)
+	}
+
+	var user *model.User
+	if identity != nil {
+		if user, err = dao.GetUserByID(identity.UserID); err != nil {
+			return "", fmt.Errorf("OidcCallback|%v", err)
+		}
+		if user == nil {
+			return "", fmt.Errorf("linked user no longer exists")
+		}
+	} else {
+		if !client.AutoProvision() {
+			return "", fmt.Errorf("no account linked to this %s identity, please login and link it first", provider)
+		}
+		if user, err = provisionOidcUser(provider, claims); err != nil {
+			return "", err
+		}
+	}
+
+	session, err := createSession(ctx, user, loginMethodOidc+provider)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("OidcCallback|user %s login by %s", user.Name, provider)
+	return session, nil
+}
+
+// linkIdentity 将第三方身份绑定到已登录用户
+func linkIdentity(ctx context.Context, userName, provider string, identity *model.UserIdentity, claims *oidc.Claims) error {
+	user, err := getUserInfo(userName)
+	if err != nil {
+		return fmt.Errorf("linkIdentity|%v", err)
+	}
+	if identity != nil {
+		if identity.UserID == user.ID {
+			return nil
+		}
+		return fmt.Errorf("this %s identity is already linked to another account", provider)
+	}
+	err = dao.CreateUserIdentity(&model.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("linkIdentity|%v", err)
+	}
+	log.Infof("linkIdentity|user %s linked %s identity %s", user.Name, provider, claims.Subject)
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditIdentityLink,
+		Actor:   user.Name,
+		Target:  user.Name,
+		Changes: map[string]audit.Change{"identity": {To: provider + ":" + claims.Subject}},
+	})
+	return nil
+}
+
+// provisionOidcUser 首次通过第三方登录时自动创建账号并绑定身份。
+// 邮箱已属于其他账号时不自动合并，避免身份提供方的邮箱被用来接管已有账号
+func provisionOidcUser(provider string, claims *oidc.Claims) (*model.User, error) {
+	var email *string
+	if claims.Email != "" && claims.EmailVerified {
+		normalized, err := normalizeEmail(claims.Email)
+		if err == nil {
+			existed, err := dao.GetUserByEmail(normalized)
+			if err != nil {
+				return nil, fmt.Errorf("provisionOidcUser|%v", err)
+			}
+			if existed != nil {
+				return nil, fmt.Errorf("email %s already registered, please login and link %s first", normalized, provider)
+			}
+			email = &normalized
+		}
+	}
+	name, err := oidcUserName(claims)
+	if err != nil {
+		return nil, err
+	}
+	// 第三方账号不使用密码登录，设置一个随机密码
+	password, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		CreateModel:   model.CreateModel{Creator: provider},
+		ModifyModel:   model.ModifyModel{Modifier: provider},
+		Name:          name,
+		PassWord:      password,
+		NickName:      claims.Name,
+		Email:         email,
+		EmailVerified: email != nil,
+		Status:        constant.UserStatusActive,
+	}
+	identity := &model.UserIdentity{Provider: provider, Subject: claims.Subject, Email: claims.Email}
+	if err := dao.CreateUserWithIdentity(user, identity, userOutbox(constant.EventUserCreated)); err != nil {
+		return nil, fmt.Errorf("provisionOidcUser|%v", err)
+	}
+	log.Infof("provisionOidcUser|created user %s for %s identity %s", user.Name, provider, claims.Subject)
+	emitUserEvent(constant.EventUserCreated, user)
+	return user, nil
+}
+
+// oidcUserName 根据 preferred_username 或邮箱前缀生成未被占用的用户名，重名时追加随机后缀
+func oidcUserName(claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if i := strings.Index(base, "@"); i >= 0 {
+		base = base[:i]
+	}
+	if base == "" && claims.Email != "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = userNameInvalidChars.ReplaceAllString(base, "")
+	// 00 开头会被当作手机号登录标识
+	if base == "" || strings.HasPrefix(base, "00") {
+		base = "user" + base
+	}
+	name := base
+	for i := 0; i < 5; i++ {
+		existed, err := dao.GetUserByName(name)
+		if err != nil {
+			return "", fmt.Errorf("oidcUserName|%v", err)
+		}
+		if existed == nil {
+			return name, nil
+		}
+		suffix, err := utils.RandomToken(3)
+		if err != nil {
+			return "", err
+		}
+		name = base + "_" + suffix
+	}
+	return "", fmt.Errorf("oidcUserName|can not find a free user name for %s", base)
+}
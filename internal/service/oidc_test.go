@@ -0,0 +1,233 @@
+package service
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v3"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIssuer 测试用的身份提供方，提供服务发现、JWKS 和令牌端点，授权码由用例预先登记
+type mockIssuer struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]map[string]interface{} // 授权码 -> ID token 中的 claims
+}
+
+var testIssuer *mockIssuer
+
+func newMockIssuer() *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	m := &mockIssuer{key: key, codes: map[string]map[string]interface{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	testIssuer = m
+	return m
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                m.URL,
+		"authorization_endpoint":                m.URL + "/authorize",
+		"token_endpoint":                        m.URL + "/token",
+		"jwks_uri":                              m.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &m.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+	}})
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	claims, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	if !ok || r.PostForm.Get("code_verifier") == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	payload := map[string]interface{}{
+		"iss": m.URL,
+		"aud": "gous",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	raw, _ := json.Marshal(payload)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jws, err := signer.Sign(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := jws.CompactSerialize()
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// issueCode 登记一个授权码，换取令牌时签发带有 claims 的 ID token
+func (m *mockIssuer) issueCode(code string, claims map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = claims
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// startOidcLogin 发起登录，返回 state 和跳转地址中的 nonce
+func startOidcLogin(t *testing.T) (state, nonce string) {
+	t.Helper()
+	authURL, state, err := OidcAuthURL("mock", "")
+	if err != nil {
+		t.Fatalf("OidcAuthURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, testIssuer.URL+"/authorize") || u.Query().Get("state") != state {
+		t.Fatalf("unexpected auth url %s", authURL)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("auth url without PKCE: %s", authURL)
+	}
+	return state, u.Query().Get("nonce")
+}
+
+func TestOidcCallbackStateMismatch(t *testing.T) {
+	ctx := context.Background()
+	if _, err := OidcCallback(ctx, "mock", "unknown-state", "code"); err == nil || !strings.Contains(err.Error(), "expired or invalid") {
+		t.Fatalf("unknown state: got %v", err)
+	}
+
+	state, nonce := startOidcLogin(t)
+	testIssuer.issueCode("state-mismatch", map[string]interface{}{"sub": "state-1", "nonce": nonce})
+	if _, err := OidcCallback(ctx, "other", state, "state-mismatch"); err == nil || !strings.Contains(err.Error(), "provider mismatch") {
+		t.Fatalf("state of another provider: got %v", err)
+	}
+	// state 只能使用一次，校验失败后也已被删除
+	if _, err := OidcCallback(ctx, "mock", state, "state-mismatch"); err == nil || !strings.Contains(err.Error(), "expired or invalid") {
+		t.Fatalf("reused state: got %v", err)
+	}
+}
+
+func TestOidcCallbackNonceMismatch(t *testing.T) {
+	state, _ := startOidcLogin(t)
+	testIssuer.issueCode("nonce-mismatch", map[string]interface{}{"sub": "nonce-1", "nonce": "forged", "preferred_username": "nonce_user"})
+	if _, err := OidcCallback(context.Background(), "mock", state, "nonce-mismatch"); err == nil || !strings.Contains(err.Error(), "oidc login failed") {
+		t.Fatalf("nonce mismatch: got %v", err)
+	}
+	if u, _ := dao.GetUserByName("nonce_user"); u != nil {
+		t.Fatal("user provisioned despite nonce mismatch")
+	}
+}
+
+func TestOidcCallbackProvision(t *testing.T) {
+	ctx := context.Background()
+	claims := map[string]interface{}{
+		"sub":                "jit-1",
+		"email":              "Jit.User@Example.com",
+		"email_verified":     true,
+		"preferred_username": "jit.user@example.com",
+		"name":               "Jit User",
+	}
+
+	state, nonce := startOidcLogin(t)
+	claims["nonce"] = nonce
+	testIssuer.issueCode("jit-first", claims)
+	session, err := OidcCallback(ctx, "mock", state, "jit-first")
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	sessionUser, err := cache.GetSessionInfo(session)
+	if err != nil {
+		t.Fatalf("session not saved: %v", err)
+	}
+	user, err := dao.GetUserByName("jit.user")
+	if err != nil || user == nil {
+		t.Fatalf("user not provisioned: %v", err)
+	}
+	if sessionUser.Name != user.Name || user.NickName != "Jit User" || user.Email == nil || *user.Email != "jit.user@example.com" || !user.EmailVerified {
+		t.Fatalf("unexpected provisioned user %+v", user)
+	}
+
+	// 再次登录时按已绑定的身份找到同一个账号，不重复开户
+	state, nonce = startOidcLogin(t)
+	claims["nonce"] = nonce
+	testIssuer.issueCode("jit-second", claims)
+	session, err = OidcCallback(ctx, "mock", state, "jit-second")
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if sessionUser, err = cache.GetSessionInfo(session); err != nil || sessionUser.ID != user.ID {
+		t.Fatalf("second login got user %+v, err %v, want id %d", sessionUser, err, user.ID)
+	}
+}
+
+func TestOidcCallbackEmailCollision(t *testing.T) {
+	existing := createTestUser(t, &model.User{Name: "collision_owner", Email: strPtr("owner@example.com"), EmailVerified: true})
+
+	state, nonce := startOidcLogin(t)
+	testIssuer.issueCode("collision", map[string]interface{}{
+		"sub":                "collision-1",
+		"email":              "OWNER@example.com",
+		"email_verified":     true,
+		"preferred_username": "collision_attacker",
+		"nonce":              nonce,
+	})
+	_, err := OidcCallback(context.Background(), "mock", state, "collision")
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("email collision: got %v, want already registered", err)
+	}
+	if u, _ := dao.GetUserByName("collision_attacker"); u != nil {
+		t.Fatal("account created for a colliding email")
+	}
+	if identity, _ := dao.GetUserIdentity("mock", "collision-1"); identity != nil {
+		t.Fatalf("identity linked to user %d", identity.UserID)
+	}
+	if owner, _ := dao.GetUserByID(existing.ID); owner == nil || owner.Name != "collision_owner" {
+		t.Fatal("existing account modified")
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/otp"
+	"Gous/pkg/constant"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"math/big"
+	"time"
+)
+
+// otpTarget 解析验证码登录的标识，只支持邮箱和手机号，返回发送渠道和缓存中使用的标识
+func otpTarget(ident string) (kind, value, channel string, err error) {
+	kind, value, err = parseIdent(ident)
+	if err != nil {
+		return "", "", "", err
+	}
+	switch kind {
+	case constant.IdentEmail:
+		channel = otp.ChannelEmail
+	case constant.IdentPhone:
+		channel = otp.ChannelSms
+	default:
+		return "", "", "", fmt.Errorf("one-time code login requires email or phone")
+	}
+	return kind, value, channel, nil
+}
+
+// generateOtpCode 生成 6 位数字验证码
+func generateOtpCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOtpCode 验证码只以摘要形式保存，拼上标识防止不同用户的摘要可以互相比对
+func hashOtpCode(target, code string) string {
+	sum := sha256.Sum256([]byte(target + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// SendOtp 向邮箱或手机号发送登录验证码。标识未注册时同样返回成功，避免被用来探测账号是否存在
+func SendOtp(ctx context.Context, req *OtpSendRequest) error {
+	conf := config.GetGlobalConf().Otp
+	if !conf.Enabled {
+		return fmt.Errorf("one-time code login is disabled")
+	}
+	kind, value, channel, err := otpTarget(req.Identifier)
+	if err != nil {
+		return err
+	}
+	target := kind + "_" + value
+
+	ok, err := cache.AcquireOtpCooldown(target, time.Duration(conf.ResendCooldown)*time.Second)
+	if err != nil {
+		return fmt.Errorf("SendOtp|check cooldown err: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("code sent too frequently, please try again later")
+	}
+
+	user, err := dao.GetUserByIdent(kind, value)
+	if err != nil {
+		return fmt.Errorf("SendOtp|%v", err)
+	}
+	if user == nil {
+		log.Infof("SendOtp|%s %s not registered, skip", kind, value)
+		return nil
+	}
+
+	code, err := generateOtpCode()
+	if err != nil {
+		return fmt.Errorf("SendOtp|generate code err: %v", err)
+	}
+	ttl := time.Duration(conf.CodeTTL) * time.Second
+	if err := cache.SetOtpCode(target, hashOtpCode(target, code), ttl); err != nil {
+		return fmt.Errorf("SendOtp|save code err: %v", err)
+	}
+	if err := otp.Send(ctx, &otp.Message{Channel: channel, To: value, Code: code, TTL: ttl}); err != nil {
+		log.Errorf("SendOtp|send %s code to %s err: %v", channel, value, err)
+		_ = cache.DelOtpCode(target)
+		return fmt.Errorf("send code failed")
+	}
+	log.Infof("SendOtp|user %s code sent via %s", user.Name, channel)
+	return nil
+}
+
+// VerifyOtp 校验验证码，通过后视为邮箱或手机号已验证，并与密码登录一样创建会话
+func VerifyOtp(ctx context.Context, req *OtpVerifyRequest) (string, error) {
+	conf := config.GetGlobalConf().Otp
+	if !conf.Enabled {
+		return "", fmt.Errorf("one-time code login is disabled")
+	}
+	kind, value, _, err := otpTarget(req.Identifier)
+	if err != nil {
+		return "", err
+	}
+	target := kind + "_" + value
+
+	attempts, codeHash, err := cache.IncrOtpAttempt(target)
+	if errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("code invalid or expired")
+	}
+	if err != nil {
+		return "", fmt.Errorf("VerifyOtp|%v", err)
+	}
+	if attempts > conf.MaxAttempts {
+		_ = cache.DelOtpCode(target)
+		err = fmt.Errorf("too many attempts, please request a new code")
+		audit.Record(ctx, &audit.Event{Action: constant.AuditLogin, Actor: req.Identifier, Target: req.Identifier, Err: err})
+		recordLoginFailure(ctx, req.Identifier, loginMethodOtp, err)
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashOtpCode(target, req.Code)), []byte(codeHash)) != 1 {
+		log.Errorf("VerifyOtp|%s wrong code, attempts=%d", target, attempts)
+		err = fmt.Errorf("code invalid or expired")
+		audit.Record(ctx, &audit.Event{Action: constant.AuditLogin, Actor: req.Identifier, Target: req.Identifier, Err: err})
+		recordLoginFailure(ctx, req.Identifier, loginMethodOtp, err)
+		return "", err
+	}
+	_ = cache.DelOtpCode(target)
+
+	user, err := dao.GetUserByIdent(kind, value)
+	if err != nil {
+		return "", fmt.Errorf("VerifyOtp|%v", err)
+	}
+	if user == nil {
+		return "", fmt.Errorf("user not found")
+	}
+
+	// 能收到验证码即证明持有该邮箱或手机号
+	columns := map[string]interface{}{}
+	if kind == constant.IdentEmail && !user.EmailVerified {
+		columns["email_verified"] = true
+		user.EmailVerified = true
+		if user.Status == constant.UserStatusPending {
+			columns["status"] = constant.UserStatusActive
+			user.Status = constant.UserStatusActive
+		}
+	}
+	if kind == constant.IdentPhone && !user.PhoneVerified {
+		columns["phone_verified"] = true
+		user.PhoneVerified = true
+	}
+	if len(columns) > 0 {
+		if err := dao.UpdateUserColumns(user.ID, columns); err != nil {
+			return "", fmt.Errorf("VerifyOtp|%v", err)
+		}
+		if err := cache.DelUserCacheInfo(user); err != nil {
+			log.Errorf("VerifyOtp|DelUserCacheInfo err:%v", err)
+		}
+	}
+
+	session, err := createSession(ctx, user, loginMethodOtp)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("VerifyOtp|user %s login by %s code", user.Name, kind)
+	return session, nil
+}
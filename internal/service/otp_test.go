@@ -0,0 +1,143 @@
+package service
+
+import (
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/otp"
+	"Gous/pkg/constant"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendOtpCooldown(t *testing.T) {
+	createTestUser(t, &model.User{Name: "otp_cooldown", Email: strPtr("cooldown@example.com"), EmailVerified: true})
+	req := &OtpSendRequest{Identifier: "cooldown@example.com"}
+
+	if err := SendOtp(context.Background(), req); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	first, ok := otp.Fake.LastCode("cooldown@example.com")
+	if !ok {
+		t.Fatal("code was not sent")
+	}
+	if err := SendOtp(context.Background(), req); err == nil || !strings.Contains(err.Error(), "too frequently") {
+		t.Fatalf("send within cooldown: got %v, want too frequently", err)
+	}
+
+	testRedis.FastForward(61 * time.Second)
+	if err := SendOtp(context.Background(), req); err != nil {
+		t.Fatalf("send after cooldown: %v", err)
+	}
+	// 重新发送后旧验证码失效
+	second, _ := otp.Fake.LastCode("cooldown@example.com")
+	if second != first {
+		if _, err := VerifyOtp(context.Background(), &OtpVerifyRequest{Identifier: req.Identifier, Code: first}); err == nil {
+			t.Fatal("previous code still accepted after resend")
+		}
+	}
+}
+
+func TestSendOtpUnknownIdentifier(t *testing.T) {
+	for _, ident := range []string{"nobody@example.com", "+8613900000001"} {
+		req := &OtpSendRequest{Identifier: ident}
+		// 未注册的标识与已注册的一样返回成功，也同样受冷却时间限制
+		if err := SendOtp(context.Background(), req); err != nil {
+			t.Fatalf("%s: first send: %v", ident, err)
+		}
+		if err := SendOtp(context.Background(), req); err == nil || !strings.Contains(err.Error(), "too frequently") {
+			t.Fatalf("%s: send within cooldown: got %v, want too frequently", ident, err)
+		}
+		if _, ok := otp.Fake.LastCode(strings.TrimSpace(ident)); ok {
+			t.Fatalf("%s: code sent to an unregistered identifier", ident)
+		}
+	}
+}
+
+func TestSendOtpRejectsUserName(t *testing.T) {
+	if err := SendOtp(context.Background(), &OtpSendRequest{Identifier: "someone"}); err == nil {
+		t.Fatal("user name accepted as otp identifier")
+	}
+}
+
+func TestVerifyOtpAttemptsExhausted(t *testing.T) {
+	createTestUser(t, &model.User{Name: "otp_attempts", Email: strPtr("attempts@example.com"), EmailVerified: true})
+	ident := "attempts@example.com"
+	if err := SendOtp(context.Background(), &OtpSendRequest{Identifier: ident}); err != nil {
+		t.Fatal(err)
+	}
+	code, _ := otp.Fake.LastCode(ident)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	// max_attempts 为 3，前三次错误的验证码只返回无效
+	for i := 1; i <= 3; i++ {
+		_, err := VerifyOtp(context.Background(), &OtpVerifyRequest{Identifier: ident, Code: wrong})
+		if err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Fatalf("attempt %d: got %v, want invalid code", i, err)
+		}
+	}
+	// 超过次数后即使验证码正确也失败，并且验证码被删除
+	if _, err := VerifyOtp(context.Background(), &OtpVerifyRequest{Identifier: ident, Code: code}); err == nil || !strings.Contains(err.Error(), "too many attempts") {
+		t.Fatalf("attempt 4: got %v, want too many attempts", err)
+	}
+	if _, err := VerifyOtp(context.Background(), &OtpVerifyRequest{Identifier: ident, Code: code}); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("after exhaustion: got %v, want expired", err)
+	}
+}
+
+func TestVerifyOtpMarksVerified(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  *model.User
+		ident string
+		check func(u *model.User) bool
+	}{
+		{
+			name:  "email",
+			user:  &model.User{Name: "otp_email", Email: strPtr("pending@example.com"), Status: constant.UserStatusPending},
+			ident: "pending@example.com",
+			check: func(u *model.User) bool { return u.EmailVerified && u.Status == constant.UserStatusActive },
+		},
+		{
+			name:  "phone",
+			user:  &model.User{Name: "otp_phone", Phone: strPtr("+8613900000002")},
+			ident: "+86 139-0000-0002",
+			check: func(u *model.User) bool { return u.PhoneVerified && !u.EmailVerified },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, tt.user)
+			if err := SendOtp(context.Background(), &OtpSendRequest{Identifier: tt.ident}); err != nil {
+				t.Fatal(err)
+			}
+			_, value, _, _ := otpTarget(tt.ident)
+			code, ok := otp.Fake.LastCode(value)
+			if !ok {
+				t.Fatal("code was not sent")
+			}
+			session, err := VerifyOtp(context.Background(), &OtpVerifyRequest{Identifier: tt.ident, Code: code})
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if session == "" {
+				t.Fatal("no session created")
+			}
+			saved, err := dao.GetUserByID(user.ID)
+			if err != nil || saved == nil {
+				t.Fatalf("reload user: %v", err)
+			}
+			if !tt.check(saved) {
+				t.Fatalf("user not marked verified: %+v", saved)
+			}
+			// 验证码只能使用一次
+			if _, err := VerifyOtp(context.Background(), &OtpVerifyRequest{Identifier: tt.ident, Code: code}); err == nil {
+				t.Fatal("code accepted twice")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"Gous/internal/audit"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/pkg/constant"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ListOutboxDeadEvents 分页查询发布次数用尽的领域事件，按时间倒序
+func ListOutboxDeadEvents(req *ListOutboxDeadEventsRequest) (*OutboxEventListResponse, error) {
+	page, size := req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 20
+	} else if size > 100 {
+		size = 100
+	}
+	list, total, err := dao.FindDeadOutboxEvents((page-1)*size, size)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &OutboxEventListResponse{Total: total, Items: make([]*OutboxEventResponse, 0, len(list))}
+	for _, e := range list {
+		rsp.Items = append(rsp.Items, outboxEventResponse(e))
+	}
+	return rsp, nil
+}
+
+// RetryOutboxEvent 死信事件重新发布。该用户之后的事件可能已经发布，消费方收到的顺序会与产生顺序不同
+func RetryOutboxEvent(ctx context.Context, id int64) error {
+	e, err := dao.GetOutboxEvent(id)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return fmt.Errorf("event %d not found", id)
+	}
+	if e.DeadAt == nil || e.PublishedAt != nil {
+		return fmt.Errorf("event %d is not dead", id)
+	}
+	if err := dao.RequeueOutboxEvent(id, time.Now()); err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditOutboxRetry,
+		Actor:   constant.AuditActorAdmin,
+		Target:  fmt.Sprintf("outbox_event:%d", e.ID),
+		Changes: map[string]audit.Change{"event_id": {To: e.EventID}, "user_id": {To: e.AggregateID}, "attempts": {From: e.Attempts, To: 0}},
+	})
+	return nil
+}
+
+func outboxEventResponse(e *model.OutboxEvent) *OutboxEventResponse {
+	rsp := &OutboxEventResponse{
+		ID:          e.ID,
+		EventID:     e.EventID,
+		EventType:   e.EventType,
+		AggregateID: e.AggregateID,
+		Attempts:    e.Attempts,
+		LastError:   e.LastError,
+		DeadAt:      e.DeadAt,
+		CreateTime:  e.CreateTime,
+	}
+	if json.Valid([]byte(e.Payload)) {
+		rsp.Payload = json.RawMessage(e.Payload)
+	}
+	return rsp
+}
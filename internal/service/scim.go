@@ -0,0 +1,829 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/erasure"
+	"Gous/internal/fieldcrypt"
+	"Gous/internal/model"
+	"Gous/internal/scim"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// scimUserAttrs 支持过滤的用户属性及对应字段
+var scimUserAttrs = map[string]scim.Attr{
+	"id":                 {Column: "id"},
+	"username":           {Column: "name"},
+	"externalid":         {Column: "external_id"},
+	"displayname":        {Expr: scimEncryptedExpr("nickname", false)},
+	"name.formatted":     {Expr: scimEncryptedExpr("nickname", false)},
+	"emails":             {Expr: scimEncryptedExpr("email", true)},
+	"emails.value":       {Expr: scimEncryptedExpr("email", true)},
+	"phonenumbers":       {Expr: scimEncryptedExpr("phone", true)},
+	"phonenumbers.value": {Expr: scimEncryptedExpr("phone", true)},
+	"meta.created":       {Column: "create_time"},
+	"meta.lastmodified":  {Column: "update_time"},
+	"active":             {Expr: scimActiveExpr},
+}
+
+// scimGroupAttrs 支持过滤的组属性及对应字段
+var scimGroupAttrs = map[string]scim.Attr{
+	"id":                {Column: "id"},
+	"displayname":       {Column: "display_name"},
+	"externalid":        {Column: "external_id"},
+	"meta.created":      {Column: "create_time"},
+	"meta.lastmodified": {Column: "update_time"},
+	"members":           {Expr: scimMemberExpr},
+	"members.value":     {Expr: scimMemberExpr},
+}
+
+// scimActiveExpr active 对应账号是否未被停用
+func scimActiveExpr(op string, value interface{}) (string, []interface{}, error) {
+	active, ok := value.(bool)
+	if op == "pr" {
+		return "1 = 1", nil, nil
+	}
+	if !ok || op != "eq" && op != "ne" {
+		return "", nil, scim.NewError(http.StatusBadRequest, "invalidFilter", "active only supports eq/ne with a boolean")
+	}
+	if op == "ne" {
+		active = !active
+	}
+	if active {
+		return "status <> ?", []interface{}{constant.UserStatusSuspended}, nil
+	}
+	return "status = ?", []interface{}{constant.UserStatusSuspended}, nil
+}
+
+// scimEncryptedExpr 加密保存的字段，开启加密后只支持 pr，有盲索引的字段另外支持 eq、ne
+func scimEncryptedExpr(column string, indexed bool) func(op string, value interface{}) (string, []interface{}, error) {
+	return func(op string, value interface{}) (string, []interface{}, error) {
+		if !fieldcrypt.Enabled() || op == "pr" || value == nil && (op == "eq" || op == "ne") {
+			return scim.ColumnSQL(column, op, value)
+		}
+		if !indexed {
+			return "", nil, scim.NewError(http.StatusBadRequest, "invalidFilter", "%s is encrypted and only supports pr", column)
+		}
+		s, ok := value.(string)
+		if !ok || op != "eq" && op != "ne" {
+			return "", nil, scim.NewError(http.StatusBadRequest, "invalidFilter", "%s is encrypted and only supports pr, eq/ne with a string", column)
+		}
+		where, args, err := dao.UserColumnEqual(column, s)
+		if err != nil {
+			return "", nil, err
+		}
+		if op == "ne" {
+			where = "(" + column + " IS NOT NULL AND NOT " + where + ")"
+		}
+		return where, args, nil
+	}
+}
+
+// scimMemberExpr 按成员查询所在的组
+func scimMemberExpr(op string, value interface{}) (string, []interface{}, error) {
+	if op == "pr" {
+		return "id IN (SELECT group_id FROM t_group_member)", nil, nil
+	}
+	id, ok := value.(string)
+	if !ok || op != "eq" {
+		return "", nil, scim.NewError(http.StatusBadRequest, "invalidFilter", "members only supports eq with a user id")
+	}
+	return "id IN (SELECT group_id FROM t_group_member WHERE user_id = ?)", []interface{}{id}, nil
+}
+
+// scimPage 把 SCIM 的 startIndex（从 1 开始）和 count 转换为 offset、limit
+func scimPage(startIndex, count int) (int, int, int) {
+	max := config.GetGlobalConf().Scim.MaxResults
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count == 0 || count > max {
+		count = max
+	}
+	return startIndex, startIndex - 1, count
+}
+
+// scimWhere 解析过滤条件并转换为 SQL
+func scimWhere(filter string, attrs map[string]scim.Attr) (string, []interface{}, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", nil, nil
+	}
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	return f.ToSQL(attrs)
+}
+
+// scimCheckVersion 校验 If-Match，不带或为 * 时不校验；弱比较，忽略 W/ 前缀
+func scimCheckVersion(ifMatch, version string) error {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(version, "W/") {
+			return nil
+		}
+	}
+	return scim.ErrPreconditionFailed
+}
+
+func scimID(id string) (int, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil || n <= 0 {
+		return 0, scim.ErrNotFound
+	}
+	return n, nil
+}
+
+func scimConflict(format string, args ...interface{}) error {
+	return scim.NewError(http.StatusConflict, "uniqueness", format, args...)
+}
+
+func scimInvalid(format string, args ...interface{}) error {
+	return scim.NewError(http.StatusBadRequest, "invalidValue", format, args...)
+}
+
+// scimUser 把用户转换为 SCIM 资源
+func scimUser(base string, u *model.User, groups []*dao.GroupMemberInfo) (*scim.User, error) {
+	id := strconv.Itoa(u.ID)
+	active := u.Status != constant.UserStatusSuspended
+	res := &scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          id,
+		UserName:    u.Name,
+		DisplayName: u.NickName,
+		Active:      &active,
+	}
+	if u.ExternalID != nil {
+		res.ExternalID = *u.ExternalID
+	}
+	if u.NickName != "" {
+		res.Name = &scim.Name{Formatted: u.NickName}
+	}
+	if u.Email != nil {
+		res.Emails = []scim.MultiValue{{Value: *u.Email, Type: "work", Primary: true}}
+	}
+	if u.Phone != nil {
+		res.PhoneNumbers = []scim.MultiValue{{Value: *u.Phone, Type: "work", Primary: true}}
+	}
+	for _, g := range groups {
+		gid := strconv.Itoa(g.GroupID)
+		res.Groups = append(res.Groups, scim.Ref{Value: gid, Ref: base + "/Groups/" + gid, Display: g.DisplayName})
+	}
+	created, modified := u.CreateTime, u.UpdateTime
+	if modified.IsZero() {
+		modified = created
+	}
+	res.Meta = &scim.Meta{ResourceType: "User", Created: &created, LastModified: &modified, Location: base + "/Users/" + id}
+	version, err := scim.Version(res)
+	if err != nil {
+		return nil, err
+	}
+	res.Meta.Version = version
+	return res, nil
+}
+
+// scimUserByID 查询用户并转换为 SCIM 资源
+func scimUserByID(base, id string) (*model.User, *scim.User, error) {
+	uid, err := scimID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := dao.GetUserByID(uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, scim.ErrNotFound
+	}
+	groups, err := dao.ListGroupMembers(nil, []int{uid})
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := scimUser(base, user, groups)
+	return user, res, err
+}
+
+// ScimListUsers 查询用户，支持过滤和分页
+func ScimListUsers(base, filter string, startIndex, count int) (*scim.ListResponse, error) {
+	where, args, err := scimWhere(filter, scimUserAttrs)
+	if err != nil {
+		return nil, err
+	}
+	start, offset, limit := scimPage(startIndex, count)
+	users, total, err := dao.FindUsers(where, args, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	groupsOf := map[int][]*dao.GroupMemberInfo{}
+	if len(users) > 0 {
+		ids := make([]int, 0, len(users))
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		members, err := dao.ListGroupMembers(nil, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			groupsOf[m.UserID] = append(groupsOf[m.UserID], m)
+		}
+	}
+	resources := make([]*scim.User, 0, len(users))
+	for _, u := range users {
+		res, err := scimUser(base, u, groupsOf[u.ID])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+	return &scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+// ScimGetUser 查询单个用户
+func ScimGetUser(base, id string) (*scim.User, error) {
+	_, res, err := scimUserByID(base, id)
+	return res, err
+}
+
+// scimUserFields 从 SCIM 资源中取出并校验要保存的字段
+type scimUserFields struct {
+	name       string
+	externalID *string
+	nickName   string
+	email      *string
+	phone      *string
+	active     bool
+	password   string
+}
+
+func parseScimUser(in *scim.User) (*scimUserFields, error) {
+	f := &scimUserFields{name: strings.TrimSpace(in.UserName), active: in.Active == nil || *in.Active, password: in.Password}
+	if f.name == "" || len(f.name) > 100 {
+		return nil, scimInvalid("userName is required and must be at most 100 characters")
+	}
+	if in.ExternalID != "" {
+		ext := in.ExternalID
+		f.externalID = &ext
+	}
+	f.nickName = in.DisplayName
+	if f.nickName == "" && in.Name != nil {
+		f.nickName = in.Name.Formatted
+		if f.nickName == "" {
+			f.nickName = strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+		}
+	}
+	if v := primaryValue(in.Emails); v != "" {
+		email, err := normalizeEmail(v)
+		if err != nil {
+			return nil, scimInvalid("%v", err)
+		}
+		f.email = &email
+	}
+	if v := primaryValue(in.PhoneNumbers); v != "" {
+		phone, err := normalizePhone(v)
+		if err != nil {
+			return nil, scimInvalid("%v", err)
+		}
+		f.phone = &phone
+	}
+	return f, nil
+}
+
+// primaryValue 多值属性中 primary 的值，没有时取第一个
+func primaryValue(values []scim.MultiValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return v.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// scimCheckUnique 用户名、邮箱、手机号不能被其他账号占用
+func scimCheckUnique(f *scimUserFields, selfID int) error {
+	if u, err := dao.GetUserByName(f.name); err != nil {
+		return err
+	} else if u != nil && u.ID != selfID {
+		return scimConflict("userName %s already exists", f.name)
+	}
+	if f.email != nil {
+		if u, err := dao.GetUserByEmail(*f.email); err != nil {
+			return err
+		} else if u != nil && u.ID != selfID {
+			return scimConflict("email %s already belongs to another user", *f.email)
+		}
+	}
+	if f.phone != nil {
+		if u, err := dao.GetUserByPhone(*f.phone); err != nil {
+			return err
+		} else if u != nil && u.ID != selfID {
+			return scimConflict("phone %s already belongs to another user", *f.phone)
+		}
+	}
+	return nil
+}
+
+// ScimCreateUser 创建用户，身份提供方提供的邮箱、手机号视为已验证
+func ScimCreateUser(ctx context.Context, base string, in *scim.User) (*scim.User, error) {
+	f, err := parseScimUser(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := scimCheckUnique(f, 0); err != nil {
+		return nil, err
+	}
+	password := f.password
+	if password == "" {
+		// 未提供密码时设置随机密码，账号通过第三方登录或验证码登录
+		if password, err = utils.RandomToken(16); err != nil {
+			return nil, err
+		}
+	}
+	status := constant.UserStatusActive
+	if !f.active {
+		status = constant.UserStatusSuspended
+	}
+	user := &model.User{
+		CreateModel:   model.CreateModel{Creator: constant.UserSourceScim},
+		ModifyModel:   model.ModifyModel{Modifier: constant.UserSourceScim},
+		Name:          f.name,
+		PassWord:      password,
+		NickName:      f.nickName,
+		Email:         f.email,
+		EmailVerified: f.email != nil,
+		Phone:         f.phone,
+		PhoneVerified: f.phone != nil,
+		Status:        status,
+		Source:        constant.UserSourceScim,
+		Role:          constant.RoleUser,
+		ExternalID:    f.externalID,
+	}
+	if err := dao.CreateUser(user, userOutbox(constant.EventUserCreated)); err != nil {
+		return nil, err
+	}
+	log.Infof("ScimCreateUser|created user %s (id=%d, active=%v)", user.Name, user.ID, f.active)
+	audit.Record(ctx, &audit.Event{
+		Action: constant.AuditScimUserCreate,
+		Actor:  constant.UserSourceScim,
+		Target: user.Name,
+		Changes: map[string]audit.Change{
+			"name":        {To: user.Name},
+			"nickname":    {To: user.NickName},
+			"external_id": {To: user.ExternalID},
+			"email":       {To: user.Email},
+			"phone":       {To: user.Phone},
+			"status":      {To: user.Status},
+		},
+	})
+	emitUserEvent(constant.EventUserCreated, user)
+	return scimUser(base, user, nil)
+}
+
+// ScimReplaceUser 整体替换用户属性，未提供的可选属性被清空，未提供密码时保留原密码
+func ScimReplaceUser(ctx context.Context, base, id, ifMatch string, in *scim.User) (*scim.User, error) {
+	user, current, err := scimUserByID(base, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := scimCheckVersion(ifMatch, current.Meta.Version); err != nil {
+		return nil, err
+	}
+	f, err := parseScimUser(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveScimUser(ctx, user, f); err != nil {
+		return nil, err
+	}
+	return ScimGetUser(base, id)
+}
+
+// ScimPatchUser 按 PATCH 操作修改用户
+func ScimPatchUser(ctx context.Context, base, id, ifMatch string, req *scim.PatchRequest) (*scim.User, error) {
+	user, current, err := scimUserByID(base, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := scimCheckVersion(ifMatch, current.Meta.Version); err != nil {
+		return nil, err
+	}
+	doc, err := scim.ToMap(current)
+	if err != nil {
+		return nil, err
+	}
+	if err := scim.ApplyPatch(doc, req.Operations); err != nil {
+		return nil, err
+	}
+	// 部分身份提供方把 active 作为字符串 "False" 传递
+	for k, v := range doc {
+		if strings.EqualFold(k, "active") {
+			if s, ok := v.(string); ok {
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, scimInvalid("active must be a boolean")
+				}
+				doc[k] = b
+			}
+		}
+	}
+	patched := &scim.User{}
+	if err := scim.FromMap(doc, patched); err != nil {
+		return nil, err
+	}
+	f, err := parseScimUser(patched)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveScimUser(ctx, user, f); err != nil {
+		return nil, err
+	}
+	return ScimGetUser(base, id)
+}
+
+// saveScimUser 保存变更的字段；停用或改名时删除用户的全部会话
+func saveScimUser(ctx context.Context, user *model.User, f *scimUserFields) error {
+	if err := scimCheckUnique(f, user.ID); err != nil {
+		return err
+	}
+	columns := map[string]interface{}{}
+	if f.name != user.Name {
+		columns["name"] = f.name
+	}
+	if f.nickName != user.NickName {
+		columns["nickname"] = f.nickName
+	}
+	if !sameString(f.externalID, user.ExternalID) {
+		columns["external_id"] = f.externalID
+	}
+	if !sameString(f.email, user.Email) {
+		columns["email"] = f.email
+		columns["email_verified"] = f.email != nil
+	}
+	if !sameString(f.phone, user.Phone) {
+		columns["phone"] = f.phone
+		columns["phone_verified"] = f.phone != nil
+	}
+	suspended := user.Status == constant.UserStatusSuspended
+	if f.active && suspended {
+		columns["status"] = constant.UserStatusActive
+	} else if !f.active && !suspended {
+		columns["status"] = constant.UserStatusSuspended
+	}
+	if f.password != "" && f.password != user.PassWord {
+		columns["password"] = f.password
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	// 审计日志中密码只记录修改过
+	old := map[string]interface{}{
+		"name": user.Name, "nickname": user.NickName, "external_id": user.ExternalID, "email": user.Email,
+		"email_verified": user.EmailVerified, "phone": user.Phone, "phone_verified": user.PhoneVerified, "status": user.Status,
+	}
+	changes := map[string]audit.Change{}
+	fields := make([]string, 0, len(columns))
+	for k, v := range columns {
+		fields = append(fields, k)
+		if k == "password" {
+			changes[k] = audit.Change{From: "******", To: "******"}
+			continue
+		}
+		changes[k] = audit.Change{From: old[k], To: v}
+	}
+	columns["modifier"] = constant.UserSourceScim
+	if err := dao.UpdateUserColumns(user.ID, columns, userOutbox(constant.EventUserUpdated, fields...)); err != nil {
+		return err
+	}
+	if err := cache.DelUserCacheInfo(user); err != nil {
+		log.Errorf("saveScimUser|del user cache err:%v", err)
+	}
+	if _, ok := columns["name"]; ok || !f.active || columns["password"] != nil {
+		if err := cache.DelUserSessions(user.Name); err != nil {
+			log.Errorf("saveScimUser|revoke sessions of %s err:%v", user.Name, err)
+		}
+	}
+	// 密码不写入日志
+	delete(columns, "password")
+	log.Infof("saveScimUser|user %s (id=%d) updated: %v", user.Name, user.ID, columns)
+	audit.Record(ctx, &audit.Event{Action: constant.AuditScimUserUpdate, Actor: constant.UserSourceScim, Target: user.Name, Changes: changes})
+	if updated, err := dao.GetUserByID(user.ID); err == nil && updated != nil {
+		emitUserEvent(constant.EventUserUpdated, updated, fields...)
+	}
+	return nil
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ScimDeleteUser 删除用户及其会话
+func ScimDeleteUser(ctx context.Context, base, id, ifMatch string) error {
+	user, current, err := scimUserByID(base, id)
+	if err != nil {
+		return err
+	}
+	if err := scimCheckVersion(ifMatch, current.Meta.Version); err != nil {
+		return err
+	}
+	_, err = eraseUser(ctx, user, erasure.RequesterScim, &audit.Event{
+		Action: constant.AuditScimUserDelete,
+		Actor:  constant.UserSourceScim,
+		Target: user.Name,
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("ScimDeleteUser|deleted user %s (id=%d)", user.Name, user.ID)
+	return nil
+}
+
+// scimGroup 把组转换为 SCIM 资源
+func scimGroup(base string, g *model.Group, members []*dao.GroupMemberInfo) (*scim.Group, error) {
+	id := strconv.Itoa(g.ID)
+	res := &scim.Group{Schemas: []string{scim.SchemaGroup}, ID: id, DisplayName: g.DisplayName}
+	if g.ExternalID != nil {
+		res.ExternalID = *g.ExternalID
+	}
+	for _, m := range members {
+		uid := strconv.Itoa(m.UserID)
+		res.Members = append(res.Members, scim.Ref{Value: uid, Ref: base + "/Users/" + uid, Display: m.UserName})
+	}
+	created, modified := g.CreateTime, g.UpdateTime
+	res.Meta = &scim.Meta{ResourceType: "Group", Created: &created, LastModified: &modified, Location: base + "/Groups/" + id}
+	version, err := scim.Version(res)
+	if err != nil {
+		return nil, err
+	}
+	res.Meta.Version = version
+	return res, nil
+}
+
+func scimGroupByID(base, id string) (*model.Group, *scim.Group, error) {
+	gid, err := scimID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	group, err := dao.GetGroup(gid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group == nil {
+		return nil, nil, scim.ErrNotFound
+	}
+	members, err := dao.ListGroupMembers([]int{gid}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := scimGroup(base, group, members)
+	return group, res, err
+}
+
+// ScimListGroups 查询组，支持过滤和分页
+func ScimListGroups(base, filter string, startIndex, count int) (*scim.ListResponse, error) {
+	where, args, err := scimWhere(filter, scimGroupAttrs)
+	if err != nil {
+		return nil, err
+	}
+	start, offset, limit := scimPage(startIndex, count)
+	groups, total, err := dao.FindGroups(where, args, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	membersOf := map[int][]*dao.GroupMemberInfo{}
+	if len(groups) > 0 {
+		ids := make([]int, 0, len(groups))
+		for _, g := range groups {
+			ids = append(ids, g.ID)
+		}
+		members, err := dao.ListGroupMembers(ids, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			membersOf[m.GroupID] = append(membersOf[m.GroupID], m)
+		}
+	}
+	resources := make([]*scim.Group, 0, len(groups))
+	for _, g := range groups {
+		res, err := scimGroup(base, g, membersOf[g.ID])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+	return &scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+// ScimGetGroup 查询单个组
+func ScimGetGroup(base, id string) (*scim.Group, error) {
+	_, res, err := scimGroupByID(base, id)
+	return res, err
+}
+
+// ScimCreateGroup 创建组
+func ScimCreateGroup(ctx context.Context, base string, in *scim.Group) (*scim.Group, error) {
+	group := &model.Group{}
+	if err := saveScimGroup(ctx, group, in); err != nil {
+		return nil, err
+	}
+	log.Infof("ScimCreateGroup|created group %s (id=%d)", group.DisplayName, group.ID)
+	return ScimGetGroup(base, strconv.Itoa(group.ID))
+}
+
+// ScimReplaceGroup 整体替换组的名称和成员
+func ScimReplaceGroup(ctx context.Context, base, id, ifMatch string, in *scim.Group) (*scim.Group, error) {
+	group, current, err := scimGroupByID(base, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := scimCheckVersion(ifMatch, current.Meta.Version); err != nil {
+		return nil, err
+	}
+	if err := saveScimGroup(ctx, group, in); err != nil {
+		return nil, err
+	}
+	return ScimGetGroup(base, id)
+}
+
+// ScimPatchGroup 按 PATCH 操作修改组，常用于增删成员
+func ScimPatchGroup(ctx context.Context, base, id, ifMatch string, req *scim.PatchRequest) (*scim.Group, error) {
+	group, current, err := scimGroupByID(base, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := scimCheckVersion(ifMatch, current.Meta.Version); err != nil {
+		return nil, err
+	}
+	doc, err := scim.ToMap(current)
+	if err != nil {
+		return nil, err
+	}
+	if err := scim.ApplyPatch(doc, req.Operations); err != nil {
+		return nil, err
+	}
+	patched := &scim.Group{}
+	if err := scim.FromMap(doc, patched); err != nil {
+		return nil, err
+	}
+	if err := saveScimGroup(ctx, group, patched); err != nil {
+		return nil, err
+	}
+	return ScimGetGroup(base, id)
+}
+
+// saveScimGroup 校验名称和成员后保存组，并记录名称和成员的变化
+func saveScimGroup(ctx context.Context, group *model.Group, in *scim.Group) error {
+	name := strings.TrimSpace(in.DisplayName)
+	if name == "" || len(name) > 255 {
+		return scimInvalid("displayName is required and must be at most 255 characters")
+	}
+	existed, err := dao.GetGroupByName(name)
+	if err != nil {
+		return err
+	}
+	if existed != nil && existed.ID != group.ID {
+		return scimConflict("group %s already exists", name)
+	}
+
+	seen := map[int]bool{}
+	userIDs := make([]int, 0, len(in.Members))
+	for _, m := range in.Members {
+		uid, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return scimInvalid("invalid member %q", m.Value)
+		}
+		if !seen[uid] {
+			seen[uid] = true
+			userIDs = append(userIDs, uid)
+		}
+	}
+	if len(userIDs) > 0 {
+		count, err := dao.CountUsersByIDs(userIDs)
+		if err != nil {
+			return err
+		}
+		if count != int64(len(userIDs)) {
+			return scimInvalid("some members do not exist")
+		}
+	}
+
+	action, oldName, oldIDs := constant.AuditScimGroupCreate, "", []int{}
+	if group.ID != 0 {
+		members, err := dao.ListGroupMembers([]int{group.ID}, nil)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			oldIDs = append(oldIDs, m.UserID)
+		}
+		action, oldName = constant.AuditScimGroupUpdate, group.DisplayName
+	}
+
+	group.DisplayName = name
+	group.ExternalID = nil
+	if in.ExternalID != "" {
+		ext := in.ExternalID
+		group.ExternalID = &ext
+	}
+	if err := dao.SaveGroup(group, userIDs); err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action: action,
+		Actor:  constant.UserSourceScim,
+		Target: name,
+		Changes: map[string]audit.Change{
+			"display_name": {From: oldName, To: name},
+			"members":      {From: oldIDs, To: userIDs},
+		},
+	})
+	return nil
+}
+
+// ScimDeleteGroup 删除组
+func ScimDeleteGroup(ctx context.Context, base, id, ifMatch string) error {
+	group, current, err := scimGroupByID(base, id)
+	if err != nil {
+		return err
+	}
+	if err := scimCheckVersion(ifMatch, current.Meta.Version); err != nil {
+		return err
+	}
+	if err := dao.DeleteGroup(group.ID); err != nil {
+		return err
+	}
+	log.Infof("ScimDeleteGroup|deleted group %s (id=%d)", group.DisplayName, group.ID)
+	audit.Record(ctx, &audit.Event{Action: constant.AuditScimGroupDelete, Actor: constant.UserSourceScim, Target: group.DisplayName})
+	return nil
+}
+
+// ScimServiceProviderConfig 声明支持的 SCIM 特性
+func ScimServiceProviderConfig(base string) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": config.GetGlobalConf().Scim.MaxResults},
+		"changePassword": map[string]bool{"supported": true},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": true},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authorization: Bearer <scim.token>",
+			"primary":     true,
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": base + "/ServiceProviderConfig"},
+	}
+}
+
+// ScimResourceTypes 支持的资源类型
+func ScimResourceTypes(base string) []map[string]interface{} {
+	types := []map[string]interface{}{}
+	for _, rt := range []struct{ name, endpoint, schema string }{
+		{"User", "/Users", scim.SchemaUser},
+		{"Group", "/Groups", scim.SchemaGroup},
+	} {
+		types = append(types, map[string]interface{}{
+			"schemas":  []string{scim.SchemaResourceType},
+			"id":       rt.name,
+			"name":     rt.name,
+			"endpoint": rt.endpoint,
+			"schema":   rt.schema,
+			"meta":     map[string]string{"resourceType": "ResourceType", "location": base + "/ResourceTypes/" + rt.name},
+		})
+	}
+	return types
+}
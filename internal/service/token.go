@@ -0,0 +1,176 @@
+package service
+
+import (
+	"Gous/config"
+	"Gous/internal/audit"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/oauth"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// AccessTokenScopes 个人访问令牌可以申请的 scope，路由在 AuthMiddleWare 中声明需要的 scope
+var AccessTokenScopes = []string{constant.ScopeUserRead, constant.ScopeUserWrite}
+
+// touchInterval 最近使用时间的更新间隔，避免每次请求都写库
+const touchInterval = time.Minute
+
+// CreateAccessToken 为会话用户创建个人访问令牌，返回的令牌明文只展示这一次
+func CreateAccessToken(ctx context.Context, session string, req *CreateAccessTokenRequest) (*AccessTokenResponse, error) {
+	conf := config.GetGlobalConf().AccessToken
+	if !conf.Enabled {
+		return nil, fmt.Errorf("personal access tokens are disabled")
+	}
+	user, err := SessionUser(session)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("name is required and must be at most 100 characters")
+	}
+	if len(req.Scopes) == 0 || !oauth.Subset(req.Scopes, strings.Join(AccessTokenScopes, " ")) {
+		return nil, fmt.Errorf("scopes must be a non-empty subset of %v", AccessTokenScopes)
+	}
+	days := conf.DefaultTTL
+	if req.ExpiresIn != nil {
+		days = *req.ExpiresIn
+	}
+	if days < 0 || conf.MaxTTL > 0 && (days == 0 || days > conf.MaxTTL) {
+		return nil, fmt.Errorf("expires_in must be between 1 and %d days", conf.MaxTTL)
+	}
+	count, err := dao.CountAccessTokens(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= int64(conf.MaxPerUser) {
+		return nil, fmt.Errorf("at most %d access tokens per user, revoke unused ones first", conf.MaxPerUser)
+	}
+
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	raw := constant.AccessTokenPrefix + random
+	token := &model.AccessToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: oauth.HashSecret(raw),
+		Hint:      raw[:len(constant.AccessTokenPrefix)+6],
+		Scopes:    strings.Join(req.Scopes, " "),
+	}
+	if days > 0 {
+		expire := time.Now().AddDate(0, 0, days)
+		token.ExpireTime = &expire
+	}
+	if err := dao.CreateAccessToken(token); err != nil {
+		return nil, err
+	}
+	log.Infof("CreateAccessToken|user %s created token %d (%s) scope=%s", user.Name, token.ID, token.Name, token.Scopes)
+	audit.Record(ctx, &audit.Event{
+		Action: constant.AuditTokenCreate,
+		Actor:  user.Name,
+		Target: user.Name,
+		Changes: map[string]audit.Change{
+			"token_id": {To: token.ID},
+			"name":     {To: token.Name},
+			"scopes":   {To: token.Scopes},
+		},
+	})
+	rsp := accessTokenResponse(token)
+	rsp.Token = raw
+	return rsp, nil
+}
+
+// ListAccessTokens 查询会话用户的个人访问令牌
+func ListAccessTokens(session string) ([]*AccessTokenResponse, error) {
+	user, err := SessionUser(session)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := dao.ListAccessTokens(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*AccessTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		list = append(list, accessTokenResponse(t))
+	}
+	return list, nil
+}
+
+// RevokeAccessToken 撤销会话用户的个人访问令牌，立即失效
+func RevokeAccessToken(ctx context.Context, session string, id int) error {
+	user, err := SessionUser(session)
+	if err != nil {
+		return err
+	}
+	deleted, err := dao.DeleteAccessToken(user.ID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("access token %d not found", id)
+	}
+	log.Infof("RevokeAccessToken|user %s revoked token %d", user.Name, id)
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditTokenRevoke,
+		Actor:   user.Name,
+		Target:  user.Name,
+		Changes: map[string]audit.Change{"token_id": {From: id}},
+	})
+	return nil
+}
+
+// AuthenticateAccessToken 校验 Bearer 令牌，返回令牌所属用户和授予的 scope，并记录最近使用情况
+func AuthenticateAccessToken(raw, ip string) (*model.User, []string, error) {
+	if !config.GetGlobalConf().AccessToken.Enabled {
+		return nil, nil, fmt.Errorf("personal access tokens are disabled")
+	}
+	if !strings.HasPrefix(raw, constant.AccessTokenPrefix) {
+		return nil, nil, fmt.Errorf("not a personal access token")
+	}
+	token, err := dao.GetAccessTokenByHash(oauth.HashSecret(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == nil {
+		return nil, nil, fmt.Errorf("access token not found or revoked")
+	}
+	now := time.Now()
+	if token.ExpireTime != nil && now.After(*token.ExpireTime) {
+		return nil, nil, fmt.Errorf("access token expired")
+	}
+	user, err := dao.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.Status == constant.UserStatusSuspended {
+		return nil, nil, fmt.Errorf("access token owner not found or suspended")
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= touchInterval || token.LastUsedIP != ip {
+		if err := dao.TouchAccessToken(token.ID, now, ip); err != nil {
+			log.Errorf("AuthenticateAccessToken|%v", err)
+		}
+	}
+	return user, oauth.SplitList(token.Scopes), nil
+}
+
+func accessTokenResponse(t *model.AccessToken) *AccessTokenResponse {
+	return &AccessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Hint:       t.Hint,
+		Scopes:     oauth.SplitList(t.Scopes),
+		ExpireTime: t.ExpireTime,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+		CreateTime: t.CreateTime,
+	}
+}
@@ -1,19 +1,26 @@
 package service
 
 import (
+	"Gous/config"
+	"Gous/internal/audit"
 	"Gous/internal/cache"
 	"Gous/internal/dao"
+	"Gous/internal/erasure"
 	"Gous/internal/model"
 	"Gous/internal/utils"
 	"Gous/pkg/constant"
 	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 // Register 用户注册
 // 真正操作数据库
-func Register(req *RegisterRequest) error {
+func Register(ctx context.Context, req *RegisterRequest) (err error) {
+	defer func() {
+		audit.Record(ctx, &audit.Event{Action: constant.AuditRegister, Actor: req.UserName, Target: req.UserName, Err: err})
+	}()
 	//校验参数合法性
 	if req.UserName == "" || req.PassWord == "" || req.Age <= 0 ||
 		!utils.Contains([]string{constant.GenderMale, constant.GenderFeMale}, req.Gender) {
@@ -21,6 +28,12 @@ func Register(req *RegisterRequest) error {
 		return fmt.Errorf("register param invalid")
 	}
 
+	// 用户名不能与邮箱、手机号登录标识混淆
+	if kind, _, _ := parseIdent(req.UserName); kind != constant.IdentUserName {
+		log.Errorf("Gous：register user_name looks like %s", kind)
+		return fmt.Errorf("user_name must not be an email or phone number")
+	}
+
 	// 数据库操作
 	existedUser, err := dao.GetUserByName(req.UserName)
 	// 查询出错
@@ -35,6 +48,46 @@ func Register(req *RegisterRequest) error {
 		return fmt.Errorf("gous: 用户已经注册，user_name=%s", req.UserName)
 	}
 
+	// 校验邮箱，开启邮箱验证时必填
+	verifyConf := config.GetGlobalConf().EmailVerify
+	var email *string
+	if req.Email != "" || verifyConf.Enabled {
+		normalized, err := normalizeEmail(req.Email)
+		if err != nil {
+			log.Errorf("Gous: Register | %v", err)
+			return fmt.Errorf("gous: register | %v", err)
+		}
+		emailUser, err := dao.GetUserByEmail(normalized)
+		if err != nil {
+			return fmt.Errorf("gous: Register | error: %v", err)
+		}
+		if emailUser != nil {
+			return fmt.Errorf("gous: 邮箱已被注册，email=%s", normalized)
+		}
+		email = &normalized
+	}
+	// 校验手机号，注册时手机号未验证，不能用于登录
+	var phone *string
+	if req.Phone != "" {
+		normalized, err := normalizePhone(req.Phone)
+		if err != nil {
+			log.Errorf("Gous: Register | %v", err)
+			return fmt.Errorf("gous: register | %v", err)
+		}
+		phoneUser, err := dao.GetUserByPhone(normalized)
+		if err != nil {
+			return fmt.Errorf("gous: Register | error: %v", err)
+		}
+		if phoneUser != nil {
+			return fmt.Errorf("gous: 手机号已被注册，phone=%s", normalized)
+		}
+		phone = &normalized
+	}
+	status := constant.UserStatusActive
+	if verifyConf.Enabled {
+		status = constant.UserStatusPending
+	}
+
 	// 往数据库中插入该记录
 	user := &model.User{
 		CreateModel: model.CreateModel{Creator: req.UserName},
@@ -44,49 +97,100 @@ func Register(req *RegisterRequest) error {
 		NickName:    req.NickName,
 		Age:         req.Age,
 		PassWord:    req.PassWord,
+		Email:       email,
+		Phone:       phone,
+		Status:      status,
 	}
 	log.Infof("Gous：user ====== %+v", user)
-	if err := dao.CreateUser(user); err != nil {
+	if err := dao.CreateUser(user, userOutbox(constant.EventUserCreated)); err != nil {
 		log.Errorf("Gous：Register failed | error: %v", err)
 		return fmt.Errorf("gous：register failed | error: %v", err)
 	}
+	emitUserEvent(constant.EventUserCreated, user)
+
+	// 发送验证邮件，失败时用户可以重新发送，不影响注册结果
+	if verifyConf.Enabled {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := requestVerificationEmail(ctx, user); err != nil {
+			log.Errorf("Gous：Register | send verification email to %s failed: %v", *email, err)
+		}
+	}
 	return nil
 }
 
 // Login 查询是否存在该用户，并创建一个会话 session
 func Login(ctx context.Context, req *LoginRequest) (string, error) {
 	uuid := ctx.Value(constant.ReqUuid)
-	log.Debugf("%s | Login access from:%s,@,%s", uuid, req.UserName, req.PassWord)
-
-	// 获取数据库中该用户信息
-	user, err := getUserInfo(req.UserName)
+	log.Debugf("%s | Login access from:%s", uuid, req.UserName)
 
-	// 查询失败或没有查到，就返回
+	// 获取数据库中该用户信息，支持用户名、邮箱、手机号登录
+	ident := req.Identifier
+	if ident == "" {
+		ident = req.UserName
+	}
+	// 按配置的认证方式校验密码
+	user, err := authenticate(ctx, ident, req.PassWord)
 	if err != nil {
-		log.Errorf("Login | %v", err)
+		log.Errorf("Login|%s|%v", ident, err)
+		audit.Record(ctx, &audit.Event{Action: constant.AuditLogin, Actor: ident, Target: ident, Err: err})
+		recordLoginFailure(ctx, ident, loginMethodPassword, err)
 		return "", fmt.Errorf("login|%v", err)
 	}
 
-	// 密码不正确
-	if req.PassWord != req.PassWord {
-		log.Errorf("Login|password err : req.password=%s|user.password=%s", req.PassWord, user.PassWord)
-		return "", fmt.Errorf("password is not correct")
+	session, err := createSession(ctx, user, loginMethodPassword)
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Login successfully, %s via %s with redis_session session_%s", user.Name, user.Source, session)
+	return session, nil
+}
+
+// createSession 校验账号状态后为用户创建会话，密码登录、验证码登录等方式共用，并记录登录审计日志和登录历史
+func createSession(ctx context.Context, user *model.User, method string) (session string, err error) {
+	defer func() {
+		audit.Record(ctx, &audit.Event{Action: constant.AuditLogin, Actor: user.Name, Target: user.Name, Err: err})
+		recordLogin(ctx, user, method, err)
+	}()
+	uuid := ctx.Value(constant.ReqUuid)
+	if user.Status == constant.UserStatusSuspended {
+		log.Errorf("Login|user %s is suspended", user.Name)
+		return "", fmt.Errorf("account is suspended")
+	}
+	// 未验证邮箱的账号按配置禁止登录
+	verifyConf := config.GetGlobalConf().EmailVerify
+	if user.Status == constant.UserStatusPending && verifyConf.UnverifiedAccess == "block" {
+		log.Errorf("Login|user %s email not verified", user.Name)
+		return "", fmt.Errorf("email not verified")
 	}
 
-	// 创建会话 ID session
-	session := utils.GenerateSession(user.Name)
+	// 创建随机的会话 ID session，不能由用户名推算
+	if session, err = utils.RandomToken(32); err != nil {
+		log.Errorf("Login|generate session for %s err:%v", user.Name, err)
+		return "", fmt.Errorf("login|generate session fail:%v", err)
+	}
 	// 缓存 session
 	err = cache.SetSessionInfo(user, session)
 
 	if err != nil {
 		log.Errorf(" Login|Failed to SetSessionInfo, uuid=%s|user_name=%s|session=%s|err=%v", uuid, user.Name, session, err)
-		return "", fmt.Errorf("login|SetSessionInfo fail:%v, err")
+		return "", fmt.Errorf("login|SetSessionInfo fail:%v", err)
 	}
-
-	log.Infof("Login successfully, %s@%s with redis_session session_%s", req.UserName, req.PassWord, session)
 	return session, nil
 }
 
+// requestUser 获取当前请求的用户：访问令牌认证时为令牌所属用户，否则为会话用户
+func requestUser(ctx context.Context, session string) (*model.User, error) {
+	if userName, _ := ctx.Value(constant.AuthUserKey).(string); userName != "" {
+		return getUserInfo(userName)
+	}
+	if session == "" {
+		return nil, fmt.Errorf("not logged in")
+	}
+	return cache.GetSessionInfo(session)
+}
+
 func getUserInfo(userName string) (*model.User, error) {
 	// 查询 redis 缓存
 	user, err := cache.GetUserInfoFromCache(userName)
@@ -121,7 +225,7 @@ func Logout(ctx context.Context, req *LogoutRequest) error {
 	session := ctx.Value(constant.SessionKey).(string)
 	log.Infof("%s|Logout access from,user_name=%s|session=%s", uuid, req.UserName, session)
 	// 查询 redis 中是否存在该 session，判断是否处于登录状态
-	_, err := cache.GetSessionInfo(session)
+	user, err := cache.GetSessionInfo(session)
 	if err != nil {
 		log.Errorf("%s|Failed to get with session=%s|err =%v", uuid, session, err)
 		return fmt.Errorf("Logout|GetSessionInfo err:%v", err)
@@ -135,12 +239,28 @@ func Logout(ctx context.Context, req *LogoutRequest) error {
 	}
 	// 删除成功
 	log.Infof("%s|Success to delSessionInfo :%s", uuid, session)
+	audit.Record(ctx, &audit.Event{Action: constant.AuditLogout, Actor: user.Name, Target: user.Name})
+	// 删除会话绑定的 CSRF token
+	if err := cache.DelCsrfToken(session); err != nil {
+		log.Errorf("%s|Failed to DelCsrfToken :%v", uuid, err)
+	}
 	return nil
 }
 
-// Logoff 注销
+// Logoff 注销，只能注销当前会话的账号，请求中的用户名需与会话一致
 func Logoff(req *LogoffRequest, ctx context.Context) error {
-	existedUser, err := dao.GetUserByName(req.UserName)
+	session, _ := ctx.Value(constant.SessionKey).(string)
+	sessionUser, err := requestUser(ctx, session)
+	if err != nil {
+		log.Errorf("Logoff|get session user err:%v", err)
+		return fmt.Errorf("logoff|%v", err)
+	}
+	if req.UserName != "" && req.UserName != sessionUser.Name {
+		log.Warnf("Logoff|session user %s requested logoff of %s", sessionUser.Name, req.UserName)
+		return fmt.Errorf("logoff|user name mismatch")
+	}
+
+	existedUser, err := dao.GetUserByName(sessionUser.Name)
 	// 查询出错
 	if err != nil {
 		log.Errorf("Logoff|%v", err)
@@ -154,22 +274,22 @@ func Logoff(req *LogoffRequest, ctx context.Context) error {
 	}
 
 	// 删除 session 会话
-	session := ctx.Value(constant.SessionKey).(string)
 	err = cache.DelSessionInfo(session)
 	if err != nil {
 		log.Errorf("|Failed to delSessionInfo :%s", session)
 		return fmt.Errorf("del delsessioninfo err:%v", err)
 	}
-
-	// 清空 redis 缓存中的用户信息
-	if err := cache.DelUserCacheInfo(existedUser); err != nil {
-		log.Errorf("DeleteCacheInfo|%v", err)
-		return fmt.Errorf("deletecacheinfo|%v", err)
+	if err := cache.DelCsrfToken(session); err != nil {
+		log.Errorf("Logoff|Failed to DelCsrfToken :%v", err)
 	}
 
-	// 删除数据库信息
-	log.Infof("user ====== %+v", existedUser)
-	if err := dao.DeleteUser(existedUser); err != nil {
+	// 删除用户，其余个人数据由清除任务处理
+	_, err = eraseUser(ctx, existedUser, erasure.RequesterUser, &audit.Event{
+		Action: constant.AuditLogoff,
+		Actor:  sessionUser.Name,
+		Target: existedUser.Name,
+	})
+	if err != nil {
 		log.Errorf("DeleteDB|%v", err)
 		return fmt.Errorf("deletedb|%v", err)
 	}
@@ -178,32 +298,35 @@ func Logoff(req *LogoffRequest, ctx context.Context) error {
 
 // GetUserInfo 获取用户信息
 func GetUserInfo(ctx context.Context, req *GetUserInfoRequest) (*GetUserInfoResponse, error) {
-	fmt.Println(ctx)
 	uuid := ctx.Value(constant.ReqUuid)
 	session := ctx.Value(constant.SessionKey).(string)
 	log.Infof("%s|GetUserInfo access from,user_name=%s|session=%s", uuid, req.UserName, session)
 
-	if session == "" || req.UserName == "" {
+	if req.UserName == "" {
 		return nil, fmt.Errorf("GetUserInfo|request params invalid")
 	}
 
-	user, err := cache.GetSessionInfo(session)
+	user, err := requestUser(ctx, session)
 	if err != nil {
 		log.Errorf("%s|Failed to get with session=%s|err =%v", uuid, session, err)
-		return nil, fmt.Errorf("getUserInfo|GetSessionInfo err:%v", err)
+		return nil, fmt.Errorf("getUserInfo|%v", err)
 	}
 
 	if user.Name != req.UserName {
 		log.Errorf("%s|session info not match with username=%s", uuid, req.UserName)
 	}
 	log.Infof("%s|Succ to GetUserInfo|user_name=%s|session=%s", uuid, req.UserName, session)
-	return &GetUserInfoResponse{
+	rsp := &GetUserInfoResponse{
 		UserName: user.Name,
 		Age:      user.Age,
 		Gender:   user.Gender,
-		PassWord: user.PassWord,
 		NickName: user.NickName,
-	}, nil
+		Verified: user.EmailVerified,
+	}
+	if user.Email != nil {
+		rsp.Email = *user.Email
+	}
+	return rsp, nil
 }
 
 // UpdateUserNickName 更新用户昵称
@@ -213,15 +336,15 @@ func UpdateUserNickName(ctx context.Context, req *UpdateNickNameRequest) error {
 	log.Infof("%s|UpdateUserNickName access from,user_name=%s|session=%s", uuid, req.UserName, session)
 	log.Infof("UpdateUserNickName|req==%v", req)
 
-	if session == "" || req.UserName == "" {
+	if req.UserName == "" {
 		return fmt.Errorf("UpdateUserNickName|request params invalid")
 	}
 
 	//从缓存中获取用户信息
-	user, err := cache.GetSessionInfo(session)
+	user, err := requestUser(ctx, session)
 	if err != nil {
 		log.Errorf("%s|Failed to get with session=%s|err =%v", uuid, session, err)
-		return fmt.Errorf("UpdateUserNickName|GetSessionInfo err:%v", err)
+		return fmt.Errorf("UpdateUserNickName|%v", err)
 	}
 
 	if user.Name != req.UserName {
@@ -232,13 +355,25 @@ func UpdateUserNickName(ctx context.Context, req *UpdateNickNameRequest) error {
 		NickName: req.NewNickName,
 	}
 
-	return updateUserInfo(updateUser, req.UserName, session)
+	// 只能修改当前请求用户自己的资料
+	if err := updateUserInfo(updateUser, user.Name, session, userOutbox(constant.EventUserUpdated, "nickname")); err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditProfileUpdate,
+		Actor:   user.Name,
+		Target:  user.Name,
+		Changes: map[string]audit.Change{"nickname": {From: user.NickName, To: req.NewNickName}},
+	})
+	user.NickName = req.NewNickName
+	emitUserEvent(constant.EventUserUpdated, user, "nickname")
+	return nil
 }
 
-// 更新数据库中用户昵称
-func updateUserInfo(user *model.User, userName, session string) error {
+// 更新数据库中用户昵称，events 与昵称在同一事务中写入
+func updateUserInfo(user *model.User, userName, session string, events ...dao.UserEvent) error {
 	//更新数据库中的昵称
-	affectedRows := dao.UpdateUserInfo(userName, user)
+	affectedRows := dao.UpdateUserInfo(userName, user, events...)
 
 	// db更新成功
 	if affectedRows == 1 {
@@ -253,7 +388,7 @@ func updateUserInfo(user *model.User, userName, session string) error {
 				}
 			}
 		} else {
-			log.Error("Failed to get dbUserInfo for cache, username=%s with err:", userName, err.Error())
+			log.Errorf("Failed to get dbUserInfo for cache, username=%s with err:%v", userName, err)
 		}
 	}
 	return nil
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"Gous/internal/audit"
+	"Gous/internal/cache"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 批量导入时遇到已存在的用户名的处理方式
+const (
+	ImportSkip   = "skip"   // 跳过
+	ImportUpsert = "upsert" // 按文件中非空的字段更新
+)
+
+// 每行的导入结果
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportSkipped   = "skipped"
+	ImportInvalid   = "invalid" // 数据有误或与其他用户冲突
+	ImportFailed    = "failed"  // 写入数据库失败
+)
+
+const importCreator = "import" // 批量导入的用户的创建人、修改人
+
+// UserImportFields 导入支持的字段，name 必填
+var UserImportFields = []string{
+	"name", "nickname", "gender", "age", "email", "email_verified", "phone", "phone_verified",
+	"password", "status", "role", "source", "external_id",
+}
+
+// UserExportFields 导出支持的字段，不导出密码
+var UserExportFields = []string{
+	"id", "name", "nickname", "gender", "age", "email", "email_verified", "phone", "phone_verified",
+	"status", "role", "source", "external_id", "create_time", "update_time",
+}
+
+// ImportRow 待导入的一行，Values 为字段名 -> 值
+type ImportRow struct {
+	Line   int
+	Values map[string]string
+	Err    error // 读取时发现的格式错误
+}
+
+// ImportResult 一行的导入结果
+type ImportResult struct {
+	Line   int    `json:"line"`
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UserImporter 批量导入用户，跨批次检查文件中重复的用户名、邮箱、手机号
+type UserImporter struct {
+	Mode   string
+	DryRun bool           // 只校验，不写入
+	seen   map[string]int // 用户名、邮箱、手机号 -> 首次出现的行号
+}
+
+// NewUserImporter mode 见 Import*
+func NewUserImporter(mode string, dryRun bool) (*UserImporter, error) {
+	if mode != ImportSkip && mode != ImportUpsert {
+		return nil, fmt.Errorf("invalid mode %s, should be %s or %s", mode, ImportSkip, ImportUpsert)
+	}
+	return &UserImporter{Mode: mode, DryRun: dryRun, seen: map[string]int{}}, nil
+}
+
+// importUser 解析后的一行，set 为文件中提供了值的字段
+type importUser struct {
+	user *model.User
+	set  map[string]bool
+}
+
+// Import 导入一批用户，新用户在同一事务中批量写入，已存在的用户按 Mode 跳过或更新。
+// 返回 error 表示数据库不可用等无法继续的错误，这一批需要重新导入
+func (im *UserImporter) Import(ctx context.Context, rows []*ImportRow) ([]*ImportResult, error) {
+	results := make([]*ImportResult, 0, len(rows))
+	var creates []*model.User
+	var created []*ImportResult
+	for _, row := range rows {
+		res := &ImportResult{Line: row.Line, Name: strings.TrimSpace(row.Values["name"])}
+		results = append(results, res)
+		u, err := im.check(row)
+		if err != nil {
+			res.Result, res.Error = ImportInvalid, err.Error()
+			continue
+		}
+		existed, err := dao.GetUserByName(u.user.Name)
+		if err != nil {
+			return nil, err
+		}
+		if conflict, err := importConflict(u.user, existed); err != nil {
+			return nil, err
+		} else if conflict != "" {
+			res.Result, res.Error = ImportInvalid, conflict
+			continue
+		}
+		if existed == nil {
+			res.Result = ImportCreated
+			if !im.DryRun {
+				creates = append(creates, u.user)
+				created = append(created, res)
+			}
+			continue
+		}
+		if im.Mode == ImportSkip {
+			res.Result = ImportSkipped
+			continue
+		}
+		columns := importChanges(existed, u)
+		if len(columns) == 0 {
+			res.Result = ImportUnchanged
+			continue
+		}
+		res.Result = ImportUpdated
+		if im.DryRun {
+			continue
+		}
+		if err := updateImportedUser(ctx, existed, columns); err != nil {
+			if err := utils.PingDB(ctx); err != nil {
+				return nil, err
+			}
+			res.Result, res.Error = ImportFailed, err.Error()
+		}
+	}
+	if len(creates) == 0 {
+		return results, nil
+	}
+	if err := dao.CreateUsers(creates, userOutbox(constant.EventUserCreated)); err == nil {
+		for _, user := range creates {
+			importedUser(ctx, user)
+		}
+		return results, nil
+	}
+	if err := utils.PingDB(ctx); err != nil {
+		return nil, err
+	}
+	// 批量写入失败时逐个写入，找出与其他写入冲突的记录
+	for i, user := range creates {
+		user.ID = 0
+		if err := dao.CreateUser(user, userOutbox(constant.EventUserCreated)); err != nil {
+			created[i].Result, created[i].Error = ImportFailed, err.Error()
+			continue
+		}
+		importedUser(ctx, user)
+	}
+	return results, nil
+}
+
+// check 解析一行并检查与文件中之前的行是否重复
+func (im *UserImporter) check(row *ImportRow) (*importUser, error) {
+	if row.Err != nil {
+		return nil, row.Err
+	}
+	u, err := parseImportUser(row.Values)
+	if err != nil {
+		return nil, err
+	}
+	// 与数据库排序规则一致，用户名不区分大小写
+	keys := map[string]string{"name": strings.ToLower(u.user.Name)}
+	if u.user.Email != nil {
+		keys["email"] = *u.user.Email
+	}
+	if u.user.Phone != nil {
+		keys["phone"] = *u.user.Phone
+	}
+	for field, value := range keys {
+		if line, ok := im.seen[field+":"+value]; ok {
+			return nil, fmt.Errorf("duplicate %s %s, first seen at line %d", field, value, line)
+		}
+	}
+	for field, value := range keys {
+		im.seen[field+":"+value] = row.Line
+	}
+	return u, nil
+}
+
+// parseImportUser 校验并转换一行，未提供密码时设置随机密码
+func parseImportUser(values map[string]string) (*importUser, error) {
+	value := func(field string) string {
+		return strings.TrimSpace(values[field])
+	}
+	u := &importUser{set: map[string]bool{}}
+	for _, f := range UserImportFields {
+		if value(f) != "" {
+			u.set[f] = true
+		}
+	}
+	name := value("name")
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if kind, _, _ := parseIdent(name); kind != constant.IdentUserName {
+		return nil, fmt.Errorf("name must not be an email or phone number")
+	}
+	user := &model.User{
+		CreateModel: model.CreateModel{Creator: importCreator},
+		ModifyModel: model.ModifyModel{Modifier: importCreator},
+		Name:        name,
+		NickName:    value("nickname"),
+		Gender:      value("gender"),
+		PassWord:    values["password"],
+		Status:      constant.UserStatusActive,
+		Source:      constant.UserSourceLocal,
+		Role:        constant.RoleUser,
+	}
+	if user.Gender != "" && !utils.Contains([]string{constant.GenderMale, constant.GenderFeMale}, user.Gender) {
+		return nil, fmt.Errorf("gender should be %s or %s", constant.GenderMale, constant.GenderFeMale)
+	}
+	if s := value("age"); s != "" {
+		age, err := strconv.Atoi(s)
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("invalid age %s", s)
+		}
+		user.Age = age
+	}
+	if s := value("email"); s != "" {
+		email, err := normalizeEmail(s)
+		if err != nil {
+			return nil, err
+		}
+		user.Email = &email
+	}
+	if s := value("phone"); s != "" {
+		phone, err := normalizePhone(s)
+		if err != nil {
+			return nil, err
+		}
+		user.Phone = &phone
+	}
+	var err error
+	if user.EmailVerified, err = importBool("email_verified", value("email_verified")); err != nil {
+		return nil, err
+	}
+	if user.PhoneVerified, err = importBool("phone_verified", value("phone_verified")); err != nil {
+		return nil, err
+	}
+	if user.EmailVerified && user.Email == nil || user.PhoneVerified && user.Phone == nil {
+		return nil, fmt.Errorf("verified flag set without email or phone")
+	}
+	if s := value("status"); s != "" {
+		if !utils.Contains([]string{constant.UserStatusActive, constant.UserStatusPending, constant.UserStatusSuspended}, s) {
+			return nil, fmt.Errorf("invalid status %s", s)
+		}
+		user.Status = s
+	}
+	if s := value("role"); s != "" {
+		user.Role = s
+	}
+	if s := value("source"); s != "" {
+		if !utils.Contains([]string{constant.UserSourceLocal, constant.UserSourceLdap, constant.UserSourceScim}, s) {
+			return nil, fmt.Errorf("invalid source %s", s)
+		}
+		user.Source = s
+	}
+	if s := value("external_id"); s != "" {
+		user.ExternalID = &s
+	}
+	if !u.set["password"] {
+		// 未提供密码时设置随机密码，用户通过找回密码、第三方登录或验证码登录
+		if user.PassWord, err = utils.RandomToken(16); err != nil {
+			return nil, err
+		}
+	}
+	u.user = user
+	return u, nil
+}
+
+func importBool(field, s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s should be true or false", field)
+	}
+	return b, nil
+}
+
+// importConflict 邮箱、手机号不能属于用户名对应用户之外的其他用户
+func importConflict(user, existed *model.User) (string, error) {
+	selfID := 0
+	if existed != nil {
+		selfID = existed.ID
+	}
+	if user.Email != nil {
+		if u, err := dao.GetUserByEmail(*user.Email); err != nil {
+			return "", err
+		} else if u != nil && u.ID != selfID {
+			return fmt.Sprintf("email %s already belongs to %s", *user.Email, u.Name), nil
+		}
+	}
+	if user.Phone != nil {
+		if u, err := dao.GetUserByPhone(*user.Phone); err != nil {
+			return "", err
+		} else if u != nil && u.ID != selfID {
+			return fmt.Sprintf("phone %s already belongs to %s", *user.Phone, u.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// importChanges 文件中提供了值且与现有数据不同的字段
+func importChanges(existed *model.User, u *importUser) map[string]interface{} {
+	user := u.user
+	columns := map[string]interface{}{}
+	set := func(field string, changed bool, value interface{}) {
+		if u.set[field] && changed {
+			columns[field] = value
+		}
+	}
+	set("nickname", user.NickName != existed.NickName, user.NickName)
+	set("gender", user.Gender != existed.Gender, user.Gender)
+	set("age", user.Age != existed.Age, user.Age)
+	set("email", !sameString(user.Email, existed.Email), user.Email)
+	set("email_verified", user.EmailVerified != existed.EmailVerified, user.EmailVerified)
+	set("phone", !sameString(user.Phone, existed.Phone), user.Phone)
+	set("phone_verified", user.PhoneVerified != existed.PhoneVerified, user.PhoneVerified)
+	set("status", user.Status != existed.Status, user.Status)
+	set("role", user.Role != existed.Role, user.Role)
+	set("source", user.Source != existed.Source, user.Source)
+	set("external_id", !sameString(user.ExternalID, existed.ExternalID), user.ExternalID)
+	set("password", user.PassWord != existed.PassWord, user.PassWord)
+	// 更换的邮箱、手机号需要重新验证
+	if _, ok := columns["email"]; ok && !u.set["email_verified"] {
+		columns["email_verified"] = false
+	}
+	if _, ok := columns["phone"]; ok && !u.set["phone_verified"] {
+		columns["phone_verified"] = false
+	}
+	return columns
+}
+
+// updateImportedUser 保存变更的字段；停用或修改密码时删除用户的全部会话
+func updateImportedUser(ctx context.Context, user *model.User, columns map[string]interface{}) error {
+	old := map[string]interface{}{
+		"nickname": user.NickName, "gender": user.Gender, "age": user.Age, "email": user.Email,
+		"email_verified": user.EmailVerified, "phone": user.Phone, "phone_verified": user.PhoneVerified,
+		"status": user.Status, "role": user.Role, "source": user.Source, "external_id": user.ExternalID,
+	}
+	changes := map[string]audit.Change{}
+	fields := make([]string, 0, len(columns))
+	for k, v := range columns {
+		fields = append(fields, k)
+		if k == "password" {
+			changes[k] = audit.Change{From: "******", To: "******"}
+			continue
+		}
+		changes[k] = audit.Change{From: old[k], To: v}
+	}
+	sort.Strings(fields)
+	revoke := columns["password"] != nil || columns["status"] == constant.UserStatusSuspended
+	columns["modifier"] = importCreator
+	if err := dao.UpdateUserColumns(user.ID, columns, userOutbox(constant.EventUserUpdated, fields...)); err != nil {
+		return err
+	}
+	if err := cache.DelUserCacheInfo(user); err != nil {
+		log.Errorf("updateImportedUser|del user cache err:%v", err)
+	}
+	if revoke {
+		if err := cache.DelUserSessions(user.Name); err != nil {
+			log.Errorf("updateImportedUser|revoke sessions of %s err:%v", user.Name, err)
+		}
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditUserImport,
+		Actor:   constant.AuditActorCli,
+		Target:  user.Name,
+		Changes: changes,
+	})
+	if updated, err := dao.GetUserByID(user.ID); err == nil && updated != nil {
+		emitUserEvent(constant.EventUserUpdated, updated, fields...)
+	}
+	return nil
+}
+
+// importedUser 新用户写入后记录审计日志并发送事件
+func importedUser(ctx context.Context, user *model.User) {
+	audit.Record(ctx, &audit.Event{
+		Action: constant.AuditUserImport,
+		Actor:  constant.AuditActorCli,
+		Target: user.Name,
+		Changes: map[string]audit.Change{
+			"name":   {To: user.Name},
+			"email":  {To: user.Email},
+			"phone":  {To: user.Phone},
+			"status": {To: user.Status},
+			"source": {To: user.Source},
+		},
+	})
+	emitUserEvent(constant.EventUserCreated, user)
+}
+
+// ExportUsers 按 id 顺序分批读取全部用户，逐个交给 write，返回导出的用户数。
+// 字段见 UserExportFields，fields 只用于记录审计日志
+func ExportUsers(ctx context.Context, batch int, fields []string, write func(values map[string]interface{}) error) (int, error) {
+	n, after := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		users, err := dao.ListUsersAfter(after, batch)
+		if err != nil {
+			return n, err
+		}
+		for _, u := range users {
+			after = u.ID
+			if err := write(userExportValues(u)); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(users) < batch {
+			break
+		}
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditUsersExport,
+		Actor:   constant.AuditActorCli,
+		Changes: map[string]audit.Change{"count": {To: n}, "fields": {To: strings.Join(fields, ",")}},
+	})
+	return n, nil
+}
+
+func userExportValues(u *model.User) map[string]interface{} {
+	values := map[string]interface{}{
+		"id":             u.ID,
+		"name":           u.Name,
+		"nickname":       u.NickName,
+		"gender":         u.Gender,
+		"age":            u.Age,
+		"email_verified": u.EmailVerified,
+		"phone_verified": u.PhoneVerified,
+		"status":         u.Status,
+		"role":           u.Role,
+		"source":         u.Source,
+		"create_time":    u.CreateTime.Format(time.RFC3339),
+		"update_time":    u.UpdateTime.Format(time.RFC3339),
+	}
+	for field, v := range map[string]*string{"email": u.Email, "phone": u.Phone, "external_id": u.ExternalID} {
+		if v != nil {
+			values[field] = *v
+		} else {
+			values[field] = nil
+		}
+	}
+	return values
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"Gous/internal/cache"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCreateSessionUnpredictable(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "session_user"})
+	first, err := createSession(context.Background(), user, loginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := createSession(context.Background(), user, loginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 会话 ID 不能由用户名推算，同一用户每次登录得到不同的会话
+	if first == second || first == utils.Md5String(user.Name+":session") || len(first) != 64 {
+		t.Fatalf("predictable sessions %s, %s", first, second)
+	}
+	for _, session := range []string{first, second} {
+		if u, err := cache.GetSessionInfo(session); err != nil || u.Name != user.Name {
+			t.Fatalf("session %s: got %v, %v", session, u, err)
+		}
+	}
+}
+
+func TestCachedUserWithoutPassword(t *testing.T) {
+	user := createTestUser(t, &model.User{Name: "cached_user", PassWord: "cached-password"})
+	session, err := createSession(context.Background(), user, loginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getUserInfo(user.Name); err != nil {
+		t.Fatal(err)
+	}
+	// 会话和用户信息缓存都不保存密码
+	for _, key := range []string{constant.SessionKeyPrefix + session, constant.UserInfoPrefix + user.Name} {
+		val, err := testRedis.Get(key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if strings.Contains(val, user.PassWord) {
+			t.Fatalf("%s caches the password: %s", key, val)
+		}
+	}
+	// 命中缓存时仍然按数据库中的密码校验
+	if got, err := (localAuthenticator{}).Authenticate(context.Background(), user.Name, "cached-password"); err != nil || got.Name != user.Name {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if _, err := (localAuthenticator{}).Authenticate(context.Background(), user.Name, ""); err != errInvalidCredentials {
+		t.Fatalf("empty password: %v", err)
+	}
+}
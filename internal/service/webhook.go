@@ -0,0 +1,282 @@
+package service
+
+import (
+	"Gous/internal/audit"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/internal/webhook"
+	"Gous/pkg/constant"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CreateWebhook 创建事件订阅，返回的密钥只展示这一次
+func CreateWebhook(ctx context.Context, req *WebhookRequest) (*WebhookResponse, error) {
+	if req.Url == nil {
+		return nil, fmt.Errorf("url is required")
+	}
+	w := &model.Webhook{Enabled: true}
+	if req.Secret == nil || *req.Secret == "" {
+		secret, err := utils.RandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		req.Secret = &secret
+	}
+	if len(req.Events) == 0 {
+		return nil, fmt.Errorf("events is required")
+	}
+	if err := applyWebhookRequest(w, req); err != nil {
+		return nil, err
+	}
+	if err := dao.SaveWebhook(w); err != nil {
+		return nil, err
+	}
+	log.Infof("CreateWebhook|webhook %d created for %s: %s", w.ID, w.Url, w.Events)
+	audit.Record(ctx, &audit.Event{
+		Action: constant.AuditWebhookCreate,
+		Actor:  constant.AuditActorAdmin,
+		Target: webhookTarget(w.ID),
+		Changes: map[string]audit.Change{
+			"url":     {To: w.Url},
+			"events":  {To: w.Events},
+			"enabled": {To: w.Enabled},
+		},
+	})
+	rsp := webhookResponse(w)
+	rsp.Secret = w.Secret
+	return rsp, nil
+}
+
+// UpdateWebhook 修改事件订阅，只修改请求中传了的字段
+func UpdateWebhook(ctx context.Context, id int, req *WebhookRequest) (*WebhookResponse, error) {
+	w, err := dao.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, fmt.Errorf("webhook %d not found", id)
+	}
+	old := *w
+	if req.Events != nil && len(req.Events) == 0 {
+		return nil, fmt.Errorf("events must not be empty")
+	}
+	if err := applyWebhookRequest(w, req); err != nil {
+		return nil, err
+	}
+	if err := dao.SaveWebhook(w); err != nil {
+		return nil, err
+	}
+	changes := map[string]audit.Change{}
+	if old.Url != w.Url {
+		changes["url"] = audit.Change{From: old.Url, To: w.Url}
+	}
+	if old.Events != w.Events {
+		changes["events"] = audit.Change{From: old.Events, To: w.Events}
+	}
+	if old.Enabled != w.Enabled {
+		changes["enabled"] = audit.Change{From: old.Enabled, To: w.Enabled}
+	}
+	if old.Secret != w.Secret {
+		changes["secret"] = audit.Change{From: "******", To: "******"}
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditWebhookUpdate,
+		Actor:   constant.AuditActorAdmin,
+		Target:  webhookTarget(w.ID),
+		Changes: changes,
+	})
+	return webhookResponse(w), nil
+}
+
+// applyWebhookRequest 校验请求并写入订阅
+func applyWebhookRequest(w *model.Webhook, req *WebhookRequest) error {
+	if req.Url != nil {
+		u, err := url.Parse(*req.Url)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.User != nil {
+			return fmt.Errorf("invalid url %q, absolute http(s) url without credentials required", *req.Url)
+		}
+		if len(*req.Url) > 1024 {
+			return fmt.Errorf("url is too long")
+		}
+		w.Url = *req.Url
+	}
+	if req.Secret != nil {
+		if len(*req.Secret) < 16 || len(*req.Secret) > 128 {
+			return fmt.Errorf("secret must be 16-128 characters")
+		}
+		w.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		seen := map[string]bool{}
+		var events []string
+		for _, e := range req.Events {
+			if !utils.Contains(webhook.Events, e) {
+				return fmt.Errorf("unsupported event %q, supported: %s", e, strings.Join(webhook.Events, ", "))
+			}
+			if !seen[e] {
+				seen[e] = true
+				events = append(events, e)
+			}
+		}
+		w.Events = strings.Join(events, " ")
+	}
+	if req.Description != nil {
+		w.Description = utils.Truncate(*req.Description, 255)
+	}
+	if req.Enabled != nil {
+		w.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// ListWebhooks 查询全部事件订阅
+func ListWebhooks() ([]*WebhookResponse, error) {
+	hooks, err := dao.ListWebhooks(false)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*WebhookResponse, 0, len(hooks))
+	for _, w := range hooks {
+		list = append(list, webhookResponse(w))
+	}
+	return list, nil
+}
+
+// DeleteWebhook 删除事件订阅及其投递记录
+func DeleteWebhook(ctx context.Context, id int) error {
+	w, err := dao.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		return fmt.Errorf("webhook %d not found", id)
+	}
+	if err := dao.DeleteWebhook(id); err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditWebhookDelete,
+		Actor:   constant.AuditActorAdmin,
+		Target:  webhookTarget(id),
+		Changes: map[string]audit.Change{"url": {From: w.Url}},
+	})
+	return nil
+}
+
+// ListWebhookDeliveries 分页查询订阅的投递记录，按时间倒序，不含请求体
+func ListWebhookDeliveries(id int, req *ListWebhookDeliveriesRequest) (*WebhookDeliveryListResponse, error) {
+	switch req.Status {
+	case "", dao.WebhookPending, dao.WebhookSuccess, dao.WebhookDead:
+	default:
+		return nil, fmt.Errorf("invalid status %q", req.Status)
+	}
+	page, size := req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 20
+	} else if size > 100 {
+		size = 100
+	}
+	list, total, err := dao.FindWebhookDeliveries(id, req.Status, (page-1)*size, size)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &WebhookDeliveryListResponse{Total: total, Items: make([]*WebhookDeliveryResponse, 0, len(list))}
+	for _, d := range list {
+		rsp.Items = append(rsp.Items, webhookDeliveryResponse(d))
+	}
+	return rsp, nil
+}
+
+// GetWebhookDelivery 查询投递记录，包括请求体和每次尝试的结果
+func GetWebhookDelivery(id int64) (*WebhookDeliveryResponse, error) {
+	d, err := dao.GetWebhookDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("delivery %d not found", id)
+	}
+	attempts, err := dao.ListWebhookAttempts(id)
+	if err != nil {
+		return nil, err
+	}
+	rsp := webhookDeliveryResponse(d)
+	rsp.Payload = json.RawMessage(d.Payload)
+	for _, a := range attempts {
+		rsp.History = append(rsp.History, &WebhookAttemptResponse{
+			Time:         a.CreateTime,
+			StatusCode:   a.StatusCode,
+			Error:        a.Error,
+			ResponseBody: a.ResponseBody,
+			Duration:     a.Duration,
+		})
+	}
+	return rsp, nil
+}
+
+// RedeliverWebhook 手动重新投递，投递次数清零，请求体和事件 id 不变
+func RedeliverWebhook(ctx context.Context, id int64) error {
+	d, err := dao.GetWebhookDelivery(id)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return fmt.Errorf("delivery %d not found", id)
+	}
+	if err := dao.ResetWebhookDelivery(id, time.Now()); err != nil {
+		return err
+	}
+	audit.Record(ctx, &audit.Event{
+		Action:  constant.AuditWebhookRedeliver,
+		Actor:   constant.AuditActorAdmin,
+		Target:  webhookTarget(d.WebhookID),
+		Changes: map[string]audit.Change{"delivery": {To: d.ID}, "status": {From: d.Status, To: dao.WebhookPending}},
+	})
+	webhook.Wakeup()
+	return nil
+}
+
+func webhookTarget(id int) string {
+	return fmt.Sprintf("webhook:%d", id)
+}
+
+func webhookResponse(w *model.Webhook) *WebhookResponse {
+	return &WebhookResponse{
+		ID:          w.ID,
+		Url:         w.Url,
+		Events:      strings.Fields(w.Events),
+		Description: w.Description,
+		Enabled:     w.Enabled,
+		CreateTime:  w.CreateTime,
+		UpdateTime:  w.UpdateTime,
+	}
+}
+
+func webhookDeliveryResponse(d *model.WebhookDelivery) *WebhookDeliveryResponse {
+	rsp := &WebhookDeliveryResponse{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		LastAttemptAt:  d.LastAttemptAt,
+		CreateTime:     d.CreateTime,
+	}
+	if d.Status == dao.WebhookPending {
+		rsp.NextAttemptAt = &d.NextAttemptAt
+	}
+	return rsp
+}
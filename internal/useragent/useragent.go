@@ -0,0 +1,105 @@
+package useragent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// 设备类型
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// Info 从 User-Agent 中识别出的浏览器、系统和设备类型，只识别常见的类型，不含版本号
+type Info struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// rule 按顺序匹配，先匹配的优先，如 Edge 的 User-Agent 中同时含有 Chrome 和 Safari
+type rule struct {
+	name     string
+	keywords []string
+}
+
+var browserRules = []rule{
+	{"Edge", []string{"edg/", "edge/", "edga/", "edgios/"}},
+	{"Opera", []string{"opr/", "opera"}},
+	{"Samsung Internet", []string{"samsungbrowser/"}},
+	{"WeChat", []string{"micromessenger/"}},
+	{"Firefox", []string{"firefox/", "fxios/"}},
+	{"Chrome", []string{"chrome/", "crios/", "chromium/"}},
+	{"Safari", []string{"safari/"}},
+	{"Internet Explorer", []string{"msie ", "trident/"}},
+}
+
+var osRules = []rule{
+	{"Windows Phone", []string{"windows phone"}},
+	{"Windows", []string{"windows"}},
+	{"iOS", []string{"iphone", "ipad", "ipod"}},
+	{"Android", []string{"android"}},
+	{"ChromeOS", []string{"cros "}},
+	{"macOS", []string{"macintosh", "mac os x"}},
+	{"Linux", []string{"linux", "x11"}},
+}
+
+var botKeywords = []string{"bot", "crawler", "spider", "slurp"}
+
+// Parse 解析 User-Agent，无法识别的浏览器取第一个产品名，如 curl、PostmanRuntime
+func Parse(ua string) Info {
+	lower := strings.ToLower(ua)
+	info := Info{
+		Browser: match(lower, browserRules),
+		OS:      match(lower, osRules),
+	}
+	if info.Browser == "" {
+		if i := strings.IndexAny(ua, "/ "); i > 0 {
+			info.Browser = ua[:i]
+		}
+	}
+
+	switch {
+	case containsAny(lower, botKeywords):
+		info.Device = DeviceBot
+	case containsAny(lower, []string{"ipad", "tablet"}) ||
+		info.OS == "Android" && !strings.Contains(lower, "mobile"):
+		info.Device = DeviceTablet
+	case containsAny(lower, []string{"mobi", "iphone", "ipod"}) || info.OS == "Windows Phone":
+		info.Device = DeviceMobile
+	case info.OS != "":
+		info.Device = DeviceDesktop
+	default:
+		info.Device = DeviceOther
+	}
+	return info
+}
+
+// Fingerprint 设备指纹，浏览器或系统升级不会改变指纹
+func (i Info) Fingerprint() string {
+	sum := sha256.Sum256([]byte(strings.ToLower(i.Browser + "|" + i.OS + "|" + i.Device)))
+	return hex.EncodeToString(sum[:])
+}
+
+func match(lower string, rules []rule) string {
+	for _, r := range rules {
+		if containsAny(lower, r.keywords) {
+			return r.name
+		}
+	}
+	return ""
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package userfile
+
+import (
+	"Gous/internal/utils"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 支持的文件格式
+const (
+	FormatCSV   = "csv"   // 第一行为列名
+	FormatJSONL = "jsonl" // 每行一个 JSON 对象
+)
+
+// Format 未指定格式时按扩展名判断
+func Format(path, format string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = FormatCSV
+		case ".jsonl", ".ndjson":
+			format = FormatJSONL
+		default:
+			return "", fmt.Errorf("cannot detect format of %s, use -format csv or jsonl", path)
+		}
+	}
+	if format != FormatCSV && format != FormatJSONL {
+		return "", fmt.Errorf("unsupported format %s", format)
+	}
+	return format, nil
+}
+
+// Mapping 字段到文件列名的映射，未映射的字段列名与字段名相同
+type Mapping map[string]string
+
+// ParseMapping 解析 field=column 形式的映射，多个用逗号分隔，fields 为支持的字段
+func ParseMapping(s string, fields []string) (Mapping, error) {
+	m := Mapping{}
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(strings.TrimSpace(item), "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid mapping %q, should be field=column", item)
+		}
+		if !utils.Contains(fields, field) {
+			return nil, fmt.Errorf("unknown field %s, supported: %s", field, strings.Join(fields, ","))
+		}
+		m[field] = column
+	}
+	return m, nil
+}
+
+// Column 字段对应的列名
+func (m Mapping) Column(field string) string {
+	if c, ok := m[field]; ok {
+		return c
+	}
+	return field
+}
+
+// Record 文件中的一条记录
+type Record struct {
+	Line   int               // 记录开始的行号
+	Offset int64             // 记录结束的位置，从该位置继续读取即可跳过已处理的记录
+	Values map[string]string // 列名 -> 值
+	Err    error             // 该行格式有误，其余行仍可读取
+}
+
+// Reader 逐条读取记录，读完时返回 io.EOF
+type Reader interface {
+	Read() (*Record, error)
+	// Columns 文件中的列名，JSON Lines 没有固定的列名，返回 nil
+	Columns() []string
+}
+
+// NewReader 从 offset 处开始读取，offset 为上次处理到的 Record.Offset，从头读取时为 0
+func NewReader(r io.ReadSeeker, format string, offset int64) (Reader, error) {
+	// 统计 offset 之前的行数，继续读取时行号与文件一致
+	line := 0
+	if offset > 0 {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		n, err := countLines(io.LimitReader(r, offset))
+		if err != nil {
+			return nil, err
+		}
+		line = n
+	}
+	if format == FormatJSONL {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return &jsonlReader{r: bufio.NewReader(r), offset: offset, line: line}, nil
+	}
+	return newCSVReader(r, offset, line)
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns []string
+	base    int64 // r 开始读取的位置
+	line    int   // r 开始读取前的行数
+}
+
+func newCSVReader(r io.ReadSeeker, offset int64, line int) (*csvReader, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty csv file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %v", err)
+	}
+	// Excel 导出的 UTF-8 文件带 BOM
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	c := &csvReader{r: cr, columns: header}
+	if offset > cr.InputOffset() {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		c.r, c.base, c.line = csv.NewReader(r), offset, line
+	}
+	c.r.FieldsPerRecord = len(header)
+	return c, nil
+}
+
+func (c *csvReader) Columns() []string {
+	return c.columns
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	values, err := c.r.Read()
+	// 列数不一致只影响该行，引号不匹配等错误无法继续读取
+	var pe *csv.ParseError
+	if err != nil && (!errors.As(err, &pe) || pe.Err != csv.ErrFieldCount) {
+		return nil, err
+	}
+	line, _ := c.r.FieldPos(0)
+	rec := &Record{Line: c.line + line, Offset: c.base + c.r.InputOffset()}
+	if err != nil {
+		rec.Err = fmt.Errorf("expected %d columns, got %d", len(c.columns), len(values))
+		return rec, nil
+	}
+	rec.Values = make(map[string]string, len(values))
+	for i, v := range values {
+		rec.Values[c.columns[i]] = v
+	}
+	return rec, nil
+}
+
+type jsonlReader struct {
+	r      *bufio.Reader
+	offset int64
+	line   int
+}
+
+func (j *jsonlReader) Columns() []string {
+	return nil
+}
+
+func (j *jsonlReader) Read() (*Record, error) {
+	for {
+		raw, err := j.r.ReadBytes('\n')
+		if len(raw) == 0 && err != nil {
+			return nil, err
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		j.offset += int64(len(raw))
+		j.line++
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+		rec := &Record{Line: j.line, Offset: j.offset}
+		rec.Values, rec.Err = decodeObject(raw)
+		return rec, nil
+	}
+}
+
+// decodeObject 解析一行 JSON 对象，值统一转换为字符串，null 视为空
+func decodeObject(raw []byte) (map[string]string, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	obj := map[string]interface{}{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	values := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case nil:
+			values[k] = ""
+		case string:
+			values[k] = v
+		case json.Number:
+			values[k] = v.String()
+		case bool:
+			values[k] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("field %s should be a string, number or boolean", k)
+		}
+	}
+	return values, nil
+}
+
+// Writer 逐条写入记录
+type Writer interface {
+	Write(values map[string]interface{}) error
+	Flush() error
+}
+
+// NewWriter columns 为输出的列名及顺序，CSV 先写入列名
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	if format == FormatJSONL {
+		return &jsonlWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw, columns: columns}, nil
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (c *csvWriter) Write(values map[string]interface{}) error {
+	row := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		if v := values[col]; v != nil {
+			row[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (j *jsonlWriter) Write(values map[string]interface{}) error {
+	obj := make(map[string]interface{}, len(j.columns))
+	for _, col := range j.columns {
+		obj[col] = values[col]
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := j.w.Write(append(raw, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
+
+// UnknownColumns 文件中没有对应字段的列，导入时忽略
+func UnknownColumns(columns, fields []string, m Mapping) []string {
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[m.Column(f)] = true
+	}
+	var unknown []string
+	for _, c := range columns {
+		if !known[c] {
+			unknown = append(unknown, c)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func countLines(r io.Reader) (int, error) {
+	buf := make([]byte, 32*1024)
+	n := 0
+	for {
+		c, err := r.Read(buf)
+		n += bytes.Count(buf[:c], []byte{'\n'})
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
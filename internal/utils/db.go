@@ -2,6 +2,7 @@ package utils
 
 import (
 	"Gous/config"
+	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
@@ -12,33 +13,72 @@ import (
 
 var (
 	db     *gorm.DB
+	dbErr  error
 	dbOnce sync.Once
 )
 
-// 连接数据库
+// 创建数据库连接池，不主动连接，连通性由 PingDB 检测
 func openDB() {
 	// 获取数据库配置
 	mysqlConf := config.GetGlobalConf().DbConfig
 	// 连接语句
-	connArgs := fmt.Sprintf("%s:%s@(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local",
+	connArgs := fmt.Sprintf("%s:%s@(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local",
 		mysqlConf.User, mysqlConf.Password, mysqlConf.Host, mysqlConf.Port, mysqlConf.Dbname)
-	log.Info("mdb addr: " + connArgs)
+	log.Infof("mdb addr: %s@(%s:%d)/%s", mysqlConf.User, mysqlConf.Host, mysqlConf.Port, mysqlConf.Dbname)
 
-	var err error
-	db, err = gorm.Open(mysql.Open(connArgs), &gorm.Config{}) // 使用默认配置连接数据库
-	if err != nil {
-		panic("failed to connect database")
+	// 跳过打开时的 ping 和版本查询，数据库暂不可用时也能拿到连接池，恢复后自动重连
+	db, dbErr = gorm.Open(mysql.New(mysql.Config{
+		DSN:                       connArgs,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DisableAutomaticPing: true})
+	if dbErr != nil {
+		dbErr = fmt.Errorf("open database err: %w", dbErr)
+		log.Error(dbErr)
+		return
 	}
 
 	sqlDB, err := db.DB() // 获取底层的 sql.DB 连接对象
 	if err != nil {
-		panic("fetch db connection err:" + err.Error())
+		dbErr = fmt.Errorf("fetch db connection err: %w", err)
+		log.Error(dbErr)
+		return
 	}
 
 	sqlDB.SetMaxIdleConns(mysqlConf.MaxIdleConn)                                        // 最大空闲连接
 	sqlDB.SetMaxOpenConns(mysqlConf.MaxOpenConn)                                        // 最大打开连接
 	sqlDB.SetConnMaxLifetime(time.Duration(mysqlConf.MaxIdleTime * int64(time.Second))) // 最大空闲时间（s）
+}
+
+// PingDB 检测数据库连通性
+func PingDB(ctx context.Context) error {
+	dbOnce.Do(openDB)
+	if dbErr != nil {
+		return dbErr
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CloseDB 关闭数据库连接池
+func CloseDB() error {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
 
+// SetDB 使用已创建的连接代替配置中的数据库，需在首次获取连接前调用，测试中用于替换为内存数据库
+func SetDB(d *gorm.DB) {
+	dbOnce.Do(func() {
+		db = d
+	})
 }
 
 func GetDB() *gorm.DB {
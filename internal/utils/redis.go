@@ -14,10 +14,10 @@ var (
 	redisOnce sync.Once
 )
 
-// 连接 redis
+// 创建 redis 客户端，连接在首次使用时建立，连通性由 PingRedis 检测
 func initRedis() {
 	redisConfig := config.GetGlobalConf().RedisConfig
-	log.Infof("redisConfig ====== %+v", redisConfig)
+	log.Infof("redis addr: %s:%d/%d", redisConfig.Host, redisConfig.Port, redisConfig.DB)
 	addr := fmt.Sprintf("%s:%d", redisConfig.Host, redisConfig.Port)
 	redisConn = redis.NewClient(&redis.Options{
 		Addr:     addr,
@@ -25,21 +25,19 @@ func initRedis() {
 		DB:       redisConfig.DB,
 		PoolSize: redisConfig.PoolSile,
 	})
-	if redisConn == nil {
-		panic("failed to call redis.NewClient")
-	}
-	// 连接测试以确保与 Redis 服务器的通信正常。
-	res, err := redisConn.Set(context.Background(), "abc", 100, 60).Result()
-	log.Infof("res=======%v,err======%v", res, err)
-	_, err = redisConn.Ping(context.Background()).Result()
-	if err != nil {
-		panic("Failed to ping redis, err:%s")
-	}
+}
+
+// PingRedis 检测 redis 连通性
+func PingRedis(ctx context.Context) error {
+	return GetRedisCLi().Ping(ctx).Err()
 }
 
 // CloseRedis 关闭 redis 连接
-func CloseRedis() {
-	redisConn.Close()
+func CloseRedis() error {
+	if redisConn == nil {
+		return nil
+	}
+	return redisConn.Close()
 }
 
 func GetRedisCLi() *redis.Client {
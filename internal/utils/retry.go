@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Backoff 指数退避重试参数
+type Backoff struct {
+	MaxRetries int           // 最大重试次数，不含首次尝试
+	Initial    time.Duration // 首次重试前的等待时间
+	Max        time.Duration // 单次等待时间上限
+}
+
+// Delay 第 n 次失败后的等待时间：Initial * 2^(n-1)，不超过 Max，Max 为 0 时不限制
+func (b Backoff) Delay(n int) time.Duration {
+	wait := b.Initial
+	for i := 1; i < n && (b.Max <= 0 || wait < b.Max); i++ {
+		wait *= 2
+	}
+	if b.Max > 0 && wait > b.Max {
+		wait = b.Max
+	}
+	return wait
+}
+
+// Retry 按指数退避执行 fn，直到成功、达到重试上限或 ctx 结束，返回尝试次数和最后一次错误
+func Retry(ctx context.Context, name string, b Backoff, fn func(ctx context.Context) error) (int, error) {
+	attempt := 0
+	for {
+		attempt++
+		err := fn(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt > b.MaxRetries {
+			return attempt, fmt.Errorf("%s: giving up after %d attempts: %w", name, attempt, err)
+		}
+		wait := b.Delay(attempt)
+		log.Warnf("%s: attempt %d failed: %v, retry in %s", name, attempt, err, wait)
+
+		select {
+		case <-ctx.Done():
+			return attempt, fmt.Errorf("%s: %v, last err: %w", name, ctx.Err(), err)
+		case <-time.After(wait):
+		}
+	}
+}
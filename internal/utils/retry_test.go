@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		b    Backoff
+		n    int
+		want time.Duration
+	}{
+		{Backoff{Initial: time.Second, Max: time.Minute}, 0, time.Second},
+		{Backoff{Initial: time.Second, Max: time.Minute}, 1, time.Second},
+		{Backoff{Initial: time.Second, Max: time.Minute}, 2, 2 * time.Second},
+		{Backoff{Initial: time.Second, Max: time.Minute}, 4, 8 * time.Second},
+		{Backoff{Initial: time.Second, Max: time.Minute}, 7, time.Minute},
+		// 次数很大时不溢出
+		{Backoff{Initial: time.Second, Max: time.Minute}, 1000, time.Minute},
+		// Max 为 0 时不限制
+		{Backoff{Initial: time.Second}, 11, 1024 * time.Second},
+		{Backoff{Initial: 10 * time.Second, Max: 5 * time.Second}, 1, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.b.Delay(tt.n); got != tt.want {
+			t.Errorf("%+v.Delay(%d) = %v, want %v", tt.b, tt.n, got, tt.want)
+		}
+	}
+}
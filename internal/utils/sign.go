@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"Gous/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// signedEnvelope 签名令牌的载荷，Purpose 防止不同用途的令牌互相冒用
+type signedEnvelope struct {
+	Purpose string          `json:"p"`
+	Expire  int64           `json:"e"`
+	Data    json.RawMessage `json:"d"`
+}
+
+// SignToken 使用 secret.signing_key 对数据签名，生成可放在链接中的令牌：base64(载荷).base64(HMAC-SHA256)
+func SignToken(purpose string, data interface{}, ttl time.Duration) (string, error) {
+	key := config.GetGlobalConf().Secret.SigningKey
+	if key == "" {
+		return "", fmt.Errorf("secret.signing_key is not configured")
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(&signedEnvelope{Purpose: purpose, Expire: time.Now().Add(ttl).Unix(), Data: raw})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(hmacSum(key, encoded)), nil
+}
+
+// VerifyToken 校验令牌签名、用途和有效期，并将数据反序列化到 out
+func VerifyToken(purpose, token string, out interface{}) error {
+	key := config.GetGlobalConf().Secret.SigningKey
+	if key == "" {
+		return fmt.Errorf("secret.signing_key is not configured")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, hmacSum(key, parts[0])) {
+		return fmt.Errorf("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed token")
+	}
+	env := &signedEnvelope{}
+	if err := json.Unmarshal(payload, env); err != nil {
+		return fmt.Errorf("malformed token")
+	}
+	if env.Purpose != purpose {
+		return fmt.Errorf("token purpose mismatch")
+	}
+	if time.Now().Unix() > env.Expire {
+		return fmt.Errorf("token expired")
+	}
+	return json.Unmarshal(env.Data, out)
+}
+
+func hmacSum(key, msg string) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
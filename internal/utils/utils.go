@@ -2,8 +2,8 @@ package utils
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/hex"
-	"fmt"
 )
 
 // Contains 检测性别合法性
@@ -28,7 +28,20 @@ func Md5String(s string) string {
 	return str
 }
 
-// GenerateSession 生成一个会话ID
-func GenerateSession(userName string) string {
-	return Md5String(fmt.Sprintf("%s:%s", userName, "session"))
+// RandomToken 生成 n 字节的随机数，返回其 16 进制表示
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Truncate 按字符截断字符串，用于写入有长度限制的字段
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
 }
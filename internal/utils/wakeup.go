@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Waker 后台任务的唤醒信号，有新任务时不必等到下一个扫描周期。
+// 任务处理前的多次唤醒合并为一次
+type Waker chan struct{}
+
+// NewWaker 创建唤醒信号
+func NewWaker() Waker {
+	return make(Waker, 1)
+}
+
+// Wake 唤醒等待中的任务，不阻塞
+func (w Waker) Wake() {
+	select {
+	case w <- struct{}{}:
+	default:
+	}
+}
+
+// Sleep 等待 d 或被唤醒，ctx 结束时返回 false
+func (w Waker) Sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-w:
+		return true
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"bytes"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var waker = utils.NewWaker()
+
+// Wakeup 有新的待投递记录时立即扫描，不必等到下一个扫描周期
+func Wakeup() {
+	waker.Wake()
+}
+
+// Dispatch 后台投递任务，定期扫描到期的投递记录并发送，多个实例可以同时运行。
+// 配置支持热加载，关闭 webhook.enabled 后暂停投递
+func Dispatch(ctx context.Context) {
+	for {
+		conf := config.GetGlobalConf().Webhook
+		if conf.Enabled {
+			dispatchDue(ctx, conf)
+		}
+		interval := time.Duration(conf.PollInterval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second // 未开启时不校验配置
+		}
+		if !waker.Sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// dispatchDue 并发投递一批到期的记录
+func dispatchDue(ctx context.Context, conf config.WebhookConf) {
+	now := time.Now()
+	due, err := dao.DueWebhookDeliveries(now, conf.BatchSize)
+	if err != nil || len(due) == 0 {
+		return
+	}
+	hooks, err := dao.ListWebhooks(false)
+	if err != nil {
+		return
+	}
+	byID := make(map[int]*model.Webhook, len(hooks))
+	for _, w := range hooks {
+		byID[w.ID] = w
+	}
+
+	client := newClient(conf)
+	timeout := time.Duration(conf.Timeout) * time.Second
+	var wg sync.WaitGroup
+	for _, d := range due {
+		w := byID[d.WebhookID]
+		if w == nil {
+			continue
+		}
+		// 订阅被停用时推迟投递，不计入投递次数，重新启用后继续投递
+		if !w.Enabled {
+			if _, err := dao.ClaimWebhookDelivery(d, now.Add(time.Duration(conf.MaxBackoff)*time.Second)); err != nil {
+				return
+			}
+			continue
+		}
+		// 租约覆盖整个投递过程，实例在投递中退出时，其他实例在租约到期后重新投递
+		ok, err := dao.ClaimWebhookDelivery(d, now.Add(timeout+time.Minute))
+		if err != nil {
+			return
+		}
+		if !ok {
+			continue // 已被其他实例领取
+		}
+		wg.Add(1)
+		go func(w *model.Webhook, d *model.WebhookDelivery) {
+			defer wg.Done()
+			deliver(ctx, client, conf, w, d)
+		}(w, d)
+	}
+	wg.Wait()
+}
+
+// deliver 发送一次并记录结果，失败时按指数退避安排重试，次数用尽后进入死信状态
+func deliver(ctx context.Context, client *http.Client, conf config.WebhookConf, w *model.Webhook, d *model.WebhookDelivery) {
+	start := time.Now()
+	code, body, err := send(ctx, client, w, d)
+	attempt := &model.WebhookAttempt{
+		DeliveryID:   d.ID,
+		StatusCode:   code,
+		ResponseBody: strings.ToValidUTF8(body, ""),
+		Duration:     int(time.Since(start).Milliseconds()),
+	}
+	attempts := d.Attempts + 1
+	columns := map[string]interface{}{
+		"attempts":         attempts,
+		"last_status_code": code,
+		"last_error":       "",
+		"last_attempt_at":  start,
+	}
+	if err == nil {
+		columns["status"] = dao.WebhookSuccess
+	} else {
+		attempt.Error = utils.Truncate(err.Error(), 512)
+		columns["last_error"] = attempt.Error
+		if attempts >= conf.MaxAttempts {
+			columns["status"] = dao.WebhookDead
+			log.Warnf("webhook|delivery %d of %s to %s is dead after %d attempts: %v", d.ID, d.EventType, w.Url, attempts, err)
+		} else {
+			columns["next_attempt_at"] = time.Now().Add(backoff(conf).Delay(attempts))
+		}
+	}
+	if err := dao.FinishWebhookAttempt(d.ID, columns, attempt); err != nil {
+		log.Errorf("webhook|delivery %d result not saved: %v", d.ID, err)
+	}
+}
+
+// send 发送请求，2xx 视为成功，不跟随重定向
+func send(ctx context.Context, client *http.Client, w *model.Webhook, d *model.WebhookDelivery) (int, string, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gous-Webhook")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(raw), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(raw), nil
+}
+
+// backoff 投递失败后的重试间隔
+func backoff(conf config.WebhookConf) utils.Backoff {
+	return utils.Backoff{Initial: time.Duration(conf.InitialBackoff) * time.Second, Max: time.Duration(conf.MaxBackoff) * time.Second}
+}
+
+// newClient 创建投递使用的客户端，不允许访问内网时在建立连接前检查解析后的地址，避免 DNS 重绑定绕过
+func newClient(conf config.WebhookConf) *http.Client {
+	dialer := &net.Dialer{Timeout: time.Duration(conf.Timeout) * time.Second}
+	if !conf.AllowPrivateNetwork {
+		dialer.Control = denyPrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // 经过代理时无法检查目标地址
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(conf.Timeout) * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func denyPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"Gous/config"
+	"Gous/internal/dao"
+	"Gous/internal/model"
+	"Gous/internal/utils"
+	"Gous/pkg/constant"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// Events 支持订阅的全部事件
+var Events = []string{constant.EventUserCreated, constant.EventUserUpdated, constant.EventUserDeleted}
+
+// 投递请求的头部
+const (
+	HeaderEvent     = "X-Gous-Event"
+	HeaderDelivery  = "X-Gous-Delivery"
+	HeaderTimestamp = "X-Gous-Timestamp"
+	HeaderSignature = "X-Gous-Signature"
+)
+
+// Envelope 投递的请求体
+type Envelope struct {
+	ID        string      `json:"id"` // 事件 id，重试和重新投递时不变，订阅方可用于去重
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Emit 生成事件并为订阅了该事件的每个启用的订阅写入一条待投递记录，应在业务数据提交成功后调用。
+// 写入失败只记录错误日志，不影响业务操作
+func Emit(eventType string, data interface{}) {
+	if !config.GetGlobalConf().Webhook.Enabled {
+		return
+	}
+	hooks, err := dao.ListWebhooks(true)
+	if err != nil {
+		log.Errorf("webhook|emit %s err:%v", eventType, err)
+		return
+	}
+	var subscribed []*model.Webhook
+	for _, w := range hooks {
+		if Subscribed(w, eventType) {
+			subscribed = append(subscribed, w)
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		log.Errorf("webhook|emit %s err:%v", eventType, err)
+		return
+	}
+	now := time.Now()
+	payload, err := json.Marshal(&Envelope{ID: id, Type: eventType, CreatedAt: now, Data: data})
+	if err != nil {
+		log.Errorf("webhook|marshal %s err:%v", eventType, err)
+		return
+	}
+	list := make([]*model.WebhookDelivery, 0, len(subscribed))
+	for _, w := range subscribed {
+		list = append(list, &model.WebhookDelivery{
+			WebhookID:     w.ID,
+			EventID:       id,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        dao.WebhookPending,
+			NextAttemptAt: now,
+		})
+	}
+	if err := dao.CreateWebhookDeliveries(list); err != nil {
+		log.Errorf("webhook|event %s %s not queued: %v", eventType, id, err)
+		return
+	}
+	Wakeup()
+}
+
+// Subscribed 订阅是否包含该事件
+func Subscribed(w *model.Webhook, eventType string) bool {
+	for _, e := range strings.Fields(w.Events) {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign 计算请求签名：对 "时间戳.请求体" 做 HMAC-SHA256。
+// 订阅方应使用相同方式计算并做常量时间比较，同时拒绝时间戳相差过大的请求以防重放
+func Sign(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
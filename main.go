@@ -2,14 +2,36 @@ package main
 
 import (
 	"Gous/config"
-	"Gous/internal/router"
+	"Gous/internal/command"
+	"Gous/internal/server"
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
 )
 
+var configPath = flag.String("config", "", "配置文件路径，默认查找 ./conf/app.yml，也可通过 GOUS_CONFIG 指定")
+
 func Init() {
-	config.InitConfig() // 初始化配置
+	// 读取、校验配置并初始化日志，配置有误时一次性输出全部问题后退出
+	if err := config.InitConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// 初始化 mysql、redis 等依赖
+	if err := server.InitDependencies(); err != nil {
+		log.Fatalf("init dependencies err:%v", err)
+	}
 }
 
 func main() {
-	Init()                       // 初始化信息
-	router.InitRouterAndServer() // 路由配置、启动服务
+	flag.Parse()
+	config.SetConfigFile(*configPath)
+	// 带子命令时执行子命令，如 gous config validate
+	if flag.NArg() > 0 {
+		os.Exit(command.Run(flag.Args()))
+	}
+
+	Init()       // 初始化信息
+	server.Run() // 路由配置、启动服务，收到退出信号后优雅停机
 }
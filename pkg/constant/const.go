@@ -3,7 +3,95 @@ package constant
 const (
 	ReqUuid          = "uuid" // 请求 uuid 名
 	UserInfoPrefix   = "userinfo_"
+	UserIdentPrefix  = "userident_" // 登录标识到用户名的映射，如 userident_email_xx
 	SessionKeyPrefix = "session_"
+	CsrfKeyPrefix    = "csrf_"
+	VerifyResendKey  = "verify_resend_" // 验证邮件重发冷却
+	VerifyCountKey   = "verify_count_"  // 验证邮件每日发送次数
+	OtpKeyPrefix     = "otp_"           // 登录验证码，如 otp_email_xx
+	OtpCooldownKey   = "otp_cooldown_"  // 验证码重发冷却
+	OidcStateKey     = "oidc_state_"    // 第三方登录跳转状态
+	OAuthCodeKey     = "oauth_code_"    // 授权码，key 中为授权码摘要
+	OAuthRefreshKey  = "oauth_refresh_" // refresh token，key 中为令牌摘要
+	OAuthRevokedKey  = "oauth_revoked_" // 已撤销的 access token，key 中为 jti
+	UserSessionsKey  = "user_sessions_" // 用户的全部会话 ID，停用账号时一起删除
+	OutboxRelayLock  = "outbox_relay"   // outbox 发布任务的锁，同一时间只有一个实例发布，保证事件顺序
+)
+
+// 用户领域事件，事件回调和 outbox 共用
+const (
+	EventUserCreated = "user.created" // 注册、SCIM 创建、第三方登录或 LDAP 首次登录自动创建
+	EventUserUpdated = "user.updated" // 资料修改
+	EventUserDeleted = "user.deleted" // 注销或 SCIM 删除
+)
+
+const (
+	IdentUserName = "username" // 用户名
+	IdentEmail    = "email"    // 已验证的邮箱
+	IdentPhone    = "phone"    // 已验证的手机号，E.164 格式
+)
+
+const (
+	UserStatusActive    = "active"    // 正常
+	UserStatusPending   = "pending"   // 等待邮箱验证
+	UserStatusSuspended = "suspended" // 已停用，不能登录
+)
+
+const (
+	UserSourceLocal = "local" // 本地注册的账号
+	UserSourceLdap  = "ldap"  // 首次通过 LDAP 登录时创建的账号，资料以目录为准
+	UserSourceScim  = "scim"  // 企业身份提供方通过 SCIM 创建的账号
+)
+
+const (
+	RoleUser = "user" // 默认角色
+)
+
+const (
+	AccessTokenPrefix = "gous_pat_"  // 个人访问令牌前缀，便于在日志、代码仓库中识别泄露的令牌
+	AuthUserKey       = "auth_user"  // 通过访问令牌认证时，上下文中保存的用户名
+	ScopeUserRead     = "user:read"  // 读取用户信息
+	ScopeUserWrite    = "user:write" // 修改用户资料
+)
+
+// 审计日志的操作
+const (
+	AuditRegister          = "user.register"
+	AuditLogin             = "user.login"
+	AuditLogout            = "user.logout"
+	AuditLogoff            = "user.logoff"
+	AuditProfileUpdate     = "user.profile_update"
+	AuditIdentityLink      = "user.identity_link"
+	AuditTokenCreate       = "token.create"
+	AuditTokenRevoke       = "token.revoke"
+	AuditConfigReload      = "admin.config_reload"
+	AuditOAuthClientCreate = "admin.oauth_client_create"
+	AuditOAuthClientDelete = "admin.oauth_client_delete"
+	AuditScimUserCreate    = "scim.user_create"
+	AuditScimUserUpdate    = "scim.user_update"
+	AuditScimUserDelete    = "scim.user_delete"
+	AuditScimGroupCreate   = "scim.group_create"
+	AuditScimGroupUpdate   = "scim.group_update"
+	AuditScimGroupDelete   = "scim.group_delete"
+	AuditWebhookCreate     = "admin.webhook_create"
+	AuditWebhookUpdate     = "admin.webhook_update"
+	AuditWebhookDelete     = "admin.webhook_delete"
+	AuditWebhookRedeliver  = "admin.webhook_redeliver"
+	AuditOutboxRetry       = "admin.outbox_retry"
+	AuditDataExport        = "user.data_export"
+	AuditExportDownload    = "user.data_export_download"
+	AuditUserErase         = "admin.user_erase"
+	AuditErasureRetry      = "admin.erasure_retry"
+	AuditUserImport        = "admin.user_import"
+	AuditUsersExport       = "admin.users_export"
+)
+
+const (
+	AuditSuccess    = "success"
+	AuditFailure    = "failure"
+	AuditActorAdmin = "admin" // 管理端口的操作，管理端口不做用户认证
+	AuditActorCli   = "cli"   // 命令行子命令的操作，如批量导入用户
+	RequestIDHeader = "X-Request-ID"
 )
 
 const (